@@ -0,0 +1,56 @@
+// Command embed shows a service monitoring its own GPUs in-process with
+// pkg/collector and pkg/export: it exports nvidia-smi readings over OTLP
+// while it runs, and prints a utilization summary when interrupted.
+//
+//	go run ./examples/embed -endpoint http://localhost:4318
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/pkg/collector"
+	"github.com/nathanleclaire/gpumon/pkg/export"
+)
+
+func main() {
+	endpoint := flag.String("endpoint", "http://localhost:4318", "OTLP/HTTP endpoint")
+	interval := flag.Duration("interval", export.DefaultInterval, "Export interval")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	mp, err := export.NewOTLPMeterProvider(ctx, export.OTLPConfig{
+		Endpoint:    *endpoint,
+		ServiceName: "embed-example",
+		Interval:    *interval,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer mp.Shutdown(context.Background())
+
+	gpus := &collector.NvidiaSMI{}
+	reg, err := export.RegisterGPUMetrics(mp.Meter("gpu-metrics"), gpus)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer reg.Unregister()
+
+	// The service's own work would run here; the sampler summarises GPU
+	// load over it.
+	s := collector.StartSampler(ctx, gpus, 2*time.Second)
+	<-ctx.Done()
+	stats, err := s.Stop()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%d samples: %.0f%% avg utilization, %.0f W peak, %d MiB peak memory\n",
+		stats.Samples, stats.AvgUtilPercent, stats.PeakPowerWatts, stats.PeakMemoryBytes>>20)
+}
@@ -0,0 +1,114 @@
+// Command plugin is a minimal gpumon plugin, serving a collector and a
+// backend. The collector reports the host's CPUs as one device, busy by the
+// load average and using the memory in use, so the plumbing can be tried on
+// a machine without accelerators (Linux only). The backend streams the
+// prompt back word by word.
+//
+// Install it under the name echo and try it:
+//
+//	go build -o ~/.config/gpumon/plugins/gpumon-plugin-echo ./examples/plugin
+//	gpumon plugins list
+//	gpumon --collector echo --otel-trace-exporter stdout monitor poll
+//	gpumon eval generate --plugin-model any=echo
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/pkg/collector"
+	"github.com/nathanleclaire/gpumon/pkg/plugin"
+)
+
+func main() {
+	// stdout carries the protocol; log to stderr, which gpumon logs.
+	log.SetOutput(os.Stderr)
+	err := plugin.Serve(&plugin.Plugin{
+		Name:      "echo",
+		Version:   "0.1.0",
+		Collector: cpus{},
+		Backend:   echo{},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type cpus struct{}
+
+func (cpus) Collect(ctx context.Context) ([]collector.Data, error) {
+	b, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return nil, err
+	}
+	load, err := strconv.ParseFloat(strings.Fields(string(b))[0], 64)
+	if err != nil {
+		return nil, err
+	}
+	util := min(int64(100*load/float64(runtime.NumCPU())), 100)
+	total, avail, err := meminfo()
+	if err != nil {
+		return nil, err
+	}
+	return []collector.Data{{
+		ID:               "cpu0",
+		Name:             fmt.Sprintf("%d CPUs", runtime.NumCPU()),
+		GPUUtilPercent:   util,
+		MemoryUsedBytes:  total - avail,
+		MemoryTotalBytes: total,
+	}}, nil
+}
+
+// meminfo returns MemTotal and MemAvailable from /proc/meminfo, in bytes.
+func meminfo() (total, avail int64, err error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, _ := strconv.ParseInt(fields[1], 10, 64)
+		switch fields[0] {
+		case "MemTotal:":
+			total = kb << 10
+		case "MemAvailable:":
+			avail = kb << 10
+		}
+	}
+	return total, avail, sc.Err()
+}
+
+type echo struct{}
+
+func (echo) Complete(ctx context.Context, req plugin.CompleteRequest, onChunk func(string)) (plugin.CompleteResult, error) {
+	start := time.Now()
+	words := strings.Fields(req.Prompt)
+	for i, w := range words {
+		if err := ctx.Err(); err != nil {
+			return plugin.CompleteResult{}, err
+		}
+		if i > 0 {
+			w = " " + w
+		}
+		onChunk(w)
+	}
+	d := time.Since(start)
+	return plugin.CompleteResult{Metrics: plugin.Metrics{
+		PromptEvalCount: len(words),
+		EvalCount:       len(words),
+		EvalDuration:    d,
+		TotalDuration:   d,
+	}}, nil
+}
@@ -0,0 +1,250 @@
+// Package config loads gpumon's layered configuration into viper. Settings
+// come from, lowest precedence first:
+//
+//  1. the user file, $XDG_CONFIG_HOME/gpumon/config.yaml or
+//     ~/.config/gpumon/config.yaml
+//  2. the project file, the nearest .gpumon.yaml in the working directory
+//     or one of its parents
+//  3. the file named by --config or GPUMON_CONFIG
+//  4. GPUMON_* environment variables
+//  5. flags on the command line
+//
+// Any flag can be set from a file or the environment. For `gpumon synth
+// generate --max-examples`, the keys tried are synth.generate.max-examples,
+// then synth.max-examples, then max-examples (or max.examples), so a
+// top-level key applies to every command with that flag and a command's
+// section overrides it:
+//
+//	log:
+//	  level: info
+//	ollama-addr: http://gpu-box:11434
+//	synth:
+//	  generate:
+//	    model: llama3
+//	    parallel: 4
+//
+// The environment variable for a key is GPUMON_ and the key upper-cased with
+// dots and dashes as underscores, e.g. GPUMON_SYNTH_GENERATE_PARALLEL.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	// EnvPrefix starts every environment variable read for a key.
+	EnvPrefix = "GPUMON"
+	// ProjectFileName is the project-local config file.
+	ProjectFileName = ".gpumon.yaml"
+)
+
+var envReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// File is one place configuration is looked for.
+type File struct {
+	Layer  string
+	Path   string
+	Loaded bool
+}
+
+// UserFile is the per-user config file, whether or not it exists.
+func UserFile() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "gpumon", "config.yaml"), nil
+}
+
+// ProjectFile is the nearest .gpumon.yaml in dir or its parents, or "".
+func ProjectFile(dir string) string {
+	for {
+		p := filepath.Join(dir, ProjectFileName)
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+			return p
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Files lists where configuration is looked for, lowest precedence first,
+// with explicit (from --config or GPUMON_CONFIG) last if set.
+func Files(explicit string) []File {
+	var files []File
+	if p, err := UserFile(); err == nil {
+		files = append(files, File{Layer: "user", Path: p})
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if p := ProjectFile(wd); p != "" {
+			files = append(files, File{Layer: "project", Path: p})
+		}
+	}
+	if explicit == "" {
+		explicit = os.Getenv(EnvPrefix + "_CONFIG")
+	}
+	if explicit != "" {
+		files = append(files, File{Layer: "explicit", Path: explicit})
+	}
+	return files
+}
+
+// Load merges the config files into viper, later files overriding earlier
+// ones, and turns on GPUMON_* environment variables. Missing user and
+// project files are skipped; a missing explicit file is an error.
+func Load(explicit string) ([]File, error) {
+	viper.SetEnvPrefix(EnvPrefix)
+	viper.SetEnvKeyReplacer(envReplacer)
+	viper.AutomaticEnv()
+	viper.SetConfigType("yaml")
+
+	files := Files(explicit)
+	for i, f := range files {
+		b, err := os.ReadFile(f.Path)
+		if errors.Is(err, fs.ErrNotExist) && f.Layer != "explicit" {
+			continue
+		}
+		if errors.Is(err, fs.ErrNotExist) && looksLikeSubset(f.Path) {
+			return files, fmt.Errorf("config file %q not found; to pick a Hugging Face dataset config, use --hf-config (formerly synth's --config)", f.Path)
+		}
+		if err != nil {
+			return files, fmt.Errorf("failed to read config: %w", err)
+		}
+		if err := viper.MergeConfig(strings.NewReader(string(b))); err != nil {
+			return files, fmt.Errorf("failed to parse config %s: %w", f.Path, err)
+		}
+		files[i].Loaded = true
+	}
+	return files, nil
+}
+
+// looksLikeSubset reports whether a missing config path is more likely a
+// dataset config name, like "default" or "wikitext-2-raw-v1", than a file:
+// a bare name with no directory or YAML extension.
+func looksLikeSubset(path string) bool {
+	if strings.ContainsAny(path, `/\`) {
+		return false
+	}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml", ".json", ".toml":
+		return false
+	}
+	return true
+}
+
+// FromConfig annotates flags that ApplyFlags set from a file or the
+// environment.
+const FromConfig = "gpumon_config_key"
+
+// ApplyFlags sets each of cmd's flags not given on the command line from
+// the most specific config key or environment variable that has it. Call
+// it after Load, before the command reads its flags.
+//
+// Values taken this way stand in for the flag's default: Changed stays
+// false, so experiment files and other per-run settings that only apply to
+// unset flags still win over the config, and viper keys bound to a flag
+// still prefer their own environment variables (OLLAMA_HOST and the like).
+// Use IsSet to ask whether a flag was given anywhere. Required flags are
+// the exception and are marked Changed, since the config satisfies them.
+func ApplyFlags(cmd *cobra.Command) error {
+	path := strings.Fields(cmd.CommandPath())[1:]
+	fs := cmd.Flags()
+	var err error
+	fs.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || f.Name == "help" || f.Name == "version" || f.Name == "config" {
+			return
+		}
+		key, ok := lookup(path, f.Name)
+		if !ok {
+			return
+		}
+		setf := f.Value.Set
+		if _, required := f.Annotations[cobra.BashCompOneRequiredFlag]; required {
+			setf = func(s string) error { return fs.Set(f.Name, s) }
+		}
+		if serr := set(setf, f.Name, viper.Get(key)); serr != nil {
+			err = fmt.Errorf("config %s: %w", key, serr)
+			return
+		}
+		_ = fs.SetAnnotation(f.Name, FromConfig, []string{key})
+	})
+	return err
+}
+
+// IsSet reports whether flag name was given on the command line or set by
+// ApplyFlags from a file or the environment.
+func IsSet(fs *pflag.FlagSet, name string) bool {
+	f := fs.Lookup(name)
+	if f == nil {
+		return false
+	}
+	_, ok := f.Annotations[FromConfig]
+	return f.Changed || ok
+}
+
+// Keys lists the keys tried for flag name on the command at path, most
+// specific first.
+func Keys(path []string, name string) []string {
+	var keys []string
+	for i := len(path); i > 0; i-- {
+		keys = append(keys, strings.Join(path[:i], ".")+"."+name)
+	}
+	keys = append(keys, name)
+	if dotted := strings.ReplaceAll(name, "-", "."); dotted != name {
+		keys = append(keys, dotted)
+	}
+	return keys
+}
+
+// lookup returns the first of Keys(path, name) set in a file or the
+// environment. Flag bindings and defaults in viper don't count, so a flag
+// is never set from its own default.
+func lookup(path []string, name string) (string, bool) {
+	keys := Keys(path, name)
+	for _, k := range keys {
+		if _, ok := os.LookupEnv(EnvPrefix + "_" + strings.ToUpper(envReplacer.Replace(k))); ok {
+			return k, true
+		}
+	}
+	for _, k := range keys {
+		if viper.InConfig(k) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// set passes val to setf, once per element for lists.
+func set(setf func(string) error, name string, val interface{}) error {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		for _, e := range v {
+			if err := setf(fmt.Sprint(e)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		return fmt.Errorf("is a section, not a value for --%s", name)
+	default:
+		return setf(fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// generateCmd is `gpumon synth generate` with a few of its flags.
+func generateCmd() *cobra.Command {
+	root := &cobra.Command{Use: "gpumon"}
+	synth := &cobra.Command{Use: "synth"}
+	gen := &cobra.Command{Use: "generate", RunE: func(*cobra.Command, []string) error { return nil }}
+	for _, name := range []string{"model", "column", "split", "tokenizer", "out-file"} {
+		gen.Flags().String(name, "default", "")
+	}
+	gen.Flags().Int("parallel", 1, "")
+	gen.Flags().Int("max-examples", 1000, "")
+	root.AddCommand(synth)
+	synth.AddCommand(gen)
+	return gen
+}
+
+func TestPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "xdg"))
+	writeFile(t, filepath.Join(dir, "xdg", "gpumon", "config.yaml"), `
+model: user
+parallel: 2
+max-examples: 10
+column: user
+split: user
+tokenizer: user
+`)
+	project := filepath.Join(dir, "project", "sub")
+	writeFile(t, filepath.Join(dir, "project", ProjectFileName), `
+parallel: 3
+max-examples: 20
+column: project
+split: project
+synth:
+  generate:
+    tokenizer: project
+`)
+	explicit := filepath.Join(dir, "extra.yaml")
+	writeFile(t, explicit, `
+max-examples: 30
+column: explicit
+split: explicit
+`)
+	if err := os.MkdirAll(project, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(project)
+
+	// Each layer sets a flag the next ones leave alone: model is only in
+	// the user file, parallel last set by the project file, max-examples
+	// by --config, column by the environment and split on the command line.
+	// tokenizer shows a command's section winning over a top-level key in
+	// a later file, and out-file is set nowhere.
+	want := map[string]string{
+		"model":        "user",
+		"parallel":     "3",
+		"max-examples": "30",
+		"column":       "env",
+		"split":        "flag",
+		"tokenizer":    "project",
+		"out-file":     "default",
+	}
+	for _, via := range []string{"flag", "env"} {
+		t.Run("config "+via, func(t *testing.T) {
+			viper.Reset()
+			t.Cleanup(viper.Reset)
+			t.Setenv("GPUMON_COLUMN", "env")
+			arg := explicit
+			if via == "env" {
+				t.Setenv("GPUMON_CONFIG", explicit)
+				arg = ""
+			} else {
+				t.Setenv("GPUMON_CONFIG", "")
+			}
+
+			files, err := Load(arg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var layers []string
+			for _, f := range files {
+				if !f.Loaded {
+					t.Errorf("%s file %s not loaded", f.Layer, f.Path)
+				}
+				layers = append(layers, f.Layer)
+			}
+			if got := strings.Join(layers, " "); got != "user project explicit" {
+				t.Errorf("layers = %s, want user project explicit", got)
+			}
+
+			cmd := generateCmd()
+			if err := cmd.ParseFlags([]string{"--split", "flag"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := ApplyFlags(cmd); err != nil {
+				t.Fatal(err)
+			}
+			fs := cmd.Flags()
+			for name, v := range want {
+				if got := fs.Lookup(name).Value.String(); got != v {
+					t.Errorf("--%s = %q, want %q", name, got, v)
+				}
+				if got, wantSet := IsSet(fs, name), v != "default"; got != wantSet {
+					t.Errorf("IsSet(%q) = %v, want %v", name, got, wantSet)
+				}
+				if got, wantChanged := fs.Lookup(name).Changed, name == "split"; got != wantChanged {
+					t.Errorf("--%s Changed = %v, want %v", name, got, wantChanged)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadMissingExplicit(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("GPUMON_CONFIG", "")
+	t.Chdir(dir)
+
+	if _, err := Load(""); err != nil {
+		t.Errorf("Load without files: %v", err)
+	}
+	if _, err := Load(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("Load with a missing --config file succeeded")
+	}
+}
@@ -0,0 +1,62 @@
+// Package docs writes gpumon's man pages from its command tree, as the
+// gpumon docs command.
+package docs
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/internal/version"
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+// NewCommand returns the docs command tree, logging to logger.
+func NewCommand(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "docs",
+		Short: "Generate documentation for every gpumon command",
+	}
+	var dir string
+	man := &cobra.Command{
+		Use:   "man",
+		Short: "Write a man page for every command, e.g. gpumon-eval-generate.1",
+		Long: `Write a section 1 man page for gpumon and each of its commands into --dir,
+named after the command path, e.g. gpumon-synth-generate.1. Install them
+where man looks, or point MANPATH at them:
+
+  gpumon docs man --dir /usr/local/share/man/man1
+  man gpumon-eval-generate
+
+The pages are dated with the build date, so a release always generates the
+same pages.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return fmt.Errorf("failed to create man page directory: %w", err)
+			}
+			info := version.Get()
+			header := &doc.GenManHeader{
+				Section: "1",
+				Source:  "gpumon " + info.Version,
+				Manual:  "gpumon manual",
+			}
+			if t, err := time.Parse(time.RFC3339, info.Date); err == nil {
+				header.Date = &t
+			}
+			root := cmd.Root()
+			root.DisableAutoGenTag = true
+			if err := doc.GenManTree(root, header, dir); err != nil {
+				return fmt.Errorf("failed to write man pages: %w", err)
+			}
+			logger.Info("Wrote man pages", "dir", dir)
+			return nil
+		},
+	}
+	man.Flags().StringVar(&dir, "dir", "man", "Directory to write the man pages to")
+	_ = man.MarkFlagDirname("dir")
+	cmd.AddCommand(man)
+	return cmd
+}
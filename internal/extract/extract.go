@@ -0,0 +1,325 @@
+// Package extract pulls answers out of free-form model output: the body of
+// a <json> or <persona> tag, a fenced code block, or the first
+// brace-balanced JSON object. Models wrap their answers inconsistently, so
+// each function accepts the variants seen in practice:
+//
+//   - tags in any case, with stray whitespace or attributes, e.g. <JSON>,
+//     < json > or <json type="object">
+//   - fences of three or more backticks or tildes, with or without an info
+//     string, opening on their own line or inline as in ```json {...}```
+//   - fences nested inside fences, e.g. a ```json block inside a
+//     ```markdown block, both of which are returned by Fences
+//   - output cut off by the token limit, where the closing tag or fence is
+//     missing; the rest of the text is returned and marked Truncated so the
+//     caller can repair or reject it
+//
+// Nothing here panics, and every body returned is a substring of the input
+// with surrounding whitespace trimmed.
+package extract
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Block is one tagged or fenced span of model output.
+type Block struct {
+	// Lang is a fence's info string, lowercased, e.g. "json"; "" for tags
+	// and bare fences.
+	Lang string
+	// Body is the trimmed text inside the tag or fence.
+	Body string
+	// Truncated is set when the output ended before the closing tag or
+	// fence.
+	Truncated bool
+
+	end int // index just past the closing fence, for Unfence
+}
+
+// -----------------------------------------------------------------------------
+// Tags
+// -----------------------------------------------------------------------------
+
+// Tag returns the first <name>...</name> element in s. It reports false
+// when there is no opening tag.
+func Tag(s, name string) (Block, bool) {
+	open, close := tagRes(name)
+	loc := open.FindStringIndex(s)
+	if loc == nil {
+		return Block{}, false
+	}
+	rest := s[loc[1]:]
+	if end := close.FindStringIndex(rest); end != nil {
+		return Block{Body: strings.TrimSpace(rest[:end[0]])}, true
+	}
+	return Block{Body: strings.TrimSpace(rest), Truncated: true}, true
+}
+
+// Tags returns every <name>...</name> element in s, in order. Only the last
+// can be truncated.
+func Tags(s, name string) []Block {
+	open, close := tagRes(name)
+	var blocks []Block
+	for {
+		loc := open.FindStringIndex(s)
+		if loc == nil {
+			return blocks
+		}
+		s = s[loc[1]:]
+		end := close.FindStringIndex(s)
+		if end == nil {
+			return append(blocks, Block{Body: strings.TrimSpace(s), Truncated: true})
+		}
+		blocks = append(blocks, Block{Body: strings.TrimSpace(s[:end[0]])})
+		s = s[end[1]:]
+	}
+}
+
+// TagBody returns the body of the first complete <name>...</name> element
+// in s, or "" if there is none or it was cut off.
+func TagBody(s, name string) string {
+	b, ok := Tag(s, name)
+	if !ok || b.Truncated {
+		return ""
+	}
+	return b.Body
+}
+
+// tagCache holds each tag name's compiled regexps, as a [2]*regexp.Regexp.
+var tagCache sync.Map
+
+func tagRes(name string) (open, close *regexp.Regexp) {
+	if res, ok := tagCache.Load(name); ok {
+		r := res.([2]*regexp.Regexp)
+		return r[0], r[1]
+	}
+	n := regexp.QuoteMeta(name)
+	r := [2]*regexp.Regexp{
+		regexp.MustCompile(`(?i)<\s*` + n + `(?:\s[^<>]*)?>`),
+		regexp.MustCompile(`(?i)<\s*/\s*` + n + `\s*>`),
+	}
+	tagCache.Store(name, r)
+	return r[0], r[1]
+}
+
+// -----------------------------------------------------------------------------
+// Reasoning
+// -----------------------------------------------------------------------------
+
+// Think returns the reasoning in s's <think> block, if it has one.
+func Think(s string) string {
+	b, _ := Tag(s, "think")
+	return b.Body
+}
+
+// Answer returns s without its reasoning: the text after </think>, or all
+// of s when there is no <think> block. When the output ended inside the
+// reasoning there is no answer, and Answer returns "".
+func Answer(s string) string {
+	open, close := tagRes("think")
+	loc := open.FindStringIndex(s)
+	if loc == nil {
+		return s
+	}
+	end := close.FindStringIndex(s[loc[1]:])
+	if end == nil {
+		return ""
+	}
+	return s[loc[1]+end[1]:]
+}
+
+// -----------------------------------------------------------------------------
+// Fences
+// -----------------------------------------------------------------------------
+
+// fence is a run of three or more backticks or tildes found by scanFence.
+type fence struct {
+	char      byte
+	n         int
+	start     int // index of the first fence character
+	end       int // index just past the run
+	lineStart bool
+}
+
+// Fences returns every fenced code block in s in the order they open, so an
+// outer block comes before the blocks nested in it. A fence on its own line
+// followed by an info string opens a nested block; a bare fence at least as
+// long as the innermost open one closes it. Blocks still open at the end of
+// s are returned as Truncated.
+func Fences(s string) []Block {
+	type open struct {
+		idx    int // into blocks
+		f      fence
+		body   int
+		inline bool
+	}
+	var blocks []Block
+	var stack []open
+	for i := 0; i < len(s); {
+		f, ok := scanFence(s, i)
+		if !ok {
+			i++
+			continue
+		}
+		lang, after, eol := infoString(s, f.end)
+		if n := len(stack); n > 0 {
+			top := stack[n-1]
+			if f.char == top.f.char && f.n >= top.f.n && (lang == "" && eol || top.inline) {
+				blocks[top.idx].Body = strings.TrimSpace(s[top.body:f.start])
+				blocks[top.idx].Truncated = false
+				blocks[top.idx].end = f.end
+				stack = stack[:n-1]
+				i = f.end
+				continue
+			}
+			if !f.lineStart || lang == "" || !eol {
+				i = f.end
+				continue
+			}
+		}
+		body := after
+		if eol {
+			body = skipLine(s, after)
+		}
+		stack = append(stack, open{idx: len(blocks), f: f, body: body, inline: !f.lineStart || !eol})
+		blocks = append(blocks, Block{Lang: lang, Truncated: true, end: len(s)})
+		i = body
+	}
+	for _, o := range stack {
+		blocks[o.idx].Body = strings.TrimSpace(s[o.body:])
+	}
+	return blocks
+}
+
+// Fence returns the first fenced block in s whose info string is one of
+// langs, or the first block of any kind when langs is empty. Pass "" among
+// langs to accept bare fences.
+func Fence(s string, langs ...string) (Block, bool) {
+	for _, b := range Fences(s) {
+		if len(langs) == 0 {
+			return b, true
+		}
+		for _, l := range langs {
+			if b.Lang == strings.ToLower(l) {
+				return b, true
+			}
+		}
+	}
+	return Block{}, false
+}
+
+// Unfence returns s without the code fence wrapped around it, if it is
+// wholly one fenced block (possibly cut off before the closing fence), and
+// otherwise s, trimmed either way.
+func Unfence(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return s
+	}
+	if _, ok := scanFence(s, 0); !ok {
+		return s
+	}
+	blocks := Fences(s)
+	if len(blocks) == 0 {
+		return s
+	}
+	if b := blocks[0]; strings.TrimSpace(s[b.end:]) == "" {
+		return b.Body
+	}
+	return s
+}
+
+// scanFence reports the fence starting at s[i], if there is one. A fence
+// can't start right after a fence character, so runs aren't split.
+func scanFence(s string, i int) (fence, bool) {
+	c := s[i]
+	if c != '`' && c != '~' {
+		return fence{}, false
+	}
+	if i > 0 && s[i-1] == c {
+		return fence{}, false
+	}
+	j := i
+	for j < len(s) && s[j] == c {
+		j++
+	}
+	if j-i < 3 {
+		return fence{}, false
+	}
+	ls := i
+	for ls > 0 && (s[ls-1] == ' ' || s[ls-1] == '\t') {
+		ls--
+	}
+	return fence{char: c, n: j - i, start: i, end: j, lineStart: ls == 0 || s[ls-1] == '\n'}, true
+}
+
+// infoString reads the word right after a fence, e.g. json, returning it
+// lowercased, the index after it and any spaces, and whether only
+// whitespace follows on its line.
+func infoString(s string, i int) (lang string, after int, eol bool) {
+	j := i
+	for j < len(s) && isInfoChar(s[j]) {
+		j++
+	}
+	lang = strings.ToLower(s[i:j])
+	for j < len(s) && (s[j] == ' ' || s[j] == '\t' || s[j] == '\r') {
+		j++
+	}
+	return lang, j, j == len(s) || s[j] == '\n'
+}
+
+func isInfoChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '-' || c == '+' || c == '.' || c == '#'
+}
+
+// skipLine returns the index after the newline at or following i.
+func skipLine(s string, i int) int {
+	if j := strings.IndexByte(s[i:], '\n'); j != -1 {
+		return i + j + 1
+	}
+	return len(s)
+}
+
+// -----------------------------------------------------------------------------
+// Objects
+// -----------------------------------------------------------------------------
+
+// Object returns the first brace-balanced JSON object in s, ignoring braces
+// inside strings. A truncated object is returned as-is, with Truncated set,
+// so a repair stage can close it.
+func Object(s string) (Block, bool) {
+	start := strings.IndexByte(s, '{')
+	if start == -1 {
+		return Block{}, false
+	}
+	depth := 0
+	inStr, esc := false, false
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		if inStr {
+			switch {
+			case esc:
+				esc = false
+			case c == '\\':
+				esc = true
+			case c == '"':
+				inStr = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inStr = true
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return Block{Body: s[start : i+1]}, true
+			}
+		}
+	}
+	return Block{Body: strings.TrimSpace(s[start:]), Truncated: true}, true
+}
@@ -0,0 +1,107 @@
+package extract
+
+import (
+	"strings"
+	"testing"
+)
+
+// seeds are the shapes of model output the package handles, as fuzzing
+// starting points.
+var seeds = []string{
+	"",
+	"plain answer",
+	`<json>{"a": 1}</json>`,
+	`<JSON type="object">{"a": 1}</ json >`,
+	`<json>{"a": 1}</json> and <json>{"b": 2`,
+	"<think>hmm</think>\nthe answer",
+	"<think>still thinking",
+	"```json\n{\"a\": 1}\n```",
+	"```json {\"a\": 1}```",
+	"~~~~markdown\n```json\n{\"a\": 1}\n```\n~~~~",
+	"````\n```python\nprint(1)\n",
+	"text ``` not a fence",
+	`prefix {"a": "}", "b": {"c": [1, 2]}} suffix`,
+	`{"a": "unterminated \"`,
+	"\n\t<persona>\n  name: x\n",
+}
+
+func addSeeds(f *testing.F) {
+	for _, s := range seeds {
+		f.Add(s)
+	}
+}
+
+func checkBody(t *testing.T, fn, s string, b Block) {
+	t.Helper()
+	if !strings.Contains(s, b.Body) {
+		t.Fatalf("%s(%q): body %q is not in the input", fn, s, b.Body)
+	}
+}
+
+func FuzzTags(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, s string) {
+		for _, name := range []string{"json", "think", "persona"} {
+			if b, ok := Tag(s, name); ok {
+				checkBody(t, "Tag", s, b)
+			}
+			blocks := Tags(s, name)
+			for i, b := range blocks {
+				checkBody(t, "Tags", s, b)
+				if b.Truncated && i != len(blocks)-1 {
+					t.Fatalf("Tags(%q, %q): block %d of %d is truncated", s, name, i, len(blocks))
+				}
+			}
+			if body := TagBody(s, name); !strings.Contains(s, body) {
+				t.Fatalf("TagBody(%q, %q) = %q, not in the input", s, name, body)
+			}
+		}
+	})
+}
+
+func FuzzFences(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, s string) {
+		for _, b := range Fences(s) {
+			checkBody(t, "Fences", s, b)
+		}
+		if b, ok := Fence(s, "json", ""); ok {
+			checkBody(t, "Fence", s, b)
+		}
+	})
+}
+
+func FuzzUnfence(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, s string) {
+		if got := Unfence(s); !strings.Contains(s, got) {
+			t.Fatalf("Unfence(%q) = %q, not in the input", s, got)
+		}
+	})
+}
+
+func FuzzAnswer(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, s string) {
+		if got := Answer(s); !strings.Contains(s, got) {
+			t.Fatalf("Answer(%q) = %q, not in the input", s, got)
+		}
+		if got := Think(s); !strings.Contains(s, got) {
+			t.Fatalf("Think(%q) = %q, not in the input", s, got)
+		}
+	})
+}
+
+func FuzzObject(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, s string) {
+		b, ok := Object(s)
+		if !ok {
+			return
+		}
+		checkBody(t, "Object", s, b)
+		if !strings.HasPrefix(b.Body, "{") {
+			t.Fatalf("Object(%q) = %q, which doesn't start with {", s, b.Body)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+// Package llm streams completions from local and hosted models. Backends
+// share one interface, so the eval and synth commands get new backends,
+// retry rules and extraction fixes in one place.
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Backend names, as recorded with results and accepted by --backend style
+// flags.
+const (
+	NameOllama = "ollama"
+	NameOpenAI = "openai"
+)
+
+type (
+	// Message is one chat turn.
+	Message = api.Message
+	// Metrics are the token counts and timings of a completion. Backends
+	// that report less than Ollama leave the rest zero.
+	Metrics = api.Metrics
+)
+
+// Request is one completion request.
+type Request struct {
+	Model  string
+	Prompt string
+	System string
+	// Chat sends System, History and Prompt as a chat transcript rather
+	// than a single prompt. The OpenAI-compatible backend always chats.
+	Chat    bool
+	History []Message
+	// Context continues an earlier Ollama /api/generate exchange.
+	Context []int
+	// Format is "json" or a JSON Schema to constrain the output to.
+	Format json.RawMessage
+	// Grammar is a GBNF grammar, understood by llama.cpp servers only.
+	Grammar string
+	Options map[string]interface{}
+}
+
+// Messages assembles the chat transcript: optional system prompt, any prior
+// history, then the prompt as the final user turn.
+func (r Request) Messages() []Message {
+	var msgs []Message
+	if r.System != "" {
+		msgs = append(msgs, Message{Role: "system", Content: r.System})
+	}
+	msgs = append(msgs, r.History...)
+	return append(msgs, Message{Role: "user", Content: r.Prompt})
+}
+
+// Backend streams one completion, calling onChunk with each piece of text
+// as it arrives. The returned context is only set by backends that keep
+// one, for Request.Context.
+type Backend interface {
+	Name() string
+	Complete(ctx context.Context, req Request, onChunk func(string)) (Metrics, []int, error)
+}
+
+// Collect runs req on b and returns the whole response.
+func Collect(ctx context.Context, b Backend, req Request) (string, Metrics, error) {
+	var out strings.Builder
+	m, _, err := b.Complete(ctx, req, func(chunk string) {
+		out.WriteString(chunk)
+	})
+	if err != nil {
+		return "", m, err
+	}
+	return out.String(), m, nil
+}
+
+// TokensPerSecond is how fast the model produced its output, or 0 if the
+// backend didn't say.
+func TokensPerSecond(m Metrics) float64 {
+	if m.EvalDuration <= 0 {
+		return 0
+	}
+	return float64(m.EvalCount) / m.EvalDuration.Seconds()
+}
+
+// WithTimeout bounds ctx by d, or only makes it cancellable when d is not
+// positive.
+func WithTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
@@ -0,0 +1,105 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// DefaultOllamaAddr is used when no address is given.
+const DefaultOllamaAddr = "http://localhost:11434"
+
+// NormalizeOllamaAddr accepts the same forms as OLLAMA_HOST: a full URL, or
+// a bare host with an optional port, e.g. "0.0.0.0" or "gpu-box:11434".
+func NormalizeOllamaAddr(addr string) (*url.URL, error) {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		addr = DefaultOllamaAddr
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("ollama address %q: %w", addr, err)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "11434")
+	}
+	return u, nil
+}
+
+// Ollama is the backend for an Ollama server.
+type Ollama struct {
+	client *api.Client
+}
+
+// NewOllama returns a traced backend for addr ("" means localhost).
+func NewOllama(addr string) (*Ollama, error) {
+	u, err := NormalizeOllamaAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+	return &Ollama{client: api.NewClient(u, httpClient)}, nil
+}
+
+// Client is the underlying Ollama client, for listing, pulling and
+// embedding.
+func (o *Ollama) Client() *api.Client { return o.client }
+
+func (o *Ollama) Name() string { return NameOllama }
+
+// Complete uses /api/chat for chat requests and /api/generate otherwise,
+// which returns a context to continue from.
+func (o *Ollama) Complete(ctx context.Context, req Request, onChunk func(string)) (Metrics, []int, error) {
+	if req.Grammar != "" {
+		return Metrics{}, nil, errors.New("ollama does not support grammar-constrained decoding")
+	}
+	var metrics Metrics
+	if req.Chat {
+		err := o.client.Chat(ctx, &api.ChatRequest{
+			Model:    req.Model,
+			Messages: req.Messages(),
+			Format:   req.Format,
+			Options:  req.Options,
+		}, func(r api.ChatResponse) error {
+			if r.Message.Content != "" {
+				onChunk(r.Message.Content)
+			}
+			if r.Done {
+				metrics = r.Metrics
+			}
+			return nil
+		})
+		return metrics, nil, err
+	}
+
+	var genContext []int
+	err := o.client.Generate(ctx, &api.GenerateRequest{
+		Model:   req.Model,
+		Prompt:  req.Prompt,
+		System:  req.System,
+		Context: req.Context,
+		Format:  req.Format,
+		Options: req.Options,
+	}, func(r api.GenerateResponse) error {
+		if r.Response != "" {
+			onChunk(r.Response)
+		}
+		// The last response carries the token counts and timings.
+		if r.Done {
+			metrics = r.Metrics
+			genContext = r.Context
+		}
+		return nil
+	})
+	return metrics, genContext, err
+}
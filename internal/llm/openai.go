@@ -0,0 +1,192 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// DefaultOpenAIAddr is used when no base URL is given.
+const DefaultOpenAIAddr = "https://api.openai.com/v1"
+
+// OpenAI is the backend for an OpenAI-compatible /chat/completions
+// endpoint, e.g. OpenAI itself, vLLM or a llama.cpp server. Every request is
+// sent as a chat regardless of Request.Chat, and the Ollama options it
+// understands are mapped to their OpenAI names.
+type OpenAI struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+// NewOpenAI returns a traced backend for baseURL ("" means OpenAI's API),
+// authenticating with apiKey if set.
+func NewOpenAI(baseURL, apiKey string) *OpenAI {
+	if baseURL == "" {
+		baseURL = DefaultOpenAIAddr
+	}
+	return &OpenAI{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		http:    &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)},
+	}
+}
+
+func (b *OpenAI) Name() string { return NameOpenAI }
+
+// openAIOptions maps Ollama option names to chat completion fields.
+var openAIOptions = map[string]string{
+	"temperature": "temperature",
+	"top_p":       "top_p",
+	"seed":        "seed",
+	"stop":        "stop",
+	"num_predict": "max_tokens",
+}
+
+type openAIChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func (b *OpenAI) Complete(ctx context.Context, req Request, onChunk func(string)) (Metrics, []int, error) {
+	body := map[string]interface{}{
+		"model":          req.Model,
+		"messages":       req.Messages(),
+		"stream":         true,
+		"stream_options": map[string]bool{"include_usage": true},
+	}
+	for k, v := range req.Options {
+		if name, ok := openAIOptions[k]; ok {
+			body[name] = v
+		}
+	}
+	if rf := openAIResponseFormat(req.Format); rf != nil {
+		body["response_format"] = rf
+	}
+	if req.Grammar != "" {
+		// A llama.cpp server extension; other servers reject it.
+		body["grammar"] = req.Grammar
+	}
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return Metrics{}, nil, err
+	}
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, b.baseURL+"/chat/completions", bytes.NewReader(buf))
+	if err != nil {
+		return Metrics{}, nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	if b.apiKey != "" {
+		hreq.Header.Set("Authorization", "Bearer "+b.apiKey)
+	}
+
+	start := time.Now()
+	resp, err := b.http.Do(hreq)
+	if err != nil {
+		return Metrics{}, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return Metrics{}, nil, api.StatusError{StatusCode: resp.StatusCode, Status: resp.Status, ErrorMessage: strings.TrimSpace(string(msg))}
+	}
+
+	var metrics Metrics
+	// first and last bracket the streamed content, which is what the
+	// model spent generating; the time before it is queueing and prompt
+	// processing.
+	var first, last time.Time
+	record := func(c openAIChunk) {
+		for _, ch := range c.Choices {
+			if s := ch.Delta.Content + ch.Message.Content; s != "" {
+				last = time.Now()
+				if first.IsZero() {
+					first = last
+				}
+				onChunk(s)
+			}
+		}
+		if c.Usage != nil {
+			metrics.PromptEvalCount = c.Usage.PromptTokens
+			metrics.EvalCount = c.Usage.CompletionTokens
+		}
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		// Some servers ignore "stream" and answer in one piece.
+		var c openAIChunk
+		if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+			return metrics, nil, fmt.Errorf("decode completion: %w", err)
+		}
+		record(c)
+	} else {
+		sc := bufio.NewScanner(resp.Body)
+		sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		for sc.Scan() {
+			data, ok := strings.CutPrefix(sc.Text(), "data:")
+			data = strings.TrimSpace(data)
+			if !ok || data == "" {
+				continue
+			}
+			if data == "[DONE]" {
+				break
+			}
+			var c openAIChunk
+			if err := json.Unmarshal([]byte(data), &c); err != nil {
+				return metrics, nil, fmt.Errorf("decode stream chunk: %w", err)
+			}
+			record(c)
+		}
+		if err := sc.Err(); err != nil {
+			return metrics, nil, err
+		}
+	}
+	metrics.TotalDuration = time.Since(start)
+	metrics.EvalDuration = last.Sub(first)
+	if metrics.EvalDuration <= 0 {
+		// The answer came in one piece, so there is nothing to tell
+		// generation from the rest of the request.
+		metrics.EvalDuration = metrics.TotalDuration
+	}
+	return metrics, nil, nil
+}
+
+// openAIResponseFormat translates the Ollama format field: "json" becomes
+// JSON mode and a schema becomes a json_schema response format.
+func openAIResponseFormat(format json.RawMessage) interface{} {
+	if len(format) == 0 {
+		return nil
+	}
+	var mode string
+	if json.Unmarshal(format, &mode) == nil {
+		if mode == "json" {
+			return map[string]string{"type": "json_object"}
+		}
+		return nil
+	}
+	return map[string]interface{}{
+		"type": "json_schema",
+		"json_schema": map[string]interface{}{
+			"name":   "result",
+			"schema": format,
+		},
+	}
+}
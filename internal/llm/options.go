@@ -0,0 +1,47 @@
+package llm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseOptionValue converts a flag value into the JSON type Ollama expects
+// for an option: integers, floats, and booleans are typed, anything else is
+// a string.
+func ParseOptionValue(v string) interface{} {
+	if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f
+	}
+	if b, err := strconv.ParseBool(v); err == nil {
+		return b
+	}
+	return v
+}
+
+// ParseOptions parses repeated key=value flags into options.
+func ParseOptions(kvs []string) (map[string]interface{}, error) {
+	opts := map[string]interface{}{}
+	for _, kv := range kvs {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid option %q (want key=value)", kv)
+		}
+		opts[strings.TrimSpace(k)] = ParseOptionValue(strings.TrimSpace(v))
+	}
+	return opts, nil
+}
+
+// MergeOptions layers option maps, later ones winning, into a new map.
+func MergeOptions(layers ...map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for _, l := range layers {
+		for k, v := range l {
+			out[k] = v
+		}
+	}
+	return out
+}
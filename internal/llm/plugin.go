@@ -0,0 +1,47 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/nathanleclaire/gpumon/pkg/plugin"
+)
+
+// Plugin is the backend for a backend plugin, named after it.
+type Plugin struct {
+	client *plugin.Client
+}
+
+// NewPlugin returns a backend completing through the running plugin c.
+func NewPlugin(c *plugin.Client) *Plugin {
+	return &Plugin{client: c}
+}
+
+func (p *Plugin) Name() string { return p.client.Info().Name }
+
+func (p *Plugin) Complete(ctx context.Context, req Request, onChunk func(string)) (Metrics, []int, error) {
+	preq := plugin.CompleteRequest{
+		Model:   req.Model,
+		Prompt:  req.Prompt,
+		System:  req.System,
+		Chat:    req.Chat,
+		Context: req.Context,
+		Format:  req.Format,
+		Grammar: req.Grammar,
+		Options: req.Options,
+	}
+	for _, m := range req.History {
+		preq.History = append(preq.History, plugin.Message{Role: m.Role, Content: m.Content})
+	}
+	res, err := p.client.Complete(ctx, preq, onChunk)
+	if err != nil {
+		return Metrics{}, nil, err
+	}
+	return Metrics{
+		TotalDuration:      res.Metrics.TotalDuration,
+		LoadDuration:       res.Metrics.LoadDuration,
+		PromptEvalCount:    res.Metrics.PromptEvalCount,
+		PromptEvalDuration: res.Metrics.PromptEvalDuration,
+		EvalCount:          res.Metrics.EvalCount,
+		EvalDuration:       res.Metrics.EvalDuration,
+	}, res.Context, nil
+}
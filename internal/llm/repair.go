@@ -0,0 +1,130 @@
+package llm
+
+import (
+	"unicode"
+
+	"github.com/nathanleclaire/gpumon/internal/extract"
+)
+
+// RepairJSON makes a best-effort pass over near-miss JSON emitted by
+// models: a code fence around it is stripped, single-quoted strings become
+// double-quoted, bare object keys are quoted, trailing commas are dropped,
+// raw newlines, tabs and other control characters inside strings are
+// escaped, and a truncated document has its open string, arrays and objects
+// closed. Input that is already valid passes through unchanged.
+func RepairJSON(s string) string {
+	rs := []rune(extract.Unfence(s))
+	var out []rune
+	var stack []rune
+	inStr, esc := false, false
+
+	trimTrailingComma := func() {
+		i := len(out) - 1
+		for i >= 0 && unicode.IsSpace(out[i]) {
+			i--
+		}
+		if i >= 0 && out[i] == ',' {
+			out = append(out[:i], out[i+1:]...)
+		}
+	}
+
+	for i := 0; i < len(rs); i++ {
+		c := rs[i]
+		if inStr {
+			switch {
+			case esc:
+				esc = false
+			case c == '\\':
+				esc = true
+			case c == '"':
+				inStr = false
+			case c == '\n':
+				out = append(out, '\\', 'n')
+				continue
+			case c == '\r':
+				out = append(out, '\\', 'r')
+				continue
+			case c == '\t':
+				out = append(out, '\\', 't')
+				continue
+			case c < 0x20:
+				// Other control characters carry no text worth keeping.
+				continue
+			}
+			out = append(out, c)
+			continue
+		}
+		switch {
+		case c == '"':
+			inStr = true
+			out = append(out, c)
+		case c == '\'':
+			out = append(out, '"')
+			j := i + 1
+			for ; j < len(rs) && rs[j] != '\''; j++ {
+				switch {
+				case rs[j] == '\\' && j+1 < len(rs):
+					out = append(out, rs[j], rs[j+1])
+					j++
+				case rs[j] == '"':
+					out = append(out, '\\', '"')
+				case rs[j] == '\n':
+					out = append(out, '\\', 'n')
+				case rs[j] == '\r':
+					out = append(out, '\\', 'r')
+				case rs[j] == '\t':
+					out = append(out, '\\', 't')
+				case rs[j] < 0x20:
+					// Dropped, as in double-quoted strings.
+				default:
+					out = append(out, rs[j])
+				}
+			}
+			out = append(out, '"')
+			i = j
+		case c == '{' || c == '[':
+			stack = append(stack, c)
+			out = append(out, c)
+		case c == '}' || c == ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			trimTrailingComma()
+			out = append(out, c)
+		case c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(rs) && (rs[j] == '_' || unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j])) {
+				j++
+			}
+			ident := rs[i:j]
+			k := j
+			for k < len(rs) && unicode.IsSpace(rs[k]) {
+				k++
+			}
+			if k < len(rs) && rs[k] == ':' {
+				out = append(out, '"')
+				out = append(out, ident...)
+				out = append(out, '"')
+			} else {
+				out = append(out, ident...)
+			}
+			i = j - 1
+		default:
+			out = append(out, c)
+		}
+	}
+
+	if inStr {
+		out = append(out, '"')
+	}
+	for len(stack) > 0 {
+		trimTrailingComma()
+		if stack[len(stack)-1] == '{' {
+			out = append(out, '}')
+		} else {
+			out = append(out, ']')
+		}
+		stack = stack[:len(stack)-1]
+	}
+	return string(out)
+}
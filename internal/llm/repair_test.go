@@ -0,0 +1,37 @@
+package llm
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"valid object", `{"a": "x, y", "b": [true, null, 1.5]}`, `{"a": "x, y", "b": [true, null, 1.5]}`},
+		{"valid array", `[{"a": "}"}, "]"]`, `[{"a": "}"}, "]"]`},
+		{"valid escapes", `{"a": "say \"hi\"\n"}`, `{"a": "say \"hi\"\n"}`},
+		{"unclosed string", `{"name": "Ari`, `{"name": "Ari"}`},
+		{"unclosed string after escape", `{"q": "say \"hi`, `{"q": "say \"hi"}`},
+		{"trailing comma in object", `{"a": 1, "b": 2,}`, `{"a": 1, "b": 2}`},
+		{"trailing comma in array", `{"a": [1, 2, ]}`, `{"a": [1, 2 ]}`},
+		{"trailing comma at the end", `{"a": [1, 2,`, `{"a": [1, 2]}`},
+		{"missing brace", `{"a": {"b": 1}`, `{"a": {"b": 1}}`},
+		{"missing bracket and braces", `{"a": [{"b": 1}, {"c": [2`, `{"a": [{"b": 1}, {"c": [2]}]}`},
+		{"fenced", "```json\n{\"a\": 1}\n```", `{"a": 1}`},
+		{"single quotes", `{'a': 'it "is"'}`, `{"a": "it \"is\""}`},
+		{"bare keys", `{name: "Ari", level_2: 3}`, `{"name": "Ari", "level_2": 3}`},
+		{"raw newline in string", "{\"a\": \"one\ntwo\"}", `{"a": "one\ntwo"}`},
+	}
+	for _, tt := range tests {
+		got := RepairJSON(tt.in)
+		if got != tt.want {
+			t.Errorf("%s: RepairJSON(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+			continue
+		}
+		if !json.Valid([]byte(got)) {
+			t.Errorf("%s: RepairJSON(%q) = %q, which isn't valid JSON", tt.name, tt.in, got)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Error kinds for failed completions. Only these are retried; an answer
+// that fails to parse or validate is a property of the model and retrying
+// it would skew results.
+const (
+	ErrKindTransport = "transport"
+	ErrKindStatus    = "status"
+)
+
+// ClassifyError reports the kind of a completion error and whether it is
+// worth retrying: transport errors and 5xx or 429 responses are,
+// cancellation and other statuses are not.
+func ClassifyError(err error) (string, bool) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrKindTransport, false
+	}
+	var se api.StatusError
+	if errors.As(err, &se) {
+		return ErrKindStatus, se.StatusCode >= http.StatusInternalServerError ||
+			se.StatusCode == http.StatusTooManyRequests
+	}
+	return ErrKindTransport, true
+}
+
+// WithRetry calls fn until it succeeds, returns a non-retryable error, or
+// retries are exhausted, doubling the backoff between attempts and logging
+// each retry to logger. It returns the number of attempts made.
+func WithRetry(ctx context.Context, logger *slog.Logger, retries int, backoff time.Duration, fn func(attempt int) error) (int, error) {
+	attempt := 0
+	for {
+		attempt++
+		err := fn(attempt)
+		if err == nil {
+			return attempt, nil
+		}
+		if _, retryable := ClassifyError(err); !retryable || attempt > retries {
+			return attempt, err
+		}
+		logger.Warn("Generation failed; retrying", "attempt", attempt, "backoff", backoff, "err", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return attempt, err
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,45 @@
+// Package logging builds the slog handlers behind every gpumon command:
+// tint's colored one-line records for people at a terminal, or slog's JSON
+// records for log pipelines such as Loki or CloudWatch.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/lmittmann/tint"
+)
+
+// Log formats accepted by NewHandler.
+const (
+	FormatPretty = "pretty"
+	FormatJSON   = "json"
+)
+
+// NewHandler returns a handler writing records at level or above to w in
+// format, which is pretty (the default when empty) or json. Pretty output
+// is colored only when w is a terminal. A nil level means info.
+func NewHandler(w io.Writer, format string, level slog.Leveler) (slog.Handler, error) {
+	switch strings.ToLower(format) {
+	case "", FormatPretty:
+		f, ok := w.(*os.File)
+		return tint.NewHandler(w, &tint.Options{
+			TimeFormat: "15:04",
+			Level:      level,
+			NoColor:    !ok || !isTerminal(f),
+		}), nil
+	case FormatJSON:
+		return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q (want pretty or json)", format)
+	}
+}
+
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync/atomic"
+)
+
+// Switch is a handler whose output can be replaced after loggers have been
+// built on it, so commands can hold on to a logger made before the flags
+// choosing the format were parsed. Loggers derived with With or WithGroup
+// follow later switches too.
+type Switch struct {
+	cur *atomic.Pointer[slog.Handler]
+	// ops are the With and WithGroup calls to replay on the current
+	// handler.
+	ops []func(slog.Handler) slog.Handler
+}
+
+// NewSwitch returns a Switch writing to h until Set is called.
+func NewSwitch(h slog.Handler) *Switch {
+	s := &Switch{cur: new(atomic.Pointer[slog.Handler])}
+	s.cur.Store(&h)
+	return s
+}
+
+// Set sends records from s, and every handler derived from it, to h.
+func (s *Switch) Set(h slog.Handler) {
+	s.cur.Store(&h)
+}
+
+func (s *Switch) handler() slog.Handler {
+	h := *s.cur.Load()
+	for _, op := range s.ops {
+		h = op(h)
+	}
+	return h
+}
+
+func (s *Switch) Enabled(ctx context.Context, level slog.Level) bool {
+	return (*s.cur.Load()).Enabled(ctx, level)
+}
+
+func (s *Switch) Handle(ctx context.Context, r slog.Record) error {
+	return s.handler().Handle(ctx, r)
+}
+
+func (s *Switch) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return s.with(func(h slog.Handler) slog.Handler { return h.WithAttrs(attrs) })
+}
+
+func (s *Switch) WithGroup(name string) slog.Handler {
+	return s.with(func(h slog.Handler) slog.Handler { return h.WithGroup(name) })
+}
+
+func (s *Switch) with(op func(slog.Handler) slog.Handler) *Switch {
+	return &Switch{cur: s.cur, ops: append(slices.Clip(s.ops), op)}
+}
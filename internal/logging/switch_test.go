@@ -0,0 +1,40 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSwitch(t *testing.T) {
+	var before, after bytes.Buffer
+	sw := NewSwitch(slog.NewTextHandler(&before, nil))
+	logger := slog.New(sw)
+	derived := logger.With("plugin", "echo").WithGroup("g")
+
+	logger.Info("one")
+	sw.Set(slog.NewJSONHandler(&after, nil))
+	logger.Info("two")
+	derived.Info("three", "k", "v")
+
+	if got := before.String(); !strings.Contains(got, "msg=one") || strings.Contains(got, "two") {
+		t.Errorf("before switch: %q", got)
+	}
+	lines := strings.Split(strings.TrimSpace(after.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("after switch: %q", after.String())
+	}
+	var rec struct {
+		Msg    string
+		Plugin string
+		G      struct{ K string }
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Msg != "three" || rec.Plugin != "echo" || rec.G.K != "v" {
+		t.Errorf("derived logger after switch wrote %s", lines[1])
+	}
+}
@@ -0,0 +1,137 @@
+// Package monitor exports GPU metrics from nvidia-smi, dynolog or a
+// collector plugin over OTLP metrics, as the gpumon monitor command.
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nathanleclaire/gpumon/internal/plugins"
+	"github.com/nathanleclaire/gpumon/internal/telemetry"
+	"github.com/nathanleclaire/gpumon/pkg/collector"
+	"github.com/nathanleclaire/gpumon/pkg/export"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+)
+
+// ServiceName is the default service.name for the monitor commands.
+const ServiceName = "gpu-mon"
+
+// loggedCollector logs each collection at debug level.
+type loggedCollector struct {
+	collector.Collector
+	name   string
+	logger *slog.Logger
+}
+
+func (c loggedCollector) Collect(ctx context.Context) ([]collector.Data, error) {
+	c.logger.Debug("Collecting " + c.name + " metrics")
+	return c.Collector.Collect(ctx)
+}
+
+// -----------------------------------------------------------------------------
+// Runners
+// -----------------------------------------------------------------------------
+
+func runNvidiaSmiCollector(ctx context.Context, logger *slog.Logger) error {
+	return runCollector(ctx, logger, plugins.NvidiaSMI, &collector.NvidiaSMI{})
+}
+
+// runCollector exports c's readings until ctx is done.
+func runCollector(ctx context.Context, logger *slog.Logger, name string, c collector.Collector) error {
+	m := otel.Meter("gpu-metrics")
+	lc := loggedCollector{Collector: c, name: name, logger: logger}
+	reg, err := export.RegisterGPUMetrics(m, lc)
+	if err != nil {
+		return fmt.Errorf("callback registration error: %w", err)
+	}
+	// Stop reading c before the caller closes it.
+	defer func() { _ = reg.Unregister() }()
+	logger.Info(name + " metrics collection running; Ctrl+C to exit.")
+	<-ctx.Done()
+	return nil
+}
+
+func runDynologCollector(ctx context.Context, logger *slog.Logger, dc *collector.DynologCollector) error {
+	m := otel.Meter("gpu-metrics")
+	reg, err := export.RegisterDynologMetrics(m, dc)
+	if err != nil {
+		return fmt.Errorf("callback registration error: %w", err)
+	}
+	// Stop reading dc before dynolog is stopped.
+	defer func() { _ = reg.Unregister() }()
+	logger.Info("dynolog metrics collection running; Ctrl+C to exit.")
+	<-ctx.Done()
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+// Cobra commands
+// -----------------------------------------------------------------------------
+
+// NewCommand returns the monitor command tree, logging to logger. Metrics
+// go to the meter provider the root command sets up from its telemetry
+// flags.
+func NewCommand(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "monitor",
+		Short: "Export GPU metrics over OTLP",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "nvidia-smi-poll",
+		Short: "Collect GPU metrics via nvidia-smi",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requireDestination(); err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return runNvidiaSmiCollector(ctx, logger)
+		},
+	}, &cobra.Command{
+		Use:   "dynolog-poll",
+		Short: "Collect GPU metrics via dynolog JSON (on stderr)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requireDestination(); err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			// Tee dynolog's log to the console.
+			dc := &collector.DynologCollector{Tee: os.Stdout}
+			if err := dc.Start(ctx); err != nil {
+				return fmt.Errorf("start dynolog: %w", err)
+			}
+			return runDynologCollector(ctx, logger, dc)
+		},
+	}, &cobra.Command{
+		Use:   "poll",
+		Short: "Collect GPU metrics from --collector: nvidia-smi or a collector plugin",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requireDestination(); err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			c, closeCollector, err := plugins.OpenCollector(ctx, logger)
+			if err != nil {
+				return err
+			}
+			defer closeCollector()
+			return runCollector(ctx, logger, viper.GetString("collector"), c)
+		},
+	})
+	return cmd
+}
+
+// requireDestination fails when telemetry is off, since the collectors would
+// otherwise record into a no-op meter provider.
+func requireDestination() error {
+	return telemetry.ConfigFromViper(ServiceName).RequireExport()
+}
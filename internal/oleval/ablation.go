@@ -0,0 +1,195 @@
+package oleval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const thinkStepByStep = "Think step by step.\n"
+
+// promptFactors are the prompt components --ablate can switch on and off.
+// Each is appended to the base prompt when on.
+var promptFactors = map[string]func(schema string) string{
+	"think": func(string) string { return thinkStepByStep },
+	"schema": func(schema string) string {
+		if schema == "" {
+			return ""
+		}
+		return "Your JSON must validate against this JSON Schema:\n" + schema + "\n"
+	},
+}
+
+// ablation records which prompt factors are on for one prompt variant.
+type ablation map[string]bool
+
+// ablations returns every on/off combination of the named factors, so two
+// factors yield four prompt variants.
+func ablations(factors []string) ([]ablation, error) {
+	if len(factors) == 0 {
+		return []ablation{nil}, nil
+	}
+	seen := map[string]bool{}
+	for _, f := range factors {
+		if _, ok := promptFactors[f]; !ok {
+			return nil, fmt.Errorf("unknown ablation factor %q (want think or schema)", f)
+		}
+		if seen[f] {
+			return nil, fmt.Errorf("duplicate ablation factor %q", f)
+		}
+		seen[f] = true
+	}
+	out := []ablation{{}}
+	for _, f := range factors {
+		var next []ablation
+		for _, a := range out {
+			for _, on := range []bool{true, false} {
+				b := ablation{f: on}
+				for k, v := range a {
+					b[k] = v
+				}
+				next = append(next, b)
+			}
+		}
+		out = next
+	}
+	return out, nil
+}
+
+// Key renders the variant as "schema=off,think=on", sorted by factor.
+func (a ablation) Key() string {
+	if len(a) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(a))
+	for f := range a {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, f := range names {
+		state := "off"
+		if a[f] {
+			state = "on"
+		}
+		parts[i] = f + "=" + state
+	}
+	return strings.Join(parts, ",")
+}
+
+// apply appends the factors that are on to base, in name order.
+func (a ablation) apply(base, schema string) string {
+	names := make([]string, 0, len(a))
+	for f, on := range a {
+		if on {
+			names = append(names, f)
+		}
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	sb.WriteString(base)
+	if !strings.HasSuffix(base, "\n") {
+		sb.WriteString("\n")
+	}
+	for _, f := range names {
+		sb.WriteString(promptFactors[f](schema))
+	}
+	return sb.String()
+}
+
+// ablationEffect compares conformance with one factor on versus off for a
+// model, pooling every other variant dimension.
+type ablationEffect struct {
+	Model      string  `json:"model"`
+	Factor     string  `json:"factor"`
+	OnRuns     int     `json:"on_runs"`
+	OffRuns    int     `json:"off_runs"`
+	OnRate     float64 `json:"on_conformance"`
+	OffRate    float64 `json:"off_conformance"`
+	Effect     float64 `json:"effect"`
+	onConform  int
+	offConform int
+}
+
+// ablationEffects derives per-factor effects from report rows whose variant
+// has a "prompt-..." part. Models run with --compare-grammar also get a
+// "grammar" factor: format-grammar rows against the model's other rows.
+func ablationEffects(rows []*ReportRow) []*ablationEffect {
+	byKey := map[string]*ablationEffect{}
+	add := func(r *ReportRow, factor string, on bool) {
+		e, ok := byKey[r.Model+"\x00"+factor]
+		if !ok {
+			e = &ablationEffect{Model: r.Model, Factor: factor}
+			byKey[r.Model+"\x00"+factor] = e
+		}
+		if on {
+			e.OnRuns += r.Runs
+			e.onConform += r.Conforming
+		} else {
+			e.OffRuns += r.Runs
+			e.offConform += r.Conforming
+		}
+	}
+	grammar := map[string]bool{}
+	for _, r := range rows {
+		if slices.Contains(strings.Split(r.Variant, "/"), "format-grammar") {
+			grammar[r.Model] = true
+		}
+	}
+	for _, r := range rows {
+		parts := strings.Split(r.Variant, "/")
+		if grammar[r.Model] {
+			add(r, "grammar", slices.Contains(parts, "format-grammar"))
+		}
+		for _, part := range parts {
+			key, ok := strings.CutPrefix(part, "prompt-")
+			if !ok {
+				continue
+			}
+			for _, kv := range strings.Split(key, ",") {
+				factor, state, _ := strings.Cut(kv, "=")
+				add(r, factor, state == "on")
+			}
+		}
+	}
+	out := make([]*ablationEffect, 0, len(byKey))
+	for _, e := range byKey {
+		if e.OnRuns > 0 {
+			e.OnRate = float64(e.onConform) / float64(e.OnRuns)
+		}
+		if e.OffRuns > 0 {
+			e.OffRate = float64(e.offConform) / float64(e.OffRuns)
+		}
+		e.Effect = e.OnRate - e.OffRate
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Model != out[j].Model {
+			return out[i].Model < out[j].Model
+		}
+		return out[i].Factor < out[j].Factor
+	})
+	return out
+}
+
+func writeAblation(w io.Writer, format string, effects []*ablationEffect) error {
+	switch format {
+	case "markdown", "md":
+		fmt.Fprintln(w, "| model | factor | on_runs | on_conformance | off_runs | off_conformance | effect |")
+		fmt.Fprintln(w, "| --- | --- | --- | --- | --- | --- | --- |")
+		for _, e := range effects {
+			fmt.Fprintf(w, "| %s | %s | %d | %.2f | %d | %.2f | %+.2f |\n",
+				e.Model, e.Factor, e.OnRuns, e.OnRate, e.OffRuns, e.OffRate, e.Effect)
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(effects)
+	default:
+		return fmt.Errorf("unknown ablation output %q (want markdown or json)", format)
+	}
+}
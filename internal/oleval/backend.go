@@ -0,0 +1,44 @@
+package oleval
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"github.com/nathanleclaire/gpumon/internal/plugins"
+)
+
+// backends resolves which completer serves each model: the OpenAI-compatible
+// backend for models listed as remote, the named backend plugin for models
+// listed as served by one, Ollama for the rest.
+type backends struct {
+	ollama  *ollamaClients
+	openai  *llm.OpenAI
+	remote  map[string]bool
+	plugin  map[string]string
+	plugins *plugins.Backends
+}
+
+func (b *backends) forModel(ctx context.Context, model string) (llm.Backend, error) {
+	if b.remote[model] {
+		return b.openai, nil
+	}
+	if name, ok := b.plugin[model]; ok {
+		return b.plugins.Get(ctx, name)
+	}
+	return b.ollama.forModel(model)
+}
+
+// parsePluginModels parses repeated --plugin-model model=plugin flags.
+func parsePluginModels(specs []string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, spec := range specs {
+		model, name, ok := strings.Cut(spec, "=")
+		if !ok || model == "" || name == "" {
+			return nil, fmt.Errorf("invalid --plugin-model %q (want model=plugin)", spec)
+		}
+		out[model] = name
+	}
+	return out, nil
+}
@@ -0,0 +1,209 @@
+package oleval
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// benchTask is the task name bench results are recorded under, so reports
+// show them as the "task-bench" variant next to the generation results.
+const benchTask = "bench"
+
+const defaultBenchPrompt = "Write a short paragraph describing a lighthouse keeper's daily routine."
+
+// benchSummary aggregates one model's repetitions. The first repetition
+// usually pays for loading the model, so load time is reported as the max.
+type benchSummary struct {
+	Model         string  `json:"model"`
+	Repetitions   int     `json:"repetitions"`
+	Failed        int     `json:"failed"`
+	TokensPerSec  float64 `json:"mean_tokens_per_sec"`
+	TTFTMS        float64 `json:"p50_ttft_ms"`
+	MaxLoadMS     float64 `json:"max_load_ms"`
+	MeanLatencyMS float64 `json:"mean_latency_ms"`
+}
+
+func runBench(cmd *cobra.Command, logger *slog.Logger) error {
+	ctx, stop := interruptContext(cmd.Context())
+	defer stop()
+
+	reps, _ := cmd.Flags().GetInt("repetitions")
+	if reps < 1 {
+		return fmt.Errorf("--repetitions must be at least 1")
+	}
+	allModels, _ := cmd.Flags().GetBool("all-models")
+	cfg := genConfig{API: "generate", Logger: logger}
+	cfg.Prompt, _ = cmd.Flags().GetString("prompt")
+	cfg.RunID, _ = cmd.Flags().GetString("run-id")
+	numPredict, _ := cmd.Flags().GetInt("num-predict")
+	// Fixed sampling keeps the repetitions comparable.
+	options := map[string]interface{}{"temperature": 0.0, "seed": 42, "num_predict": numPredict}
+
+	client, err := newOllamaClient("")
+	if err != nil {
+		return err
+	}
+	ctx, span := otel.Tracer("character-generator").Start(ctx, "command_bench")
+	defer span.End()
+
+	models, err := pickModels(ctx, client.Client(), allModels, "")
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	include, _ := cmd.Flags().GetString("include-regex")
+	excludes, _ := cmd.Flags().GetStringArray("exclude")
+	if models, err = filterModels(logger, models, include, excludes); err != nil {
+		return err
+	}
+	if cfg.Store, err = openStore(viper.GetString("store")); err != nil {
+		return err
+	}
+	defer cfg.Store.Close()
+
+	if cfg.RunID == "" {
+		cfg.RunID = newRunID(models, []string{benchTask})
+	}
+	if _, err := os.Stat(filepath.Join(runRoot(cfg.RunID), "manifest.json")); os.IsNotExist(err) {
+		if err := writeManifest(&RunManifest{
+			RunID:      cfg.RunID,
+			CreatedAt:  time.Now(),
+			Models:     models,
+			API:        cfg.API,
+			Options:    options,
+			Samples:    reps,
+			Tasks:      []string{benchTask},
+			PromptHash: promptHash(cfg.Prompt, nil),
+			GitSHA:     gitSHA(),
+		}); err != nil {
+			return err
+		}
+	}
+	logger.Info("Bench", "run_id", cfg.RunID, "models", len(models), "repetitions", reps)
+	span.SetAttributes(
+		attribute.String("run.id", cfg.RunID),
+		attribute.StringSlice("all.models", models),
+		attribute.Int("repetitions", reps),
+	)
+
+	var summaries []*benchSummary
+	for _, m := range models {
+		var metas []*GenerationMeta
+		for rep := 1; rep <= reps; rep++ {
+			if ctx.Err() != nil {
+				return ErrInterrupted
+			}
+			meta := benchOne(ctx, client, m, rep, options, cfg)
+			if err := saveResults(context.WithoutCancel(ctx), logger, m, nil, nil, meta); err != nil {
+				return err
+			}
+			dir := resultDir(cfg.RunID, m, nil, meta.Variant(), rep)
+			if err := cfg.Store.RecordGeneration(context.WithoutCancel(ctx), meta, dir); err != nil {
+				logger.Error("Store write failed", "model", m, "err", err)
+			}
+			metas = append(metas, meta)
+		}
+		summaries = append(summaries, summarizeBench(m, metas))
+	}
+	writeBenchSummary(os.Stdout, summaries)
+	return nil
+}
+
+// benchOne streams the fixed prompt once and records its timings.
+func benchOne(ctx context.Context, client llm.Backend, model string, rep int, options map[string]interface{}, cfg genConfig) *GenerationMeta {
+	ctx, span := otel.Tracer("character-generator").Start(ctx, "bench_repetition",
+		trace.WithAttributes(
+			attribute.String("model", model),
+			attribute.Int("repetition", rep),
+		),
+	)
+	defer span.End()
+
+	var ttft time.Duration
+	var out []byte
+	start := time.Now()
+	metrics, _, err := client.Complete(ctx, cfg.request(model, cfg.Prompt, nil, options), func(chunk string) {
+		if ttft == 0 {
+			ttft = time.Since(start)
+		}
+		out = append(out, chunk...)
+	})
+	meta := &GenerationMeta{
+		RunID:     cfg.RunID,
+		Task:      benchTask,
+		Sample:    rep,
+		Backend:   client.Name(),
+		Model:     model,
+		Timestamp: time.Now(),
+		API:       cfg.API,
+		Options:   options,
+		TTFTMS:    durationMS(ttft),
+		LatencyMS: durationMS(time.Since(start)),
+		Status:    statusSuccess,
+		raw:       string(out),
+	}
+	recordMetrics(meta, metrics)
+	if err != nil {
+		span.RecordError(err)
+		meta.Status = statusFailed
+		meta.ErrorKind, _ = llm.ClassifyError(err)
+		meta.ParseError = fmt.Sprintf("stream generation error: %v", err)
+		cfg.Logger.Warn("Bench repetition failed", "model", model, "repetition", rep, "err", err)
+	}
+	span.SetAttributes(
+		attribute.Float64("tokens.per_sec", meta.TokensPerSec),
+		attribute.Float64("duration.ttft_ms", meta.TTFTMS),
+		attribute.Float64("duration.load_ms", meta.LoadMS),
+	)
+	cfg.Logger.Info("Bench", "model", model, "repetition", rep,
+		"tokens_per_sec", fmt.Sprintf("%.1f", meta.TokensPerSec),
+		"ttft_ms", fmt.Sprintf("%.0f", meta.TTFTMS),
+		"load_ms", fmt.Sprintf("%.0f", meta.LoadMS))
+	return meta
+}
+
+func summarizeBench(model string, metas []*GenerationMeta) *benchSummary {
+	s := &benchSummary{Model: model, Repetitions: len(metas)}
+	var ttfts []float64
+	ok := 0
+	for _, m := range metas {
+		if m.Status != statusSuccess {
+			s.Failed++
+			continue
+		}
+		ok++
+		s.TokensPerSec += m.TokensPerSec
+		s.MeanLatencyMS += m.LatencyMS
+		s.MaxLoadMS = max(s.MaxLoadMS, m.LoadMS)
+		ttfts = append(ttfts, m.TTFTMS)
+	}
+	if ok > 0 {
+		s.TokensPerSec /= float64(ok)
+		s.MeanLatencyMS /= float64(ok)
+		sort.Float64s(ttfts)
+		s.TTFTMS = ttfts[len(ttfts)/2]
+	}
+	return s
+}
+
+func writeBenchSummary(w io.Writer, rows []*benchSummary) {
+	fmt.Fprintln(w, "| model | repetitions | failed | mean_tokens_per_sec | p50_ttft_ms | max_load_ms | mean_latency_ms |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- | --- | --- | --- |")
+	for _, r := range rows {
+		fmt.Fprintf(w, "| %s | %d | %d | %.1f | %.0f | %.0f | %.0f |\n",
+			r.Model, r.Repetitions, r.Failed, r.TokensPerSec, r.TTFTMS, r.MaxLoadMS, r.MeanLatencyMS)
+	}
+}
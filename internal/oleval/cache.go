@@ -0,0 +1,141 @@
+package oleval
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"github.com/ollama/ollama/api"
+	"github.com/spf13/viper"
+)
+
+// responseCache stores completions on disk keyed by a hash of everything
+// that determines the request, so re-running an experiment or evaluation
+// reuses earlier outputs instead of generating them again. A nil cache
+// passes every request through. It is safe for concurrent use.
+type responseCache struct {
+	dir          string
+	hits, misses atomic.Int64
+}
+
+// cacheKey is hashed into the cache file name. Sample keeps the samples of
+// one combination apart; without a seed they are meant to differ.
+type cacheKey struct {
+	Backend string                 `json:"backend"`
+	Model   string                 `json:"model"`
+	API     string                 `json:"api"`
+	Prompt  string                 `json:"prompt"`
+	System  string                 `json:"system,omitempty"`
+	History []api.Message          `json:"history,omitempty"`
+	Context []int                  `json:"context,omitempty"`
+	Format  json.RawMessage        `json:"format,omitempty"`
+	Grammar string                 `json:"grammar,omitempty"`
+	Options map[string]interface{} `json:"options,omitempty"`
+	Sample  int                    `json:"sample,omitempty"`
+}
+
+type cacheEntry struct {
+	Key     cacheKey    `json:"key"`
+	Text    string      `json:"text"`
+	Metrics api.Metrics `json:"metrics"`
+	Context []int       `json:"context,omitempty"`
+}
+
+// openResponseCache returns the cache selected by --cache-dir, or nil with
+// --no-cache.
+func openResponseCache() (*responseCache, error) {
+	if viper.GetBool("no.cache") {
+		return nil, nil
+	}
+	dir := viper.GetString("cache.dir")
+	if dir == "" {
+		dir = filepath.Join(outDir(), ".cache")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cache dir: %w", err)
+	}
+	return &responseCache{dir: dir}, nil
+}
+
+func (k cacheKey) hash() string {
+	b, _ := json.Marshal(k)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *responseCache) path(h string) string {
+	return filepath.Join(c.dir, h[:2], h+".json")
+}
+
+// complete answers from the cache when it can, replaying the stored text
+// through onChunk, and otherwise calls client and stores a successful
+// answer. The returned bool reports a cache hit.
+func (c *responseCache) complete(ctx context.Context, client llm.Backend, model, prompt string, format json.RawMessage,
+	options map[string]interface{}, cfg genConfig, onChunk func(string)) (api.Metrics, []int, bool, error) {
+
+	if c == nil {
+		m, genContext, err := client.Complete(ctx, cfg.request(model, prompt, format, options), onChunk)
+		return m, genContext, false, err
+	}
+	key := cacheKey{
+		Backend: client.Name(), Model: model, API: cfg.API, Prompt: prompt, System: cfg.System,
+		History: cfg.History, Context: cfg.Context, Format: format, Grammar: cfg.Grammar,
+		Options: options, Sample: cfg.Sample,
+	}
+	h := key.hash()
+	if b, err := os.ReadFile(c.path(h)); err == nil {
+		var e cacheEntry
+		if err := json.Unmarshal(b, &e); err == nil {
+			c.hits.Add(1)
+			onChunk(e.Text)
+			return e.Metrics, e.Context, true, nil
+		}
+	}
+	c.misses.Add(1)
+	var out strings.Builder
+	m, genContext, err := client.Complete(ctx, cfg.request(model, prompt, format, options), func(chunk string) {
+		out.WriteString(chunk)
+		onChunk(chunk)
+	})
+	if err != nil || ctx.Err() != nil {
+		return m, genContext, false, err
+	}
+	if err := c.put(h, &cacheEntry{Key: key, Text: out.String(), Metrics: m, Context: genContext}); err != nil {
+		cfg.Logger.Warn("Cache write failed", "model", model, "err", err)
+	}
+	return m, genContext, false, nil
+}
+
+func (c *responseCache) put(h string, e *cacheEntry) error {
+	p := c.path(h)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	// Concurrent writers of the same key each use their own temporary file.
+	f, err := os.CreateTemp(filepath.Dir(p), h+".*.tmp")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	if err := writeJSONFile(f.Name(), e); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// logStats reports how many requests the cache answered.
+func (c *responseCache) logStats(logger *slog.Logger) {
+	if c == nil || c.hits.Load()+c.misses.Load() == 0 {
+		return
+	}
+	logger.Info("Response cache", "dir", c.dir, "hits", c.hits.Load(), "misses", c.misses.Load())
+}
@@ -0,0 +1,24 @@
+package oleval
+
+import (
+	"encoding/json"
+
+	"github.com/nathanleclaire/gpumon/internal/llm"
+)
+
+// request builds the completion request for prompt: a chat when cfg.API is
+// "chat", otherwise a generate call continuing from cfg.Context, which
+// returns the conversation context for the next turn.
+func (cfg genConfig) request(model, prompt string, format json.RawMessage, options map[string]interface{}) llm.Request {
+	return llm.Request{
+		Model:   model,
+		Prompt:  prompt,
+		System:  cfg.System,
+		Chat:    cfg.API == "chat",
+		History: cfg.History,
+		Context: cfg.Context,
+		Format:  format,
+		Grammar: cfg.Grammar,
+		Options: options,
+	}
+}
@@ -0,0 +1,76 @@
+package oleval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// correctionPrompt tells the model what was wrong with its last answer.
+func correctionPrompt(out parsedOutput) string {
+	var sb strings.Builder
+	sb.WriteString("Your JSON was invalid")
+	if out.Err != "" {
+		sb.WriteString(": " + out.Err)
+	}
+	sb.WriteString("\n")
+	for _, v := range out.Violations {
+		sb.WriteString("- " + v + "\n")
+	}
+	sb.WriteString("Reply with only the corrected JSON.")
+	return sb.String()
+}
+
+// runCorrections feeds the parse or validation error of a non-conforming
+// answer back to the model, up to cfg.Corrections times, and stops at the
+// first conforming reply. The attempts are recorded as turns numbered from 1;
+// the returned output is the last one parsed.
+func runCorrections(ctx context.Context, client llm.Backend, model string, format json.RawMessage,
+	options map[string]interface{}, cfg genConfig, prompt, answer string, genContext []int, first parsedOutput) ([]turnMeta, parsedOutput) {
+
+	cv := newConversation(client, model, format, options, cfg, prompt, answer, genContext)
+	last := first
+	var attempts []turnMeta
+	for i := 1; i <= cfg.Corrections && !last.Conforming(); i++ {
+		attemptCtx, span := otel.Tracer("character-generator").Start(ctx, "correction_attempt",
+			trace.WithAttributes(
+				attribute.String("model", model),
+				attribute.Int("attempt", i),
+			),
+		)
+		next := correctionPrompt(last)
+		start := time.Now()
+		text, metrics, err := cv.send(attemptCtx, next)
+		tm := turnMeta{
+			Turn:         i,
+			Prompt:       next,
+			LatencyMS:    durationMS(time.Since(start)),
+			OutputTokens: metrics.EvalCount,
+			raw:          text,
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.End()
+			tm.ErrorKind, _ = llm.ClassifyError(err)
+			tm.ParseError = fmt.Sprintf("stream generation error: %v", err)
+			return append(attempts, tm), last
+		}
+		last = parseOutput(text, cfg)
+		tm.ConformingJSON = last.Conforming()
+		tm.ErrorKind = last.ErrorKind
+		tm.ParseError = last.Err
+		tm.Violations = last.Violations
+		tm.result = last.Result
+		span.SetAttributes(attribute.Bool("conforming_json", tm.ConformingJSON))
+		span.End()
+		attempts = append(attempts, tm)
+	}
+	return attempts, last
+}
@@ -0,0 +1,56 @@
+package oleval
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// modelPrice is what a backend charges, in USD per million tokens.
+type modelPrice struct {
+	Prompt     float64 `yaml:"prompt_per_mtok" json:"prompt_per_mtok"`
+	Completion float64 `yaml:"completion_per_mtok" json:"completion_per_mtok"`
+}
+
+// priceTable maps model names to prices, loaded from --prices. A key matches
+// a model exactly, or its base name without the ":tag" suffix; "*" applies to
+// every other model (e.g. an electricity estimate for local runs).
+type priceTable map[string]modelPrice
+
+func loadPrices(path string) (priceTable, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read prices: %w", err)
+	}
+	var t priceTable
+	// YAML is a superset of JSON, so either works here.
+	if err := yaml.Unmarshal(b, &t); err != nil {
+		return nil, fmt.Errorf("parse prices: %w", err)
+	}
+	return t, nil
+}
+
+func (t priceTable) lookup(model string) (modelPrice, bool) {
+	if p, ok := t[model]; ok {
+		return p, true
+	}
+	if base, _, ok := strings.Cut(model, ":"); ok {
+		if p, ok := t[base]; ok {
+			return p, true
+		}
+	}
+	p, ok := t["*"]
+	return p, ok
+}
+
+// Cost prices one generation's token counts. ok is false when the table has
+// no entry for the model.
+func (t priceTable) Cost(model string, promptTokens, outputTokens int) (cost float64, ok bool) {
+	p, ok := t.lookup(model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(promptTokens)*p.Prompt + float64(outputTokens)*p.Completion) / 1e6, true
+}
@@ -0,0 +1,191 @@
+package oleval
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dashboard row statuses, in the order a model goes through them.
+const (
+	dashQueued    = "queued"
+	dashStreaming = "streaming"
+	dashParsing   = "parsing"
+	dashDone      = "done"
+)
+
+// dashboard redraws a table of per-model progress in place while generate
+// runs, instead of echoing every streamed token. A nil dashboard does
+// nothing, so callers need not check whether it is enabled.
+type dashboard struct {
+	mu     sync.Mutex
+	out    io.Writer
+	rows   []*dashRow
+	byName map[string]*dashRow
+	lines  int
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+type dashRow struct {
+	model      string
+	status     string
+	total      int
+	finished   int
+	generated  int
+	conforming int
+	tokens     int
+	// chunks counts the current generation's streamed chunks.
+	chunks  int
+	started time.Time
+	elapsed time.Duration
+}
+
+// newDashboard starts redrawing to out. totals is the number of generations
+// planned per model, in display order.
+func newDashboard(out io.Writer, models []string, totals map[string]int) *dashboard {
+	d := &dashboard{
+		out:    out,
+		byName: map[string]*dashRow{},
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	for _, m := range models {
+		r := &dashRow{model: m, status: dashQueued, total: totals[m]}
+		d.rows = append(d.rows, r)
+		d.byName[m] = r
+	}
+	go d.loop()
+	return d
+}
+
+func (d *dashboard) loop() {
+	defer close(d.done)
+	t := time.NewTicker(250 * time.Millisecond)
+	defer t.Stop()
+	for {
+		d.draw()
+		select {
+		case <-t.C:
+		case <-d.stop:
+			d.draw()
+			return
+		}
+	}
+}
+
+// Close stops redrawing after drawing the final state.
+func (d *dashboard) Close() {
+	if d == nil {
+		return
+	}
+	close(d.stop)
+	<-d.done
+}
+
+func (d *dashboard) update(model string, f func(r *dashRow)) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if r, ok := d.byName[model]; ok {
+		f(r)
+	}
+}
+
+// begin marks the start of one generation for model.
+func (d *dashboard) begin(model string) {
+	d.update(model, func(r *dashRow) {
+		if r.started.IsZero() {
+			r.started = time.Now()
+		}
+		r.status = dashStreaming
+		r.chunks = 0
+	})
+}
+
+// streamed counts one streamed chunk, roughly a token, until finish
+// replaces the estimate with the backend's count. Without a dashboard the
+// chunk is echoed as before.
+func (d *dashboard) streamed(model, chunk string) {
+	if d == nil {
+		fmt.Print(chunk)
+		return
+	}
+	d.update(model, func(r *dashRow) {
+		r.tokens++
+		r.chunks++
+	})
+}
+
+// streamEnd ends the echoed output of one answer.
+func (d *dashboard) streamEnd() {
+	if d == nil {
+		fmt.Println()
+	}
+}
+
+func (d *dashboard) parsing(model string) {
+	d.update(model, func(r *dashRow) { r.status = dashParsing })
+}
+
+// finish records a completed generation; a nil meta means it was skipped.
+func (d *dashboard) finish(model string, meta *GenerationMeta) {
+	d.update(model, func(r *dashRow) {
+		r.finished++
+		if meta != nil {
+			r.generated++
+			if meta.ConformingJSON {
+				r.conforming++
+			}
+			if meta.OutputTokens > 0 {
+				r.tokens += meta.OutputTokens - r.chunks
+			}
+		}
+		if !r.started.IsZero() {
+			r.elapsed = time.Since(r.started)
+		}
+		r.chunks = 0
+		r.status = dashQueued
+		if r.finished >= r.total {
+			r.status = dashDone
+		}
+	})
+}
+
+func (d *dashboard) draw() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var sb strings.Builder
+	if d.lines > 0 {
+		// Move back to the top of the previous frame.
+		fmt.Fprintf(&sb, "\x1b[%dA", d.lines)
+	}
+	width := len("model")
+	for _, r := range d.rows {
+		width = max(width, len(r.model))
+	}
+	line := func(format string, args ...any) {
+		sb.WriteString("\x1b[2K")
+		fmt.Fprintf(&sb, format, args...)
+		sb.WriteString("\n")
+	}
+	line("%-*s  %-9s  %9s  %8s  %8s  %s", width, "model", "status", "progress", "tokens", "elapsed", "conforming")
+	for _, r := range d.rows {
+		elapsed := r.elapsed
+		if r.status == dashStreaming || r.status == dashParsing {
+			elapsed = time.Since(r.started)
+		}
+		conf := "-"
+		if r.generated > 0 {
+			conf = fmt.Sprintf("%d/%d (%.0f%%)", r.conforming, r.generated, 100*float64(r.conforming)/float64(r.generated))
+		}
+		line("%-*s  %-9s  %9s  %8d  %8s  %s", width, r.model, r.status,
+			fmt.Sprintf("%d/%d", r.finished, r.total), r.tokens, elapsed.Round(100*time.Millisecond), conf)
+	}
+	d.lines = len(d.rows) + 1
+	_, _ = io.WriteString(d.out, sb.String())
+}
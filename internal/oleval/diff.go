@@ -0,0 +1,118 @@
+package oleval
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// diffRow compares one model/variant combination between two runs. A
+// nil side means the combination only exists in the other run.
+type diffRow struct {
+	Key  string
+	A, B *ReportRow
+}
+
+func diffRuns(cmd *cobra.Command, logger *slog.Logger) error {
+	runs, _ := cmd.Flags().GetStringArray("run")
+	threshold, _ := cmd.Flags().GetFloat64("threshold")
+	failOnRegression, _ := cmd.Flags().GetBool("fail-on-regression")
+	if len(runs) != 2 {
+		return fmt.Errorf("diff needs exactly two --run values, got %d", len(runs))
+	}
+
+	a, err := collectReport(logger, resolveRun(runs[0]), nil)
+	if err != nil {
+		return fmt.Errorf("run A: %w", err)
+	}
+	b, err := collectReport(logger, resolveRun(runs[1]), nil)
+	if err != nil {
+		return fmt.Errorf("run B: %w", err)
+	}
+
+	rows := pairReports(a, b)
+	regressions := writeDiff(os.Stdout, runs[0], runs[1], rows, threshold)
+	logger.Info("Diff complete", "combinations", len(rows), "regressions", regressions)
+	if failOnRegression && regressions > 0 {
+		return fmt.Errorf("%d regression(s) between %s and %s", regressions, runs[0], runs[1])
+	}
+	return nil
+}
+
+func reportKey(r *ReportRow) string {
+	return r.Model + "\x00" + r.Variant
+}
+
+func pairReports(a, b []*ReportRow) []diffRow {
+	byKey := map[string]*diffRow{}
+	for _, r := range a {
+		byKey[reportKey(r)] = &diffRow{Key: reportKey(r), A: r}
+	}
+	for _, r := range b {
+		if d, ok := byKey[reportKey(r)]; ok {
+			d.B = r
+			continue
+		}
+		byKey[reportKey(r)] = &diffRow{Key: reportKey(r), B: r}
+	}
+	rows := make([]diffRow, 0, len(byKey))
+	for _, d := range byKey {
+		rows = append(rows, *d)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Key < rows[j].Key })
+	return rows
+}
+
+// writeDiff prints a Markdown table of per-model deltas (B minus A) and
+// returns how many combinations regressed by more than threshold in
+// conformance or any judge score.
+func writeDiff(w io.Writer, nameA, nameB string, rows []diffRow, threshold float64) int {
+	fmt.Fprintf(w, "Comparing A=%s against B=%s\n\n", nameA, nameB)
+	fmt.Fprintln(w, "| model | variant | conformance A | conformance B | Δ conformance | Δ creativity | Δ coherence | Δ backstory | |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- | --- | --- | --- | --- | --- |")
+	regressions := 0
+	for _, d := range rows {
+		ref := d.A
+		if ref == nil {
+			ref = d.B
+		}
+		if d.A == nil || d.B == nil {
+			status := "only in B"
+			if d.B == nil {
+				status = "only in A"
+			}
+			fmt.Fprintf(w, "| %s | %s | | | | | | | %s |\n", ref.Model, displayVariant(ref.Variant), status)
+			continue
+		}
+		deltas := []float64{
+			d.B.ConformanceRate - d.A.ConformanceRate,
+			judgedDelta(d.A, d.B, func(r *ReportRow) float64 { return r.Creativity }),
+			judgedDelta(d.A, d.B, func(r *ReportRow) float64 { return r.Coherence }),
+			judgedDelta(d.A, d.B, func(r *ReportRow) float64 { return r.BackstoryQuality }),
+		}
+		// Judge scores are on a 1–10 scale; normalise so one threshold
+		// applies to both conformance rate and scores.
+		marker := ""
+		if deltas[0] < -threshold || deltas[1]/10 < -threshold ||
+			deltas[2]/10 < -threshold || deltas[3]/10 < -threshold {
+			marker = "**REGRESSION**"
+			regressions++
+		}
+		fmt.Fprintf(w, "| %s | %s | %.2f | %.2f | %+.2f | %+.2f | %+.2f | %+.2f | %s |\n",
+			ref.Model, displayVariant(ref.Variant), d.A.ConformanceRate, d.B.ConformanceRate,
+			deltas[0], deltas[1], deltas[2], deltas[3], marker)
+	}
+	return regressions
+}
+
+// judgedDelta compares a judge score only when both runs were judged.
+func judgedDelta(a, b *ReportRow, score func(*ReportRow) float64) float64 {
+	if a.Judged == 0 || b.Judged == 0 {
+		return 0
+	}
+	return score(b) - score(a)
+}
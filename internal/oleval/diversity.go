@@ -0,0 +1,101 @@
+package oleval
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/ollama/ollama/api"
+)
+
+// shingleSize is the word n-gram length used for string similarity.
+const shingleSize = 3
+
+// diversity returns 1 minus the mean pairwise similarity of items, so 0 means
+// every sample is identical and values near 1 mean they share almost nothing.
+// Fewer than two items have no defined diversity and return 0.
+func diversity[T any](items []T, similarity func(a, b T) float64) float64 {
+	if len(items) < 2 {
+		return 0
+	}
+	var sum float64
+	var pairs int
+	for i := range items {
+		for j := i + 1; j < len(items); j++ {
+			sum += similarity(items[i], items[j])
+			pairs++
+		}
+	}
+	return 1 - sum/float64(pairs)
+}
+
+// shingles splits text into lower-cased words and returns the set of word
+// n-grams; texts shorter than n words yield a single shingle.
+func shingles(text string) map[string]struct{} {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	set := map[string]struct{}{}
+	if len(words) < shingleSize {
+		set[strings.Join(words, " ")] = struct{}{}
+		return set
+	}
+	for i := 0; i+shingleSize <= len(words); i++ {
+		set[strings.Join(words[i:i+shingleSize], " ")] = struct{}{}
+	}
+	return set
+}
+
+// jaccard is |a ∩ b| / |a ∪ b|.
+func jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	inter := 0
+	for k := range a {
+		if _, ok := b[k]; ok {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
+
+// textDiversity scores samples by word-trigram Jaccard similarity.
+func textDiversity(texts []string) float64 {
+	sets := make([]map[string]struct{}, len(texts))
+	for i, t := range texts {
+		sets[i] = shingles(t)
+	}
+	return diversity(sets, jaccard)
+}
+
+// embeddingDiversity scores samples by cosine similarity of their embeddings
+// from an Ollama embedding model.
+func embeddingDiversity(ctx context.Context, client *api.Client, model string, texts []string) (float64, error) {
+	if len(texts) < 2 {
+		return 0, nil
+	}
+	resp, err := client.Embed(ctx, &api.EmbedRequest{Model: model, Input: texts})
+	if err != nil {
+		return 0, fmt.Errorf("embed: %w", err)
+	}
+	if len(resp.Embeddings) != len(texts) {
+		return 0, fmt.Errorf("embed: got %d embeddings for %d inputs", len(resp.Embeddings), len(texts))
+	}
+	return diversity(resp.Embeddings, cosine), nil
+}
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range min(len(a), len(b)) {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
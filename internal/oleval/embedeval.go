@@ -0,0 +1,163 @@
+package oleval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// embedBatchSize bounds the inputs sent in one /api/embed request.
+const embedBatchSize = 32
+
+// embeddingMetrics places a backstory in embedding space, stored in
+// evaluation.json next to the judge scores.
+type embeddingMetrics struct {
+	Model string `json:"model"`
+	// ConstraintSimilarity compares the backstory with the character sheet
+	// it was asked to fit (tags, class and equipment).
+	ConstraintSimilarity float64 `json:"constraint_similarity"`
+	// CentroidSimilarity compares it with the mean backstory of its model.
+	CentroidSimilarity float64 `json:"centroid_similarity"`
+	// NearestModel is the model whose mean backstory is closest; another
+	// model's name means this output clusters with that model's style.
+	NearestModel string `json:"nearest_model"`
+	// ModelDistinctiveness is 1 minus the similarity of the model's mean
+	// backstory to the mean over every model.
+	ModelDistinctiveness float64 `json:"model_distinctiveness"`
+}
+
+type embeddedBackstory struct {
+	dir        string
+	model      string
+	backstory  []float32
+	constraint []float32
+}
+
+// constraintText describes what a backstory should be consistent with.
+func constraintText(meta *GenerationMeta, c *Character) string {
+	return fmt.Sprintf("A %s character. Class: %s. Equipment: %s.",
+		strings.Join(meta.Tags, ", "), c.Class, strings.Join(c.Equipment, ", "))
+}
+
+// embedEvaluate embeds every character backstory under metaPaths with
+// embedModel and merges the resulting metrics into each evaluation.json.
+// Suite task results, which have no backstory, are skipped.
+func embedEvaluate(ctx context.Context, logger *slog.Logger, client *api.Client, embedModel string, metaPaths []string) error {
+	ctx, span := otel.Tracer("character-generator").Start(ctx, "embedding_evaluation")
+	defer span.End()
+
+	var items []*embeddedBackstory
+	var texts []string
+	for _, p := range metaPaths {
+		meta, err := loadMeta(p)
+		if err != nil || meta.Task != "" || !meta.ConformingJSON {
+			continue
+		}
+		dir := filepath.Dir(p)
+		c, err := loadCharacter(filepath.Join(dir, "result.json"))
+		if err != nil || strings.TrimSpace(c.Backstory) == "" {
+			continue
+		}
+		items = append(items, &embeddedBackstory{dir: dir, model: meta.Model})
+		texts = append(texts, c.Backstory, constraintText(meta, c))
+	}
+	span.SetAttributes(attribute.Int("embedding.backstories", len(items)))
+	if len(items) == 0 {
+		logger.Info("No backstories to embed")
+		return nil
+	}
+
+	vecs, err := embedAll(ctx, client, embedModel, texts)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	byModel := map[string][][]float32{}
+	var all [][]float32
+	for i, it := range items {
+		it.backstory, it.constraint = vecs[2*i], vecs[2*i+1]
+		byModel[it.model] = append(byModel[it.model], it.backstory)
+		all = append(all, it.backstory)
+	}
+	centroids := map[string][]float32{}
+	for m, vs := range byModel {
+		centroids[m] = centroid(vs)
+	}
+	global := centroid(all)
+
+	var errs []error
+	for _, it := range items {
+		em := &embeddingMetrics{
+			Model:                embedModel,
+			ConstraintSimilarity: cosine(it.backstory, it.constraint),
+			CentroidSimilarity:   cosine(it.backstory, centroids[it.model]),
+			ModelDistinctiveness: 1 - cosine(centroids[it.model], global),
+		}
+		best := -2.0
+		for m, c := range centroids {
+			if sim := cosine(it.backstory, c); sim > best {
+				best, em.NearestModel = sim, m
+			}
+		}
+		if err := mergeEmbeddingMetrics(it.dir, em); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", it.dir, err))
+		}
+	}
+	logger.Info("Embedded backstories", "model", embedModel, "count", len(items), "models", len(centroids))
+	return errors.Join(errs...)
+}
+
+// embedAll embeds texts in batches, preserving order.
+func embedAll(ctx context.Context, client *api.Client, model string, texts []string) ([][]float32, error) {
+	out := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += embedBatchSize {
+		batch := texts[start:min(start+embedBatchSize, len(texts))]
+		resp, err := client.Embed(ctx, &api.EmbedRequest{Model: model, Input: batch})
+		if err != nil {
+			return nil, fmt.Errorf("embed: %w", err)
+		}
+		if len(resp.Embeddings) != len(batch) {
+			return nil, fmt.Errorf("embed: got %d embeddings for %d inputs", len(resp.Embeddings), len(batch))
+		}
+		out = append(out, resp.Embeddings...)
+	}
+	return out, nil
+}
+
+func centroid(vs [][]float32) []float32 {
+	if len(vs) == 0 {
+		return nil
+	}
+	c := make([]float32, len(vs[0]))
+	for _, v := range vs {
+		for i := range min(len(c), len(v)) {
+			c[i] += v[i]
+		}
+	}
+	for i := range c {
+		c[i] /= float32(len(vs))
+	}
+	return c
+}
+
+// mergeEmbeddingMetrics adds em to the result's evaluation.json, creating it
+// if the result was never judged.
+func mergeEmbeddingMetrics(dir string, em *embeddingMetrics) error {
+	ev, err := loadEvaluation(evaluationPath(dir))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		ev = &Evaluation{}
+	}
+	ev.Embedding = em
+	return writeJSONFile(evaluationPath(dir), ev)
+}
@@ -0,0 +1,158 @@
+package oleval
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// judgeVerdict is one ensemble member's scores, kept in evaluation.json next
+// to the aggregate.
+type judgeVerdict struct {
+	JudgeModel string      `json:"judge_model"`
+	Scores     JudgeScores `json:"scores"`
+	Rationale  string      `json:"rationale,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// judgePanel scores with every judge and aggregates their scores, which
+// reduces the bias of any single judge model. A panel of one behaves exactly
+// like that judge.
+type judgePanel struct {
+	judges []*judge
+	agg    string
+}
+
+func newJudgePanel(judges []*judge, agg string) (*judgePanel, error) {
+	switch agg {
+	case "mean", "median", "majority":
+	default:
+		return nil, fmt.Errorf("unknown judge aggregation %q (want mean, median or majority)", agg)
+	}
+	return &judgePanel{judges: judges, agg: agg}, nil
+}
+
+func (p *judgePanel) models() []string {
+	names := make([]string, len(p.judges))
+	for i, j := range p.judges {
+		names[i] = j.model
+	}
+	return names
+}
+
+func (p *judgePanel) Score(ctx context.Context, c *Character) (*Evaluation, error) {
+	if len(p.judges) == 1 {
+		return p.judges[0].Score(ctx, c)
+	}
+	ev := &Evaluation{
+		JudgeModel:    strings.Join(p.models(), "+"),
+		PromptVersion: judgePromptVersion,
+		Aggregation:   p.agg,
+	}
+	var ok []JudgeScores
+	var errs []string
+	for _, j := range p.judges {
+		one, err := j.Score(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		ev.Timestamp = one.Timestamp
+		ev.Judges = append(ev.Judges, judgeVerdict{
+			JudgeModel: one.JudgeModel, Scores: one.Scores, Rationale: one.Rationale, Error: one.Error,
+		})
+		if one.Error != "" {
+			errs = append(errs, one.JudgeModel+": "+one.Error)
+			continue
+		}
+		ok = append(ok, one.Scores)
+	}
+	if len(ok) == 0 {
+		ev.Error = strings.Join(errs, "; ")
+		return ev, nil
+	}
+	ev.Scores = aggregateScores(ok, p.agg)
+	ev.Agreement = judgeAgreement(ok)
+	return ev, nil
+}
+
+// aggregateScores combines each criterion across judges.
+func aggregateScores(scores []JudgeScores, agg string) JudgeScores {
+	pick := func(get func(JudgeScores) float64) float64 {
+		vals := make([]float64, len(scores))
+		for i, s := range scores {
+			vals[i] = get(s)
+		}
+		switch agg {
+		case "median":
+			return median(vals)
+		case "majority":
+			return majority(vals)
+		default:
+			var sum float64
+			for _, v := range vals {
+				sum += v
+			}
+			return sum / float64(len(vals))
+		}
+	}
+	return JudgeScores{
+		Creativity:       pick(func(s JudgeScores) float64 { return s.Creativity }),
+		Coherence:        pick(func(s JudgeScores) float64 { return s.Coherence }),
+		BackstoryQuality: pick(func(s JudgeScores) float64 { return s.BackstoryQuality }),
+	}
+}
+
+func median(vals []float64) float64 {
+	s := append([]float64(nil), vals...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+// majority returns the score most judges gave, rounded to an integer; with
+// no single most common score it falls back to the median.
+func majority(vals []float64) float64 {
+	counts := map[float64]int{}
+	for _, v := range vals {
+		counts[math.Round(v)]++
+	}
+	best, bestN, tie := 0.0, 0, false
+	for v, n := range counts {
+		switch {
+		case n > bestN:
+			best, bestN, tie = v, n, false
+		case n == bestN:
+			tie = true
+		}
+	}
+	if tie {
+		return median(vals)
+	}
+	return best
+}
+
+// judgeAgreement is 1 minus the mean absolute difference between every pair
+// of judges, over all criteria, scaled by the 1-10 score range: 1 means the
+// judges gave identical scores, 0 that they were as far apart as possible.
+func judgeAgreement(scores []JudgeScores) float64 {
+	if len(scores) < 2 {
+		return 0
+	}
+	var diff float64
+	pairs := 0
+	for i := range scores {
+		for j := i + 1; j < len(scores); j++ {
+			a, b := scores[i], scores[j]
+			diff += math.Abs(a.Creativity-b.Creativity) +
+				math.Abs(a.Coherence-b.Coherence) +
+				math.Abs(a.BackstoryQuality-b.BackstoryQuality)
+			pairs += 3
+		}
+	}
+	return 1 - diff/float64(pairs)/9
+}
@@ -0,0 +1,130 @@
+package oleval
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Experiment is a versionable description of a generate run, loaded from
+// --experiment. Flags given explicitly on the command line take precedence
+// over the file.
+type Experiment struct {
+	Name         string                   `yaml:"name"`
+	Models       []string                 `yaml:"models"`
+	Tags         []string                 `yaml:"tags"`
+	Prompt       string                   `yaml:"prompt"`
+	PromptFile   string                   `yaml:"prompt_file"`
+	SystemPrompt string                   `yaml:"system_prompt"`
+	Format       string                   `yaml:"format"`
+	API          string                   `yaml:"api"`
+	Options      map[string]interface{}   `yaml:"options"`
+	Sweep        map[string][]interface{} `yaml:"sweep"`
+	Samples      int                      `yaml:"samples"`
+	Turns        []string                 `yaml:"turns"`
+	Suite        string                   `yaml:"suite"`
+	Retries      *int                     `yaml:"retries"`
+	Timeout      string                   `yaml:"timeout"`
+	Backend      struct {
+		Type    string `yaml:"type"`
+		Address string `yaml:"address"`
+		// Models maps model names to their own server address.
+		Models map[string]string `yaml:"models"`
+	} `yaml:"backend"`
+	// OpenAI lists models served by an OpenAI-compatible API, compared in
+	// the same run as the Ollama models.
+	OpenAI struct {
+		Address   string   `yaml:"address"`
+		APIKeyEnv string   `yaml:"api_key_env"`
+		Models    []string `yaml:"models"`
+	} `yaml:"openai"`
+}
+
+func loadExperiment(path string) (*Experiment, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read experiment: %w", err)
+	}
+	var exp Experiment
+	if err := yaml.Unmarshal(b, &exp); err != nil {
+		return nil, fmt.Errorf("parse experiment: %w", err)
+	}
+	if exp.PromptFile != "" {
+		p, err := os.ReadFile(exp.PromptFile)
+		if err != nil {
+			return nil, fmt.Errorf("read prompt file: %w", err)
+		}
+		exp.Prompt = string(p)
+	}
+	switch exp.Backend.Type {
+	case "", "ollama":
+	default:
+		return nil, fmt.Errorf("unsupported backend %q", exp.Backend.Type)
+	}
+	return &exp, nil
+}
+
+// sweepSpecs renders the experiment's sweep table in --sweep syntax, sorted
+// by parameter name so the cross-product order is stable.
+func (e *Experiment) sweepSpecs() []string {
+	names := make([]string, 0, len(e.Sweep))
+	for name := range e.Sweep {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	specs := make([]string, 0, len(names))
+	for _, name := range names {
+		vals := make([]string, 0, len(e.Sweep[name]))
+		for _, v := range e.Sweep[name] {
+			vals = append(vals, fmt.Sprint(v))
+		}
+		specs = append(specs, name+"="+strings.Join(vals, ","))
+	}
+	return specs
+}
+
+// apply fills cfg from the experiment wherever the corresponding flag was not
+// set explicitly.
+func (e *Experiment) apply(cmd *cobra.Command, cfg *genConfig) error {
+	changed := cmd.Flags().Changed
+	if e.Format != "" && !changed("format") {
+		cfg.Format = e.Format
+	}
+	if e.API != "" && !changed("api") {
+		cfg.API = e.API
+	}
+	if e.SystemPrompt != "" && !changed("system-prompt") {
+		cfg.System = e.SystemPrompt
+	}
+	if e.Prompt != "" {
+		cfg.Prompt = e.Prompt
+	}
+	if e.Samples > 0 && !changed("samples") {
+		cfg.Samples = e.Samples
+	}
+	if len(e.Turns) > 0 && !changed("turn") {
+		cfg.Turns = e.Turns
+	}
+	if e.Retries != nil && !changed("retries") {
+		cfg.Retries = *e.Retries
+	}
+	if e.Timeout != "" && !changed("timeout") {
+		d, err := time.ParseDuration(e.Timeout)
+		if err != nil {
+			return fmt.Errorf("experiment timeout: %w", err)
+		}
+		cfg.Timeout = d
+	}
+	for k, v := range e.Options {
+		// Explicit --option/--seed/... flags were already collected and win.
+		if _, set := cfg.Options[k]; !set {
+			cfg.Options[k] = v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package oleval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"github.com/spf13/cobra"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// ExportRow is one generation flattened for analysis outside oleval. Judge
+// scores are null for results that were never judged, or whose judging
+// failed. Params and Options hold the JSON of their maps, since their value
+// types vary by key.
+type ExportRow struct {
+	RunID            string   `parquet:"name=run_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Model            string   `parquet:"name=model, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Backend          string   `parquet:"name=backend, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Tags             []string `parquet:"name=tags, type=LIST, valuetype=BYTE_ARRAY, valueconvertedtype=UTF8"`
+	Task             string   `parquet:"name=task, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Variant          string   `parquet:"name=variant, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Sample           int32    `parquet:"name=sample, type=INT32"`
+	Format           string   `parquet:"name=format, type=BYTE_ARRAY, convertedtype=UTF8"`
+	API              string   `parquet:"name=api, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Params           string   `parquet:"name=params, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Options          string   `parquet:"name=options, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Status           string   `parquet:"name=status, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ErrorKind        string   `parquet:"name=error_kind, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ConformingJSON   bool     `parquet:"name=conforming_json, type=BOOLEAN"`
+	Repaired         bool     `parquet:"name=repaired, type=BOOLEAN"`
+	SelfCorrected    bool     `parquet:"name=self_corrected, type=BOOLEAN"`
+	Cached           bool     `parquet:"name=cached, type=BOOLEAN"`
+	Violations       int32    `parquet:"name=violations, type=INT32"`
+	Timestamp        int64    `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	LatencyMS        float64  `parquet:"name=latency_ms, type=DOUBLE"`
+	TTFTMS           float64  `parquet:"name=ttft_ms, type=DOUBLE"`
+	LoadMS           float64  `parquet:"name=load_ms, type=DOUBLE"`
+	PromptTokens     int32    `parquet:"name=prompt_tokens, type=INT32"`
+	OutputTokens     int32    `parquet:"name=output_tokens, type=INT32"`
+	TokensPerSec     float64  `parquet:"name=tokens_per_sec, type=DOUBLE"`
+	CostUSD          float64  `parquet:"name=cost_usd, type=DOUBLE"`
+	JudgeModel       *string  `parquet:"name=judge_model, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Creativity       *float64 `parquet:"name=creativity, type=DOUBLE, repetitiontype=OPTIONAL"`
+	Coherence        *float64 `parquet:"name=coherence, type=DOUBLE, repetitiontype=OPTIONAL"`
+	BackstoryQuality *float64 `parquet:"name=backstory_quality, type=DOUBLE, repetitiontype=OPTIONAL"`
+	JudgeAgreement   *float64 `parquet:"name=judge_agreement, type=DOUBLE, repetitiontype=OPTIONAL"`
+}
+
+func exportResults(cmd *cobra.Command, logger *slog.Logger) error {
+	format, _ := cmd.Flags().GetString("format")
+	out, _ := cmd.Flags().GetString("out")
+	runID, _ := cmd.Flags().GetString("run")
+	if format != "parquet" {
+		return fmt.Errorf("unknown export format %q (want parquet)", format)
+	}
+	if out == "" {
+		out = "results.parquet"
+	}
+
+	rows, err := collectExport(logger, runRoot(runID))
+	if err != nil {
+		return err
+	}
+	if err := writeParquet(out, rows); err != nil {
+		return err
+	}
+	logger.Info("Exported results", "path", out, "rows", len(rows))
+	return nil
+}
+
+// collectExport flattens every meta.json under root, with the scores from
+// its evaluation.json when there is one.
+func collectExport(logger *slog.Logger, root string) ([]*ExportRow, error) {
+	var rows []*ExportRow
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, e error) error {
+		if e != nil {
+			logger.Error("filepath walk error", "path", p, "err", e)
+			return nil
+		}
+		if d.IsDir() || d.Name() != "meta.json" {
+			return nil
+		}
+		meta, err := loadMeta(p)
+		if err != nil {
+			logger.Error("Skipping unreadable meta", "path", p, "err", err)
+			return nil
+		}
+		row := exportRow(meta)
+		if ev, err := loadEvaluation(evaluationPath(filepath.Dir(p))); err == nil && ev.JudgeModel != "" && ev.Error == "" {
+			row.JudgeModel = &ev.JudgeModel
+			row.Creativity = &ev.Scores.Creativity
+			row.Coherence = &ev.Scores.Coherence
+			row.BackstoryQuality = &ev.Scores.BackstoryQuality
+			if len(ev.Judges) > 1 {
+				row.JudgeAgreement = &ev.Agreement
+			}
+		}
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, err
+}
+
+func exportRow(meta *GenerationMeta) *ExportRow {
+	backend := meta.Backend
+	if backend == "" {
+		backend = llm.NameOllama
+	}
+	return &ExportRow{
+		RunID:          meta.RunID,
+		Model:          meta.Model,
+		Backend:        backend,
+		Tags:           meta.Tags,
+		Task:           meta.Task,
+		Variant:        meta.Variant(),
+		Sample:         int32(max(meta.Sample, 1)),
+		Format:         meta.Format,
+		API:            meta.API,
+		Params:         jsonString(meta.Params),
+		Options:        jsonString(meta.Options),
+		Status:         meta.Status,
+		ErrorKind:      meta.ErrorKind,
+		ConformingJSON: meta.ConformingJSON,
+		Repaired:       meta.Repaired,
+		SelfCorrected:  meta.SelfCorrected,
+		Cached:         meta.Cached,
+		Violations:     int32(len(meta.Violations)),
+		Timestamp:      meta.Timestamp.UnixMilli(),
+		LatencyMS:      meta.LatencyMS,
+		TTFTMS:         meta.TTFTMS,
+		LoadMS:         meta.LoadMS,
+		PromptTokens:   int32(meta.PromptTokens),
+		OutputTokens:   int32(meta.OutputTokens),
+		TokensPerSec:   meta.TokensPerSec,
+		CostUSD:        meta.CostUSD,
+	}
+}
+
+// jsonString renders a map column; empty maps become "".
+func jsonString[M ~map[string]interface{}](m M) string {
+	if len(m) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+func writeParquet(path string, rows []*ExportRow) error {
+	fw, err := local.NewLocalFileWriter(path)
+	if err != nil {
+		return fmt.Errorf("failed to create parquet file: %w", err)
+	}
+	defer fw.Close()
+	pw, err := writer.NewParquetWriter(fw, new(ExportRow), 4)
+	if err != nil {
+		return fmt.Errorf("failed to create parquet writer: %w", err)
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	for _, r := range rows {
+		if err := pw.Write(r); err != nil {
+			return fmt.Errorf("failed to write row: %w", err)
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		return fmt.Errorf("failed to finish parquet file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package oleval
+
+import "github.com/nathanleclaire/gpumon/internal/extract"
+
+// extractor pulls a candidate JSON document out of free-form model output,
+// returning "" if its strategy does not apply.
+type extractor struct {
+	name string
+	fn   func(string) string
+}
+
+// extractors are tried in order; the first non-empty match wins and its name
+// is recorded in GenerationMeta.Extraction.
+var extractors = []extractor{
+	{"fenced", func(text string) string {
+		b, _ := extract.Fence(text, "json", "jsonc", "json5", "")
+		return b.Body
+	}},
+	{"tagged", func(text string) string {
+		b, _ := extract.Tag(text, "json")
+		return b.Body
+	}},
+	{"balanced", extractBalancedObject},
+}
+
+func extractJSON(text string) (string, string) {
+	// JSON drafted inside the reasoning block is not the answer.
+	text = extract.Answer(text)
+	for _, ex := range extractors {
+		if block := ex.fn(text); block != "" {
+			return block, ex.name
+		}
+	}
+	return "", ""
+}
+
+// extractBalancedObject returns the first brace-balanced object in text. A
+// truncated object is returned as-is so the repair stage can close it.
+func extractBalancedObject(text string) string {
+	b, _ := extract.Object(text)
+	return b.Body
+}
@@ -0,0 +1,143 @@
+package oleval
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// grammarPrimitives are the GBNF rules shared by every derived grammar.
+const grammarPrimitives = `ws ::= [ \t\n]*
+string ::= "\"" ( [^"\\\x00-\x1f] | "\\" ( ["\\/bfnrt] | "u" [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] ) )* "\"" ws
+number ::= "-"? ( "0" | [1-9] [0-9]* ) ( "." [0-9]+ )? ( [eE] [-+]? [0-9]+ )? ws
+integer ::= "-"? ( "0" | [1-9] [0-9]* ) ws
+boolean ::= ( "true" | "false" ) ws
+null ::= "null" ws
+value ::= object | array | string | number | boolean | null
+object ::= "{" ws ( string ":" ws value ( "," ws string ":" ws value )* )? "}" ws
+array ::= "[" ws ( value ( "," ws value )* )? "]" ws
+`
+
+// schemaGrammar derives a GBNF grammar, as accepted by llama.cpp's server,
+// that only admits documents of the schema's shape. Required properties are
+// emitted in name order followed by the optional ones; objects without
+// required properties, and length and range bounds, are left unconstrained.
+func schemaGrammar(s *jsonSchema) string {
+	g := &grammarBuilder{rules: map[string]string{}}
+	root := g.rule("root", s)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "root ::= ws %s\n", root)
+	names := make([]string, 0, len(g.rules))
+	for name := range g.rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&sb, "%s ::= %s\n", name, g.rules[name])
+	}
+	sb.WriteString(grammarPrimitives)
+	return sb.String()
+}
+
+type grammarBuilder struct {
+	rules map[string]string
+}
+
+// rule returns the expression matching s, defining named rules for nested
+// objects and arrays.
+func (g *grammarBuilder) rule(name string, s *jsonSchema) string {
+	if s == nil {
+		return "value"
+	}
+	if len(s.Enum) > 0 {
+		alts := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			b, _ := json.Marshal(e)
+			alts[i] = gbnfLiteral(string(b))
+		}
+		return "( " + strings.Join(alts, " | ") + " ) ws"
+	}
+	switch s.Type {
+	case "string", "number", "integer", "boolean", "null":
+		return s.Type
+	case "array":
+		if s.Items == nil {
+			return "array"
+		}
+		item := g.rule(name+"-item", s.Items)
+		g.rules[name+"-array"] = fmt.Sprintf(`"[" ws ( %s ( "," ws %s )* )? "]" ws`, item, item)
+		return name + "-array"
+	case "object":
+		if len(s.Properties) == 0 || len(s.Required) == 0 {
+			return "object"
+		}
+		required := map[string]bool{}
+		for _, r := range s.Required {
+			required[r] = true
+		}
+		var req, opt []string
+		for prop := range s.Properties {
+			if required[prop] {
+				req = append(req, prop)
+			} else {
+				opt = append(opt, prop)
+			}
+		}
+		sort.Strings(req)
+		sort.Strings(opt)
+		member := func(prop string) string {
+			key, _ := json.Marshal(prop)
+			return fmt.Sprintf(`%s ws ":" ws %s`, gbnfLiteral(string(key)), g.rule(name+"-"+ruleName(prop), s.Properties[prop]))
+		}
+		parts := make([]string, 0, len(req)+len(opt))
+		for i, prop := range req {
+			if i > 0 {
+				parts = append(parts, `"," ws`)
+			}
+			parts = append(parts, member(prop))
+		}
+		for _, prop := range opt {
+			parts = append(parts, fmt.Sprintf(`( "," ws %s )?`, member(prop)))
+		}
+		g.rules[name+"-object"] = `"{" ws ` + strings.Join(parts, " ") + ` "}" ws`
+		return name + "-object"
+	default:
+		return "value"
+	}
+}
+
+// gbnfLiteral quotes s as a GBNF string literal.
+func gbnfLiteral(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// ruleName maps a property name onto GBNF's rule name alphabet.
+func ruleName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, s)
+}
+
+// targetSchema is the schema grammar mode constrains to: the task's, the
+// --rules file, or the built-in character schema.
+func targetSchema(cfg genConfig) (*jsonSchema, error) {
+	if cfg.Task != nil && cfg.Task.schema != nil {
+		return cfg.Task.schema, nil
+	}
+	if cfg.Rules != nil {
+		return cfg.Rules, nil
+	}
+	var s jsonSchema
+	if err := json.Unmarshal([]byte(characterSchema), &s); err != nil {
+		return nil, fmt.Errorf("character schema: %w", err)
+	}
+	return &s, nil
+}
@@ -0,0 +1,117 @@
+package oleval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// judgePromptVersion is bumped whenever judgeRubric changes so scores from
+// different rubrics are never compared as if they were the same measurement.
+const judgePromptVersion = "v1"
+
+const judgeRubric = `
+You are judging an RPG character generated by another language model. Score
+the character on each criterion with an integer from 1 (poor) to 10 (excellent):
+
+- creativity: how original and surprising the concept, class, and equipment are.
+- coherence: how well the class, equipment, properties, and backstory fit together.
+- backstory_quality: how vivid, specific, and well written the backstory is.
+
+Respond ONLY with a JSON object of the form:
+{"creativity": <int>, "coherence": <int>, "backstory_quality": <int>, "rationale": "<one or two sentences>"}
+
+Character:
+`
+
+type JudgeScores struct {
+	Creativity       float64 `json:"creativity"`
+	Coherence        float64 `json:"coherence"`
+	BackstoryQuality float64 `json:"backstory_quality"`
+}
+
+// Evaluation is the judge's verdict on one result.json, stored beside it as
+// evaluation.json.
+type Evaluation struct {
+	JudgeModel    string      `json:"judge_model"`
+	PromptVersion string      `json:"prompt_version"`
+	Timestamp     time.Time   `json:"timestamp"`
+	Scores        JudgeScores `json:"scores"`
+	Rationale     string      `json:"rationale,omitempty"`
+	Error         string      `json:"error,omitempty"`
+	// Judges, Aggregation and Agreement are set for a judge ensemble, whose
+	// Scores are the aggregate of the members'.
+	Judges      []judgeVerdict `json:"judges,omitempty"`
+	Aggregation string         `json:"aggregation,omitempty"`
+	Agreement   float64        `json:"agreement,omitempty"`
+	// Embedding is filled by evaluate --embed-model.
+	Embedding *embeddingMetrics `json:"embedding,omitempty"`
+}
+
+type judge struct {
+	client *llm.Ollama
+	model  string
+	cache  *responseCache
+	logger *slog.Logger
+}
+
+func (j *judge) Score(ctx context.Context, c *Character) (*Evaluation, error) {
+	ctx, span := otel.Tracer("character-generator").Start(ctx, "judge_score",
+		trace.WithAttributes(
+			attribute.String("judge.model", j.model),
+			attribute.String("judge.prompt_version", judgePromptVersion),
+		),
+	)
+	defer span.End()
+
+	charJSON, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal character: %w", err)
+	}
+	var out strings.Builder
+	_, _, cached, err := j.cache.complete(ctx, j.client, j.model, judgeRubric+string(charJSON),
+		json.RawMessage(`"json"`), map[string]interface{}{"temperature": 0}, genConfig{API: "generate", Logger: j.logger},
+		func(chunk string) { out.WriteString(chunk) })
+	span.SetAttributes(attribute.Bool("judge.cached", cached))
+	ev := &Evaluation{
+		JudgeModel:    j.model,
+		PromptVersion: judgePromptVersion,
+		Timestamp:     time.Now(),
+	}
+	if err != nil {
+		span.RecordError(err)
+		ev.Error = fmt.Sprintf("judge generation error: %v", err)
+		return ev, nil
+	}
+
+	var verdict struct {
+		JudgeScores
+		Rationale string `json:"rationale"`
+	}
+	if e := json.Unmarshal([]byte(strings.TrimSpace(out.String())), &verdict); e != nil {
+		span.RecordError(e)
+		ev.Error = fmt.Sprintf("judge unmarshal error: %v", e)
+		return ev, nil
+	}
+	ev.Scores = verdict.JudgeScores
+	ev.Rationale = verdict.Rationale
+	span.SetAttributes(
+		attribute.Float64("judge.creativity", ev.Scores.Creativity),
+		attribute.Float64("judge.coherence", ev.Scores.Coherence),
+		attribute.Float64("judge.backstory_quality", ev.Scores.BackstoryQuality),
+	)
+	return ev, nil
+}
+
+func evaluationPath(dir string) string {
+	return filepath.Join(dir, "evaluation.json")
+}
@@ -0,0 +1,1796 @@
+package oleval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/internal/extract"
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"github.com/nathanleclaire/gpumon/internal/logging"
+	"github.com/nathanleclaire/gpumon/internal/plugins"
+	"github.com/nathanleclaire/gpumon/pkg/collector"
+	"github.com/ollama/ollama/api"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Character struct {
+	Class      string                 `json:"class"`
+	Equipment  []string               `json:"equipment"`
+	Properties map[string]interface{} `json:"properties"`
+	Backstory  string                 `json:"backstory"`
+	Extra      map[string]interface{} `json:"extra,omitempty"`
+}
+
+type GenerationMeta struct {
+	RunID          string                 `json:"run_id,omitempty"`
+	Task           string                 `json:"task,omitempty"`
+	Backend        string                 `json:"backend,omitempty"`
+	PromptVariant  string                 `json:"prompt_variant,omitempty"`
+	Sample         int                    `json:"sample,omitempty"`
+	Model          string                 `json:"model"`
+	Tags           []string               `json:"tags"`
+	Timestamp      time.Time              `json:"timestamp"`
+	Think          string                 `json:"think,omitempty"`
+	Format         string                 `json:"format,omitempty"`
+	API            string                 `json:"api,omitempty"`
+	Status         string                 `json:"status,omitempty"`
+	Params         paramSet               `json:"params,omitempty"`
+	Options        map[string]interface{} `json:"options,omitempty"`
+	LatencyMS      float64                `json:"latency_ms,omitempty"`
+	TTFTMS         float64                `json:"ttft_ms,omitempty"`
+	Cached         bool                   `json:"cached,omitempty"`
+	PromptTokens   int                    `json:"prompt_tokens,omitempty"`
+	OutputTokens   int                    `json:"output_tokens,omitempty"`
+	TokensPerSec   float64                `json:"tokens_per_sec,omitempty"`
+	LoadMS         float64                `json:"load_ms,omitempty"`
+	TotalMS        float64                `json:"total_ms,omitempty"`
+	CostUSD        float64                `json:"cost_usd,omitempty"`
+	GPU            *gpuMeta               `json:"gpu,omitempty"`
+	Attempts       int                    `json:"attempts,omitempty"`
+	ErrorKind      string                 `json:"error_kind,omitempty"`
+	ConformingJSON bool                   `json:"conforming_json"`
+	Turns          []turnMeta             `json:"turns,omitempty"`
+	Corrections    []turnMeta             `json:"corrections,omitempty"`
+	SelfCorrected  bool                   `json:"self_corrected,omitempty"`
+	Consistency    float64                `json:"consistency,omitempty"`
+	Repaired       bool                   `json:"repaired,omitempty"`
+	Extraction     string                 `json:"extraction,omitempty"`
+	Violations     []string               `json:"violations,omitempty"`
+	ParseError     string                 `json:"parse_error,omitempty"`
+	// TraceID and SpanID identify the model_inference span that produced
+	// the result; evaluate links its spans back to it.
+	TraceID string `json:"trace_id,omitempty"`
+	SpanID  string `json:"span_id,omitempty"`
+
+	// raw is the full streamed output, saved as raw.txt.
+	raw string
+}
+
+// characterSchema is the JSON schema passed as Ollama's structured-output
+// format when generating with --format schema.
+const characterSchema = `{
+  "type": "object",
+  "properties": {
+    "class": {"type": "string"},
+    "equipment": {"type": "array", "items": {"type": "string"}},
+    "properties": {
+      "type": "object",
+      "properties": {
+        "strength": {"type": "integer"},
+        "dexterity": {"type": "integer"}
+      },
+      "required": ["strength", "dexterity"]
+    },
+    "backstory": {"type": "string"},
+    "extra": {"type": "object"}
+  },
+  "required": ["class", "equipment", "properties", "backstory"]
+}`
+
+// genConfig holds the per-run settings shared by every model generation.
+type genConfig struct {
+	Format  string
+	Retries int
+	Backoff time.Duration
+	Timeout time.Duration
+	// SkipExisting skips combinations that already have a meta.json;
+	// Resume skips only those whose stored result conformed.
+	SkipExisting bool
+	Resume       bool
+	// Options are user-supplied model options applied on top of the defaults
+	// and beneath any swept parameters.
+	Options map[string]interface{}
+	Store   *sqlStore
+	RunID   string
+	// Prompt overrides the built-in character prompt when set.
+	Prompt  string
+	Samples int
+	// Rules, when set, replaces the built-in character checks.
+	Rules *jsonSchema
+	// API selects Ollama's generate or chat endpoint. System and History
+	// are sent ahead of the prompt.
+	API     string
+	System  string
+	History []api.Message
+	// Prices, when set, are applied to each generation's token counts.
+	Prices priceTable
+	// GPUInterval, when positive, samples GPUs from GPUs during each
+	// generation.
+	GPUInterval time.Duration
+	GPUs        collector.Collector
+	// Task is the suite task being run; nil means the built-in character
+	// prompt.
+	Task *Task
+	// Turns are follow-up prompts sent after the first answer in the same
+	// conversation. Context carries /api/generate's conversation state.
+	Turns   []string
+	Context []int
+	// State checkpoints finished combinations for --recover.
+	State *runState
+	// Corrections is how many times a non-conforming answer is sent back
+	// with its error for the model to fix.
+	Corrections int
+	// Sample is the sample number, part of the response cache key.
+	Sample int
+	// Cache, when set, answers repeated requests from disk.
+	Cache *responseCache
+	// Grammar is the GBNF grammar sent to backends that support
+	// grammar-constrained decoding.
+	Grammar string
+	// Ablation, when set, builds the prompt from its base with each
+	// --ablate factor switched on or off.
+	Ablation ablation
+	// Dashboard, when set, shows progress in place of the streamed output.
+	Dashboard *dashboard
+	// Logger receives the run's logs; the dashboard sends them to a file.
+	Logger *slog.Logger
+}
+
+// Generation statuses recorded in GenerationMeta.Status and on spans.
+const (
+	statusSuccess = "success"
+	statusPartial = "partial"
+	statusFailed  = "failed"
+	statusTimeout = "timeout"
+	// statusInterrupted marks a generation cut short by Ctrl+C.
+	statusInterrupted = "interrupted"
+)
+
+// Error kinds recorded in GenerationMeta.ErrorKind besides the transport and
+// status kinds from llm.ClassifyError. These are never retried.
+const (
+	errKindParse      = "parse"
+	errKindValidation = "validation"
+)
+
+// ErrInterrupted is returned by commands stopped by SIGINT/SIGTERM after
+// they have saved what they had.
+var ErrInterrupted = errors.New("interrupted")
+
+// ServiceName is the default service.name for the eval commands.
+const ServiceName = "character-generator"
+
+// NewCommand returns the eval command tree, logging to logger. The log
+// level and telemetry come from the root command's flags, through viper.
+func NewCommand(logger *slog.Logger) *cobra.Command {
+	rootCmd := &cobra.Command{
+		Use:   "eval",
+		Short: "Generate RPG characters with local models and evaluate, compare and report on them",
+	}
+	generateCmd := &cobra.Command{
+		Use:   "generate",
+		Short: "Generate RPG characters for each model and tags",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return generateCharacters(cmd, logger)
+		},
+	}
+	evaluateCmd := &cobra.Command{
+		Use:   "evaluate",
+		Short: "Evaluate stored character data",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return evaluateResults(cmd, logger)
+		},
+	}
+	reportCmd := &cobra.Command{
+		Use:   "report",
+		Short: "Aggregate stored results per model into a shareable table",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return reportResults(cmd, logger)
+		},
+	}
+	diffCmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Compare conformance and judge scores per model between two runs",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return diffRuns(cmd, logger)
+		},
+	}
+	benchCmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Measure tokens/sec, time to first token and load time per model with a fixed prompt",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBench(cmd, logger)
+		},
+	}
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete old runs, failed results, or every result of a removed model",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return pruneResults(cmd, logger)
+		},
+	}
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Flatten every stored result into one file for analysis in pandas or DuckDB",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exportResults(cmd, logger)
+		},
+	}
+	trackCmd := &cobra.Command{
+		Use:   "track",
+		Short: "Log a run's parameters, per-model metrics and results to an MLflow tracking server",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return trackRun(cmd, logger)
+		},
+	}
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve POST /generate, running one generation through the full parse and validation pipeline",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return serveGenerate(cmd, logger)
+		},
+	}
+	serveUICmd := &cobra.Command{
+		Use:   "serve-ui",
+		Short: "Browse runs, scores, characters and think blocks in a local web UI",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return serveUI(cmd, logger)
+		},
+	}
+	rootCmd.AddCommand(generateCmd, evaluateCmd, reportCmd, diffCmd, benchCmd, pruneCmd, exportCmd, trackCmd, serveCmd, serveUICmd)
+
+	_ = viper.BindEnv("ollama.addr", "OLLAMA_HOST")
+	rootCmd.PersistentFlags().String("ollama-addr", "",
+		"Ollama server address, e.g. http://gpu-box:11434 (defaults from env OLLAMA_HOST if set, else localhost:11434)")
+	_ = viper.BindPFlag("ollama.addr", rootCmd.PersistentFlags().Lookup("ollama-addr"))
+	rootCmd.PersistentFlags().StringSlice("models", nil, "List of models (fallback to discovering locally)")
+	_ = viper.BindPFlag("models", rootCmd.PersistentFlags().Lookup("models"))
+
+	rootCmd.PersistentFlags().StringSlice("tags", nil, "List of tags (fallback to 'default-tag')")
+	_ = viper.BindPFlag("tags", rootCmd.PersistentFlags().Lookup("tags"))
+
+	rootCmd.PersistentFlags().Bool("no-cache", false, "Always call the model instead of reusing cached responses to identical requests")
+	_ = viper.BindPFlag("no.cache", rootCmd.PersistentFlags().Lookup("no-cache"))
+	rootCmd.PersistentFlags().String("cache-dir", "", "Response cache directory (default <out-dir>/.cache)")
+	_ = viper.BindPFlag("cache.dir", rootCmd.PersistentFlags().Lookup("cache-dir"))
+
+	rootCmd.PersistentFlags().String("rules", "", "JSON Schema file of validation rules (default: built-in character checks)")
+	_ = viper.BindPFlag("rules", rootCmd.PersistentFlags().Lookup("rules"))
+
+	rootCmd.PersistentFlags().String("store", "", "Also record results in a database, e.g. sqlite://results.db")
+	_ = viper.BindPFlag("store", rootCmd.PersistentFlags().Lookup("store"))
+
+	_ = viper.BindEnv("out.dir", "OLEVAL_OUT_DIR")
+	rootCmd.PersistentFlags().String("out-dir", "gens", "Directory holding run results (defaults from env OLEVAL_OUT_DIR if set)")
+	_ = viper.BindPFlag("out.dir", rootCmd.PersistentFlags().Lookup("out-dir"))
+
+	rootCmd.PersistentFlags().String("prices", "", "YAML/JSON price table (USD per million prompt/completion tokens per model) used to cost generations")
+	_ = viper.BindPFlag("prices", rootCmd.PersistentFlags().Lookup("prices"))
+
+	generateCmd.Flags().Bool("all-models", false, "Use all local models from Ollama")
+	generateCmd.Flags().String("models-csv", "", "Comma-separated model names")
+	generateCmd.Flags().String("include-regex", "", "Only run models whose name matches this regexp")
+	generateCmd.Flags().StringArray("exclude", nil, "Skip models whose name matches this regexp, e.g. embed or :q4_ (repeatable)")
+	generateCmd.Flags().StringArray("openai-model", nil, "Model served by the OpenAI-compatible API at --openai-addr, run alongside the Ollama models (repeatable)")
+	_ = viper.BindEnv("openai.addr", "OPENAI_BASE_URL")
+	_ = viper.BindEnv("openai.key", "OPENAI_API_KEY")
+	generateCmd.Flags().String("openai-addr", "", "Base URL of the OpenAI-compatible API (defaults from env OPENAI_BASE_URL if set, else "+llm.DefaultOpenAIAddr+"); the key is read from OPENAI_API_KEY")
+	_ = viper.BindPFlag("openai.addr", generateCmd.Flags().Lookup("openai-addr"))
+	generateCmd.Flags().StringArray("model-addr", nil, "Send one model to a different Ollama server, as model=address (repeatable)")
+	generateCmd.Flags().StringArray("plugin-model", nil, "Model served by a backend plugin, as model=plugin, run alongside the Ollama models (repeatable; see gpumon plugins)")
+	generateCmd.Flags().String("format", "", "Structured output mode: json, schema, or grammar (GBNF derived from the schema, llama.cpp servers only) (default free-form)")
+	generateCmd.Flags().Int("correct", 0, "Send a non-conforming answer's error back to the model up to this many times; self-correction is reported apart from first-shot conformance")
+	generateCmd.Flags().Bool("compare-grammar", false, "Also run every OpenAI-compatible model with --format grammar, to compare conformance with and without constrained decoding")
+	generateCmd.Flags().Int("retries", 2, "Retries for transport/stream errors (parse errors are never retried)")
+	generateCmd.Flags().Duration("retry-backoff", 2*time.Second, "Initial backoff between retries; doubles each attempt")
+	generateCmd.Flags().Duration("timeout", 0, "Per-model generation timeout (0 disables)")
+	generateCmd.Flags().StringArray("sweep", nil, "Sweep a model option over values, e.g. temperature=0.2,0.7,1.0 (repeatable)")
+	generateCmd.Flags().Int("seed", 0, "Sampling seed for reproducible generations (0 leaves it unset)")
+	generateCmd.Flags().Int("num-predict", 0, "Maximum tokens to generate (0 leaves it unset)")
+	generateCmd.Flags().Int("top-k", 0, "Top-k sampling (0 leaves it unset)")
+	generateCmd.Flags().StringArray("stop", nil, "Stop sequence (repeatable)")
+	generateCmd.Flags().StringArray("option", nil, "Arbitrary model option as key=value (repeatable)")
+	generateCmd.Flags().String("api", "generate", "Ollama endpoint: generate or chat (chat applies the model's chat template)")
+	generateCmd.Flags().String("system-prompt", "", "System prompt sent with each generation")
+	generateCmd.Flags().String("history-file", "", "JSON file of prior chat messages ([{\"role\":...,\"content\":...}]) sent before the prompt (chat API only)")
+	generateCmd.Flags().StringArray("turn", nil, "Follow-up prompt sent in the same conversation after the first answer, e.g. \"Level up this character and return the updated JSON\" (repeatable)")
+	generateCmd.Flags().String("suite", "", "Directory of tasks (subdirectories with task.yaml) to run instead of the built-in character prompt")
+	generateCmd.Flags().String("experiment", "", "YAML experiment file declaring models, tags, prompt, options, sweeps and samples")
+	generateCmd.Flags().Int("samples", 1, "Generations per model, tag and parameter combination")
+	generateCmd.Flags().String("run-id", "", "Run ID to write under --out-dir (default: new timestamped ID, or the latest run with --skip-existing/--resume)")
+	generateCmd.Flags().Bool("skip-existing", false, "Skip model/tag combinations that already have results on disk")
+	generateCmd.Flags().Bool("resume", false, "Skip combinations with a conforming result; retry only failed ones")
+	generateCmd.Flags().Duration("gpu-sample-interval", 0, "Sample GPU utilization and VRAM from --collector at this interval during each generation (0 disables)")
+	generateCmd.Flags().String("recover", "", "Resume a crashed or killed run by ID with its original flags, skipping combinations its state.json records as completed")
+	generateCmd.Flags().Bool("dashboard", false, "Show a live table of per-model status, tokens, elapsed time and conformance instead of the streamed output; logs go to the run's generate.log")
+	generateCmd.Flags().StringSlice("ablate", nil, "Prompt factors to run both with and without: think (\"think step by step\"), schema (JSON Schema in the prompt)")
+
+	evaluateCmd.Flags().StringSlice("judge-model", nil, "Score each character with this judge model; several form an ensemble aggregated by --judge-agg (skipped if empty)")
+	evaluateCmd.Flags().String("judge-agg", "mean", "How an ensemble's scores are combined: mean, median, or majority")
+	evaluateCmd.Flags().String("embed-model", "", "Embed backstories with this Ollama model and record similarity and clustering metrics (skipped if empty)")
+	evaluateCmd.Flags().Int("workers", 4, "Number of results evaluated concurrently")
+	evaluateCmd.Flags().String("run", "", "Only evaluate this run ID (default: every run)")
+
+	reportCmd.Flags().String("output", "markdown", "Output format: markdown, csv, or json")
+	reportCmd.Flags().String("sort", "conformance", "Sort column: model, conformance, creativity, coherence, backstory, latency, speed (tokens/sec), ttft, think, diversity, consistency, self-correct, cost (per conforming result)")
+	reportCmd.Flags().Bool("desc", true, "Sort descending")
+	reportCmd.Flags().String("run", "", "Only report on this run ID (default: every run)")
+	reportCmd.Flags().String("embed-model", "", "Score diversity by embedding cosine similarity with this Ollama model (default: word-trigram overlap)")
+	reportCmd.Flags().Bool("ablation", false, "Report the conformance effect of each --ablate prompt factor, and of --compare-grammar, per model instead (markdown or json)")
+	reportCmd.Flags().String("save-dir", "", "Also write report.md, report.csv and report.json into this directory")
+
+	diffCmd.Flags().StringArray("run", nil, "Run ID or results directory to compare; pass exactly twice (A then B)")
+	diffCmd.Flags().Float64("threshold", 0.05, "Drop in conformance rate (or judge score / 10) counted as a regression")
+	diffCmd.Flags().Bool("fail-on-regression", false, "Exit non-zero if any regression is found")
+
+	benchCmd.Flags().Int("repetitions", 5, "Runs of the prompt per model")
+	benchCmd.Flags().String("prompt", defaultBenchPrompt, "Fixed prompt sent on every repetition")
+	benchCmd.Flags().Int("num-predict", 128, "Tokens to generate per repetition")
+	benchCmd.Flags().Bool("all-models", false, "Bench every local model")
+	benchCmd.Flags().String("include-regex", "", "Only bench models whose name matches this regexp")
+	benchCmd.Flags().StringArray("exclude", nil, "Skip models whose name matches this regexp (repeatable)")
+	benchCmd.Flags().String("run-id", "", "Run ID to write under --out-dir (default: new timestamped ID)")
+
+	pruneCmd.Flags().Duration("older-than", 0, "Select runs created longer ago than this, e.g. 720h")
+	pruneCmd.Flags().Bool("failed-only", false, "Remove only failed, timed-out and interrupted results")
+	pruneCmd.Flags().StringArray("model", nil, "Remove only this model's results (repeatable)")
+	pruneCmd.Flags().String("run", "", "Only prune this run ID; on its own, removes the whole run")
+	pruneCmd.Flags().Bool("dry-run", false, "List what would be removed without deleting anything")
+
+	exportCmd.Flags().String("format", "parquet", "Export format: parquet")
+	exportCmd.Flags().String("out", "results.parquet", "File to write")
+	exportCmd.Flags().String("run", "", "Only export this run ID (default: every run)")
+
+	_ = viper.BindEnv("mlflow.uri", "MLFLOW_TRACKING_URI")
+	trackCmd.Flags().String("mlflow-uri", "", "MLflow tracking server, e.g. http://localhost:5000 (defaults from env MLFLOW_TRACKING_URI if set)")
+	_ = viper.BindPFlag("mlflow.uri", trackCmd.Flags().Lookup("mlflow-uri"))
+	trackCmd.Flags().String("run", "", "Run ID to log (default: the latest run)")
+	trackCmd.Flags().String("experiment", "", "MLflow experiment, created if missing (default: the run's experiment name, else oleval)")
+	trackCmd.Flags().Bool("artifacts", true, "Also upload the report and every result.json (needs a server proxying artifacts)")
+
+	serveCmd.Flags().String("addr", "localhost:8091", "Address to listen on")
+	serveCmd.Flags().Int("retries", 2, "Retries for transport/stream errors (parse errors are never retried)")
+	serveCmd.Flags().Duration("retry-backoff", 2*time.Second, "Initial backoff between retries; doubles each attempt")
+	serveCmd.Flags().Duration("timeout", 5*time.Minute, "Default per-request generation timeout, overridable by the request (0 disables)")
+
+	serveUICmd.Flags().String("addr", "localhost:8090", "Address to listen on")
+
+	// Shell completion for flags taking one of a fixed set of values, or a
+	// run ID.
+	noFiles := cobra.ShellCompDirectiveNoFileComp
+	_ = generateCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"json", "schema", "grammar"}, noFiles))
+	_ = generateCmd.RegisterFlagCompletionFunc("api", cobra.FixedCompletions([]string{"generate", "chat"}, noFiles))
+	_ = generateCmd.RegisterFlagCompletionFunc("ablate", cobra.FixedCompletions([]string{"think", "schema"}, noFiles))
+	_ = evaluateCmd.RegisterFlagCompletionFunc("judge-agg", cobra.FixedCompletions([]string{"mean", "median", "majority"}, noFiles))
+	_ = reportCmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions([]string{"markdown", "csv", "json"}, noFiles))
+	_ = reportCmd.RegisterFlagCompletionFunc("sort", cobra.FixedCompletions([]string{"model", "conformance", "creativity", "coherence",
+		"backstory", "latency", "speed", "ttft", "think", "diversity", "consistency", "self-correct", "cost"}, noFiles))
+	_ = exportCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"parquet"}, noFiles))
+	_ = generateCmd.RegisterFlagCompletionFunc("run-id", completeRunIDs)
+	_ = generateCmd.RegisterFlagCompletionFunc("recover", completeRunIDs)
+	for _, c := range []*cobra.Command{evaluateCmd, reportCmd, pruneCmd, exportCmd, trackCmd} {
+		_ = c.RegisterFlagCompletionFunc("run", completeRunIDs)
+	}
+	// diff also takes results directories.
+	_ = diffCmd.RegisterFlagCompletionFunc("run", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		ids, _ := runIDs()
+		return ids, cobra.ShellCompDirectiveDefault
+	})
+	return rootCmd
+}
+
+// interruptContext is cancelled by the first SIGINT or SIGTERM so in-flight
+// work can be saved and traces flushed; a second signal kills the process
+// as usual. Spans started from it are children of any span in parent.
+func interruptContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(parent, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+func generateCharacters(cmd *cobra.Command, logger *slog.Logger) error {
+	ctx, stop := interruptContext(cmd.Context())
+	defer stop()
+
+	cfg := genConfig{Logger: logger}
+	var err error
+	if recoverID, _ := cmd.Flags().GetString("recover"); recoverID != "" {
+		if cfg.State, err = loadRunState(recoverID); err != nil {
+			return err
+		}
+		if err := cfg.State.restoreFlags(cmd); err != nil {
+			return err
+		}
+		logger.Info("Recovering run", "run_id", recoverID, "completed", len(cfg.State.Completed), "args", cfg.State.Args)
+	}
+	allModelsFlag, _ := cmd.Flags().GetBool("all-models")
+	modelsCSV, _ := cmd.Flags().GetString("models-csv")
+	cfg.Format, _ = cmd.Flags().GetString("format")
+	if _, err := formatField(cfg.Format); err != nil {
+		return err
+	}
+	cfg.Retries, _ = cmd.Flags().GetInt("retries")
+	cfg.Backoff, _ = cmd.Flags().GetDuration("retry-backoff")
+	cfg.Timeout, _ = cmd.Flags().GetDuration("timeout")
+	cfg.SkipExisting, _ = cmd.Flags().GetBool("skip-existing")
+	cfg.Resume, _ = cmd.Flags().GetBool("resume")
+	cfg.GPUInterval, _ = cmd.Flags().GetDuration("gpu-sample-interval")
+	cfg.Corrections, _ = cmd.Flags().GetInt("correct")
+	factors, _ := cmd.Flags().GetStringSlice("ablate")
+	prompts, err := ablations(factors)
+	if err != nil {
+		return err
+	}
+	if cfg.Options, err = optionsFromFlags(cmd); err != nil {
+		return err
+	}
+	cfg.API, _ = cmd.Flags().GetString("api")
+	cfg.System, _ = cmd.Flags().GetString("system-prompt")
+	historyFile, _ := cmd.Flags().GetString("history-file")
+	if cfg.API != "generate" && cfg.API != "chat" {
+		return fmt.Errorf("unknown api %q (want generate or chat)", cfg.API)
+	}
+	if historyFile != "" {
+		if cfg.API != "chat" {
+			return errors.New("--history-file requires --api chat")
+		}
+		if cfg.History, err = loadHistory(historyFile); err != nil {
+			return err
+		}
+	}
+	cfg.Samples, _ = cmd.Flags().GetInt("samples")
+	cfg.Turns, _ = cmd.Flags().GetStringArray("turn")
+	sweeps, _ := cmd.Flags().GetStringArray("sweep")
+	suiteDir, _ := cmd.Flags().GetString("suite")
+	ollamaAddr := ""
+	remoteModels, _ := cmd.Flags().GetStringArray("openai-model")
+	openAIAddr := viper.GetString("openai.addr")
+	openAIKey := viper.GetString("openai.key")
+	modelAddrSpecs, _ := cmd.Flags().GetStringArray("model-addr")
+	modelAddrs, err := parseModelAddrs(modelAddrSpecs)
+	if err != nil {
+		return err
+	}
+	pluginModelSpecs, _ := cmd.Flags().GetStringArray("plugin-model")
+	pluginModels, err := parsePluginModels(pluginModelSpecs)
+	if err != nil {
+		return err
+	}
+	var exp *Experiment
+	if expPath, _ := cmd.Flags().GetString("experiment"); expPath != "" {
+		if exp, err = loadExperiment(expPath); err != nil {
+			return err
+		}
+		if err := exp.apply(cmd, &cfg); err != nil {
+			return err
+		}
+		if !cmd.Flags().Changed("sweep") {
+			sweeps = exp.sweepSpecs()
+		}
+		if exp.Backend.Address != "" && !cmd.Flags().Changed("ollama-addr") {
+			ollamaAddr = exp.Backend.Address
+		}
+		for m, addr := range exp.Backend.Models {
+			if _, set := modelAddrs[m]; !set {
+				modelAddrs[m] = addr
+			}
+		}
+		if exp.Suite != "" && !cmd.Flags().Changed("suite") {
+			suiteDir = exp.Suite
+		}
+		remoteModels = append(remoteModels, exp.OpenAI.Models...)
+		if exp.OpenAI.Address != "" && !cmd.Flags().Changed("openai-addr") {
+			openAIAddr = exp.OpenAI.Address
+		}
+		if exp.OpenAI.APIKeyEnv != "" {
+			openAIKey = os.Getenv(exp.OpenAI.APIKeyEnv)
+		}
+		if _, err := formatField(cfg.Format); err != nil {
+			return err
+		}
+	}
+	if cfg.Samples < 1 {
+		cfg.Samples = 1
+	}
+	formats := []string{cfg.Format}
+	if compareGrammar, _ := cmd.Flags().GetBool("compare-grammar"); compareGrammar && cfg.Format != "grammar" {
+		formats = append(formats, "grammar")
+	}
+	paramSets, err := parseSweeps(sweeps)
+	if err != nil {
+		return err
+	}
+	if rulesPath := viper.GetString("rules"); rulesPath != "" {
+		if cfg.Rules, err = loadSchema(rulesPath); err != nil {
+			return err
+		}
+	}
+	if pricesPath := viper.GetString("prices"); pricesPath != "" {
+		if cfg.Prices, err = loadPrices(pricesPath); err != nil {
+			return err
+		}
+	}
+	tasks := []*Task{nil}
+	if suiteDir != "" {
+		if tasks, err = loadSuite(suiteDir); err != nil {
+			return err
+		}
+	}
+	if cfg.Store, err = openStore(viper.GetString("store")); err != nil {
+		return err
+	}
+	defer cfg.Store.Close()
+	if cfg.Cache, err = openResponseCache(); err != nil {
+		return err
+	}
+	defer cfg.Cache.logStats(logger)
+
+	clients := &backends{
+		ollama:  newOllamaClients(ollamaAddr, modelAddrs),
+		openai:  llm.NewOpenAI(openAIAddr, openAIKey),
+		remote:  map[string]bool{},
+		plugin:  pluginModels,
+		plugins: plugins.NewBackends(logger),
+	}
+	defer clients.plugins.Close()
+	for _, m := range remoteModels {
+		clients.remote[m] = true
+	}
+	if cfg.GPUInterval > 0 {
+		gpus, stop, err := plugins.OpenCollector(ctx, logger)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		cfg.GPUs = gpus
+	}
+	client, err := newOllamaClient(ollamaAddr)
+	if err != nil {
+		return err
+	}
+
+	// Create a root span for the entire "generate" command.
+	ctx, span := otel.Tracer("character-generator").Start(ctx, "command_generate")
+	defer span.End()
+
+	var models []string
+	localFlags := allModelsFlag || modelsCSV != "" || len(viper.GetStringSlice("models")) > 0
+	if exp != nil && len(exp.Models) > 0 && !localFlags {
+		models = exp.Models
+	} else if localFlags || len(remoteModels) == 0 && len(pluginModels) == 0 {
+		// With only remote or plugin models requested, don't also discover
+		// local ones.
+		var modelErr error
+		models, modelErr = pickModels(ctx, client.Client(), allModelsFlag, modelsCSV)
+		if modelErr != nil {
+			span.RecordError(modelErr)
+			return modelErr
+		}
+	}
+	for _, m := range remoteModels {
+		if !slices.Contains(models, m) {
+			models = append(models, m)
+		}
+	}
+	for _, m := range slices.Sorted(maps.Keys(pluginModels)) {
+		if !slices.Contains(models, m) {
+			models = append(models, m)
+		}
+	}
+	include, _ := cmd.Flags().GetString("include-regex")
+	excludes, _ := cmd.Flags().GetStringArray("exclude")
+	if models, err = filterModels(logger, models, include, excludes); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	tags := viper.GetStringSlice("tags")
+	if len(tags) == 0 && exp != nil {
+		tags = exp.Tags
+	}
+	if len(tags) == 0 {
+		tags = []string{"default-tag"}
+		logger.Info("No tags specified; using fallback", "tags", tags)
+	}
+
+	cfg.RunID, _ = cmd.Flags().GetString("run-id")
+	if cfg.RunID == "" && (cfg.SkipExisting || cfg.Resume) {
+		// Skipping only makes sense against an earlier run's results.
+		if cfg.RunID, err = latestRunID(); err != nil {
+			return fmt.Errorf("--skip-existing/--resume: %w", err)
+		}
+	}
+	if cfg.RunID == "" {
+		cfg.RunID = newRunID(models, tags)
+	}
+	if _, err := os.Stat(filepath.Join(runRoot(cfg.RunID), "manifest.json")); os.IsNotExist(err) {
+		manifest := &RunManifest{
+			RunID:      cfg.RunID,
+			CreatedAt:  time.Now(),
+			Models:     models,
+			Tags:       tags,
+			Format:     cfg.Format,
+			Formats:    formats,
+			API:        cfg.API,
+			Sweeps:     sweeps,
+			Options:    cfg.Options,
+			Samples:    cfg.Samples,
+			Suite:      suiteDir,
+			Tasks:      taskNames(tasks),
+			Ablate:     factors,
+			PromptHash: promptHash(cfg.Prompt, tasks),
+			GitSHA:     gitSHA(),
+		}
+		if exp != nil {
+			manifest.Experiment = exp.Name
+		}
+		if err := writeManifest(manifest); err != nil {
+			span.RecordError(err)
+			return err
+		}
+	}
+	if cfg.State == nil {
+		if cfg.State, err = loadRunState(cfg.RunID); err != nil {
+			// A new run, or one from before checkpoints were kept.
+			cfg.State = &runState{RunID: cfg.RunID, Args: os.Args[1:], StartedAt: time.Now(), Completed: map[string]time.Time{}}
+		}
+		cfg.State.Done = false
+		if err := cfg.State.save(); err != nil {
+			return err
+		}
+	}
+	logger.Info("Run", "run_id", cfg.RunID, "dir", runRoot(cfg.RunID))
+
+	span.SetAttributes(
+		attribute.String("run.id", cfg.RunID),
+		attribute.StringSlice("all.models", models),
+		attribute.StringSlice("tags", tags),
+		attribute.String("format", cfg.Format),
+		attribute.Int("retries", cfg.Retries),
+		attribute.String("timeout", cfg.Timeout.String()),
+		attribute.StringSlice("sweeps", sweeps),
+	)
+
+	if showDashboard, _ := cmd.Flags().GetBool("dashboard"); showDashboard {
+		totals := map[string]int{}
+		for _, m := range models {
+			client, err := clients.forModel(ctx, m)
+			if err != nil {
+				return err
+			}
+			n := 0
+			for _, format := range formats {
+				if format != "grammar" || client.Name() == llm.NameOpenAI {
+					n++
+				}
+			}
+			totals[m] = len(tasks) * len(prompts) * n * len(paramSets) * cfg.Samples
+		}
+		// Logs would scroll the table away; send them to the run directory.
+		logPath := filepath.Join(runRoot(cfg.RunID), "generate.log")
+		logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("dashboard log: %w", err)
+		}
+		defer logFile.Close()
+		h, err := logging.NewHandler(logFile, viper.GetString("log.format"), nil)
+		if err != nil {
+			return err
+		}
+		prevLogger := logger
+		logger = slog.New(h)
+		cfg.Logger = logger
+		cfg.Dashboard = newDashboard(os.Stdout, models, totals)
+		defer cfg.Dashboard.Close()
+		prevLogger.Info("Dashboard on; logging to file", "path", logPath)
+	}
+
+	for _, task := range tasks {
+		tcfg := cfg
+		tcfg.Task = task
+		if task != nil && task.schema != nil {
+			tcfg.Rules = task.schema
+		}
+		if task != nil && len(task.Turns) > 0 {
+			tcfg.Turns = task.Turns
+		}
+		for _, m := range models {
+			client, err := clients.forModel(ctx, m)
+			if err != nil {
+				return err
+			}
+			for _, abl := range prompts {
+				tcfg.Ablation = abl
+				for _, format := range formats {
+					if format == "grammar" && client.Name() != llm.NameOpenAI {
+						logger.Info("Skipping grammar mode; backend has no grammar support", "model", m, "backend", client.Name())
+						continue
+					}
+					tcfg.Format = format
+					for _, params := range paramSets {
+						for sample := 1; sample <= cfg.Samples; sample++ {
+							if ctx.Err() != nil {
+								span.SetAttributes(attribute.Bool("interrupted", true))
+								return ErrInterrupted
+							}
+							if err := generateForModel(ctx, client, m, tags, params, sample, tcfg); err != nil {
+								return err
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return cfg.State.finish()
+}
+
+// generateForModel runs, records, and saves a single generation for one model
+// and parameter set.
+func generateForModel(ctx context.Context, client llm.Backend, m string, tags []string, params paramSet, sample int, cfg genConfig) error {
+	variant := (&GenerationMeta{Task: cfg.taskName(), PromptVariant: cfg.Ablation.Key(), Format: cfg.Format, API: cfg.API, Params: params}).Variant()
+	cfg.Sample = sample
+	dir := resultDir(cfg.RunID, m, tags, variant, sample)
+	if cfg.State.completed(dir) {
+		cfg.Logger.Info("Skipping", "model", m, "tags", tags, "variant", variant, "reason", "checkpointed")
+		cfg.Dashboard.finish(m, nil)
+		return nil
+	}
+	if reason := skipReason(dir, cfg); reason != "" {
+		cfg.Logger.Info("Skipping", "model", m, "tags", tags, "variant", variant, "reason", reason)
+		cfg.Dashboard.finish(m, nil)
+		return nil
+	}
+	modelCtx, modelSpan := otel.Tracer("character-generator").Start(ctx, "model_generation",
+		trace.WithAttributes(
+			attribute.String("model.name", m),
+			attribute.String("model.task", cfg.taskName()),
+			attribute.String("model.format", cfg.Format),
+			attribute.String("model.params", params.Key()),
+			attribute.String("model.variant", variant),
+			attribute.Int("model.sample", sample),
+		),
+	)
+	defer modelSpan.End()
+	cfg.Logger.Info("Generating", "model", m, "tags", tags, "variant", variant, "sample", sample)
+
+	genCtx, cancel := llm.WithTimeout(modelCtx, cfg.Timeout)
+	var sampler *collector.Sampler
+	if cfg.GPUInterval > 0 {
+		sampler = collector.StartSampler(genCtx, cfg.GPUs, cfg.GPUInterval)
+	}
+	cfg.Dashboard.begin(m)
+	result, meta := generateOne(genCtx, client, m, tags, params, cfg)
+	defer cfg.Dashboard.finish(m, meta)
+	meta.Sample = sample
+	if sampler != nil {
+		if stats, err := sampler.Stop(); err != nil {
+			cfg.Logger.Warn("GPU sampling failed", "model", m, "err", err)
+		} else {
+			meta.GPU = newGPUMeta(stats)
+			modelSpan.SetAttributes(
+				attribute.Float64("gpu.util_avg_percent", meta.GPU.UtilAvgPercent),
+				attribute.Float64("gpu.util_peak_percent", meta.GPU.UtilPeakPercent),
+				attribute.Float64("gpu.memory_avg_mib", meta.GPU.MemoryAvgMiB),
+				attribute.Float64("gpu.memory_peak_mib", meta.GPU.MemoryPeakMiB),
+			)
+		}
+	}
+	cancel()
+	if meta.Status == statusTimeout {
+		cfg.Logger.Warn("Generation timed out; moving on", "model", m, "timeout", cfg.Timeout)
+	}
+
+	modelSpan.SetAttributes(
+		attribute.Bool("model.conforming_json", meta.ConformingJSON),
+		attribute.String("model.parse_error", meta.ParseError),
+		attribute.Int("model.attempts", meta.Attempts),
+		attribute.String("model.error_kind", meta.ErrorKind),
+		attribute.String("model.think_snippet", trimTo(meta.Think, 80)),
+		attribute.Int("model.output_tokens", meta.OutputTokens),
+		attribute.Float64("model.tokens_per_sec", meta.TokensPerSec),
+	)
+
+	// Save even when interrupted, so the partial meta survives Ctrl+C.
+	saveCtx := context.WithoutCancel(modelCtx)
+	if err := saveResults(saveCtx, cfg.Logger, m, tags, result, meta); err != nil {
+		modelSpan.RecordError(err)
+		modelSpan.SetAttributes(attribute.String("generation.status", "save_failed"))
+		return err
+	}
+	modelSpan.SetAttributes(attribute.String("generation.status", meta.Status))
+	if err := cfg.Store.RecordGeneration(saveCtx, meta, dir); err != nil {
+		modelSpan.RecordError(err)
+		cfg.Logger.Error("Store write failed", "model", m, "err", err)
+	}
+	if meta.Status != statusInterrupted {
+		if err := cfg.State.markCompleted(dir); err != nil {
+			cfg.Logger.Warn("Checkpoint failed", "model", m, "err", err)
+		}
+	}
+	return nil
+}
+
+// optionsFromFlags collects the model option flags into the map passed as
+// GenerateRequest.Options. Unset flags are omitted so model defaults apply.
+func optionsFromFlags(cmd *cobra.Command) (map[string]interface{}, error) {
+	opts := map[string]interface{}{}
+	if seed, _ := cmd.Flags().GetInt("seed"); seed != 0 {
+		opts["seed"] = seed
+	}
+	if n, _ := cmd.Flags().GetInt("num-predict"); n != 0 {
+		opts["num_predict"] = n
+	}
+	if k, _ := cmd.Flags().GetInt("top-k"); k != 0 {
+		opts["top_k"] = k
+	}
+	if stop, _ := cmd.Flags().GetStringArray("stop"); len(stop) > 0 {
+		opts["stop"] = stop
+	}
+	raw, _ := cmd.Flags().GetStringArray("option")
+	extra, err := llm.ParseOptions(raw)
+	if err != nil {
+		return nil, err
+	}
+	return llm.MergeOptions(opts, extra), nil
+}
+
+func pickModels(ctx context.Context, client *api.Client, allModels bool, csv string) ([]string, error) {
+	switch {
+	case allModels:
+		resp, err := client.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing models: %w", err)
+		}
+		if len(resp.Models) == 0 {
+			return nil, errors.New("no local models found")
+		}
+		var mm []string
+		for _, m := range resp.Models {
+			mm = append(mm, strings.TrimSpace(m.Name))
+		}
+		return mm, nil
+
+	case csv != "":
+		spl := strings.Split(csv, ",")
+		var mm []string
+		for _, s := range spl {
+			mm = append(mm, strings.TrimSpace(s))
+		}
+		return mm, nil
+
+	default:
+		mm := viper.GetStringSlice("models")
+		if len(mm) == 0 {
+			// fallback: try listing from Ollama
+			resp, err := client.List(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("could not discover models: %w", err)
+			}
+			for _, m := range resp.Models {
+				mm = append(mm, strings.TrimSpace(m.Name))
+			}
+		}
+		if len(mm) == 0 {
+			return nil, errors.New("no models found in config or locally")
+		}
+		return mm, nil
+	}
+}
+
+// filterModels keeps the models matching include (if set) and none of the
+// exclude patterns. Matching is by unanchored regexp on the full name, e.g.
+// "embed" or ":q4_".
+func filterModels(logger *slog.Logger, models []string, include string, excludes []string) ([]string, error) {
+	var inc *regexp.Regexp
+	if include != "" {
+		var err error
+		if inc, err = regexp.Compile(include); err != nil {
+			return nil, fmt.Errorf("--include-regex: %w", err)
+		}
+	}
+	exc := make([]*regexp.Regexp, 0, len(excludes))
+	for _, e := range excludes {
+		re, err := regexp.Compile(e)
+		if err != nil {
+			return nil, fmt.Errorf("--exclude %q: %w", e, err)
+		}
+		exc = append(exc, re)
+	}
+
+	var kept, dropped []string
+models:
+	for _, m := range models {
+		if inc != nil && !inc.MatchString(m) {
+			dropped = append(dropped, m)
+			continue
+		}
+		for _, re := range exc {
+			if re.MatchString(m) {
+				dropped = append(dropped, m)
+				continue models
+			}
+		}
+		kept = append(kept, m)
+	}
+	if len(dropped) > 0 {
+		logger.Info("Filtered out models", "models", dropped)
+	}
+	if len(kept) == 0 {
+		return nil, errors.New("no models left after --include-regex/--exclude")
+	}
+	return kept, nil
+}
+
+// generateOne returns the decoded result (a *Character for character tasks,
+// otherwise the raw JSON document) alongside its metadata. The result is nil
+// when nothing usable was produced.
+func generateOne(ctx context.Context, client llm.Backend, model string, tags []string, params paramSet, cfg genConfig) (any, *GenerationMeta) {
+	ctx, genSpan := otel.Tracer("character-generator").Start(ctx, "model_inference",
+		trace.WithAttributes(
+			attribute.String("model", model),
+			attribute.StringSlice("tags", tags),
+			attribute.String("format", cfg.Format),
+			attribute.String("api", cfg.API),
+			attribute.String("params", params.Key()),
+		),
+	)
+	defer genSpan.End()
+
+	format := cfg.Format
+	prompt := cfg.Prompt
+	schemaText := characterSchema
+	switch {
+	case prompt != "":
+	case cfg.Ablation != nil:
+		// The ablation decides whether to think step by step.
+		prompt = characterPrompt
+	default:
+		prompt = buildPrompt(model)
+	}
+	formatJSON, _ := formatField(format)
+	if cfg.Task != nil {
+		var err error
+		if prompt, err = cfg.Task.render(model, tags); err != nil {
+			genSpan.RecordError(err)
+			return nil, &GenerationMeta{
+				RunID: cfg.RunID, Task: cfg.Task.Name, Backend: client.Name(), PromptVariant: cfg.Ablation.Key(), Model: model, Tags: tags,
+				Timestamp: time.Now(), Format: format, API: cfg.API, Params: params, Status: statusFailed, ParseError: err.Error(),
+			}
+		}
+		schemaText = string(cfg.Task.schemaRaw)
+		if format == "schema" {
+			// Constrain to the task's own schema; without one, plain JSON
+			// mode is the closest match.
+			formatJSON = cfg.Task.schemaRaw
+			if formatJSON == nil {
+				formatJSON, _ = formatField("json")
+			}
+		}
+	}
+	if format == "grammar" {
+		s, err := targetSchema(cfg)
+		if err != nil {
+			genSpan.RecordError(err)
+			return nil, &GenerationMeta{
+				RunID: cfg.RunID, Task: cfg.taskName(), Backend: client.Name(), PromptVariant: cfg.Ablation.Key(), Model: model, Tags: tags,
+				Timestamp: time.Now(), Format: format, API: cfg.API, Params: params, Status: statusFailed, ParseError: err.Error(),
+			}
+		}
+		cfg.Grammar = schemaGrammar(s)
+	}
+	if cfg.Ablation != nil {
+		prompt = cfg.Ablation.apply(prompt, schemaText)
+		genSpan.SetAttributes(attribute.String("prompt_variant", cfg.Ablation.Key()))
+	}
+	options := llm.MergeOptions(map[string]interface{}{
+		"temperature": 0.7,
+		"format":      "text",
+	}, cfg.Options, params)
+
+	var fullOutput strings.Builder
+	var metrics api.Metrics
+	var genContext []int
+	var ttft time.Duration
+	var cached bool
+	start := time.Now()
+	attempts, err := llm.WithRetry(ctx, cfg.Logger, cfg.Retries, cfg.Backoff, func(attempt int) error {
+		// A failed stream leaves a truncated answer; start over each attempt.
+		fullOutput.Reset()
+		attemptStart := time.Now()
+		ttft = 0
+		var err error
+		metrics, genContext, cached, err = cfg.Cache.complete(ctx, client, model, prompt, formatJSON, options, cfg, func(chunk string) {
+			if ttft == 0 {
+				ttft = time.Since(attemptStart)
+			}
+			cfg.Dashboard.streamed(model, chunk)
+			fullOutput.WriteString(chunk)
+		})
+		cfg.Dashboard.streamEnd()
+		return err
+	})
+	if err == nil && ctx.Err() != nil {
+		// The client can end a cancelled stream without an error; the
+		// output is truncated either way.
+		err = ctx.Err()
+	}
+	genSpan.SetAttributes(attribute.Int("attempts", attempts))
+
+	finalText := fullOutput.String()
+
+	meta := &GenerationMeta{
+		RunID:         cfg.RunID,
+		Task:          cfg.taskName(),
+		Backend:       client.Name(),
+		Model:         model,
+		PromptVariant: cfg.Ablation.Key(),
+		Tags:          tags,
+		Timestamp:     time.Now(),
+		Think:         extract.Think(finalText),
+		Format:        format,
+		API:           cfg.API,
+		Params:        params,
+		Options:       options,
+		TTFTMS:        durationMS(ttft),
+		Cached:        cached,
+		LatencyMS:     durationMS(time.Since(start)),
+		Attempts:      attempts,
+		raw:           finalText,
+	}
+	if sc := genSpan.SpanContext(); sc.IsValid() {
+		meta.TraceID = sc.TraceID().String()
+		meta.SpanID = sc.SpanID().String()
+	}
+	recordMetrics(meta, metrics)
+	if cost, ok := cfg.Prices.Cost(model, meta.PromptTokens, meta.OutputTokens); ok {
+		meta.CostUSD = cost
+		genSpan.SetAttributes(attribute.Float64("cost.usd", cost))
+	}
+	genSpan.SetAttributes(
+		attribute.Int("tokens.prompt", meta.PromptTokens),
+		attribute.Int("tokens.output", meta.OutputTokens),
+		attribute.Float64("tokens.per_sec", meta.TokensPerSec),
+		attribute.Float64("duration.load_ms", meta.LoadMS),
+		attribute.Float64("duration.total_ms", meta.TotalMS),
+		attribute.Float64("duration.latency_ms", meta.LatencyMS),
+	)
+
+	if err != nil {
+		genSpan.RecordError(err)
+		meta.ConformingJSON = false
+		meta.ErrorKind, _ = llm.ClassifyError(err)
+		meta.Status = statusFailed
+		switch {
+		case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+			meta.Status = statusTimeout
+		case errors.Is(ctx.Err(), context.Canceled):
+			meta.Status = statusInterrupted
+		}
+		meta.ParseError = fmt.Sprintf("stream generation error: %v", err)
+		return nil, meta
+	}
+
+	cfg.Dashboard.parsing(model)
+	out := parseOutput(finalText, cfg)
+	meta.Extraction = out.Extraction
+	meta.Repaired = out.Repaired
+	meta.ErrorKind = out.ErrorKind
+	meta.Violations = out.Violations
+	meta.ParseError = out.Err
+	meta.ConformingJSON = out.Conforming()
+	genSpan.SetAttributes(
+		attribute.String("extraction", out.Extraction),
+		attribute.Bool("repaired", out.Repaired),
+	)
+	if len(out.Violations) > 0 {
+		genSpan.SetAttributes(attribute.StringSlice("violations", out.Violations))
+	}
+	meta.Status = statusSuccess
+	if !meta.ConformingJSON {
+		meta.Status = statusPartial
+	}
+
+	if cfg.Corrections > 0 && !meta.ConformingJSON {
+		var fixed parsedOutput
+		meta.Corrections, fixed = runCorrections(ctx, client, model, formatJSON, options, cfg, prompt, finalText, genContext, out)
+		meta.SelfCorrected = fixed.Conforming()
+		genSpan.SetAttributes(
+			attribute.Int("corrections", len(meta.Corrections)),
+			attribute.Bool("self_corrected", meta.SelfCorrected),
+		)
+	}
+	if len(cfg.Turns) > 0 && out.Result != nil {
+		meta.Turns = runFollowUps(ctx, client, model, formatJSON, options, cfg, prompt, finalText, genContext, out)
+		meta.Consistency = meanRetention(meta.Turns)
+		genSpan.SetAttributes(attribute.Float64("consistency", meta.Consistency))
+	}
+	return out.Result, meta
+}
+
+// parsedOutput is the outcome of extracting, decoding and validating one
+// model answer.
+type parsedOutput struct {
+	// Result is a *Character for character tasks, otherwise the raw JSON
+	// document; nil if nothing could be decoded.
+	Result     any
+	Doc        interface{}
+	Extraction string
+	Repaired   bool
+	ErrorKind  string
+	Violations []string
+	Err        string
+}
+
+func (p parsedOutput) Conforming() bool { return p.Result != nil && p.Err == "" }
+
+func parseOutput(text string, cfg genConfig) parsedOutput {
+	jsonBlock, strategy := extractJSON(text)
+	out := parsedOutput{Extraction: strategy}
+	if jsonBlock == "" {
+		out.ErrorKind = errKindParse
+		out.Err = "no JSON found in output"
+		return out
+	}
+
+	var c Character
+	target := any(&c)
+	if !cfg.Task.decodesCharacter() {
+		target = &out.Doc
+	}
+	e := json.Unmarshal([]byte(jsonBlock), target)
+	if e != nil {
+		// Sloppy-but-recoverable JSON is tracked separately from invalid JSON.
+		repaired := llm.RepairJSON(jsonBlock)
+		if re := json.Unmarshal([]byte(repaired), target); re == nil {
+			out.Repaired = true
+			jsonBlock = repaired
+			e = nil
+		}
+	}
+	if e != nil {
+		out.ErrorKind = errKindParse
+		out.Err = fmt.Sprintf("unmarshal error: %v", e)
+		return out
+	}
+
+	out.Result = &c
+	switch {
+	case cfg.Task.decodesCharacter():
+		_ = json.Unmarshal([]byte(jsonBlock), &out.Doc)
+		out.Violations = validateResult(cfg.Rules, jsonBlock, c)
+	case cfg.Rules != nil:
+		out.Result = json.RawMessage(jsonBlock)
+		out.Violations = cfg.Rules.Validate(out.Doc)
+	default:
+		out.Result = json.RawMessage(jsonBlock)
+	}
+	if len(out.Violations) > 0 {
+		out.ErrorKind = errKindValidation
+		out.Err = strings.Join(out.Violations, "; ")
+	}
+	return out
+}
+
+// taskName is the suite task's name, or "" for the built-in character task.
+func (cfg genConfig) taskName() string {
+	if cfg.Task == nil {
+		return ""
+	}
+	return cfg.Task.Name
+}
+
+// gpuMeta is the GPU load observed while a generation ran.
+type gpuMeta struct {
+	Samples         int     `json:"samples"`
+	UtilAvgPercent  float64 `json:"util_avg_percent"`
+	UtilPeakPercent float64 `json:"util_peak_percent"`
+	MemoryAvgMiB    float64 `json:"memory_avg_mib"`
+	MemoryPeakMiB   float64 `json:"memory_peak_mib"`
+}
+
+func newGPUMeta(s collector.Stats) *gpuMeta {
+	const mib = 1 << 20
+	return &gpuMeta{
+		Samples:         s.Samples,
+		UtilAvgPercent:  s.AvgUtilPercent,
+		UtilPeakPercent: s.PeakUtilPercent,
+		MemoryAvgMiB:    s.AvgMemoryBytes / mib,
+		MemoryPeakMiB:   float64(s.PeakMemoryBytes) / mib,
+	}
+}
+
+// recordMetrics copies the token counts and server-side timings from the
+// final streamed response into meta.
+func recordMetrics(meta *GenerationMeta, m api.Metrics) {
+	meta.PromptTokens = m.PromptEvalCount
+	meta.OutputTokens = m.EvalCount
+	meta.TokensPerSec = llm.TokensPerSecond(m)
+	meta.LoadMS = durationMS(m.LoadDuration)
+	meta.TotalMS = durationMS(m.TotalDuration)
+}
+
+func durationMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// characterPrompt is the default character prompt without the trailing
+// "think step by step" line, which --ablate switches on and off.
+const characterPrompt = `
+Generate a response that deliberately challenges conventional thinking 
+and explores unexpected connections. Draw from diverse domains of 
+knowledge to create novel analogies and metaphors. Each response 
+should offer a fresh perspective not explored previously, pushing 
+beyond obvious solutions for unique angles and innovative approaches. 
+Aim to surprise and delight with original insights while maintaining 
+logical coherence.
+
+In the final output, embed your chain of thought in <think>...</think>, 
+and provide your final JSON in triple backtick code blocks (` + "```" + `or ` + "```" + `json). 
+The JSON must include: class, equipment, properties{strength, dexterity}, 
+a 'backstory' field, and optionally an 'extra' object. You may add more fields.
+`
+
+func buildPrompt(model string) string {
+	prompt := characterPrompt
+	if model != "deepseek-r1" {
+		prompt += thinkStepByStep
+	}
+	return prompt
+}
+
+// formatField maps the --format mode to the value of GenerateRequest.Format.
+// An empty mode leaves decoding unconstrained.
+func formatField(mode string) (json.RawMessage, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case "json":
+		return json.RawMessage(`"json"`), nil
+	case "schema":
+		return json.RawMessage(characterSchema), nil
+	case "grammar":
+		// Constrained by genConfig.Grammar instead, on backends that
+		// support it.
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q (want json, schema or grammar)", mode)
+	}
+}
+
+func saveResults(ctx context.Context, logger *slog.Logger, model string, tags []string, result any, meta *GenerationMeta) error {
+	ctx, span := otel.Tracer("character-generator").Start(ctx, "save_results",
+		trace.WithAttributes(
+			attribute.String("model", model),
+			attribute.StringSlice("tags", tags),
+		),
+	)
+	defer span.End()
+
+	dir := resultDir(meta.RunID, model, tags, meta.Variant(), meta.Sample)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("mkdir: %w", err)
+	}
+
+	if result != nil {
+		resPath := filepath.Join(dir, "result.json")
+		if err := writeJSONFile(resPath, result); err != nil {
+			span.RecordError(err)
+			return err
+		}
+		span.SetAttributes(attribute.String("save_results.result_path", resPath))
+	}
+	if meta.raw != "" {
+		if err := os.WriteFile(filepath.Join(dir, "raw.txt"), []byte(meta.raw), 0o644); err != nil {
+			span.RecordError(err)
+			return fmt.Errorf("write raw output: %w", err)
+		}
+	}
+	for _, group := range []struct {
+		prefix string
+		turns  []turnMeta
+	}{{"turn", meta.Turns}, {"correction", meta.Corrections}} {
+		for _, t := range group.turns {
+			if t.raw != "" {
+				if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%s-%d.raw.txt", group.prefix, t.Turn)), []byte(t.raw), 0o644); err != nil {
+					span.RecordError(err)
+					return fmt.Errorf("write raw output: %w", err)
+				}
+			}
+			if t.result == nil {
+				continue
+			}
+			if err := writeJSONFile(filepath.Join(dir, fmt.Sprintf("%s-%d.json", group.prefix, t.Turn)), t.result); err != nil {
+				span.RecordError(err)
+				return err
+			}
+		}
+	}
+
+	metaPath := filepath.Join(dir, "meta.json")
+	if err := writeJSONFile(metaPath, meta); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	logger.Info("Saved results", "dir", dir, "model", model,
+		"tags", tags, "conforming_json", meta.ConformingJSON)
+	span.SetAttributes(
+		attribute.String("save_results.meta_path", metaPath),
+		attribute.Bool("save_results.conforming_json", meta.ConformingJSON),
+		attribute.String("save_results.parse_error", meta.ParseError),
+	)
+	return nil
+}
+
+// Variant identifies how a generation differed from the default free-form
+// /generate run, e.g. "format-json/params-temperature=0.2". Results for
+// different variants are stored and reported separately.
+func (m *GenerationMeta) Variant() string {
+	var parts []string
+	if m.Task != "" {
+		parts = append(parts, "task-"+m.Task)
+	}
+	if m.PromptVariant != "" {
+		parts = append(parts, "prompt-"+m.PromptVariant)
+	}
+	if m.Format != "" {
+		parts = append(parts, "format-"+m.Format)
+	}
+	if m.API != "" && m.API != "generate" {
+		parts = append(parts, "api-"+m.API)
+	}
+	if key := m.Params.Key(); key != "" {
+		parts = append(parts, "params-"+key)
+	}
+	return strings.Join(parts, "/")
+}
+
+// resultDir is where the result and meta for one generation are stored.
+// Samples after the first get their own sample-N subdirectory.
+func resultDir(runID, model string, tags []string, variant string, sample int) string {
+	dir := filepath.Join(runRoot(runID), sanitize(model), sanitize(strings.Join(tags, "_")))
+	if variant != "" {
+		for _, part := range strings.Split(variant, "/") {
+			dir = filepath.Join(dir, sanitize(part))
+		}
+	}
+	if sample > 1 {
+		dir = filepath.Join(dir, fmt.Sprintf("sample-%d", sample))
+	}
+	return dir
+}
+
+// skipReason explains why the generation stored in dir should not be
+// re-run, or returns "" if it should.
+func skipReason(dir string, cfg genConfig) string {
+	if !cfg.SkipExisting && !cfg.Resume {
+		return ""
+	}
+	meta, err := loadMeta(filepath.Join(dir, "meta.json"))
+	if err != nil {
+		return ""
+	}
+	if cfg.SkipExisting {
+		return "existing result"
+	}
+	if meta.ConformingJSON {
+		return "already conforming"
+	}
+	return ""
+}
+
+func evaluateResults(cmd *cobra.Command, logger *slog.Logger) error {
+	ctx, stop := interruptContext(cmd.Context())
+	defer stop()
+
+	ctx, span := otel.Tracer("character-generator").Start(ctx, "command_evaluate")
+	defer span.End()
+
+	var panel *judgePanel
+	if judgeModels, _ := cmd.Flags().GetStringSlice("judge-model"); len(judgeModels) > 0 {
+		client, err := newOllamaClient("")
+		if err != nil {
+			return err
+		}
+		cache, err := openResponseCache()
+		if err != nil {
+			return err
+		}
+		defer cache.logStats(logger)
+		judges := make([]*judge, len(judgeModels))
+		for i, m := range judgeModels {
+			judges[i] = &judge{client: client, model: m, cache: cache, logger: logger}
+		}
+		agg, _ := cmd.Flags().GetString("judge-agg")
+		if panel, err = newJudgePanel(judges, agg); err != nil {
+			return err
+		}
+		span.SetAttributes(
+			attribute.StringSlice("judge.models", judgeModels),
+			attribute.String("judge.aggregation", agg),
+		)
+	}
+	store, err := openStore(viper.GetString("store"))
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	runID, _ := cmd.Flags().GetString("run")
+	root := runRoot(runID)
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		err := fmt.Errorf("no %q directory found", root)
+		span.RecordError(err)
+		return err
+	}
+	var metaPaths []string
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, e error) error {
+		if e != nil {
+			logger.Error("filepath walk error", "path", p, "err", e)
+			return nil
+		}
+		if d.IsDir() || !strings.HasSuffix(p, "meta.json") {
+			return nil
+		}
+		metaPaths = append(metaPaths, p)
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	workers, _ := cmd.Flags().GetInt("workers")
+	span.SetAttributes(
+		attribute.Int("evaluate.results", len(metaPaths)),
+		attribute.Int("evaluate.workers", workers),
+	)
+	ecfg := evalConfig{Judge: panel, Store: store, Logger: logger}
+	if rulesPath := viper.GetString("rules"); rulesPath != "" {
+		if ecfg.Rules, err = loadSchema(rulesPath); err != nil {
+			return err
+		}
+	}
+	if err := evaluateAll(ctx, metaPaths, workers, ecfg); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	if embedModel, _ := cmd.Flags().GetString("embed-model"); embedModel != "" {
+		client, err := newOllamaClient("")
+		if err != nil {
+			return err
+		}
+		if err := embedEvaluate(ctx, logger, client.Client(), embedModel, metaPaths); err != nil {
+			span.RecordError(err)
+			return err
+		}
+	}
+	writeThinkSummary(os.Stdout, summarizeThink(metaPaths))
+	return nil
+}
+
+// evaluateAll evaluates every meta.json with at most workers in flight and
+// returns all failures joined together.
+func evaluateAll(ctx context.Context, metaPaths []string, workers int, cfg evalConfig) error {
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, workers)
+	)
+	for _, p := range metaPaths {
+		if ctx.Err() != nil {
+			mu.Lock()
+			errs = append(errs, ErrInterrupted)
+			mu.Unlock()
+			break
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(p string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := evaluateOne(ctx, p, cfg); err != nil {
+				cfg.Logger.Error("Failed evaluating", "path", p, "err", err)
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", p, err))
+				mu.Unlock()
+			}
+		}(p)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// evalConfig holds the optional passes applied to every stored result.
+type evalConfig struct {
+	Judge *judgePanel
+	Store *sqlStore
+	// Rules re-validates stored results, e.g. after the rules file changed.
+	Rules  *jsonSchema
+	Logger *slog.Logger
+}
+
+func evaluateOne(ctx context.Context, metaPath string, cfg evalConfig) error {
+	dir := filepath.Dir(metaPath)
+	resPath := filepath.Join(dir, "result.json")
+
+	ctx, span := otel.Tracer("character-generator").Start(ctx, "evaluate_one",
+		trace.WithAttributes(
+			attribute.String("meta_path", metaPath),
+			attribute.String("result_path", resPath),
+		),
+	)
+	defer span.End()
+
+	meta, err := loadMeta(metaPath)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	span.SetAttributes(
+		attribute.String("model", meta.Model),
+		attribute.StringSlice("tags", meta.Tags),
+		attribute.String("format", meta.Format),
+		attribute.String("variant", meta.Variant()),
+		attribute.Bool("conforming_json", meta.ConformingJSON),
+	)
+	if link, ok := generationLink(meta); ok {
+		span.AddLink(link)
+	}
+
+	var ch *Character
+	if _, err := os.Stat(resPath); err == nil {
+		ch, _ = loadCharacter(resPath)
+	}
+	logEval(cfg.Logger, meta, ch, metaPath, resPath)
+
+	think := analyzeThink(meta)
+	span.SetAttributes(
+		attribute.Bool("think.present", think.Present),
+		attribute.Int("think.tokens", think.Tokens),
+		attribute.Float64("think.ratio", think.Ratio),
+		attribute.Bool("think.json_leak", think.JSONLeak),
+	)
+	if think.Present {
+		if err := writeJSONFile(filepath.Join(dir, "think.json"), think); err != nil {
+			span.RecordError(err)
+			return err
+		}
+	}
+
+	if cfg.Rules != nil && ch != nil {
+		if raw, err := os.ReadFile(resPath); err == nil {
+			var v interface{}
+			if err := json.Unmarshal(raw, &v); err == nil {
+				violations := cfg.Rules.Validate(v)
+				span.SetAttributes(attribute.StringSlice("violations", violations))
+				cfg.Logger.Info("Rules checked", "model", meta.Model, "violations", violations)
+				if err := recordViolations(metaPath, meta, violations); err != nil {
+					span.RecordError(err)
+					return err
+				}
+			}
+		}
+	}
+
+	if cfg.Judge == nil || ch == nil {
+		return nil
+	}
+	if meta.Task != "" {
+		// The judge rubric only makes sense for the built-in character task.
+		cfg.Logger.Debug("Not judging suite task", "task", meta.Task, "path", metaPath)
+		return nil
+	}
+	ev, err := cfg.Judge.Score(ctx, ch)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	cfg.Logger.Info("Judged",
+		"model", meta.Model,
+		"judge", ev.JudgeModel,
+		"creativity", ev.Scores.Creativity,
+		"coherence", ev.Scores.Coherence,
+		"backstory_quality", ev.Scores.BackstoryQuality,
+		"agreement", ev.Agreement,
+		"error", ev.Error,
+	)
+	if prev, err := loadEvaluation(evaluationPath(dir)); err == nil {
+		// Keep metrics from an earlier --embed-model pass.
+		ev.Embedding = prev.Embedding
+	}
+	if err := cfg.Store.RecordEvaluation(ctx, meta, ev, dir); err != nil {
+		span.RecordError(err)
+		cfg.Logger.Error("Store write failed", "path", metaPath, "err", err)
+	}
+	return writeJSONFile(evaluationPath(dir), ev)
+}
+
+// recordViolations stores the violations found by re-checking a result
+// against --rules in its meta.json, judging its conformance as generate
+// would have with those rules.
+func recordViolations(metaPath string, meta *GenerationMeta, violations []string) error {
+	meta.Violations = violations
+	switch {
+	case len(violations) > 0:
+		meta.ErrorKind = errKindValidation
+		meta.ParseError = strings.Join(violations, "; ")
+		meta.ConformingJSON = false
+		meta.Status = statusPartial
+	case meta.ErrorKind == errKindValidation:
+		// It only failed the rules it was generated with.
+		meta.ErrorKind = ""
+		meta.ParseError = ""
+		meta.ConformingJSON = true
+		meta.Status = statusSuccess
+	}
+	return writeJSONFile(metaPath, meta)
+}
+
+// loadHistory reads a JSON array of chat messages for --history-file.
+func loadHistory(path string) ([]api.Message, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	var msgs []api.Message
+	if err := json.Unmarshal(b, &msgs); err != nil {
+		return nil, fmt.Errorf("parse history: %w", err)
+	}
+	return msgs, nil
+}
+
+func loadCharacter(path string) (*Character, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Character
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func loadEvaluation(path string) (*Evaluation, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ev Evaluation
+	if err := json.Unmarshal(b, &ev); err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+func loadMeta(path string) (*GenerationMeta, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m GenerationMeta
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func logEval(logger *slog.Logger, meta *GenerationMeta, c *Character, mp, rp string) {
+	logger.Info("Evaluation",
+		"model", meta.Model,
+		"tags", meta.Tags,
+		"variant", meta.Variant(),
+		"status", meta.Status,
+		"conforming_json", meta.ConformingJSON,
+		"repaired", meta.Repaired,
+		"extraction", meta.Extraction,
+		"error_kind", meta.ErrorKind,
+		"attempts", meta.Attempts,
+		"parse_error", meta.ParseError,
+		"think", trimTo(meta.Think, 80),
+		"meta_path", mp,
+		"result_path", rp,
+	)
+	if c != nil {
+		logger.Info("Character",
+			"class", c.Class,
+			"equipment", c.Equipment,
+			"properties", c.Properties,
+			"backstory", trimTo(c.Backstory, 80),
+		)
+	}
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '/', '\\', ' ':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+func trimTo(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// validateResult checks a parsed result against the configured rules, or the
+// built-in character checks when no rules file was given.
+func validateResult(rules *jsonSchema, doc string, c Character) []string {
+	if rules == nil {
+		if err := validateChar(c); err != nil {
+			return []string{err.Error()}
+		}
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(doc), &v); err != nil {
+		return []string{fmt.Sprintf("unmarshal error: %v", err)}
+	}
+	return rules.Validate(v)
+}
+
+func validateChar(c Character) error {
+	if c.Class == "" {
+		return errors.New("character 'class' is empty")
+	}
+	if c.Properties == nil {
+		return errors.New("'properties' is missing")
+	}
+	return nil
+}
+
+func writeJSONFile(path string, v any) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,360 @@
+package oleval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// mlflowClient talks to an MLflow tracking server's REST API. Auth comes
+// from MLFLOW_TRACKING_TOKEN, or MLFLOW_TRACKING_USERNAME and
+// MLFLOW_TRACKING_PASSWORD, as with MLflow's own client.
+type mlflowClient struct {
+	base string
+	http *http.Client
+}
+
+// mlflow caps log-batch requests at 1000 metrics and 100 params.
+const (
+	mlflowMaxMetrics = 1000
+	mlflowMaxParams  = 100
+)
+
+type mlflowKV struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type mlflowMetric struct {
+	Key       string  `json:"key"`
+	Value     float64 `json:"value"`
+	Timestamp int64   `json:"timestamp"`
+	Step      int64   `json:"step"`
+}
+
+func trackRun(cmd *cobra.Command, logger *slog.Logger) error {
+	runID, _ := cmd.Flags().GetString("run")
+	experiment, _ := cmd.Flags().GetString("experiment")
+	artifacts, _ := cmd.Flags().GetBool("artifacts")
+	uri := viper.GetString("mlflow.uri")
+	if uri == "" {
+		return errors.New("no MLflow server: pass --mlflow-uri or set MLFLOW_TRACKING_URI")
+	}
+	if runID == "" {
+		var err error
+		if runID, err = latestRunID(); err != nil {
+			return err
+		}
+	}
+	m, err := loadManifest(runID)
+	if err != nil {
+		return err
+	}
+	if experiment == "" {
+		experiment = m.Experiment
+	}
+	if experiment == "" {
+		experiment = "oleval"
+	}
+	var prices priceTable
+	if pricesPath := viper.GetString("prices"); pricesPath != "" {
+		if prices, err = loadPrices(pricesPath); err != nil {
+			return err
+		}
+	}
+	rows, err := collectReport(logger, runRoot(runID), prices)
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	c := &mlflowClient{base: strings.TrimSuffix(uri, "/"), http: &http.Client{Timeout: time.Minute}}
+	expID, err := c.experimentID(ctx, experiment)
+	if err != nil {
+		return err
+	}
+	mlRun, artifactURI, err := c.createRun(ctx, expID, m)
+	if err != nil {
+		return err
+	}
+	if err := c.logBatch(ctx, mlRun, manifestParams(m), reportMetrics(rows, m.CreatedAt)); err != nil {
+		return err
+	}
+	if artifacts {
+		if err := c.logArtifacts(ctx, logger, artifactURI, runID, rows); err != nil {
+			return err
+		}
+	}
+	if err := c.call(ctx, http.MethodPost, "runs/update", map[string]interface{}{
+		"run_id": mlRun, "status": "FINISHED", "end_time": time.Now().UnixMilli(),
+	}, nil); err != nil {
+		return err
+	}
+	logger.Info("Logged run to MLflow", "run_id", runID, "experiment", experiment, "mlflow_run", mlRun)
+	return nil
+}
+
+// manifestParams flattens the manifest into MLflow params.
+func manifestParams(m *RunManifest) []mlflowKV {
+	params := []mlflowKV{
+		{"run_id", m.RunID},
+		{"models", strings.Join(m.Models, ",")},
+		{"tags", strings.Join(m.Tags, ",")},
+		{"format", m.Format},
+		{"api", m.API},
+		{"samples", fmt.Sprint(m.Samples)},
+		{"prompt_hash", m.PromptHash},
+		{"git_sha", m.GitSHA},
+	}
+	if len(m.Formats) > 0 {
+		params = append(params, mlflowKV{"formats", strings.Join(m.Formats, ",")})
+	}
+	if len(m.Sweeps) > 0 {
+		params = append(params, mlflowKV{"sweeps", strings.Join(m.Sweeps, ";")})
+	}
+	if len(m.Tasks) > 0 {
+		params = append(params, mlflowKV{"tasks", strings.Join(m.Tasks, ",")})
+	}
+	if len(m.Ablate) > 0 {
+		params = append(params, mlflowKV{"ablate", strings.Join(m.Ablate, ",")})
+	}
+	for k, v := range m.Options {
+		params = append(params, mlflowKV{"option." + k, fmt.Sprint(v)})
+	}
+	return slices.DeleteFunc(params, func(kv mlflowKV) bool { return kv.Value == "" })
+}
+
+// reportMetrics logs each report row's figures under "<model>/<variant>/".
+func reportMetrics(rows []*ReportRow, at time.Time) []mlflowMetric {
+	var metrics []mlflowMetric
+	for _, r := range rows {
+		prefix := mlflowKey(r.Model + "/" + displayVariant(r.Variant))
+		for name, v := range map[string]float64{
+			"runs":                float64(r.Runs),
+			"conformance_rate":    r.ConformanceRate,
+			"repaired_rate":       r.RepairedRate,
+			"creativity":          r.Creativity,
+			"coherence":           r.Coherence,
+			"backstory_quality":   r.BackstoryQuality,
+			"judge_agreement":     r.JudgeAgreement,
+			"mean_latency_ms":     r.MeanLatencyMS,
+			"tokens_per_sec":      r.TokensPerSec,
+			"ttft_ms":             r.TTFTMS,
+			"think_rate":          r.ThinkRate,
+			"diversity":           r.Diversity,
+			"consistency":         r.Consistency,
+			"self_correct_rate":   r.SelfCorrectRate,
+			"total_cost_usd":      r.TotalCostUSD,
+			"cost_per_conforming": r.CostPerConforming,
+		} {
+			metrics = append(metrics, mlflowMetric{Key: prefix + "/" + name, Value: v, Timestamp: at.UnixMilli()})
+		}
+	}
+	return metrics
+}
+
+// mlflowKey replaces the characters MLflow rejects in keys; it allows
+// letters, digits, underscores, dashes, periods, spaces and slashes.
+func mlflowKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("_-. /", r):
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func (c *mlflowClient) experimentID(ctx context.Context, name string) (string, error) {
+	var got struct {
+		Experiment struct {
+			ID string `json:"experiment_id"`
+		} `json:"experiment"`
+	}
+	err := c.call(ctx, http.MethodGet, "experiments/get-by-name?experiment_name="+url.QueryEscape(name), nil, &got)
+	if err == nil {
+		return got.Experiment.ID, nil
+	}
+	var apiErr *mlflowError
+	if !errors.As(err, &apiErr) || apiErr.Code != "RESOURCE_DOES_NOT_EXIST" {
+		return "", err
+	}
+	var created struct {
+		ID string `json:"experiment_id"`
+	}
+	if err := c.call(ctx, http.MethodPost, "experiments/create", map[string]string{"name": name}, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+func (c *mlflowClient) createRun(ctx context.Context, expID string, m *RunManifest) (string, string, error) {
+	var got struct {
+		Run struct {
+			Info struct {
+				RunID       string `json:"run_id"`
+				ArtifactURI string `json:"artifact_uri"`
+			} `json:"info"`
+		} `json:"run"`
+	}
+	err := c.call(ctx, http.MethodPost, "runs/create", map[string]interface{}{
+		"experiment_id": expID,
+		"run_name":      m.RunID,
+		"start_time":    m.CreatedAt.UnixMilli(),
+		"tags": []mlflowKV{
+			{"mlflow.source.name", "oleval"},
+			{"mlflow.source.git.commit", m.GitSHA},
+		},
+	}, &got)
+	return got.Run.Info.RunID, got.Run.Info.ArtifactURI, err
+}
+
+func (c *mlflowClient) logBatch(ctx context.Context, runID string, params []mlflowKV, metrics []mlflowMetric) error {
+	for len(params) > 0 || len(metrics) > 0 {
+		np, nm := min(len(params), mlflowMaxParams), min(len(metrics), mlflowMaxMetrics-mlflowMaxParams)
+		err := c.call(ctx, http.MethodPost, "runs/log-batch", map[string]interface{}{
+			"run_id": runID, "params": params[:np], "metrics": metrics[:nm],
+		}, nil)
+		if err != nil {
+			return err
+		}
+		params, metrics = params[np:], metrics[nm:]
+	}
+	return nil
+}
+
+// logArtifacts uploads the report and every result.json through the
+// server's artifact proxy, which only serves mlflow-artifacts: URIs.
+func (c *mlflowClient) logArtifacts(ctx context.Context, logger *slog.Logger, artifactURI, runID string, rows []*ReportRow) error {
+	root, ok := strings.CutPrefix(artifactURI, "mlflow-artifacts:")
+	if !ok {
+		logger.Warn("Not uploading artifacts; server does not proxy them", "artifact_uri", artifactURI)
+		return nil
+	}
+	root = strings.TrimPrefix(root, "/")
+	files := map[string][]byte{}
+	for name, format := range map[string]string{"report.md": "markdown", "report.json": "json"} {
+		var buf bytes.Buffer
+		if err := writeReport(&buf, format, rows); err != nil {
+			return err
+		}
+		files[name] = buf.Bytes()
+	}
+	base := runRoot(runID)
+	err := filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || (d.Name() != "result.json" && d.Name() != "manifest.json") {
+			return err
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+		if d.Name() == "result.json" {
+			rel = filepath.Join("results", rel)
+		}
+		files[filepath.ToSlash(rel)], err = os.ReadFile(p)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for name, b := range files {
+		if err := c.upload(ctx, path.Join(root, name), b); err != nil {
+			return err
+		}
+	}
+	logger.Info("Uploaded artifacts", "files", len(files))
+	return nil
+}
+
+func (c *mlflowClient) upload(ctx context.Context, p string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.base+"/api/2.0/mlflow-artifacts/artifacts/"+p, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	c.auth(req)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("upload %s: %w", p, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("upload %s: %s: %s", p, resp.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// mlflowError is an error response from the tracking API.
+type mlflowError struct {
+	Status  int
+	Code    string `json:"error_code"`
+	Message string `json:"message"`
+}
+
+func (e *mlflowError) Error() string {
+	return fmt.Sprintf("mlflow: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+func (c *mlflowClient) call(ctx context.Context, method, endpoint string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+"/api/2.0/mlflow/"+endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.auth(req)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("mlflow %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("mlflow %s: %w", endpoint, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		e := &mlflowError{Status: resp.StatusCode}
+		if json.Unmarshal(b, e) != nil || e.Code == "" {
+			e.Message = strings.TrimSpace(string(b))
+		}
+		return e
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(b, out)
+}
+
+func (c *mlflowClient) auth(req *http.Request) {
+	if token := os.Getenv("MLFLOW_TRACKING_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if user := os.Getenv("MLFLOW_TRACKING_USERNAME"); user != "" {
+		req.SetBasicAuth(user, os.Getenv("MLFLOW_TRACKING_PASSWORD"))
+	}
+}
@@ -0,0 +1,59 @@
+package oleval
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"github.com/spf13/viper"
+)
+
+// newOllamaClient returns a traced backend for addr ("" means --ollama-addr,
+// OLLAMA_HOST, or localhost).
+func newOllamaClient(addr string) (*llm.Ollama, error) {
+	if addr == "" {
+		addr = viper.GetString("ollama.addr")
+	}
+	return llm.NewOllama(addr)
+}
+
+// ollamaClients hands out one client per model, honouring per-model address
+// overrides and sharing clients between models on the same server.
+type ollamaClients struct {
+	byAddr    map[string]*llm.Ollama
+	modelAddr map[string]string
+	fallback  string
+}
+
+func newOllamaClients(fallback string, modelAddr map[string]string) *ollamaClients {
+	return &ollamaClients{byAddr: map[string]*llm.Ollama{}, modelAddr: modelAddr, fallback: fallback}
+}
+
+func (c *ollamaClients) forModel(model string) (*llm.Ollama, error) {
+	addr, ok := c.modelAddr[model]
+	if !ok {
+		addr = c.fallback
+	}
+	if cl, ok := c.byAddr[addr]; ok {
+		return cl, nil
+	}
+	cl, err := newOllamaClient(addr)
+	if err != nil {
+		return nil, fmt.Errorf("model %s: %w", model, err)
+	}
+	c.byAddr[addr] = cl
+	return cl, nil
+}
+
+// parseModelAddrs parses repeated --model-addr model=address flags.
+func parseModelAddrs(specs []string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, spec := range specs {
+		model, addr, ok := strings.Cut(spec, "=")
+		if !ok || model == "" || addr == "" {
+			return nil, fmt.Errorf("invalid --model-addr %q (want model=address)", spec)
+		}
+		out[model] = addr
+	}
+	return out, nil
+}
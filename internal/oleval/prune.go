@@ -0,0 +1,209 @@
+package oleval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// pruneFilter selects what prune deletes. OlderThan alone removes whole
+// runs; Failed and Models select individual results, within old runs when
+// OlderThan is also set.
+type pruneFilter struct {
+	OlderThan time.Duration
+	Failed    bool
+	Models    []string
+	RunID     string
+}
+
+func (f pruneFilter) selectsResults() bool {
+	return f.Failed || len(f.Models) > 0
+}
+
+// failedStatuses are the generation statuses --failed-only removes: those
+// that produced no usable answer.
+var failedStatuses = []string{statusFailed, statusTimeout, statusInterrupted}
+
+func pruneResults(cmd *cobra.Command, logger *slog.Logger) error {
+	var f pruneFilter
+	f.OlderThan, _ = cmd.Flags().GetDuration("older-than")
+	f.Failed, _ = cmd.Flags().GetBool("failed-only")
+	f.Models, _ = cmd.Flags().GetStringArray("model")
+	f.RunID, _ = cmd.Flags().GetString("run")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	if f.OlderThan <= 0 && !f.selectsResults() && f.RunID == "" {
+		return errors.New("nothing selected: pass --older-than, --failed-only, --model or --run")
+	}
+
+	runs, err := pruneCandidates(logger, f)
+	if err != nil {
+		return err
+	}
+	var freed int64
+	removed := 0
+	for _, run := range runs {
+		root := runRoot(run)
+		paths := []string{root}
+		if f.selectsResults() {
+			if paths, err = matchingResults(logger, root, f); err != nil {
+				return err
+			}
+		}
+		for _, p := range paths {
+			size := dirSize(p, !f.selectsResults())
+			freed += size
+			removed++
+			if dryRun {
+				fmt.Printf("would remove %s (%s)\n", p, humanBytes(size))
+				continue
+			}
+			if f.selectsResults() {
+				err = removeResult(p, root)
+			} else {
+				err = os.RemoveAll(p)
+			}
+			if err != nil {
+				return fmt.Errorf("remove %s: %w", p, err)
+			}
+			fmt.Printf("removed %s (%s)\n", p, humanBytes(size))
+		}
+	}
+	what := "runs"
+	if f.selectsResults() {
+		what = "results"
+	}
+	logger.Info("Pruned", what, removed, "freed", humanBytes(freed), "dry_run", dryRun)
+	return nil
+}
+
+// pruneCandidates lists the runs the filter applies to, oldest first.
+func pruneCandidates(logger *slog.Logger, f pruneFilter) ([]string, error) {
+	if f.RunID != "" {
+		if _, err := os.Stat(runRoot(f.RunID)); err != nil {
+			return nil, fmt.Errorf("run %s: %w", f.RunID, err)
+		}
+		return []string{f.RunID}, nil
+	}
+	entries, err := os.ReadDir(outDir())
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-f.OlderThan)
+	var runs []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(outDir(), e.Name(), "manifest.json"))
+		if err != nil {
+			continue
+		}
+		var m RunManifest
+		if err := json.Unmarshal(b, &m); err != nil {
+			logger.Warn("Skipping run with unreadable manifest", "run", e.Name(), "err", err)
+			continue
+		}
+		if f.OlderThan > 0 && !m.CreatedAt.Before(cutoff) {
+			continue
+		}
+		runs = append(runs, e.Name())
+	}
+	sort.Strings(runs)
+	return runs, nil
+}
+
+// matchingResults returns the result directories under root whose meta.json
+// matches the filter's model and status conditions.
+func matchingResults(logger *slog.Logger, root string, f pruneFilter) ([]string, error) {
+	var dirs []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() != "meta.json" {
+			return err
+		}
+		meta, err := loadMeta(p)
+		if err != nil {
+			logger.Warn("Skipping unreadable meta", "path", p, "err", err)
+			return nil
+		}
+		if len(f.Models) > 0 && !slices.Contains(f.Models, meta.Model) {
+			return nil
+		}
+		if f.Failed && !slices.Contains(failedStatuses, meta.Status) {
+			return nil
+		}
+		dirs = append(dirs, filepath.Dir(p))
+		return nil
+	})
+	return dirs, err
+}
+
+// removeResult deletes the files of one result. Later samples live in
+// subdirectories of the first, so those are left alone; directories emptied
+// by the removal are cleaned up as far as the run root.
+func removeResult(dir, root string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	for d := dir; d != root && d != "." && d != string(filepath.Separator); d = filepath.Dir(d) {
+		if os.Remove(d) != nil {
+			// Not empty.
+			break
+		}
+	}
+	return nil
+}
+
+// dirSize sums the files under p; with recursive unset only p's own files
+// count, matching what removeResult deletes.
+func dirSize(p string, recursive bool) int64 {
+	var n int64
+	if !recursive {
+		entries, _ := os.ReadDir(p)
+		for _, e := range entries {
+			if info, err := e.Info(); err == nil && !e.IsDir() {
+				n += info.Size()
+			}
+		}
+		return n
+	}
+	_ = filepath.WalkDir(p, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				n += info.Size()
+			}
+		}
+		return nil
+	})
+	return n
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,366 @@
+package oleval
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// ReportRow aggregates every stored generation for one model and variant.
+type ReportRow struct {
+	Model            string  `json:"model"`
+	Backend          string  `json:"backend"`
+	Variant          string  `json:"variant"`
+	Runs             int     `json:"runs"`
+	Conforming       int     `json:"conforming"`
+	ConformanceRate  float64 `json:"conformance_rate"`
+	RepairedRate     float64 `json:"repaired_rate"`
+	Judged           int     `json:"judged"`
+	Creativity       float64 `json:"avg_creativity"`
+	Coherence        float64 `json:"avg_coherence"`
+	BackstoryQuality float64 `json:"avg_backstory_quality"`
+	// JudgeAgreement averages inter-judge agreement over results scored by
+	// a judge ensemble.
+	JudgeAgreement float64 `json:"judge_agreement"`
+	MeanLatencyMS  float64 `json:"mean_latency_ms"`
+	TokensPerSec   float64 `json:"mean_tokens_per_sec"`
+	TTFTMS         float64 `json:"mean_ttft_ms"`
+	ThinkRate      float64 `json:"think_rate"`
+	// Diversity is 1 minus the mean pairwise similarity of the conforming
+	// samples; 0 when there are fewer than two.
+	Diversity float64 `json:"diversity"`
+	// Consistency is the mean share of keys kept across follow-up turns,
+	// over multi-turn generations only.
+	Consistency float64 `json:"consistency"`
+	// SelfCorrectRate is the share of non-conforming answers fixed after
+	// --correct fed the error back, over those that were re-prompted.
+	SelfCorrectRate float64 `json:"self_correct_rate"`
+	// TotalCostUSD sums the priced generations; CostPerConforming divides it
+	// by the conforming ones, the figure to weigh against quality.
+	TotalCostUSD      float64 `json:"total_cost_usd"`
+	CostPerConforming float64 `json:"cost_per_conforming"`
+
+	latencies int
+	speeds    int
+	ttfts     int
+	thinks    int
+	repaired  int
+	texts     []string
+	multiTurn int
+	corrected int
+	ensembled int
+	reprompts int
+}
+
+func reportResults(cmd *cobra.Command, logger *slog.Logger) error {
+	output, _ := cmd.Flags().GetString("output")
+	sortBy, _ := cmd.Flags().GetString("sort")
+	desc, _ := cmd.Flags().GetBool("desc")
+	saveDir, _ := cmd.Flags().GetString("save-dir")
+	runID, _ := cmd.Flags().GetString("run")
+	embedModel, _ := cmd.Flags().GetString("embed-model")
+	ablation, _ := cmd.Flags().GetBool("ablation")
+
+	rows, err := Report(logger, runID)
+	if err != nil {
+		return err
+	}
+	if ablation {
+		return writeAblation(os.Stdout, output, ablationEffects(rows))
+	}
+	if embedModel != "" {
+		client, err := newOllamaClient("")
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			d, err := embeddingDiversity(cmd.Context(), client.Client(), embedModel, row.texts)
+			if err != nil {
+				return fmt.Errorf("diversity for %s: %w", row.Model, err)
+			}
+			row.Diversity = d
+		}
+	}
+	if err := sortReport(rows, sortBy, desc); err != nil {
+		return err
+	}
+
+	if saveDir != "" {
+		if err := os.MkdirAll(saveDir, 0o755); err != nil {
+			return fmt.Errorf("mkdir: %w", err)
+		}
+		for name, format := range map[string]string{
+			"report.md":   "markdown",
+			"report.csv":  "csv",
+			"report.json": "json",
+		} {
+			if err := writeReportFile(filepath.Join(saveDir, name), format, rows); err != nil {
+				return err
+			}
+		}
+		logger.Info("Saved report", "dir", saveDir, "models", len(rows))
+	}
+	return writeReport(os.Stdout, output, rows)
+}
+
+// Report aggregates the stored results of run runID, or of every run when
+// runID is "", priced from --prices, as `gpumon eval report` does.
+func Report(logger *slog.Logger, runID string) ([]*ReportRow, error) {
+	var prices priceTable
+	if pricesPath := viper.GetString("prices"); pricesPath != "" {
+		var err error
+		if prices, err = loadPrices(pricesPath); err != nil {
+			return nil, err
+		}
+	}
+	return collectReport(logger, runRoot(runID), prices)
+}
+
+// collectReport aggregates every meta.json under root. Generations recorded
+// without a cost are priced from prices, which may be nil.
+func collectReport(logger *slog.Logger, root string, prices priceTable) ([]*ReportRow, error) {
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil, fmt.Errorf("no %q directory found", root)
+	}
+	byKey := map[string]*ReportRow{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, e error) error {
+		if e != nil {
+			logger.Error("filepath walk error", "path", p, "err", e)
+			return nil
+		}
+		if d.IsDir() || d.Name() != "meta.json" {
+			return nil
+		}
+		meta, err := loadMeta(p)
+		if err != nil {
+			logger.Error("Skipping unreadable meta", "path", p, "err", err)
+			return nil
+		}
+		variant := meta.Variant()
+		key := meta.Model + "\x00" + variant
+		row, ok := byKey[key]
+		if !ok {
+			row = &ReportRow{Model: meta.Model, Backend: meta.Backend, Variant: variant}
+			if row.Backend == "" {
+				// Results from before remote backends were all from Ollama.
+				row.Backend = llm.NameOllama
+			}
+			byKey[key] = row
+		}
+		row.Runs++
+		if meta.ConformingJSON {
+			row.Conforming++
+			if b, err := os.ReadFile(filepath.Join(filepath.Dir(p), "result.json")); err == nil {
+				row.texts = append(row.texts, string(b))
+			}
+		}
+		if meta.Think != "" {
+			row.thinks++
+		}
+		if meta.Repaired {
+			row.repaired++
+		}
+		if meta.CostUSD > 0 {
+			row.TotalCostUSD += meta.CostUSD
+		} else if cost, ok := prices.Cost(meta.Model, meta.PromptTokens, meta.OutputTokens); ok {
+			row.TotalCostUSD += cost
+		}
+		if len(meta.Corrections) > 0 {
+			row.reprompts++
+			if meta.SelfCorrected {
+				row.corrected++
+			}
+		}
+		if len(meta.Turns) > 0 {
+			row.Consistency += meta.Consistency
+			row.multiTurn++
+		}
+		if meta.LatencyMS > 0 && !meta.Cached {
+			// A cache hit's wall time says nothing about the model.
+			row.MeanLatencyMS += meta.LatencyMS
+			row.latencies++
+		}
+		if meta.TokensPerSec > 0 {
+			row.TokensPerSec += meta.TokensPerSec
+			row.speeds++
+		}
+		if meta.TTFTMS > 0 && !meta.Cached {
+			row.TTFTMS += meta.TTFTMS
+			row.ttfts++
+		}
+		if ev, err := loadEvaluation(evaluationPath(filepath.Dir(p))); err == nil && ev.JudgeModel != "" && ev.Error == "" {
+			row.Judged++
+			row.Creativity += ev.Scores.Creativity
+			row.Coherence += ev.Scores.Coherence
+			row.BackstoryQuality += ev.Scores.BackstoryQuality
+			if len(ev.Judges) > 1 {
+				row.JudgeAgreement += ev.Agreement
+				row.ensembled++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]*ReportRow, 0, len(byKey))
+	for _, row := range byKey {
+		row.ConformanceRate = float64(row.Conforming) / float64(row.Runs)
+		row.ThinkRate = float64(row.thinks) / float64(row.Runs)
+		row.RepairedRate = float64(row.repaired) / float64(row.Runs)
+		if row.latencies > 0 {
+			row.MeanLatencyMS /= float64(row.latencies)
+		}
+		if row.speeds > 0 {
+			row.TokensPerSec /= float64(row.speeds)
+		}
+		if row.ttfts > 0 {
+			row.TTFTMS /= float64(row.ttfts)
+		}
+		row.Diversity = textDiversity(row.texts)
+		if row.multiTurn > 0 {
+			row.Consistency /= float64(row.multiTurn)
+		}
+		if row.ensembled > 0 {
+			row.JudgeAgreement /= float64(row.ensembled)
+		}
+		if row.reprompts > 0 {
+			row.SelfCorrectRate = float64(row.corrected) / float64(row.reprompts)
+		}
+		if row.Conforming > 0 {
+			row.CostPerConforming = row.TotalCostUSD / float64(row.Conforming)
+		}
+		if row.Judged > 0 {
+			row.Creativity /= float64(row.Judged)
+			row.Coherence /= float64(row.Judged)
+			row.BackstoryQuality /= float64(row.Judged)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func sortReport(rows []*ReportRow, by string, desc bool) error {
+	var key func(r *ReportRow) float64
+	switch by {
+	case "model":
+		sort.Slice(rows, func(i, j int) bool {
+			if desc {
+				i, j = j, i
+			}
+			if rows[i].Model != rows[j].Model {
+				return rows[i].Model < rows[j].Model
+			}
+			return rows[i].Variant < rows[j].Variant
+		})
+		return nil
+	case "conformance":
+		key = func(r *ReportRow) float64 { return r.ConformanceRate }
+	case "creativity":
+		key = func(r *ReportRow) float64 { return r.Creativity }
+	case "coherence":
+		key = func(r *ReportRow) float64 { return r.Coherence }
+	case "backstory":
+		key = func(r *ReportRow) float64 { return r.BackstoryQuality }
+	case "latency":
+		key = func(r *ReportRow) float64 { return r.MeanLatencyMS }
+	case "speed":
+		key = func(r *ReportRow) float64 { return r.TokensPerSec }
+	case "ttft":
+		key = func(r *ReportRow) float64 { return r.TTFTMS }
+	case "think":
+		key = func(r *ReportRow) float64 { return r.ThinkRate }
+	case "self-correct":
+		key = func(r *ReportRow) float64 { return r.SelfCorrectRate }
+	case "consistency":
+		key = func(r *ReportRow) float64 { return r.Consistency }
+	case "diversity":
+		key = func(r *ReportRow) float64 { return r.Diversity }
+	case "cost":
+		key = func(r *ReportRow) float64 { return r.CostPerConforming }
+	default:
+		return fmt.Errorf("unknown sort column %q", by)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if desc {
+			return key(rows[i]) > key(rows[j])
+		}
+		return key(rows[i]) < key(rows[j])
+	})
+	return nil
+}
+
+func writeReportFile(path, format string, rows []*ReportRow) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	defer f.Close()
+	return writeReport(f, format, rows)
+}
+
+var reportHeader = []string{
+	"model", "backend", "variant", "runs", "conformance", "repaired", "judged",
+	"creativity", "coherence", "backstory", "judge_agreement", "mean_latency_ms", "tokens_per_sec", "ttft_ms", "think_rate",
+	"diversity", "consistency", "self_correct_rate", "cost_usd", "cost_per_conforming",
+}
+
+func reportRecord(r *ReportRow) []string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	usd := func(v float64) string { return strconv.FormatFloat(v, 'f', 6, 64) }
+	return []string{
+		r.Model, r.Backend, displayVariant(r.Variant), strconv.Itoa(r.Runs), f(r.ConformanceRate), f(r.RepairedRate), strconv.Itoa(r.Judged),
+		f(r.Creativity), f(r.Coherence), f(r.BackstoryQuality), f(r.JudgeAgreement), f(r.MeanLatencyMS), f(r.TokensPerSec), f(r.TTFTMS), f(r.ThinkRate),
+		f(r.Diversity), f(r.Consistency), f(r.SelfCorrectRate), usd(r.TotalCostUSD), usd(r.CostPerConforming),
+	}
+}
+
+func displayVariant(v string) string {
+	if v == "" {
+		return "default"
+	}
+	return v
+}
+
+func writeReport(w io.Writer, format string, rows []*ReportRow) error {
+	switch format {
+	case "markdown", "md":
+		fmt.Fprintf(w, "| %s |\n", strings.Join(reportHeader, " | "))
+		fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(reportHeader)))
+		for _, r := range rows {
+			fmt.Fprintf(w, "| %s |\n", strings.Join(reportRecord(r), " | "))
+		}
+		return nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write(reportHeader); err != nil {
+			return err
+		}
+		for _, r := range rows {
+			if err := cw.Write(reportRecord(r)); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	default:
+		return fmt.Errorf("unknown report format %q (want markdown, csv, or json)", format)
+	}
+}
@@ -0,0 +1,160 @@
+package oleval
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// RunManifest records everything needed to tell one experiment apart from
+// another. It is written to <out-dir>/<run-id>/manifest.json.
+type RunManifest struct {
+	RunID      string                 `json:"run_id"`
+	Experiment string                 `json:"experiment,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+	Models     []string               `json:"models"`
+	Tags       []string               `json:"tags"`
+	Format     string                 `json:"format,omitempty"`
+	Formats    []string               `json:"formats,omitempty"`
+	API        string                 `json:"api,omitempty"`
+	Sweeps     []string               `json:"sweeps,omitempty"`
+	Options    map[string]interface{} `json:"options,omitempty"`
+	Samples    int                    `json:"samples"`
+	Suite      string                 `json:"suite,omitempty"`
+	Tasks      []string               `json:"tasks,omitempty"`
+	Ablate     []string               `json:"ablate,omitempty"`
+	PromptHash string                 `json:"prompt_hash"`
+	GitSHA     string                 `json:"git_sha,omitempty"`
+}
+
+// newRunID returns a sortable ID: a UTC timestamp plus a short hash that
+// keeps concurrent runs started in the same second apart.
+func newRunID(models, tags []string) string {
+	now := time.Now().UTC()
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%s|%s",
+		now.UnixNano(), strings.Join(models, ","), strings.Join(tags, ","))))
+	return now.Format("20060102-150405") + "-" + hex.EncodeToString(sum[:])[:6]
+}
+
+// promptHash fingerprints the prompt templates: every suite task's, or the
+// override (an empty one meaning the built-in character prompt).
+func promptHash(prompt string, tasks []*Task) string {
+	if prompt == "" {
+		prompt = buildPrompt("")
+	}
+	if names := taskNames(tasks); len(names) > 0 {
+		var sb strings.Builder
+		for _, t := range tasks {
+			sb.WriteString(t.Name + "\x00" + t.Prompt + "\x00")
+		}
+		prompt = sb.String()
+	}
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// gitSHA returns the current commit of the working directory, or "" outside a
+// git checkout.
+func gitSHA() string {
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// outDir is the directory holding all runs, from --out-dir.
+func outDir() string {
+	if dir := viper.GetString("out.dir"); dir != "" {
+		return dir
+	}
+	return "gens"
+}
+
+// runRoot is the directory holding a run's results; an empty ID means every
+// run under the output directory.
+func runRoot(runID string) string {
+	if runID == "" {
+		return outDir()
+	}
+	return filepath.Join(outDir(), runID)
+}
+
+// resolveRun accepts either a run ID under the output directory or a path to a results
+// directory.
+func resolveRun(run string) string {
+	if _, err := os.Stat(filepath.Join(runRoot(run), "manifest.json")); err == nil {
+		return runRoot(run)
+	}
+	return run
+}
+
+// latestRunID returns the most recent run in the output directory, relying on run IDs
+// sorting chronologically.
+func latestRunID() (string, error) {
+	ids, err := runIDs()
+	if err != nil {
+		return "", err
+	}
+	if len(ids) == 0 {
+		return "", errors.New("no previous runs found")
+	}
+	return ids[len(ids)-1], nil
+}
+
+// runIDs lists the runs under the output directory, oldest first.
+func runIDs() ([]string, error) {
+	entries, err := os.ReadDir(outDir())
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(outDir(), e.Name(), "manifest.json")); err == nil {
+			ids = append(ids, e.Name())
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// completeRunIDs completes a run ID flag from the runs under --out-dir.
+func completeRunIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	ids, _ := runIDs()
+	return ids, cobra.ShellCompDirectiveNoFileComp
+}
+
+func writeManifest(m *RunManifest) error {
+	dir := runRoot(m.RunID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("mkdir: %w", err)
+	}
+	return writeJSONFile(filepath.Join(dir, "manifest.json"), m)
+}
+
+// loadManifest reads a run's manifest.json.
+func loadManifest(runID string) (*RunManifest, error) {
+	b, err := os.ReadFile(filepath.Join(runRoot(runID), "manifest.json"))
+	if err != nil {
+		return nil, fmt.Errorf("run %s: %w", runID, err)
+	}
+	var m RunManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("run %s manifest: %w", runID, err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,145 @@
+package oleval
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// jsonSchema is the subset of JSON Schema supported by --rules: types,
+// required properties, nested properties/items, numeric ranges, string and
+// array length bounds, and enums.
+type jsonSchema struct {
+	Type       string                 `json:"type,omitempty"`
+	Properties map[string]*jsonSchema `json:"properties,omitempty"`
+	Required   []string               `json:"required,omitempty"`
+	Items      *jsonSchema            `json:"items,omitempty"`
+	Enum       []interface{}          `json:"enum,omitempty"`
+	Minimum    *float64               `json:"minimum,omitempty"`
+	Maximum    *float64               `json:"maximum,omitempty"`
+	MinLength  *int                   `json:"minLength,omitempty"`
+	MaxLength  *int                   `json:"maxLength,omitempty"`
+	MinItems   *int                   `json:"minItems,omitempty"`
+	MaxItems   *int                   `json:"maxItems,omitempty"`
+}
+
+func loadSchema(path string) (*jsonSchema, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rules: %w", err)
+	}
+	var s jsonSchema
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("parse rules: %w", err)
+	}
+	return &s, nil
+}
+
+// Validate returns one message per violated constraint, each prefixed with
+// the path of the offending value.
+func (s *jsonSchema) Validate(v interface{}) []string {
+	var out []string
+	s.validate("$", v, &out)
+	return out
+}
+
+func (s *jsonSchema) validate(path string, v interface{}, out *[]string) {
+	fail := func(format string, args ...interface{}) {
+		*out = append(*out, path+": "+fmt.Sprintf(format, args...))
+	}
+	if s.Type != "" && !typeMatches(s.Type, v) {
+		fail("expected %s, got %s", s.Type, jsonType(v))
+		return
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("%v is not one of %v", v, s.Enum)
+		}
+	}
+
+	switch val := v.(type) {
+	case float64:
+		if s.Minimum != nil && val < *s.Minimum {
+			fail("%v is below minimum %v", val, *s.Minimum)
+		}
+		if s.Maximum != nil && val > *s.Maximum {
+			fail("%v exceeds maximum %v", val, *s.Maximum)
+		}
+	case string:
+		n := len([]rune(val))
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("length %d is below minLength %d", n, *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("length %d exceeds maxLength %d", n, *s.MaxLength)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(val) < *s.MinItems {
+			fail("%d items is below minItems %d", len(val), *s.MinItems)
+		}
+		if s.MaxItems != nil && len(val) > *s.MaxItems {
+			fail("%d items exceeds maxItems %d", len(val), *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range val {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, out)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if child, ok := val[name]; ok {
+				s.Properties[name].validate(path+"."+name, child, out)
+			}
+		}
+	}
+}
+
+func typeMatches(want string, v interface{}) bool {
+	got := jsonType(v)
+	if want == "number" && got == "integer" {
+		return true
+	}
+	return strings.EqualFold(want, got)
+}
+
+func jsonType(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if val == math.Trunc(val) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
@@ -0,0 +1,203 @@
+package oleval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"github.com/nathanleclaire/gpumon/internal/plugins"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// GenerateRequest is the body of POST /generate. Only Model is required;
+// the rest default as for the generate command.
+type GenerateRequest struct {
+	Model string `json:"model"`
+	// Backend is "ollama" (the default), "openai", or the name of a backend
+	// plugin.
+	Backend string                 `json:"backend,omitempty"`
+	Prompt  string                 `json:"prompt,omitempty"`
+	System  string                 `json:"system,omitempty"`
+	Format  string                 `json:"format,omitempty"`
+	API     string                 `json:"api,omitempty"`
+	Tags    []string               `json:"tags,omitempty"`
+	Options map[string]interface{} `json:"options,omitempty"`
+	Correct int                    `json:"correct,omitempty"`
+	Turns   []string               `json:"turns,omitempty"`
+	// Timeout is a Go duration such as "90s"; empty uses the server's
+	// --timeout.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// GenerateResponse carries the decoded result, a Character unless the rules
+// describe another document, with the same meta generate saves.
+type GenerateResponse struct {
+	Result any             `json:"result"`
+	Meta   *GenerationMeta `json:"meta"`
+	Raw    string          `json:"raw"`
+}
+
+type genServer struct {
+	clients *backends
+	base    genConfig
+}
+
+func serveGenerate(cmd *cobra.Command, logger *slog.Logger) error {
+	ctx, stop := interruptContext(cmd.Context())
+	defer stop()
+
+	addr, _ := cmd.Flags().GetString("addr")
+	cfg := genConfig{Logger: logger}
+	var err error
+	cfg.Retries, _ = cmd.Flags().GetInt("retries")
+	cfg.Backoff, _ = cmd.Flags().GetDuration("retry-backoff")
+	cfg.Timeout, _ = cmd.Flags().GetDuration("timeout")
+	if rulesPath := viper.GetString("rules"); rulesPath != "" {
+		if cfg.Rules, err = loadSchema(rulesPath); err != nil {
+			return err
+		}
+	}
+	if pricesPath := viper.GetString("prices"); pricesPath != "" {
+		if cfg.Prices, err = loadPrices(pricesPath); err != nil {
+			return err
+		}
+	}
+	if cfg.Cache, err = openResponseCache(); err != nil {
+		return err
+	}
+	defer cfg.Cache.logStats(logger)
+
+	s := &genServer{
+		clients: &backends{
+			ollama:  newOllamaClients("", nil),
+			openai:  llm.NewOpenAI(viper.GetString("openai.addr"), viper.GetString("openai.key")),
+			remote:  map[string]bool{},
+			plugins: plugins.NewBackends(logger),
+		},
+		base: cfg,
+	}
+	defer s.clients.plugins.Close()
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /generate", s.generate)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	logger.Info("Serving generation API", "addr", "http://"+addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// config turns a request into the generation settings, on top of the
+// server's own.
+func (s *genServer) config(ctx context.Context, req *GenerateRequest) (llm.Backend, genConfig, error) {
+	cfg := s.base
+	if req.Model == "" {
+		return nil, cfg, errors.New("model is required")
+	}
+	if _, err := formatField(req.Format); err != nil {
+		return nil, cfg, err
+	}
+	cfg.Format = req.Format
+	cfg.API = req.API
+	if cfg.API == "" {
+		cfg.API = "generate"
+	}
+	if cfg.API != "generate" && cfg.API != "chat" {
+		return nil, cfg, fmt.Errorf("unknown api %q (want generate or chat)", cfg.API)
+	}
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil {
+			return nil, cfg, fmt.Errorf("timeout: %w", err)
+		}
+		cfg.Timeout = d
+	}
+	cfg.Prompt = req.Prompt
+	cfg.System = req.System
+	cfg.Options = req.Options
+	cfg.Corrections = req.Correct
+	cfg.Turns = req.Turns
+
+	var client llm.Backend
+	switch req.Backend {
+	case "", llm.NameOllama:
+		c, err := s.clients.ollama.forModel(req.Model)
+		if err != nil {
+			return nil, cfg, err
+		}
+		client = c
+	case llm.NameOpenAI:
+		client = s.clients.openai
+	default:
+		c, err := s.clients.plugins.Get(ctx, req.Backend)
+		if err != nil {
+			return nil, cfg, fmt.Errorf("backend %q is not %s, %s or a backend plugin: %w", req.Backend, llm.NameOllama, llm.NameOpenAI, err)
+		}
+		client = c
+	}
+	if cfg.Format == "grammar" && client.Name() != llm.NameOpenAI {
+		return nil, cfg, errors.New("format grammar needs the openai backend")
+	}
+	return client, cfg, nil
+}
+
+func (s *genServer) generate(w http.ResponseWriter, r *http.Request) {
+	var req GenerateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+		return
+	}
+	client, cfg, err := s.config(r.Context(), &req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, span := otel.Tracer("character-generator").Start(r.Context(), "serve_generate")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("model", req.Model),
+		attribute.String("backend", client.Name()),
+	)
+	genCtx, cancel := llm.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	s.base.Logger.Info("Generating", "model", req.Model, "backend", client.Name(), "remote", r.RemoteAddr)
+	result, meta := generateOne(genCtx, client, req.Model, req.Tags, nil, cfg)
+	span.SetAttributes(attribute.String("generation.status", meta.Status))
+
+	status := http.StatusOK
+	switch meta.Status {
+	case statusFailed, statusInterrupted:
+		status = http.StatusBadGateway
+	case statusTimeout:
+		status = http.StatusGatewayTimeout
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(&GenerateResponse{Result: result, Meta: meta, Raw: meta.raw}); err != nil {
+		s.base.Logger.Error("Write response failed", "err", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
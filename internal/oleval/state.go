@@ -0,0 +1,163 @@
+package oleval
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// recoverOverridable are the flags that may differ from the recorded command
+// line when recovering a run: where to reach the backend, how hard to try,
+// and where telemetry goes. Anything that changes what is generated may not.
+var recoverOverridable = map[string]bool{
+	"ollama-addr":         true,
+	"openai-addr":         true,
+	"timeout":             true,
+	"retries":             true,
+	"retry-backoff":       true,
+	"gpu-sample-interval": true,
+	"collector":           true,
+	"plugin-dir":          true,
+	"store":               true,
+	"out-dir":             true,
+	"no-cache":            true,
+	"cache-dir":           true,
+	"log-level":           true,
+	"log-format":          true,
+	"config":              true,
+	"honeycomb-key":       true,
+	"otel-endpoint":       true,
+	"otel-service-name":   true,
+	"otel-trace-exporter": true,
+	"otel-disabled":       true,
+	"otel-local-only":     true,
+}
+
+// runState is the checkpoint a generate run keeps in
+// <out-dir>/<run-id>/state.json. Completed holds the result directory of
+// every model×tag×variant×sample combination that finished, relative to the
+// run; Args is the original command line, replayed by --recover.
+type runState struct {
+	RunID     string               `json:"run_id"`
+	Args      []string             `json:"args"`
+	StartedAt time.Time            `json:"started_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+	Done      bool                 `json:"done"`
+	Completed map[string]time.Time `json:"completed"`
+
+	mu sync.Mutex
+}
+
+func statePath(runID string) string {
+	return filepath.Join(runRoot(runID), "state.json")
+}
+
+func loadRunState(runID string) (*runState, error) {
+	data, err := os.ReadFile(statePath(runID))
+	if err != nil {
+		return nil, fmt.Errorf("run state: %w", err)
+	}
+	var st runState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("run state %s: %w", statePath(runID), err)
+	}
+	if st.Completed == nil {
+		st.Completed = map[string]time.Time{}
+	}
+	return &st, nil
+}
+
+// restoreFlags replays the recorded command line onto cmd so the recovered
+// run uses the original models, tags, sweeps and options. Flags given on
+// this invocation are re-applied on top and must be overridable.
+func (st *runState) restoreFlags(cmd *cobra.Command) error {
+	current := map[string]string{}
+	var bad []string
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if f.Name == "recover" {
+			return
+		}
+		if !recoverOverridable[f.Name] {
+			bad = append(bad, "--"+f.Name)
+			return
+		}
+		current[f.Name] = f.Value.String()
+	})
+	if len(bad) > 0 {
+		return fmt.Errorf("--recover replays the original flags; %v cannot be changed", bad)
+	}
+	if err := cmd.Flags().Parse(st.Args); err != nil {
+		return fmt.Errorf("replay flags of run %s: %w", st.RunID, err)
+	}
+	for name, v := range current {
+		if err := cmd.Flags().Set(name, v); err != nil {
+			return err
+		}
+	}
+	return cmd.Flags().Set("run-id", st.RunID)
+}
+
+func (st *runState) completed(dir string) bool {
+	if st == nil {
+		return false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	_, ok := st.Completed[st.key(dir)]
+	return ok
+}
+
+// markCompleted records dir as finished and checkpoints the state.
+func (st *runState) markCompleted(dir string) error {
+	if st == nil {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.Completed[st.key(dir)] = time.Now()
+	return st.saveLocked()
+}
+
+func (st *runState) finish() error {
+	if st == nil {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.Done = true
+	return st.saveLocked()
+}
+
+func (st *runState) save() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.saveLocked()
+}
+
+// saveLocked writes the state to a temporary file and renames it into place,
+// so a crash mid-write never leaves a truncated checkpoint.
+func (st *runState) saveLocked() error {
+	st.UpdatedAt = time.Now()
+	path := statePath(st.RunID)
+	tmp := path + ".tmp"
+	if err := writeJSONFile(tmp, st); err != nil {
+		return fmt.Errorf("run state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("run state: %w", err)
+	}
+	return nil
+}
+
+func (st *runState) key(dir string) string {
+	if rel, err := filepath.Rel(runRoot(st.RunID), dir); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(dir)
+}
@@ -0,0 +1,149 @@
+package oleval
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+const storeSchema = `
+CREATE TABLE IF NOT EXISTS generations (
+	id             INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp      TEXT NOT NULL,
+	model          TEXT NOT NULL,
+	tags           TEXT NOT NULL,
+	format         TEXT NOT NULL,
+	api            TEXT NOT NULL DEFAULT '',
+	backend        TEXT NOT NULL DEFAULT '',
+	params         TEXT NOT NULL,
+	variant        TEXT NOT NULL DEFAULT '',
+	options        TEXT NOT NULL,
+	status         TEXT NOT NULL,
+	conforming     INTEGER NOT NULL,
+	error_kind     TEXT NOT NULL,
+	parse_error    TEXT NOT NULL,
+	attempts       INTEGER NOT NULL,
+	latency_ms     REAL NOT NULL,
+	prompt_tokens  INTEGER NOT NULL,
+	output_tokens  INTEGER NOT NULL,
+	tokens_per_sec REAL NOT NULL,
+	cost_usd       REAL NOT NULL DEFAULT 0,
+	result_dir     TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS evaluations (
+	id                INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp         TEXT NOT NULL,
+	model             TEXT NOT NULL,
+	tags              TEXT NOT NULL,
+	format            TEXT NOT NULL,
+	params            TEXT NOT NULL,
+	variant           TEXT NOT NULL DEFAULT '',
+	judge_model       TEXT NOT NULL,
+	prompt_version    TEXT NOT NULL,
+	creativity        REAL NOT NULL,
+	coherence         REAL NOT NULL,
+	backstory_quality REAL NOT NULL,
+	agreement         REAL NOT NULL DEFAULT 0,
+	error             TEXT NOT NULL,
+	result_dir        TEXT NOT NULL
+);
+`
+
+// storeMigrations add columns introduced after a store was first created.
+// Each runs on open; "duplicate column" errors mean it was already applied.
+var storeMigrations = []string{
+	`ALTER TABLE generations ADD COLUMN cost_usd REAL NOT NULL DEFAULT 0`,
+	`ALTER TABLE generations ADD COLUMN backend TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE evaluations ADD COLUMN agreement REAL NOT NULL DEFAULT 0`,
+}
+
+// sqlStore mirrors generations and evaluations into a SQL database so results
+// can be queried without walking the results tree. A nil *sqlStore records
+// nothing.
+type sqlStore struct {
+	db *sql.DB
+}
+
+// openStore opens the store named by a --store URL. Only sqlite:// is
+// supported; an empty spec disables the store.
+func openStore(spec string) (*sqlStore, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	path, ok := strings.CutPrefix(spec, "sqlite://")
+	if !ok || path == "" {
+		return nil, fmt.Errorf("unsupported store %q (want sqlite://path)", spec)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open store: %w", err)
+	}
+	// SQLite allows a single writer; serialise access from concurrent
+	// evaluate workers instead of surfacing SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(storeSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create store schema: %w", err)
+	}
+	for _, m := range storeMigrations {
+		if _, err := db.Exec(m); err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			db.Close()
+			return nil, fmt.Errorf("migrate store: %w", err)
+		}
+	}
+	return &sqlStore{db: db}, nil
+}
+
+func (s *sqlStore) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+func (s *sqlStore) RecordGeneration(ctx context.Context, meta *GenerationMeta, dir string) error {
+	if s == nil {
+		return nil
+	}
+	tags, _ := json.Marshal(meta.Tags)
+	opts, _ := json.Marshal(meta.Options)
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO generations (
+	timestamp, model, tags, format, api, backend, params, variant, options, status,
+	conforming, error_kind, parse_error, attempts, latency_ms, prompt_tokens,
+	output_tokens, tokens_per_sec, cost_usd, result_dir
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		meta.Timestamp.UTC().Format("2006-01-02T15:04:05.000Z"), meta.Model, string(tags),
+		meta.Format, meta.API, meta.Backend, meta.Params.Key(), meta.Variant(), string(opts), meta.Status, meta.ConformingJSON,
+		meta.ErrorKind, meta.ParseError, meta.Attempts, meta.LatencyMS, meta.PromptTokens,
+		meta.OutputTokens, meta.TokensPerSec, meta.CostUSD, dir,
+	)
+	if err != nil {
+		return fmt.Errorf("record generation: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) RecordEvaluation(ctx context.Context, meta *GenerationMeta, ev *Evaluation, dir string) error {
+	if s == nil {
+		return nil
+	}
+	tags, _ := json.Marshal(meta.Tags)
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO evaluations (
+	timestamp, model, tags, format, params, variant, judge_model, prompt_version,
+	creativity, coherence, backstory_quality, agreement, error, result_dir
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		ev.Timestamp.UTC().Format("2006-01-02T15:04:05.000Z"), meta.Model, string(tags),
+		meta.Format, meta.Params.Key(), meta.Variant(), ev.JudgeModel, ev.PromptVersion,
+		ev.Scores.Creativity, ev.Scores.Coherence, ev.Scores.BackstoryQuality, ev.Agreement, ev.Error, dir,
+	)
+	if err != nil {
+		return fmt.Errorf("record evaluation: %w", err)
+	}
+	return nil
+}
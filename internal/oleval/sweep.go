@@ -0,0 +1,54 @@
+package oleval
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nathanleclaire/gpumon/internal/llm"
+)
+
+// paramSet is one combination of model options produced by --sweep.
+type paramSet map[string]interface{}
+
+// Key renders the set as a stable, path-safe identifier such as
+// "temperature=0.2_top_p=0.9". The empty set renders as "".
+func (p paramSet) Key() string {
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, p[k]))
+	}
+	return strings.Join(parts, "_")
+}
+
+// parseSweeps expands flags of the form "name=v1,v2,v3" into the
+// cross-product of all values. With no sweeps it returns a single empty set
+// so callers can always range over the result.
+func parseSweeps(specs []string) ([]paramSet, error) {
+	sets := []paramSet{{}}
+	for _, spec := range specs {
+		name, vals, ok := strings.Cut(spec, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || vals == "" {
+			return nil, fmt.Errorf("invalid sweep %q (want name=v1,v2)", spec)
+		}
+		var next []paramSet
+		for _, set := range sets {
+			for _, v := range strings.Split(vals, ",") {
+				ps := paramSet{}
+				for k, existing := range set {
+					ps[k] = existing
+				}
+				ps[name] = llm.ParseOptionValue(strings.TrimSpace(v))
+				next = append(next, ps)
+			}
+		}
+		sets = next
+	}
+	return sets, nil
+}
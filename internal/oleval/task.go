@@ -0,0 +1,146 @@
+package oleval
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Task is one structured-output scenario from a --suite directory. Each task
+// lives in its own subdirectory with a task.yaml:
+//
+//	name: recipe                # defaults to the directory name
+//	prompt_file: prompt.tmpl    # or an inline prompt:
+//	schema_file: schema.json    # JSON Schema for validation and --format schema
+//	validator: schema           # schema (default) or character
+//	turns:                      # optional follow-up prompts
+//	  - Now make it vegetarian and return the updated JSON.
+//
+// Prompts are text/template templates rendered with .Model and .Tags. File
+// paths are relative to the task directory.
+type Task struct {
+	Name       string   `yaml:"name"`
+	Prompt     string   `yaml:"prompt"`
+	PromptFile string   `yaml:"prompt_file"`
+	SchemaFile string   `yaml:"schema_file"`
+	Validator  string   `yaml:"validator"`
+	Turns      []string `yaml:"turns"`
+
+	tmpl      *template.Template
+	schema    *jsonSchema
+	schemaRaw json.RawMessage
+}
+
+// loadSuite loads every subdirectory of dir that contains a task.yaml, in
+// name order.
+func loadSuite(dir string) ([]*Task, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read suite: %w", err)
+	}
+	var tasks []*Task
+	seen := map[string]bool{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		taskDir := filepath.Join(dir, e.Name())
+		if _, err := os.Stat(filepath.Join(taskDir, "task.yaml")); err != nil {
+			continue
+		}
+		t, err := loadTask(taskDir)
+		if err != nil {
+			return nil, fmt.Errorf("task %s: %w", e.Name(), err)
+		}
+		if seen[t.Name] {
+			return nil, fmt.Errorf("duplicate task name %q", t.Name)
+		}
+		seen[t.Name] = true
+		tasks = append(tasks, t)
+	}
+	if len(tasks) == 0 {
+		return nil, fmt.Errorf("no tasks (subdirectories with task.yaml) in %s", dir)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Name < tasks[j].Name })
+	return tasks, nil
+}
+
+func loadTask(dir string) (*Task, error) {
+	b, err := os.ReadFile(filepath.Join(dir, "task.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	var t Task
+	if err := yaml.Unmarshal(b, &t); err != nil {
+		return nil, fmt.Errorf("parse task.yaml: %w", err)
+	}
+	if t.Name == "" {
+		t.Name = filepath.Base(dir)
+	}
+	if t.PromptFile != "" {
+		p, err := os.ReadFile(filepath.Join(dir, t.PromptFile))
+		if err != nil {
+			return nil, fmt.Errorf("read prompt file: %w", err)
+		}
+		t.Prompt = string(p)
+	}
+	if strings.TrimSpace(t.Prompt) == "" {
+		return nil, fmt.Errorf("no prompt or prompt_file")
+	}
+	if t.tmpl, err = template.New(t.Name).Option("missingkey=error").Parse(t.Prompt); err != nil {
+		return nil, fmt.Errorf("parse prompt template: %w", err)
+	}
+	if t.SchemaFile != "" {
+		path := filepath.Join(dir, t.SchemaFile)
+		if t.schema, err = loadSchema(path); err != nil {
+			return nil, err
+		}
+		if t.schemaRaw, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	switch t.Validator {
+	case "":
+		t.Validator = "schema"
+	case "schema", "character":
+	default:
+		return nil, fmt.Errorf("unknown validator %q (want schema or character)", t.Validator)
+	}
+	return &t, nil
+}
+
+// render fills the prompt template for one model and tag set.
+func (t *Task) render(model string, tags []string) (string, error) {
+	var sb strings.Builder
+	err := t.tmpl.Execute(&sb, struct {
+		Model string
+		Tags  []string
+	}{model, tags})
+	if err != nil {
+		return "", fmt.Errorf("render prompt for task %s: %w", t.Name, err)
+	}
+	return sb.String(), nil
+}
+
+// decodesCharacter reports whether results are decoded as a Character, as for
+// the built-in task (t == nil), rather than as arbitrary JSON.
+func (t *Task) decodesCharacter() bool {
+	return t == nil || t.Validator == "character"
+}
+
+// taskNames lists tasks for the run manifest.
+func taskNames(tasks []*Task) []string {
+	var names []string
+	for _, t := range tasks {
+		if t != nil {
+			names = append(names, t.Name)
+		}
+	}
+	return names
+}
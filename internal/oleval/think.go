@@ -0,0 +1,110 @@
+package oleval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// charsPerToken approximates tokenisation for think text, whose own token
+// count Ollama does not report separately.
+const charsPerToken = 4
+
+// thinkStats describes one result's reasoning block.
+type thinkStats struct {
+	Present bool `json:"present"`
+	// Tokens is estimated from the think text's length and capped at the
+	// generation's output token count.
+	Tokens int `json:"tokens"`
+	// Ratio is think tokens over answer tokens (output minus think).
+	Ratio float64 `json:"ratio"`
+	// JSONLeak is set when a parseable JSON object appears inside the think
+	// block, i.e. the model drafted its answer while reasoning.
+	JSONLeak bool `json:"json_leak"`
+}
+
+func analyzeThink(meta *GenerationMeta) thinkStats {
+	think := strings.TrimSpace(meta.Think)
+	if think == "" {
+		return thinkStats{}
+	}
+	st := thinkStats{Present: true}
+	st.Tokens = (utf8.RuneCountInString(think) + charsPerToken - 1) / charsPerToken
+	if meta.OutputTokens > 0 {
+		st.Tokens = min(st.Tokens, meta.OutputTokens)
+		st.Ratio = float64(st.Tokens) / float64(max(meta.OutputTokens-st.Tokens, 1))
+	}
+	if block := extractBalancedObject(think); block != "" {
+		st.JSONLeak = json.Valid([]byte(block))
+	}
+	return st
+}
+
+// thinkSummary aggregates thinkStats per model and variant. Token and ratio
+// means are over results that had a think block.
+type thinkSummary struct {
+	Model       string
+	Variant     string
+	Results     int
+	WithThink   int
+	MeanTokens  float64
+	MeanRatio   float64
+	JSONLeakPct float64
+	leaks       int
+}
+
+func summarizeThink(metaPaths []string) []*thinkSummary {
+	byKey := map[string]*thinkSummary{}
+	for _, p := range metaPaths {
+		meta, err := loadMeta(p)
+		if err != nil {
+			continue
+		}
+		key := meta.Model + "\x00" + meta.Variant()
+		s, ok := byKey[key]
+		if !ok {
+			s = &thinkSummary{Model: meta.Model, Variant: meta.Variant()}
+			byKey[key] = s
+		}
+		s.Results++
+		st := analyzeThink(meta)
+		if !st.Present {
+			continue
+		}
+		s.WithThink++
+		s.MeanTokens += float64(st.Tokens)
+		s.MeanRatio += st.Ratio
+		if st.JSONLeak {
+			s.leaks++
+		}
+	}
+	out := make([]*thinkSummary, 0, len(byKey))
+	for _, s := range byKey {
+		if s.WithThink > 0 {
+			s.MeanTokens /= float64(s.WithThink)
+			s.MeanRatio /= float64(s.WithThink)
+			s.JSONLeakPct = float64(s.leaks) / float64(s.WithThink)
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Model != out[j].Model {
+			return out[i].Model < out[j].Model
+		}
+		return out[i].Variant < out[j].Variant
+	})
+	return out
+}
+
+func writeThinkSummary(w io.Writer, rows []*thinkSummary) {
+	fmt.Fprintln(w, "| model | variant | results | think_rate | mean_think_tokens | think_answer_ratio | json_leak_rate |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- | --- | --- | --- |")
+	for _, r := range rows {
+		fmt.Fprintf(w, "| %s | %s | %d | %.2f | %.0f | %.2f | %.2f |\n",
+			r.Model, displayVariant(r.Variant), r.Results,
+			float64(r.WithThink)/float64(r.Results), r.MeanTokens, r.MeanRatio, r.JSONLeakPct)
+	}
+}
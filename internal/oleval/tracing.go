@@ -0,0 +1,23 @@
+package oleval
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// generationLink is a span link to the inference span recorded in meta, if
+// the result was generated with tracing on.
+func generationLink(meta *GenerationMeta) (trace.Link, bool) {
+	tid, err := trace.TraceIDFromHex(meta.TraceID)
+	if err != nil {
+		return trace.Link{}, false
+	}
+	sid, err := trace.SpanIDFromHex(meta.SpanID)
+	if err != nil {
+		return trace.Link{}, false
+	}
+	return trace.Link{
+		SpanContext: trace.NewSpanContext(trace.SpanContextConfig{TraceID: tid, SpanID: sid, TraceFlags: trace.FlagsSampled, Remote: true}),
+		Attributes:  []attribute.KeyValue{attribute.String("link.kind", "generation")},
+	}, true
+}
@@ -0,0 +1,178 @@
+package oleval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"github.com/ollama/ollama/api"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// turnMeta records one follow-up turn. KeyRetention is the fraction of the
+// previous answer's top-level keys still present in this one; ChangedKeys
+// lists the retained keys whose values differ.
+type turnMeta struct {
+	Turn           int      `json:"turn"`
+	Prompt         string   `json:"prompt"`
+	ConformingJSON bool     `json:"conforming_json"`
+	ErrorKind      string   `json:"error_kind,omitempty"`
+	ParseError     string   `json:"parse_error,omitempty"`
+	Violations     []string `json:"violations,omitempty"`
+	KeyRetention   float64  `json:"key_retention"`
+	ChangedKeys    []string `json:"changed_keys,omitempty"`
+	LatencyMS      float64  `json:"latency_ms,omitempty"`
+	OutputTokens   int      `json:"output_tokens,omitempty"`
+
+	result any
+	raw    string
+}
+
+// conversation carries a multi-turn exchange: as chat history for /api/chat
+// and as the returned context for /api/generate.
+type conversation struct {
+	client     llm.Backend
+	model      string
+	format     json.RawMessage
+	options    map[string]interface{}
+	cfg        genConfig
+	history    []api.Message
+	genContext []int
+	// prompt and answer are the last exchange, not yet in history.
+	prompt, answer string
+}
+
+func newConversation(client llm.Backend, model string, format json.RawMessage, options map[string]interface{},
+	cfg genConfig, prompt, answer string, genContext []int) *conversation {
+	return &conversation{
+		client: client, model: model, format: format, options: options, cfg: cfg,
+		history: append([]api.Message(nil), cfg.History...), genContext: genContext,
+		prompt: prompt, answer: answer,
+	}
+}
+
+// send asks next in the conversation and returns the streamed answer, which
+// becomes the last exchange.
+func (cv *conversation) send(ctx context.Context, next string) (string, api.Metrics, error) {
+	cv.history = append(cv.history,
+		api.Message{Role: "user", Content: cv.prompt},
+		api.Message{Role: "assistant", Content: cv.answer})
+	tcfg := cv.cfg
+	tcfg.History = cv.history
+	tcfg.Context = cv.genContext
+
+	var out strings.Builder
+	var metrics api.Metrics
+	genContext := cv.genContext
+	_, err := llm.WithRetry(ctx, cv.cfg.Logger, cv.cfg.Retries, cv.cfg.Backoff, func(attempt int) error {
+		out.Reset()
+		var err error
+		metrics, genContext, _, err = cv.cfg.Cache.complete(ctx, cv.client, cv.model, next, cv.format, cv.options, tcfg, func(chunk string) {
+			cv.cfg.Dashboard.streamed(cv.model, chunk)
+			out.WriteString(chunk)
+		})
+		cv.cfg.Dashboard.streamEnd()
+		return err
+	})
+	cv.genContext = genContext
+	cv.prompt, cv.answer = next, out.String()
+	return out.String(), metrics, err
+}
+
+// runFollowUps sends cfg.Turns one after another in the conversation started
+// by the first prompt and answer. It stops at the first turn that fails to
+// stream; later turns would have nothing to build on.
+func runFollowUps(ctx context.Context, client llm.Backend, model string, format json.RawMessage,
+	options map[string]interface{}, cfg genConfig, prompt, answer string, genContext []int, first parsedOutput) []turnMeta {
+
+	cv := newConversation(client, model, format, options, cfg, prompt, answer, genContext)
+	prev := first
+	var turns []turnMeta
+	for i, followUp := range cfg.Turns {
+		turnCtx, span := otel.Tracer("character-generator").Start(ctx, "follow_up_turn",
+			trace.WithAttributes(
+				attribute.String("model", model),
+				attribute.Int("turn", i+2),
+			),
+		)
+		start := time.Now()
+		text, metrics, err := cv.send(turnCtx, followUp)
+		tm := turnMeta{
+			Turn:         i + 2,
+			Prompt:       followUp,
+			LatencyMS:    durationMS(time.Since(start)),
+			OutputTokens: metrics.EvalCount,
+			raw:          text,
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.End()
+			tm.ErrorKind, _ = llm.ClassifyError(err)
+			tm.ParseError = fmt.Sprintf("stream generation error: %v", err)
+			return append(turns, tm)
+		}
+
+		parsed := parseOutput(text, cfg)
+		tm.ConformingJSON = parsed.Conforming()
+		tm.ErrorKind = parsed.ErrorKind
+		tm.ParseError = parsed.Err
+		tm.Violations = parsed.Violations
+		tm.result = parsed.Result
+		tm.KeyRetention, tm.ChangedKeys = compareTurns(prev.Doc, parsed.Doc)
+		span.SetAttributes(
+			attribute.Bool("conforming_json", tm.ConformingJSON),
+			attribute.Float64("key_retention", tm.KeyRetention),
+		)
+		span.End()
+		turns = append(turns, tm)
+
+		if parsed.Result != nil {
+			prev = parsed
+		}
+	}
+	return turns
+}
+
+// compareTurns returns the fraction of prev's top-level keys present in next
+// and the retained keys whose values changed. Non-object answers retain
+// nothing.
+func compareTurns(prev, next interface{}) (float64, []string) {
+	p, ok := prev.(map[string]interface{})
+	if !ok || len(p) == 0 {
+		return 0, nil
+	}
+	n, _ := next.(map[string]interface{})
+	kept := 0
+	var changed []string
+	for k, pv := range p {
+		nv, ok := n[k]
+		if !ok {
+			continue
+		}
+		kept++
+		if !reflect.DeepEqual(pv, nv) {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return float64(kept) / float64(len(p)), changed
+}
+
+// meanRetention averages KeyRetention over the follow-up turns.
+func meanRetention(turns []turnMeta) float64 {
+	if len(turns) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, t := range turns {
+		sum += t.KeyRetention
+	}
+	return sum / float64(len(turns))
+}
@@ -0,0 +1,220 @@
+package oleval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// uiStoreEnabled toggles the store link in the page header.
+var uiStoreEnabled bool
+
+var uiTemplates = template.Must(template.New("ui").Funcs(template.FuncMap{
+	"variant":      displayVariant,
+	"pct":          func(f float64) string { return fmt.Sprintf("%.0f%%", f*100) },
+	"num":          func(f float64) string { return fmt.Sprintf("%.2f", f) },
+	"storeEnabled": func() bool { return uiStoreEnabled },
+}).Parse(`
+{{define "head"}}<!doctype html>
+<html><head><meta charset="utf-8"><title>oleval{{if .}} – {{.}}{{end}}</title>
+<style>
+body{font-family:system-ui,sans-serif;margin:2em;max-width:72em}
+table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:.3em .6em;text-align:left}
+th{background:#f4f4f4}pre{background:#f8f8f8;padding:1em;overflow-x:auto;white-space:pre-wrap}
+.ok{color:#186a18}.bad{color:#a61b1b}
+</style></head><body><p><a href="/">runs</a>{{if storeEnabled}} · <a href="/store">store</a>{{end}}</p>{{end}}
+
+{{define "index"}}{{template "head" ""}}
+<h1>Runs</h1>
+<table><tr><th>run</th><th>experiment</th><th>created</th><th>models</th><th>samples</th></tr>
+{{range .}}<tr><td><a href="/run/{{.RunID}}">{{.RunID}}</a></td><td>{{.Experiment}}</td>
+<td>{{.CreatedAt.Format "2006-01-02 15:04"}}</td><td>{{len .Models}}</td><td>{{.Samples}}</td></tr>
+{{else}}<tr><td colspan="5">No runs found.</td></tr>{{end}}
+</table></body></html>{{end}}
+
+{{define "run"}}{{template "head" .RunID}}
+<h1>Run {{.RunID}}</h1>
+<table><tr><th>model</th><th>variant</th><th>runs</th><th>conformance</th><th>repaired</th>
+<th>judged</th><th>creativity</th><th>coherence</th><th>backstory</th><th>latency ms</th><th>think</th></tr>
+{{range .Rows}}<tr><td>{{.Model}}</td><td>{{variant .Variant}}</td><td>{{.Runs}}</td><td>{{pct .ConformanceRate}}</td>
+<td>{{pct .RepairedRate}}</td><td>{{.Judged}}</td><td>{{num .Creativity}}</td><td>{{num .Coherence}}</td>
+<td>{{num .BackstoryQuality}}</td><td>{{num .MeanLatencyMS}}</td><td>{{pct .ThinkRate}}</td></tr>{{end}}
+</table>
+<h2>Results</h2>
+<table><tr><th>result</th><th>status</th></tr>
+{{range .Results}}<tr><td><a href="/result?path={{.Path}}">{{.Path}}</a></td>
+<td class="{{if .Meta.ConformingJSON}}ok{{else}}bad{{end}}">{{.Meta.Status}}</td></tr>{{end}}
+</table></body></html>{{end}}
+
+{{define "result"}}{{template "head" .Path}}
+<h1>{{.Meta.Model}} <small>{{variant .Meta.Variant}}</small></h1>
+<p>Status: <b class="{{if .Meta.ConformingJSON}}ok{{else}}bad{{end}}">{{.Meta.Status}}</b>
+{{if .Meta.ParseError}} – {{.Meta.ParseError}}{{end}}</p>
+{{if and .Evaluation .Evaluation.JudgeModel}}<h2>Judge ({{.Evaluation.JudgeModel}}, {{.Evaluation.PromptVersion}})</h2>
+<p>creativity {{num .Evaluation.Scores.Creativity}} · coherence {{num .Evaluation.Scores.Coherence}} ·
+backstory {{num .Evaluation.Scores.BackstoryQuality}}</p><p>{{.Evaluation.Rationale}}</p>{{end}}
+{{with .Evaluation}}{{with .Embedding}}<h2>Embedding ({{.Model}})</h2>
+<p>constraint similarity {{num .ConstraintSimilarity}} · centroid similarity {{num .CentroidSimilarity}} ·
+nearest model {{.NearestModel}} · model distinctiveness {{num .ModelDistinctiveness}}</p>{{end}}{{end}}
+{{if .Character}}<h2>Character</h2><pre>{{.Character}}</pre>{{end}}
+{{if .Meta.Think}}<h2>Think</h2><pre>{{.Meta.Think}}</pre>{{end}}
+{{if .Raw}}<h2>Raw output</h2><pre>{{.Raw}}</pre>{{end}}
+<h2>Meta</h2><pre>{{.MetaJSON}}</pre>
+</body></html>{{end}}
+
+{{define "store"}}{{template "head" "store"}}
+<h1>Store: latest generations</h1>
+<table><tr><th>timestamp</th><th>model</th><th>variant</th><th>status</th><th>latency ms</th><th>tokens/s</th></tr>
+{{range .}}<tr><td>{{.Timestamp}}</td><td>{{.Model}}</td><td>{{variant .Variant}}</td><td>{{.Status}}</td>
+<td>{{num .LatencyMS}}</td><td>{{num .TokensPerSec}}</td></tr>{{end}}
+</table></body></html>{{end}}
+`))
+
+type uiResult struct {
+	Path string
+	Meta *GenerationMeta
+}
+
+type uiServer struct {
+	store  *sqlStore
+	logger *slog.Logger
+}
+
+func serveUI(cmd *cobra.Command, logger *slog.Logger) error {
+	addr, _ := cmd.Flags().GetString("addr")
+	store, err := openStore(viper.GetString("store"))
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ui := &uiServer{store: store, logger: logger}
+	uiStoreEnabled = store != nil
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", ui.index)
+	mux.HandleFunc("GET /run/{id}", ui.run)
+	mux.HandleFunc("GET /result", ui.result)
+	mux.HandleFunc("GET /store", ui.storeRows)
+	logger.Info("Serving results UI", "addr", "http://"+addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+func (u *uiServer) render(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := uiTemplates.ExecuteTemplate(w, name, data); err != nil {
+		u.logger.Error("Render failed", "template", name, "err", err)
+	}
+}
+
+func (u *uiServer) index(w http.ResponseWriter, r *http.Request) {
+	entries, err := os.ReadDir(outDir())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var runs []*RunManifest
+	for _, e := range entries {
+		var m RunManifest
+		b, err := os.ReadFile(filepath.Join(outDir(), e.Name(), "manifest.json"))
+		if err != nil || json.Unmarshal(b, &m) != nil {
+			continue
+		}
+		runs = append(runs, &m)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].RunID > runs[j].RunID })
+	u.render(w, "index", runs)
+}
+
+func (u *uiServer) run(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" || strings.ContainsAny(id, `/\`) || id == ".." {
+		http.NotFound(w, r)
+		return
+	}
+	root := runRoot(id)
+	rows, err := collectReport(u.logger, root, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := sortReport(rows, "model", false); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var results []uiResult
+	_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, e error) error {
+		if e != nil || d.IsDir() || d.Name() != "meta.json" {
+			return nil
+		}
+		if meta, err := loadMeta(p); err == nil {
+			results = append(results, uiResult{Path: filepath.Dir(p), Meta: meta})
+		}
+		return nil
+	})
+	u.render(w, "run", map[string]any{"RunID": id, "Rows": rows, "Results": results})
+}
+
+func (u *uiServer) result(w http.ResponseWriter, r *http.Request) {
+	dir := filepath.Clean(r.URL.Query().Get("path"))
+	if rel, err := filepath.Rel(outDir(), dir); err != nil || strings.HasPrefix(rel, "..") {
+		http.NotFound(w, r)
+		return
+	}
+	meta, err := loadMeta(filepath.Join(dir, "meta.json"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	metaJSON, _ := json.MarshalIndent(meta, "", "  ")
+	data := map[string]any{"Path": dir, "Meta": meta, "MetaJSON": string(metaJSON)}
+	if b, err := os.ReadFile(filepath.Join(dir, "result.json")); err == nil {
+		data["Character"] = string(b)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "raw.txt")); err == nil {
+		data["Raw"] = string(b)
+	}
+	if ev, err := loadEvaluation(evaluationPath(dir)); err == nil {
+		data["Evaluation"] = ev
+	}
+	u.render(w, "result", data)
+}
+
+func (u *uiServer) storeRows(w http.ResponseWriter, r *http.Request) {
+	if u.store == nil {
+		http.Error(w, "no --store configured", http.StatusNotFound)
+		return
+	}
+	rows, err := u.store.db.QueryContext(r.Context(), `
+SELECT timestamp, model, variant, status, latency_ms, tokens_per_sec
+FROM generations ORDER BY id DESC LIMIT 200`)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	type storeRow struct {
+		Timestamp, Model, Variant, Status string
+		LatencyMS, TokensPerSec           float64
+	}
+	var out []storeRow
+	for rows.Next() {
+		var sr storeRow
+		if err := rows.Scan(&sr.Timestamp, &sr.Model, &sr.Variant, &sr.Status, &sr.LatencyMS, &sr.TokensPerSec); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out = append(out, sr)
+	}
+	u.render(w, "store", out)
+}
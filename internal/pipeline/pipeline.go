@@ -0,0 +1,243 @@
+// Package pipeline runs a generation job and its evaluation end to end, as
+// the gpumon pipeline command. GPUs are sampled throughout, every stage
+// runs under one root span so the whole job is a single trace, and the
+// stages' results are combined into one report of quality against GPU
+// cost per example.
+package pipeline
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/internal/config"
+	"github.com/nathanleclaire/gpumon/internal/oleval"
+	"github.com/nathanleclaire/gpumon/internal/plugins"
+	"github.com/nathanleclaire/gpumon/pkg/collector"
+	"github.com/nathanleclaire/gpumon/pkg/export"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is the default service.name for the pipeline commands.
+const ServiceName = "gpumon-pipeline"
+
+// options are the settings shared by every profile.
+type options struct {
+	RunID       string
+	ReportDir   string
+	GPUInterval time.Duration
+	PricePerKWh float64
+}
+
+// NewCommand returns the pipeline command tree, logging to logger. Each
+// profile is a subcommand; arguments after -- go to its generation stage.
+func NewCommand(logger *slog.Logger) *cobra.Command {
+	var opts options
+	cmd := &cobra.Command{
+		Use:   "pipeline",
+		Short: "Generate, then evaluate, with GPU sampling, as one trace and one report",
+		Long: `Run a generation job and its evaluation as one pipeline: eval generates
+characters and judges them, synth generates a dataset and scores it.
+
+GPUs are sampled through every stage. While telemetry is on, the usual GPU
+metrics are exported tagged with pipeline.run_id and pipeline.stage, and
+every stage's spans sit under one pipeline root span. The combined report,
+written to <report-dir>/<run-id>/report.md and report.json and printed,
+sets the quality of the results against the GPU time and energy they cost
+per accepted example.`,
+	}
+	cmd.PersistentFlags().StringVar(&opts.RunID, "run-id",
+		"", "Pipeline run ID, also the eval run ID (default: new timestamped ID)")
+	cmd.PersistentFlags().StringVar(&opts.ReportDir, "report-dir",
+		"pipelines", "Directory holding each run's report and, for synth, its dataset")
+	cmd.PersistentFlags().DurationVar(&opts.GPUInterval, "gpu-sample-interval",
+		5*time.Second, "Sample GPUs from --collector at this interval throughout (0 disables)")
+	cmd.PersistentFlags().Float64Var(&opts.PricePerKWh, "price-per-kwh",
+		0, "Electricity price in USD per kWh, to cost the GPU energy per example (0 leaves it out)")
+	cmd.AddCommand(newEvalCmd(logger, &opts), newSynthCmd(logger, &opts))
+	return cmd
+}
+
+// run is one pipeline run in progress.
+type run struct {
+	logger *slog.Logger
+	opts   *options
+	root   *cobra.Command
+	dir    string
+	report Report
+}
+
+func newRun(cmd *cobra.Command, logger *slog.Logger, opts *options, profile string) (*run, error) {
+	id := opts.RunID
+	if id == "" {
+		id = newRunID()
+	}
+	dir := filepath.Join(opts.ReportDir, id)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create run directory: %w", err)
+	}
+	return &run{
+		logger: logger,
+		opts:   opts,
+		root:   cmd.Root(),
+		dir:    dir,
+		report: Report{RunID: id, Profile: profile, Started: time.Now(), Status: "ok"},
+	}, nil
+}
+
+// newRunID is a UTC timestamp plus a random suffix, like eval's run IDs.
+func newRunID() string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// start opens the pipeline's root span, the run marker every stage's spans
+// and metrics are tied to.
+func (r *run) start(ctx context.Context) (context.Context, trace.Span) {
+	ctx, span := otel.Tracer(ServiceName).Start(ctx, "pipeline", trace.WithAttributes(
+		attribute.String("pipeline.run_id", r.report.RunID),
+		attribute.String("pipeline.profile", r.report.Profile),
+	))
+	if sc := span.SpanContext(); sc.HasTraceID() {
+		r.report.TraceID = sc.TraceID().String()
+	}
+	r.logger.Info("Pipeline started", "run_id", r.report.RunID, "profile", r.report.Profile, "dir", r.dir)
+	return ctx, span
+}
+
+// stage runs the command line args under the root command, as if given to
+// gpumon, in a span of its own with the GPUs sampled and their metrics
+// tagged with the stage. It returns the command, so the caller can read
+// the flags it ended up with.
+func (r *run) stage(ctx context.Context, name string, args []string) (*cobra.Command, error) {
+	sr := StageReport{Name: name, Args: args, Status: "ok"}
+	start := time.Now()
+	ctx, span := otel.Tracer(ServiceName).Start(ctx, "stage_"+name, trace.WithAttributes(
+		attribute.String("pipeline.run_id", r.report.RunID),
+		attribute.String("pipeline.stage", name),
+		attribute.String("stage.command", strings.Join(args, " ")),
+	))
+	defer span.End()
+	// fail ends a stage that couldn't get as far as running.
+	fail := func(err error) (*cobra.Command, error) {
+		sr.WallTime = time.Since(start).Seconds()
+		return nil, r.endStage(span, sr, err)
+	}
+
+	var sampler *collector.Sampler
+	if r.opts.GPUInterval > 0 {
+		gpus, stop, err := plugins.OpenCollector(ctx, r.logger)
+		if err != nil {
+			return fail(err)
+		}
+		defer stop()
+		sampler = collector.StartSampler(ctx, gpus, r.opts.GPUInterval)
+		reg, err := export.RegisterGPUMetrics(otel.Meter("gpu-metrics"), gpus,
+			attribute.String("pipeline.run_id", r.report.RunID),
+			attribute.String("pipeline.stage", name))
+		if err != nil {
+			_, _ = sampler.Stop()
+			return fail(fmt.Errorf("callback registration error: %w", err))
+		}
+		defer func() { _ = reg.Unregister() }()
+	}
+
+	r.logger.Info("Stage started", "stage", name, "args", args)
+	cmd, err := execute(ctx, r.root, args)
+	sr.WallTime = time.Since(start).Seconds()
+	if sampler != nil {
+		if stats, serr := sampler.Stop(); serr != nil {
+			r.logger.Warn("GPU sampling failed", "stage", name, "err", serr)
+		} else if stats.Samples > 0 {
+			sr.GPU = newGPUStats(stats, sr.WallTime)
+			span.SetAttributes(
+				attribute.Float64("gpu.util_avg_percent", sr.GPU.UtilAvgPercent),
+				attribute.Float64("gpu.energy_wh", sr.GPU.EnergyWh),
+			)
+		}
+	}
+	return cmd, r.endStage(span, sr, err)
+}
+
+// endStage records sr in the report, marked failed and its span with it
+// if err is set, and returns err.
+func (r *run) endStage(span trace.Span, sr StageReport, err error) error {
+	if err != nil {
+		sr.Status, sr.Error = "failed", err.Error()
+		if errors.Is(err, oleval.ErrInterrupted) {
+			sr.Status = "interrupted"
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		r.report.Status = sr.Status
+	}
+	r.report.Stages = append(r.report.Stages, sr)
+	r.logger.Info("Stage finished", "stage", sr.Name, "status", sr.Status, "seconds", sr.WallTime)
+	return err
+}
+
+// execute runs args as a gpumon command line in-process. The root's
+// persistent pre-run, which set up logging, config and telemetry for the
+// pipeline command itself, is not run again.
+func execute(ctx context.Context, root *cobra.Command, args []string) (*cobra.Command, error) {
+	cmd, rest, err := root.Find(args)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.RunE == nil {
+		return nil, fmt.Errorf("%q is not a runnable command", strings.Join(args, " "))
+	}
+	cmd.SetContext(ctx)
+	if err := cmd.ParseFlags(rest); err != nil {
+		return cmd, err
+	}
+	if err := config.ApplyFlags(cmd); err != nil {
+		return cmd, err
+	}
+	if err := cmd.ValidateRequiredFlags(); err != nil {
+		return cmd, err
+	}
+	argv := cmd.Flags().Args()
+	if err := cmd.ValidateArgs(argv); err != nil {
+		return cmd, err
+	}
+	return cmd, cmd.RunE(cmd, argv)
+}
+
+// finish prices the GPU energy, writes the report and prints it, and
+// returns err, the first stage failure if any.
+func (r *run) finish(span trace.Span, err error) error {
+	rep := &r.report
+	rep.WallTime = time.Since(rep.Started).Seconds()
+	if err != nil && rep.Status == "ok" {
+		rep.Status = "failed"
+	}
+	rep.finish(r.opts.PricePerKWh)
+	span.SetAttributes(
+		attribute.String("pipeline.status", rep.Status),
+		attribute.Int("pipeline.examples", rep.Examples),
+		attribute.Int("pipeline.accepted", rep.Accepted),
+		attribute.Float64("pipeline.energy_wh", rep.EnergyWh),
+	)
+	span.End()
+
+	if werr := writeReport(r.dir, *rep); werr != nil {
+		err = errors.Join(err, werr)
+	} else {
+		r.logger.Info("Saved report", "dir", r.dir)
+	}
+	printReport(os.Stdout, *rep)
+	return err
+}
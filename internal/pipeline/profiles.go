@@ -0,0 +1,171 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nathanleclaire/gpumon/internal/oleval"
+	"github.com/nathanleclaire/gpumon/internal/synner"
+	"github.com/spf13/cobra"
+)
+
+// -----------------------------------------------------------------------------
+// eval profile
+// -----------------------------------------------------------------------------
+
+func newEvalCmd(logger *slog.Logger, opts *options) *cobra.Command {
+	var judgeModels []string
+	var judgeAgg, embedModel string
+	cmd := &cobra.Command{
+		Use:   "eval [-- eval generate flags]",
+		Short: "Run eval generate, then eval evaluate, and report conformance and judge scores against GPU cost",
+		Example: `  gpumon pipeline eval --judge-model llama3 -- --models qwen2.5,mistral --samples 5
+  gpumon pipeline eval --price-per-kwh 0.30 -- --experiment nightly.yaml`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := newRun(cmd, logger, opts, "eval")
+			if err != nil {
+				return err
+			}
+			ctx, span := r.start(cmd.Context())
+			return r.finish(span, r.runEval(ctx, args, judgeModels, judgeAgg, embedModel))
+		},
+	}
+	cmd.Flags().StringSliceVar(&judgeModels, "judge-model",
+		nil, "Judge model for eval evaluate; several form an ensemble (skipped if empty)")
+	cmd.Flags().StringVar(&judgeAgg, "judge-agg",
+		"", "How eval evaluate combines an ensemble's scores: mean, median, or majority (default: its own)")
+	cmd.Flags().StringVar(&embedModel, "embed-model",
+		"", "Embedding model for eval evaluate's similarity metrics (skipped if empty)")
+	_ = cmd.RegisterFlagCompletionFunc("judge-agg", cobra.FixedCompletions([]string{"mean", "median", "majority"}, cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+// runEval generates under the pipeline's run ID, unless args name another,
+// evaluates that run, and reports on it.
+func (r *run) runEval(ctx context.Context, args, judgeModels []string, judgeAgg, embedModel string) error {
+	gen, err := r.stage(ctx, "generate", append([]string{"eval", "generate", "--run-id", r.report.RunID}, args...))
+	if err != nil {
+		return err
+	}
+	runID, _ := gen.Flags().GetString("run-id")
+
+	evalArgs := []string{"eval", "evaluate", "--run", runID}
+	for _, m := range judgeModels {
+		evalArgs = append(evalArgs, "--judge-model", m)
+	}
+	if judgeAgg != "" {
+		evalArgs = append(evalArgs, "--judge-agg", judgeAgg)
+	}
+	if embedModel != "" {
+		evalArgs = append(evalArgs, "--embed-model", embedModel)
+	}
+	if _, err := r.stage(ctx, "evaluate", evalArgs); err != nil {
+		return err
+	}
+
+	rows, err := oleval.Report(r.logger, runID)
+	if err != nil {
+		return err
+	}
+	r.report.Eval = rows
+	for _, row := range rows {
+		r.report.Examples += row.Runs
+		r.report.Accepted += row.Conforming
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+// synth profile
+// -----------------------------------------------------------------------------
+
+func newSynthCmd(logger *slog.Logger, opts *options) *cobra.Command {
+	var scorer, rubric string
+	cmd := &cobra.Command{
+		Use:   "synth [-- synth generate flags]",
+		Short: "Run synth generate, then synth score, and report dataset scores against GPU cost",
+		Long: `Run synth generate into <report-dir>/<run-id>/dataset.jsonl, unless the
+generate flags give another --out-file, then score the dataset with
+--scorer on the same Ollama servers into scored.jsonl. Without --scorer,
+the report has the dataset's counts but no scores.`,
+		Example: `  gpumon pipeline synth --scorer llama3 -- --input-file romance.parquet --model mistral --max-examples 500`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := newRun(cmd, logger, opts, "synth")
+			if err != nil {
+				return err
+			}
+			ctx, span := r.start(cmd.Context())
+			return r.finish(span, r.runSynth(ctx, args, scorer, rubric))
+		},
+	}
+	cmd.Flags().StringVar(&scorer, "scorer",
+		"", "Ollama model or reward model URL for synth score (skipped if empty)")
+	cmd.Flags().StringVar(&rubric, "rubric",
+		"", "Rubric prompt template file for synth score (default: its own)")
+	return cmd
+}
+
+// runSynth generates a dataset, scores it if there is a scorer, and
+// reports on it.
+func (r *run) runSynth(ctx context.Context, args []string, scorer, rubric string) error {
+	gen, err := r.stage(ctx, "generate", append([]string{"synth", "generate",
+		"--out-file", filepath.Join(r.dir, "dataset.jsonl"),
+		"--report", filepath.Join(r.dir, "generate.json"),
+	}, args...))
+	if err != nil {
+		return err
+	}
+	dataset, _ := gen.Flags().GetString("out-file")
+	reportPath, _ := gen.Flags().GetString("report")
+	b, err := os.ReadFile(reportPath)
+	if err != nil {
+		return fmt.Errorf("failed to read generate report: %w", err)
+	}
+	var counts struct {
+		Accepted int `json:"accepted"`
+		Failed   int `json:"failed"`
+		Rejected int `json:"rejected"`
+	}
+	if err := json.Unmarshal(b, &counts); err != nil {
+		return fmt.Errorf("failed to parse generate report: %w", err)
+	}
+	r.report.Examples = counts.Accepted + counts.Failed + counts.Rejected
+	r.report.Accepted = counts.Accepted
+
+	if scorer != "" {
+		addrs, _ := gen.Flags().GetStringSlice("ollama-addr")
+		scored := filepath.Join(r.dir, "scored.jsonl")
+		scoreArgs := []string{"synth", "score", dataset, "--scorer", scorer, "--out", scored,
+			"--ollama-addr", strings.Join(addrs, ",")}
+		if rubric != "" {
+			scoreArgs = append(scoreArgs, "--rubric", rubric)
+		}
+		if _, err := r.stage(ctx, "score", scoreArgs); err != nil {
+			return err
+		}
+		dataset = scored
+	}
+
+	n, scores, err := synner.DatasetScores(dataset)
+	if err != nil {
+		return err
+	}
+	q := &SynthQuality{Dataset: dataset, Conversations: n}
+	for name, vs := range scores {
+		s := ScoreSummary{Name: name, N: len(vs), Min: slices.Min(vs), Max: slices.Max(vs)}
+		for _, v := range vs {
+			s.Mean += v
+		}
+		s.Mean /= float64(len(vs))
+		q.Scores = append(q.Scores, s)
+	}
+	slices.SortFunc(q.Scores, func(a, b ScoreSummary) int { return strings.Compare(a.Name, b.Name) })
+	r.report.Synth = q
+	return nil
+}
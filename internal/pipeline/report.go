@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/internal/oleval"
+	"github.com/nathanleclaire/gpumon/pkg/collector"
+)
+
+// Report is a pipeline run's combined report, saved as report.json.
+type Report struct {
+	RunID   string `json:"run_id"`
+	Profile string `json:"profile"`
+	Status  string `json:"status"`
+	// TraceID is the trace holding every stage's spans, when tracing is on.
+	TraceID  string        `json:"trace_id,omitempty"`
+	Started  time.Time     `json:"started"`
+	WallTime float64       `json:"wall_seconds"`
+	Stages   []StageReport `json:"stages"`
+
+	// Examples counts what the generation stage produced, and Accepted
+	// those that passed: conforming characters, or accepted conversations.
+	Examples int `json:"examples"`
+	Accepted int `json:"accepted"`
+
+	// The GPU totals are over every stage, evaluation included, and the
+	// per-example figures divide them by Accepted.
+	BusySeconds           float64  `json:"gpu_busy_seconds,omitempty"`
+	EnergyWh              float64  `json:"energy_wh,omitempty"`
+	BusySecondsPerExample float64  `json:"gpu_busy_seconds_per_example,omitempty"`
+	EnergyWhPerExample    float64  `json:"energy_wh_per_example,omitempty"`
+	CostPerExample        *float64 `json:"energy_cost_usd_per_example,omitempty"`
+
+	Eval  []*oleval.ReportRow `json:"eval,omitempty"`
+	Synth *SynthQuality       `json:"synth,omitempty"`
+}
+
+// StageReport is one stage's outcome and GPU load.
+type StageReport struct {
+	Name     string    `json:"name"`
+	Args     []string  `json:"args"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	WallTime float64   `json:"wall_seconds"`
+	GPU      *GPUStats `json:"gpu,omitempty"`
+}
+
+// GPUStats is the GPU load over one stage, from collector.Stats.
+type GPUStats struct {
+	Samples         int     `json:"samples"`
+	UtilAvgPercent  float64 `json:"util_avg_percent"`
+	UtilPeakPercent float64 `json:"util_peak_percent"`
+	MemoryPeakMiB   float64 `json:"memory_peak_mib"`
+	PowerAvgWatts   float64 `json:"power_avg_watts,omitempty"`
+	// BusySeconds is the stage's wall-clock time scaled by the average
+	// utilization; EnergyWh is the average power over it.
+	BusySeconds float64 `json:"busy_seconds"`
+	EnergyWh    float64 `json:"energy_wh,omitempty"`
+}
+
+func newGPUStats(s collector.Stats, seconds float64) *GPUStats {
+	return &GPUStats{
+		Samples:         s.Samples,
+		UtilAvgPercent:  s.AvgUtilPercent,
+		UtilPeakPercent: s.PeakUtilPercent,
+		MemoryPeakMiB:   float64(s.PeakMemoryBytes) / (1 << 20),
+		PowerAvgWatts:   s.AvgPowerWatts,
+		BusySeconds:     seconds * s.AvgUtilPercent / 100,
+		EnergyWh:        s.AvgPowerWatts * seconds / 3600,
+	}
+}
+
+// SynthQuality sums up the scores of a synth pipeline's dataset.
+type SynthQuality struct {
+	Dataset       string         `json:"dataset"`
+	Conversations int            `json:"conversations"`
+	Scores        []ScoreSummary `json:"scores,omitempty"`
+}
+
+// ScoreSummary is one scorer's scores over the dataset.
+type ScoreSummary struct {
+	Name string  `json:"name"`
+	N    int     `json:"n"`
+	Mean float64 `json:"mean"`
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+}
+
+// finish adds up the stages' GPU load and divides it over the accepted
+// examples, pricing energy at pricePerKWh when it is set.
+func (r *Report) finish(pricePerKWh float64) {
+	for _, s := range r.Stages {
+		if s.GPU != nil {
+			r.BusySeconds += s.GPU.BusySeconds
+			r.EnergyWh += s.GPU.EnergyWh
+		}
+	}
+	if r.Accepted == 0 {
+		return
+	}
+	r.BusySecondsPerExample = r.BusySeconds / float64(r.Accepted)
+	r.EnergyWhPerExample = r.EnergyWh / float64(r.Accepted)
+	if pricePerKWh > 0 && r.EnergyWh > 0 {
+		cost := r.EnergyWhPerExample / 1000 * pricePerKWh
+		r.CostPerExample = &cost
+	}
+}
+
+// writeReport saves r as report.json and report.md in dir.
+func writeReport(dir string, r Report) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "report.json"), append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	var sb strings.Builder
+	printReport(&sb, r)
+	if err := os.WriteFile(filepath.Join(dir, "report.md"), []byte(sb.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// printReport writes r as markdown.
+func printReport(w io.Writer, r Report) {
+	fmt.Fprintf(w, "## Pipeline %s (%s): %s in %s\n\n", r.RunID, r.Profile, r.Status,
+		time.Duration(r.WallTime*float64(time.Second)).Round(time.Second))
+	if r.TraceID != "" {
+		fmt.Fprintf(w, "Trace: %s\n\n", r.TraceID)
+	}
+
+	fmt.Fprintln(w, "| stage | status | time | gpu util avg | gpu util peak | gpu mem peak | energy |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- | --- | --- | --- |")
+	for _, s := range r.Stages {
+		status := s.Status
+		if s.Error != "" {
+			status += ": " + s.Error
+		}
+		gpu := "| - | - | - | -"
+		if g := s.GPU; g != nil {
+			gpu = fmt.Sprintf("| %.0f%% | %.0f%% | %.0f MiB | %.2f Wh", g.UtilAvgPercent, g.UtilPeakPercent, g.MemoryPeakMiB, g.EnergyWh)
+		}
+		fmt.Fprintf(w, "| %s | %s | %s %s |\n", s.Name, status,
+			time.Duration(s.WallTime*float64(time.Second)).Round(time.Second), gpu)
+	}
+
+	fmt.Fprintf(w, "\n%d examples generated, %d accepted.\n", r.Examples, r.Accepted)
+	if r.BusySeconds > 0 || r.EnergyWh > 0 {
+		fmt.Fprintf(w, "GPU: %.0f busy seconds, %.2f Wh", r.BusySeconds, r.EnergyWh)
+		if r.Accepted > 0 {
+			fmt.Fprintf(w, "; %.1f busy seconds and %.3f Wh per accepted example", r.BusySecondsPerExample, r.EnergyWhPerExample)
+		}
+		if r.CostPerExample != nil {
+			fmt.Fprintf(w, " ($%.6f)", *r.CostPerExample)
+		}
+		fmt.Fprintln(w, ".")
+	}
+
+	if len(r.Eval) > 0 {
+		fmt.Fprintln(w, "\n| model | variant | runs | conformance | creativity | coherence | backstory | cost per conforming |")
+		fmt.Fprintln(w, "| --- | --- | --- | --- | --- | --- | --- | --- |")
+		for _, row := range r.Eval {
+			variant := row.Variant
+			if variant == "" {
+				variant = "default"
+			}
+			fmt.Fprintf(w, "| %s | %s | %d | %.2f | %.2f | %.2f | %.2f | %.6f |\n", row.Model, variant, row.Runs,
+				row.ConformanceRate, row.Creativity, row.Coherence, row.BackstoryQuality, row.CostPerConforming)
+		}
+	}
+	if q := r.Synth; q != nil {
+		fmt.Fprintf(w, "\nDataset %s: %d conversations.\n", q.Dataset, q.Conversations)
+		if len(q.Scores) > 0 {
+			fmt.Fprintln(w, "\n| score | n | mean | min | max |")
+			fmt.Fprintln(w, "| --- | --- | --- | --- | --- |")
+			for _, s := range q.Scores {
+				fmt.Fprintf(w, "| %s | %d | %.2f | %.2f | %.2f |\n", s.Name, s.N, s.Mean, s.Min, s.Max)
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nathanleclaire/gpumon/pkg/collector"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestNewGPUStats(t *testing.T) {
+	s := collector.Stats{
+		Samples:         12,
+		AvgUtilPercent:  50,
+		PeakUtilPercent: 90,
+		PeakMemoryBytes: 2 << 30,
+		AvgPowerWatts:   200,
+	}
+	got := newGPUStats(s, 3600)
+	if got.Samples != 12 || got.UtilAvgPercent != 50 || got.UtilPeakPercent != 90 || got.PowerAvgWatts != 200 {
+		t.Errorf("newGPUStats copied %+v from %+v", got, s)
+	}
+	if !near(got.MemoryPeakMiB, 2048) {
+		t.Errorf("MemoryPeakMiB = %v, want 2048", got.MemoryPeakMiB)
+	}
+	if !near(got.BusySeconds, 1800) {
+		t.Errorf("BusySeconds = %v, want 1800 (an hour at 50%%)", got.BusySeconds)
+	}
+	if !near(got.EnergyWh, 200) {
+		t.Errorf("EnergyWh = %v, want 200 (an hour at 200 W)", got.EnergyWh)
+	}
+}
+
+func TestReportFinish(t *testing.T) {
+	stages := func() []StageReport {
+		return []StageReport{
+			{Name: "generate", GPU: &GPUStats{BusySeconds: 300, EnergyWh: 150}},
+			{Name: "evaluate", GPU: &GPUStats{BusySeconds: 100, EnergyWh: 50}},
+			{Name: "report"}, // not sampled
+		}
+	}
+	tests := []struct {
+		name        string
+		accepted    int
+		price       float64
+		busyPerEx   float64
+		energyPerEx float64
+		cost        float64 // 0 for no cost
+	}{
+		{name: "priced", accepted: 4, price: 0.30, busyPerEx: 100, energyPerEx: 50, cost: 0.015},
+		{name: "unpriced", accepted: 4, busyPerEx: 100, energyPerEx: 50},
+		{name: "nothing accepted", accepted: 0, price: 0.30},
+	}
+	for _, tt := range tests {
+		r := Report{Stages: stages(), Accepted: tt.accepted}
+		r.finish(tt.price)
+		if !near(r.BusySeconds, 400) || !near(r.EnergyWh, 200) {
+			t.Errorf("%s: totals %v s, %v Wh, want 400 s, 200 Wh over every stage", tt.name, r.BusySeconds, r.EnergyWh)
+		}
+		if !near(r.BusySecondsPerExample, tt.busyPerEx) || !near(r.EnergyWhPerExample, tt.energyPerEx) {
+			t.Errorf("%s: per example %v s, %v Wh, want %v s, %v Wh", tt.name,
+				r.BusySecondsPerExample, r.EnergyWhPerExample, tt.busyPerEx, tt.energyPerEx)
+		}
+		switch {
+		case tt.cost == 0 && r.CostPerExample != nil:
+			t.Errorf("%s: cost per example %v, want none", tt.name, *r.CostPerExample)
+		case tt.cost != 0 && (r.CostPerExample == nil || !near(*r.CostPerExample, tt.cost)):
+			t.Errorf("%s: cost per example %v, want %v", tt.name, r.CostPerExample, tt.cost)
+		}
+	}
+
+	// Without GPU samples there is no energy to price.
+	r := Report{Stages: []StageReport{{Name: "generate"}}, Accepted: 3}
+	r.finish(0.30)
+	if r.EnergyWh != 0 || r.CostPerExample != nil {
+		t.Errorf("unsampled run: %v Wh, cost %v; want neither", r.EnergyWh, r.CostPerExample)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	dir := t.TempDir()
+	r := Report{RunID: "r1", Profile: "synth", Status: "ok", Accepted: 2,
+		Stages: []StageReport{{Name: "generate", Status: "ok", WallTime: 60, GPU: &GPUStats{Samples: 3, EnergyWh: 10}}}}
+	r.finish(0)
+	if err := writeReport(dir, r); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Report
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.RunID != "r1" || len(got.Stages) != 1 || !near(got.EnergyWhPerExample, 5) {
+		t.Errorf("report.json read back as %+v", got)
+	}
+	md, err := os.ReadFile(filepath.Join(dir, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(md), "## Pipeline r1 (synth): ok") || !strings.Contains(string(md), "| generate |") {
+		t.Errorf("report.md =\n%s", md)
+	}
+}
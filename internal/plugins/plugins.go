@@ -0,0 +1,226 @@
+// Package plugins finds and runs gpumon's plugins, the out-of-tree GPU
+// collectors and LLM backends of package plugin, and lists them as the
+// gpumon plugins command.
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/nathanleclaire/gpumon/internal/config"
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"github.com/nathanleclaire/gpumon/pkg/collector"
+	"github.com/nathanleclaire/gpumon/pkg/plugin"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// NvidiaSMI is the built-in collector, used unless --collector names a
+// plugin.
+const NvidiaSMI = "nvidia-smi"
+
+// AddFlags defines --plugin-dir and --collector on fs, for the root
+// command's persistent flags.
+func AddFlags(fs *pflag.FlagSet) {
+	fs.String("plugin-dir", "", "Directory holding gpumon-plugin-* executables (default: plugins next to the user config file)")
+	_ = viper.BindPFlag("plugin.dir", fs.Lookup("plugin-dir"))
+	fs.String("collector", NvidiaSMI, "Where GPU samples come from: nvidia-smi, or the name of a collector plugin")
+	_ = viper.BindPFlag("collector", fs.Lookup("collector"))
+}
+
+// Dir is the plugins directory: --plugin-dir, or plugins beside the user
+// config file, e.g. ~/.config/gpumon/plugins.
+func Dir() string {
+	if d := viper.GetString("plugin.dir"); d != "" {
+		return d
+	}
+	p, err := config.UserFile()
+	if err != nil {
+		return "plugins"
+	}
+	return filepath.Join(filepath.Dir(p), "plugins")
+}
+
+// Open finds the plugin called name and starts it, logging what it writes
+// to stderr. Close the client when done with it.
+func Open(ctx context.Context, logger *slog.Logger, name string) (*plugin.Client, error) {
+	path, err := plugin.Find(Dir(), name)
+	if err != nil {
+		return nil, err
+	}
+	c, err := plugin.Start(ctx, path, &logWriter{logger: logger.With("plugin", name)})
+	if err != nil {
+		return nil, err
+	}
+	info := c.Info()
+	logger.Debug("Started plugin", "plugin", name, "version", info.Version, "path", path)
+	return c, nil
+}
+
+// OpenCollector returns the collector --collector names, and a function to
+// stop it with.
+func OpenCollector(ctx context.Context, logger *slog.Logger) (collector.Collector, func(), error) {
+	name := viper.GetString("collector")
+	if name == "" || name == NvidiaSMI {
+		return &collector.NvidiaSMI{}, func() {}, nil
+	}
+	c, err := Open(ctx, logger, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !c.Info().Collector {
+		closePlugin(logger, c)
+		return nil, nil, fmt.Errorf("plugin %s is not a collector", name)
+	}
+	return c, func() { closePlugin(logger, c) }, nil
+}
+
+// CompleteCollector completes --collector with nvidia-smi and the plugins
+// in the plugins directory, without starting them.
+func CompleteCollector(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	names := []string{NvidiaSMI}
+	found, _ := plugin.Discover(Dir())
+	for _, f := range found {
+		names = append(names, f.Name)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// Backends starts backend plugins as they are first asked for, and stops
+// them all on Close. It is safe for concurrent use.
+type Backends struct {
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	running map[string]*plugin.Client
+}
+
+// NewBackends returns an empty set of backend plugins.
+func NewBackends(logger *slog.Logger) *Backends {
+	return &Backends{logger: logger, running: map[string]*plugin.Client{}}
+}
+
+// Get returns the backend plugin called name, starting it if need be.
+func (b *Backends) Get(ctx context.Context, name string) (llm.Backend, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.running[name]; ok {
+		return llm.NewPlugin(c), nil
+	}
+	c, err := Open(ctx, b.logger, name)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Info().Backend {
+		closePlugin(b.logger, c)
+		return nil, fmt.Errorf("plugin %s is not a backend", name)
+	}
+	b.running[name] = c
+	return llm.NewPlugin(c), nil
+}
+
+// Close stops every plugin started.
+func (b *Backends) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for name, c := range b.running {
+		closePlugin(b.logger, c)
+		delete(b.running, name)
+	}
+}
+
+func closePlugin(logger *slog.Logger, c *plugin.Client) {
+	if err := c.Close(); err != nil {
+		logger.Warn("Plugin exited uncleanly", "plugin", c.Info().Name, "err", err)
+	}
+}
+
+// logWriter logs each line a plugin writes to stderr.
+type logWriter struct {
+	logger *slog.Logger
+	mu     sync.Mutex
+	buf    []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i == -1 {
+			return len(p), nil
+		}
+		if line := strings.TrimSpace(string(w.buf[:i])); line != "" {
+			w.logger.Info(line)
+		}
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// NewCommand returns the plugins command tree, logging to logger.
+func NewCommand(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plugins",
+		Short: "List the collector and backend plugins gpumon can run",
+		Long: `Plugins are executables named gpumon-plugin-<name> in the plugins directory
+(--plugin-dir, by default ~/.config/gpumon/plugins). gpumon runs them as
+subprocesses and talks to them over JSON-RPC on stdin and stdout.
+
+A collector plugin reports GPUs or other accelerators: pick it with
+--collector <name> for GPU sampling, or gpumon monitor poll. A backend
+plugin serves completions: give models to eval generate with --plugin-model
+<model>=<name>, or send "backend": "<name>" to eval serve.
+
+See package github.com/nathanleclaire/gpumon/pkg/plugin to write one.`,
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Start each plugin in the plugins directory and show what it serves",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := Dir()
+			found, err := plugin.Discover(dir)
+			if err != nil {
+				return err
+			}
+			if len(found) == 0 {
+				logger.Info("No plugins found", "dir", dir)
+				return nil
+			}
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAME\tVERSION\tSERVES\tPATH")
+			for _, f := range found {
+				c, err := Open(cmd.Context(), logger, f.Name)
+				if err != nil {
+					logger.Warn("Plugin failed to start", "plugin", f.Name, "err", err)
+					fmt.Fprintf(tw, "%s\t-\tbroken\t%s\n", f.Name, f.Path)
+					continue
+				}
+				info := c.Info()
+				closePlugin(logger, c)
+				var serves []string
+				if info.Collector {
+					serves = append(serves, "collector")
+				}
+				if info.Backend {
+					serves = append(serves, "backend")
+				}
+				version := info.Version
+				if version == "" {
+					version = "-"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.Name, version, strings.Join(serves, ","), f.Path)
+			}
+			return tw.Flush()
+		},
+	})
+	return cmd
+}
@@ -0,0 +1,266 @@
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Release asset names, besides the binaries themselves.
+const (
+	ChecksumsAsset = "checksums.txt"
+	SignatureAsset = "checksums.txt.sig"
+)
+
+// maxDownload bounds any one download, well above the binary's size.
+const maxDownload = 512 << 20
+
+// release is the part of GitHub's release object used here.
+type release struct {
+	TagName string  `json:"tag_name"`
+	HTMLURL string  `json:"html_url"`
+	Assets  []asset `json:"assets"`
+}
+
+type asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+func (r *release) asset(name string) (asset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return asset{}, false
+}
+
+// github fetches releases of repo from the API at api, authenticating with
+// token if set, for private repos and the rate limit.
+type github struct {
+	api    string
+	repo   string
+	token  string
+	client *http.Client
+}
+
+// PublicAPI is GitHub's own API, the only host GITHUB_TOKEN is sent to
+// unless a token is given with --token.
+const PublicAPI = "https://api.github.com"
+
+// resolveToken returns the token to send to api: flagToken if given, else
+// GITHUB_TOKEN, but only to GitHub itself, so a mistyped or hostile
+// --api-url doesn't receive it.
+func resolveToken(api, flagToken string) string {
+	if flagToken != "" {
+		return flagToken
+	}
+	if u, err := url.Parse(api); err != nil || u.Scheme != "https" || u.Host != "api.github.com" {
+		return ""
+	}
+	return os.Getenv("GITHUB_TOKEN")
+}
+
+// release fetches the release tagged tag, or the latest if tag is "".
+func (g *github) release(ctx context.Context, tag string) (*release, error) {
+	u := g.api + "/repos/" + g.repo + "/releases/latest"
+	if tag != "" {
+		u = g.api + "/repos/" + g.repo + "/releases/tags/" + url.PathEscape(tag)
+	}
+	b, err := g.get(ctx, u, "application/vnd.github+json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up release: %w", err)
+	}
+	var rel release
+	if err := json.Unmarshal(b, &rel); err != nil {
+		return nil, fmt.Errorf("bad release from %s: %w", u, err)
+	}
+	if rel.TagName == "" {
+		return nil, fmt.Errorf("bad release from %s: no tag", u)
+	}
+	return &rel, nil
+}
+
+// download fetches a release asset.
+func (g *github) download(ctx context.Context, a asset) ([]byte, error) {
+	b, err := g.get(ctx, a.URL, "application/octet-stream")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", a.Name, err)
+	}
+	return b, nil
+}
+
+func (g *github) get(ctx context.Context, url, accept string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("GET %s: %s: %s", url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxDownload+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxDownload {
+		return nil, fmt.Errorf("GET %s: larger than %d MiB", url, maxDownload>>20)
+	}
+	return b, nil
+}
+
+// parseChecksums reads sha256sum output: a hex digest, whitespace, and a
+// file name, optionally marked binary with a leading *.
+func parseChecksums(b []byte) (map[string]string, error) {
+	sums := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, fmt.Errorf("bad %s line %q", ChecksumsAsset, sc.Text())
+		}
+		sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return sums, sc.Err()
+}
+
+// verifyChecksum checks b against name's digest in sums.
+func verifyChecksum(sums map[string]string, name string, b []byte) error {
+	want, ok := sums[name]
+	if !ok {
+		return fmt.Errorf("%s has no checksum for %s", ChecksumsAsset, name)
+	}
+	sum := sha256.Sum256(b)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", name, got, want)
+	}
+	return nil
+}
+
+// verifySignature checks sig, a base64 Ed25519 signature, over checksums
+// with the base64 public key pub.
+func verifySignature(pub string, checksums, sig []byte) error {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(pub))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("bad public key: want %d bytes, base64", ed25519.PublicKeySize)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return fmt.Errorf("bad %s: %w", SignatureAsset, err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), checksums, raw) {
+		return errors.New("signature verification failed: " + ChecksumsAsset + " was not signed by the release key")
+	}
+	return nil
+}
+
+// compareVersions orders two vMAJOR.MINOR.PATCH[-PRERELEASE] versions like
+// semver, returning -1, 0 or 1. ok is false if either doesn't parse.
+func compareVersions(a, b string) (c int, ok bool) {
+	pa, okA := parseVersion(a)
+	pb, okB := parseVersion(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	for i := 0; i < 3; i++ {
+		if pa.nums[i] != pb.nums[i] {
+			if pa.nums[i] < pb.nums[i] {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	// A prerelease comes before its release.
+	switch {
+	case pa.pre == pb.pre:
+		return 0, true
+	case pa.pre == "":
+		return 1, true
+	case pb.pre == "":
+		return -1, true
+	}
+	return comparePrerelease(pa.pre, pb.pre), true
+}
+
+// comparePrerelease orders two prerelease strings by their dot-separated
+// identifiers as semver does: numeric ones by value and before alphanumeric
+// ones, which compare as strings, and a shorter list first when the rest
+// are equal, so rc.9 < rc.10 < rc.10.1.
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := compareIdentifier(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(as), len(bs))
+}
+
+func compareIdentifier(a, b string) int {
+	na, errA := strconv.ParseUint(a, 10, 64)
+	nb, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		return cmp.Compare(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+type semver struct {
+	nums [3]int
+	pre  string
+}
+
+func parseVersion(s string) (semver, bool) {
+	s, ok := strings.CutPrefix(s, "v")
+	if !ok {
+		return semver{}, false
+	}
+	s, _, _ = strings.Cut(s, "+")
+	core, pre, _ := strings.Cut(s, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return semver{}, false
+	}
+	var v semver
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return semver{}, false
+		}
+		v.nums[i] = n
+	}
+	v.pre = pre
+	return v, true
+}
@@ -0,0 +1,150 @@
+package selfupdate
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+		ok   bool
+	}{
+		{"v1.2.0", "v1.2.0", 0, true},
+		{"v1.2.1", "v1.2.0", 1, true},
+		{"v1.10.0", "v1.9.0", 1, true},
+		{"v2.0.0", "v10.0.0", -1, true},
+		{"v1.2.0", "v1.2.0-rc.1", 1, true},
+		{"v1.2.0-rc.1", "v1.2.0", -1, true},
+		{"v1.2.0-rc.10", "v1.2.0-rc.9", 1, true},
+		{"v1.2.0-rc.9", "v1.2.0-rc.10", -1, true},
+		{"v1.2.0-rc.1", "v1.2.0-rc.1.1", -1, true},
+		{"v1.2.0-1", "v1.2.0-alpha", -1, true},
+		{"v1.2.0-alpha", "v1.2.0-beta", -1, true},
+		{"v1.2.0-beta.2", "v1.2.0-alpha.10", 1, true},
+		{"v1.2.0+build.5", "v1.2.0", 0, true},
+		{"v1.2.0-rc.1+build.5", "v1.2.0-rc.1", 0, true},
+		{"dev", "v1.2.0", 0, false},
+		{"v1.2", "v1.2.0", 0, false},
+		{"1.2.0", "v1.2.0", 0, false},
+		{"v1.x.0", "v1.2.0", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := compareVersions(tt.a, tt.b)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("compareVersions(%q, %q) = %d, %v; want %d, %v", tt.a, tt.b, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseChecksums(t *testing.T) {
+	sum := strings.Repeat("ab", sha256.Size)
+	tests := []struct {
+		name    string
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", in: "", want: map[string]string{}},
+		{
+			name: "text and binary",
+			in:   sum + "  gpumon_linux_amd64\n" + strings.ToUpper(sum) + " *gpumon_windows_amd64.exe\n\n",
+			want: map[string]string{"gpumon_linux_amd64": sum, "gpumon_windows_amd64.exe": sum},
+		},
+		{name: "short digest", in: "abcd  gpumon_linux_amd64\n", wantErr: true},
+		{name: "no file name", in: sum + "\n", wantErr: true},
+		{name: "space in name", in: sum + "  gpumon linux\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseChecksums([]byte(tt.in))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+		for k, v := range tt.want {
+			if got[k] != v {
+				t.Errorf("%s: %s = %q, want %q", tt.name, k, got[k], v)
+			}
+		}
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	bin := []byte("gpumon binary")
+	sum := sha256.Sum256(bin)
+	sums := map[string]string{"gpumon_linux_amd64": hex.EncodeToString(sum[:])}
+	if err := verifyChecksum(sums, "gpumon_linux_amd64", bin); err != nil {
+		t.Errorf("matching binary: %v", err)
+	}
+	if err := verifyChecksum(sums, "gpumon_linux_amd64", []byte("tampered")); err == nil {
+		t.Error("tampered binary verified")
+	}
+	if err := verifyChecksum(sums, "gpumon_darwin_arm64", bin); err == nil {
+		t.Error("binary without a checksum verified")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksums := []byte(strings.Repeat("ab", sha256.Size) + "  gpumon_linux_amd64\n")
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, checksums)) + "\n"
+	key := base64.StdEncoding.EncodeToString(pub)
+
+	tests := []struct {
+		name      string
+		key       string
+		checksums []byte
+		sig       string
+		wantErr   bool
+	}{
+		{name: "valid", key: key, checksums: checksums, sig: sig},
+		{name: "other key", key: base64.StdEncoding.EncodeToString(otherPub), checksums: checksums, sig: sig, wantErr: true},
+		{name: "tampered checksums", key: key, checksums: append([]byte("00"), checksums[2:]...), sig: sig, wantErr: true},
+		{name: "bad key", key: "not base64!", checksums: checksums, sig: sig, wantErr: true},
+		{name: "short key", key: base64.StdEncoding.EncodeToString(pub[:16]), checksums: checksums, sig: sig, wantErr: true},
+		{name: "bad signature", key: key, checksums: checksums, sig: "!!!", wantErr: true},
+	}
+	for _, tt := range tests {
+		err := verifySignature(tt.key, tt.checksums, []byte(tt.sig))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestResolveToken(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "env-token")
+	tests := []struct {
+		api, flag, want string
+	}{
+		{PublicAPI, "", "env-token"},
+		{PublicAPI, "flag-token", "flag-token"},
+		{"https://github.example.com/api/v3", "", ""},
+		{"https://github.example.com/api/v3", "flag-token", "flag-token"},
+		{"http://api.github.com", "", ""},
+		{"https://api.github.com.evil.example", "", ""},
+	}
+	for _, tt := range tests {
+		if got := resolveToken(tt.api, tt.flag); got != tt.want {
+			t.Errorf("resolveToken(%q, %q) = %q, want %q", tt.api, tt.flag, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+// Package selfupdate replaces the running gpumon binary with a GitHub
+// release, as the gpumon self-update command, for GPU nodes without a
+// package manager.
+//
+// A release carries, for each platform, the binary gpumon_<os>_<arch>
+// (.exe on Windows), bare or as a .tar.gz holding it, plus checksums.txt,
+// the sha256sum of every asset, and checksums.txt.sig, the base64 Ed25519
+// signature of checksums.txt made with the release key. Release builds
+// embed the public key with
+//
+//	-ldflags "-X github.com/nathanleclaire/gpumon/internal/selfupdate.PublicKey=<base64 key>"
+//
+// and only install releases signed with it. Builds without it, such as
+// go install, need the key given with --public-key; checksums alone come
+// from the same place as the binary, so they don't prove who built it.
+package selfupdate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/internal/version"
+	"github.com/spf13/cobra"
+)
+
+// PublicKey is the base64 Ed25519 key releases are signed with, set at
+// build time. Without it, self-update installs nothing unless given
+// --public-key.
+var PublicKey = ""
+
+// DefaultRepo is where releases are published.
+const DefaultRepo = "nathanleclaire/gpumon"
+
+type options struct {
+	Check     bool
+	Tag       string
+	Force     bool
+	Repo      string
+	API       string
+	Token     string
+	PublicKey string
+}
+
+// NewCommand returns the self-update command, logging to logger.
+func NewCommand(logger *slog.Logger) *cobra.Command {
+	var opts options
+	cmd := &cobra.Command{
+		Use:   "self-update",
+		Short: "Replace this binary with the latest GitHub release",
+		Long: `Download the latest release (or --tag) for this OS and architecture from
+GitHub, verify it against the release's checksums.txt and the signature on
+that file, check that it runs, and swap it in for the running binary in one
+rename. Builds made without the release key, such as with go install, need
+it given with --public-key.
+
+Set GITHUB_TOKEN to raise GitHub's rate limit or reach a private repo, and
+--api-url for GitHub Enterprise or a mirror. GITHUB_TOKEN is only sent to
+api.github.com; give other hosts theirs with --token.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return run(cmd.Context(), logger, cmd.OutOrStdout(), opts)
+		},
+	}
+	cmd.Flags().BoolVar(&opts.Check, "check",
+		false, "Only report whether a newer release is out")
+	cmd.Flags().StringVar(&opts.Tag, "tag",
+		"", "Release tag to install, e.g. v1.2.0 (default: the latest release)")
+	cmd.Flags().BoolVar(&opts.Force, "force",
+		false, "Install even if the release isn't newer, or this is a dev build")
+	cmd.Flags().StringVar(&opts.Repo, "repo",
+		DefaultRepo, "GitHub repository releases come from, as owner/name")
+	cmd.Flags().StringVar(&opts.API, "api-url",
+		PublicAPI, "GitHub API base URL")
+	cmd.Flags().StringVar(&opts.Token, "token",
+		"", "Token to send to --api-url (default: $GITHUB_TOKEN, sent only to api.github.com)")
+	cmd.Flags().StringVar(&opts.PublicKey, "public-key",
+		"", "Base64 Ed25519 key checksums.txt must be signed with (default: the key built in)")
+	return cmd
+}
+
+func run(ctx context.Context, logger *slog.Logger, out io.Writer, opts options) error {
+	key := opts.PublicKey
+	if key == "" {
+		key = PublicKey
+	}
+	api := strings.TrimSuffix(opts.API, "/")
+	gh := &github{
+		api:    api,
+		repo:   opts.Repo,
+		token:  resolveToken(api, opts.Token),
+		client: &http.Client{Timeout: 10 * time.Minute},
+	}
+	rel, err := gh.release(ctx, opts.Tag)
+	if err != nil {
+		return err
+	}
+
+	current := version.Get().Version
+	cmp, comparable := compareVersions(rel.TagName, current)
+	if opts.Check {
+		switch {
+		case !comparable:
+			fmt.Fprintf(out, "gpumon %s is not a release; the latest is %s (%s)\n", current, rel.TagName, rel.HTMLURL)
+		case cmp > 0:
+			fmt.Fprintf(out, "gpumon %s is out, this is %s (%s)\n", rel.TagName, current, rel.HTMLURL)
+		default:
+			fmt.Fprintf(out, "gpumon %s is up to date\n", current)
+		}
+		return nil
+	}
+	if !opts.Force {
+		switch {
+		case !comparable:
+			return fmt.Errorf("gpumon %s is not a release build; pass --force to replace it with %s", current, rel.TagName)
+		case cmp == 0:
+			logger.Info("Already up to date", "version", current)
+			return nil
+		case cmp < 0 && opts.Tag == "":
+			logger.Info("Already newer than the latest release", "version", current, "latest", rel.TagName)
+			return nil
+		case cmp < 0:
+			return fmt.Errorf("%s is older than this build, %s; pass --force to downgrade", rel.TagName, current)
+		}
+	}
+
+	if key == "" {
+		return errors.New("this build has no release key to verify releases with; pass the key releases are signed with as --public-key")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find this binary: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return fmt.Errorf("failed to find this binary: %w", err)
+	}
+
+	bin, err := fetch(ctx, logger, gh, rel, key)
+	if err != nil {
+		return err
+	}
+	if err := install(ctx, logger, exe, bin); err != nil {
+		return err
+	}
+	logger.Info("Updated gpumon", "from", current, "to", rel.TagName, "path", exe)
+	return nil
+}
+
+// assetName is this platform's binary, as released.
+func assetName() string {
+	name := "gpumon_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// fetch downloads this platform's binary from rel and verifies it against
+// the checksums, and the checksums against their signature by key.
+func fetch(ctx context.Context, logger *slog.Logger, gh *github, rel *release, key string) ([]byte, error) {
+	name := assetName()
+	a, ok := rel.asset(name)
+	archived := false
+	if !ok {
+		if a, ok = rel.asset(name + ".tar.gz"); !ok {
+			return nil, fmt.Errorf("release %s has no %s for this platform", rel.TagName, name)
+		}
+		archived = true
+	}
+	sumsAsset, ok := rel.asset(ChecksumsAsset)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s; refusing to install an unverified binary", rel.TagName, ChecksumsAsset)
+	}
+	sumsRaw, err := gh.download(ctx, sumsAsset)
+	if err != nil {
+		return nil, err
+	}
+	sigAsset, ok := rel.asset(SignatureAsset)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s; refusing to install an unsigned binary", rel.TagName, SignatureAsset)
+	}
+	sig, err := gh.download(ctx, sigAsset)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(key, sumsRaw, sig); err != nil {
+		return nil, err
+	}
+	logger.Debug("Verified release signature", "release", rel.TagName)
+	sums, err := parseChecksums(sumsRaw)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Downloading", "release", rel.TagName, "asset", a.Name)
+	b, err := gh.download(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyChecksum(sums, a.Name, b); err != nil {
+		return nil, err
+	}
+	if archived {
+		return untar(b, name)
+	}
+	return b, nil
+}
+
+// untar returns the file in the gzipped tarball b whose base name is name
+// or gpumon, with or without .exe.
+func untar(b []byte, name string) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("bad archive: %w", err)
+	}
+	tr := tar.NewReader(zr)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("archive has no gpumon binary")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad archive: %w", err)
+		}
+		base := strings.TrimSuffix(filepath.Base(h.Name), ".exe")
+		if h.Typeflag != tar.TypeReg || base != strings.TrimSuffix(name, ".exe") && base != "gpumon" {
+			continue
+		}
+		return io.ReadAll(io.LimitReader(tr, maxDownload))
+	}
+}
+
+// install writes bin next to exe, checks it runs, and renames it over exe,
+// so exe is only ever the old binary or the whole new one.
+func install(ctx context.Context, logger *slog.Logger, exe string, bin []byte) error {
+	dir := filepath.Dir(exe)
+	fi, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".gpumon-update-*")
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("can't write to %s; rerun as a user who can (e.g. with sudo): %w", dir, err)
+		}
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	if _, err := tmp.Write(bin); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, fi.Mode().Perm()|0o111); err != nil {
+		return err
+	}
+
+	// A binary for the wrong platform or a broken build fails here, before
+	// it replaces one that works.
+	checkCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(checkCtx, tmpPath, "--version").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("downloaded binary doesn't run here: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	logger.Debug("New binary runs", "version", strings.TrimSpace(string(out)))
+
+	if runtime.GOOS != "windows" {
+		if err := os.Rename(tmpPath, exe); err != nil {
+			return fmt.Errorf("failed to replace %s: %w", exe, err)
+		}
+		return nil
+	}
+	// Windows won't rename over a running executable, but will rename it
+	// out of the way, and back if the new one can't take its place.
+	old := exe + ".old"
+	_ = os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return fmt.Errorf("failed to move %s aside: %w", exe, err)
+	}
+	if err := os.Rename(tmpPath, exe); err != nil {
+		err = fmt.Errorf("failed to replace %s: %w", exe, err)
+		if rerr := os.Rename(old, exe); rerr != nil {
+			return errors.Join(err, fmt.Errorf("failed to restore %s from %s: %w", exe, old, rerr))
+		}
+		return err
+	}
+	return nil
+}
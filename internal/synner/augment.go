@@ -0,0 +1,232 @@
+package synner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/nathanleclaire/gpumon/internal/extract"
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"github.com/spf13/cobra"
+)
+
+// augmentOptions are the augment command's settings.
+type augmentOptions struct {
+	Model       string
+	OllamaAddrs []string
+	Parallel    int
+	// Factor is how many paraphrased variants to make of each conversation.
+	Factor int
+	// GPT also paraphrases the gpt turns, not only the human ones.
+	GPT          bool
+	KeepOriginal bool
+	Temperature  float64
+	Seed         int64
+	Out          string
+}
+
+func newAugmentCmd(logger *slog.Logger) *cobra.Command {
+	var opts augmentOptions
+	cmd := &cobra.Command{
+		Use:   "augment [in]",
+		Short: "Grow a dataset with paraphrased variants of its conversations",
+		Long: `Make --factor variants of every conversation in a dataset, each with its human
+turns (and, with --gpt, its gpt turns) reworded by the model, to add diversity
+without new source text. Each variant follows its original in the output and
+keeps the original's JSONL fields, plus "augmented_from", the original's index.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAugment(logger, args[0], opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.Model, "model",
+		"llama2", "Local model name in Ollama")
+	cmd.Flags().StringSliceVar(&opts.OllamaAddrs, "ollama-addr",
+		[]string{"http://localhost:11434"}, "Ollama server address; repeat or comma-separate to spread paraphrasing across several")
+	cmd.Flags().IntVar(&opts.Parallel, "parallel",
+		1, "Paraphrases to run at once on each Ollama server")
+	cmd.Flags().IntVar(&opts.Factor, "factor",
+		1, "Paraphrased variants to make of each conversation")
+	cmd.Flags().BoolVar(&opts.GPT, "gpt",
+		false, "Also paraphrase the gpt turns")
+	cmd.Flags().BoolVar(&opts.KeepOriginal, "keep-original",
+		true, "Write the original conversations as well as the variants")
+	cmd.Flags().Float64Var(&opts.Temperature, "temperature",
+		0.9, "Sampling temperature for paraphrasing")
+	cmd.Flags().Int64Var(&opts.Seed, "seed",
+		0, "Seed for paraphrasing; each variant uses its own seed from it")
+	cmd.Flags().StringVar(&opts.Out, "out",
+		"", "Where to write the augmented dataset (default: <in>.augmented.<ext>)")
+	return cmd
+}
+
+func runAugment(logger *slog.Logger, in string, opts augmentOptions) error {
+	if opts.Factor < 1 {
+		return fmt.Errorf("--factor must be at least 1, got %d", opts.Factor)
+	}
+	ext := datasetExt(in)
+	if opts.Out == "" {
+		opts.Out = strings.TrimSuffix(in, ext) + ".augmented" + ext
+	}
+	if format, _ := outputFormat(opts.Out, ""); format == "json" {
+		logger.Warn("JSON output keeps only the conversations; use a .jsonl --out to keep which original each variant came from", "out", opts.Out)
+	}
+	recs, err := loadRecords(in)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", in, err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	pool, err := newEndpointPool(ctx, opts.OllamaAddrs, logger)
+	if err != nil {
+		return err
+	}
+
+	// Workers paraphrase one variant each; this goroutine alone collects.
+	type job struct{ i, v int }
+	type result struct {
+		job
+		conv []ShareGPTTurn
+		err  error
+	}
+	jobs := make(chan job)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for range pool.Len() * max(opts.Parallel, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				conv, err := paraphraseConversation(ctx, pool, recs[j.i].conv, j.v, opts)
+				results <- result{j, conv, err}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range recs {
+			for v := range opts.Factor {
+				select {
+				case jobs <- job{i, v}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	variants := make([][][]ShareGPTTurn, len(recs))
+	for i := range variants {
+		variants[i] = make([][]ShareGPTTurn, opts.Factor)
+	}
+	made, failed, same := 0, 0, 0
+	for r := range results {
+		switch {
+		case r.err != nil:
+			if ctx.Err() == nil {
+				failed++
+				logger.Error("Paraphrasing failed", "index", r.i, "variant", r.v+1, "err", r.err)
+			}
+			continue
+		case conversationHash(r.conv) == conversationHash(recs[r.i].conv):
+			same++
+			logger.Warn("Variant is the same as the original", "index", r.i, "variant", r.v+1)
+			continue
+		}
+		variants[r.i][r.v] = r.conv
+		made++
+		logger.Info("Made variant",
+			"index", r.i,
+			"variant", r.v+1,
+			"done", made+failed+same,
+			"of", len(recs)*opts.Factor)
+	}
+	if ctx.Err() != nil {
+		return errors.New("interrupted; nothing written")
+	}
+
+	var out []datasetRecord
+	for i, r := range recs {
+		if opts.KeepOriginal {
+			out = append(out, r)
+		}
+		for _, conv := range variants[i] {
+			if conv == nil {
+				continue
+			}
+			vr, err := r.withConv(conv)
+			if err != nil {
+				return err
+			}
+			if vr, err = vr.withField("augmented_from", i); err != nil {
+				return err
+			}
+			out = append(out, vr)
+		}
+	}
+	if err := writeRecordsFile(opts.Out, out); err != nil {
+		return fmt.Errorf("failed to write %s: %w", opts.Out, err)
+	}
+	logger.Info("Wrote augmented dataset",
+		"path", opts.Out,
+		"conversations", len(out),
+		"variants", made,
+		"failed", failed,
+		"unchanged", same)
+	return nil
+}
+
+// paraphraseConversation returns the v'th variant of conv, with its human
+// turns, and gpt turns if asked, reworded.
+func paraphraseConversation(ctx context.Context, pool *endpointPool, conv []ShareGPTTurn, v int, opts augmentOptions) ([]ShareGPTTurn, error) {
+	options := map[string]interface{}{
+		"temperature": opts.Temperature,
+		"seed":        opts.Seed + int64(v),
+	}
+	out := make([]ShareGPTTurn, len(conv))
+	for i, t := range conv {
+		out[i] = t
+		if t.From != "human" && (t.From != "gpt" || !opts.GPT) {
+			continue
+		}
+		var resp string
+		err := pool.do(ctx, func(b llm.Backend) error {
+			var err error
+			resp, _, err = generateChat(ctx, b, opts.Model, paraphrasePrompt(t), options, echoNone, nil)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		p := extract.TagBody(resp, "paraphrase")
+		if p == "" {
+			return nil, fmt.Errorf("no <paraphrase> in the response for turn %d", i+1)
+		}
+		out[i].Value = p
+	}
+	return out, nil
+}
+
+func paraphrasePrompt(t ShareGPTTurn) string {
+	who, keep := "a user's message", "the same meaning, intent and tone"
+	if t.From == "gpt" {
+		who, keep = "a narrator's reply", "every event, detail and line of dialogue, the same tone and about the same length and paragraphs"
+	}
+	return fmt.Sprintf(`Below is %s from a roleplay conversation. Rewrite it in different
+words, keeping %s. Do not add anything or answer it.
+
+<message>
+%s
+</message>
+
+Reply with only the rewritten message inside <paraphrase></paraphrase> tags.`, who, keep, t.Value)
+}
@@ -0,0 +1,53 @@
+package synner
+
+import (
+	"log/slog"
+	"math"
+
+	"github.com/spf13/cobra"
+)
+
+// corpusFlags are generate's flags for reading the corpus, which backfill
+// has no use for.
+var corpusFlags = []string{
+	"input-file", "split", "hf-config", "column", "cache-dir", "shuffle-buffer",
+	"sample-order", "sample-window", "max-chunks-per-book", "dry-run", "dry-run-sample",
+}
+
+func newBackfillCmd(logger *slog.Logger) *cobra.Command {
+	opts := defaultGenOptions()
+	cmd := &cobra.Command{
+		Use:   "backfill [dataset]",
+		Short: "Retry the chunks that failed while generating a dataset",
+		Long: `Generate again every chunk recorded as failed in a dataset's failure ledger,
+<dataset>.failures.jsonl, and add the conversations to the dataset. The ledger
+holds each chunk's text, so the corpus isn't needed. Every generate flag
+applies, so failures can be retried with another --model or --temperature;
+chunks that fail again stay in the ledger for the next backfill.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.prepare(cmd.Flags()); err != nil {
+				return err
+			}
+			opts.Backfill = failuresPath(args[0])
+			if !cmd.Flags().Changed("out-file") {
+				opts.OutFile = args[0]
+			}
+			// Keep clear of the checkpoint of a generate run on the same
+			// dataset.
+			if opts.Worker == "" {
+				opts.Worker = "backfill"
+			}
+			return runGenerate(cmd.Context(), logger, opts)
+		},
+	}
+	addGenerateFlags(cmd, &opts)
+	// Every failure is retried unless --max-examples says otherwise.
+	opts.MaxExamples = math.MaxInt
+	f := cmd.Flags().Lookup("max-examples")
+	f.DefValue, f.Usage = "0", "Max examples to generate (default: all the failures)"
+	for _, name := range corpusFlags {
+		cmd.Flags().MarkHidden(name)
+	}
+	return cmd
+}
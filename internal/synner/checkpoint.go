@@ -0,0 +1,146 @@
+package synner
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checkpoint records every processed chunk as one JSON line next to the
+// output file, so a crashed or interrupted run can pick up where it left
+// off with --resume instead of losing everything generated so far.
+type checkpoint struct {
+	path string
+	f    *os.File
+	done map[string]bool
+}
+
+type checkpointEntry struct {
+	Chunk        string         `json:"chunk"`
+	Conversation []ShareGPTTurn `json:"conversation,omitempty"`
+	Meta         *convMeta      `json:"meta,omitempty"`
+}
+
+// checkpointPath is the checkpoint of the run writing outFile as worker,
+// which is empty for a run writing outFile alone.
+func checkpointPath(outFile, worker string) string {
+	if worker != "" {
+		return outFile + "." + worker + ".checkpoint.jsonl"
+	}
+	return outFile + ".checkpoint.jsonl"
+}
+
+// openCheckpoint starts a checkpoint for outFile, locked for the life of
+// the run so that a second run can't take it over. With resume it first
+// reads the existing one and returns the conversations it holds, with
+// their provenance; otherwise any earlier checkpoint is discarded.
+func openCheckpoint(outFile, worker string, resume bool) (*checkpoint, [][]ShareGPTTurn, []convMeta, error) {
+	c := &checkpoint{path: checkpointPath(outFile, worker), done: map[string]bool{}}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return nil, nil, nil, err
+	}
+	f, err := os.OpenFile(c.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	if err := lockFile(f, false); err != nil {
+		f.Close()
+		if errors.Is(err, errLocked) {
+			return nil, nil, nil, fmt.Errorf("checkpoint %s is in use by another run; give each run writing to %s its own --worker", c.path, outFile)
+		}
+		return nil, nil, nil, fmt.Errorf("failed to lock checkpoint: %w", err)
+	}
+	c.f = f
+	var convs [][]ShareGPTTurn
+	var metas []convMeta
+	if resume {
+		convs, metas, err = c.load()
+	} else {
+		err = f.Truncate(0)
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, nil, err
+	}
+	return c, convs, metas, nil
+}
+
+func (c *checkpoint) load() ([][]ShareGPTTurn, []convMeta, error) {
+	f, err := os.Open(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	defer f.Close()
+	var convs [][]ShareGPTTurn
+	var metas []convMeta
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var good int64
+	for sc.Scan() {
+		var e checkpointEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			// A crash mid-write leaves a torn last line; that chunk is
+			// simply generated again. It is cut off so the next entry
+			// doesn't land on the end of it.
+			if err := c.f.Truncate(good); err != nil {
+				return nil, nil, fmt.Errorf("failed to repair checkpoint: %w", err)
+			}
+			break
+		}
+		good += int64(len(sc.Bytes())) + 1
+		c.done[e.Chunk] = true
+		if len(e.Conversation) > 0 {
+			convs = append(convs, e.Conversation)
+			var m convMeta
+			if e.Meta != nil {
+				m = *e.Meta
+			}
+			metas = append(metas, m)
+		}
+	}
+	return convs, metas, sc.Err()
+}
+
+// Done reports whether the chunk with this hash was already processed.
+func (c *checkpoint) Done(hash string) bool {
+	return c.done[hash]
+}
+
+// Record appends a processed chunk and its conversation and provenance, if
+// any, and syncs it to disk before returning.
+func (c *checkpoint) Record(hash string, conv []ShareGPTTurn, meta *convMeta) error {
+	b, err := json.Marshal(checkpointEntry{Chunk: hash, Conversation: conv, Meta: meta})
+	if err != nil {
+		return err
+	}
+	if _, err := c.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	c.done[hash] = true
+	return c.f.Sync()
+}
+
+func (c *checkpoint) Close() error {
+	return c.f.Close()
+}
+
+// Remove deletes the checkpoint once its conversations are in the output.
+func (c *checkpoint) Remove() error {
+	// Removed while still locked, so no other run can open it in between.
+	err := os.Remove(c.path)
+	c.f.Close()
+	return err
+}
+
+func chunkHash(chunk string) string {
+	sum := sha256.Sum256([]byte(chunk))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,160 @@
+package synner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckpointPath(t *testing.T) {
+	if got := checkpointPath("out/data.jsonl", ""); got != "out/data.jsonl.checkpoint.jsonl" {
+		t.Errorf("checkpointPath without a worker = %q", got)
+	}
+	if got := checkpointPath("out/data.jsonl", "w2"); got != "out/data.jsonl.w2.checkpoint.jsonl" {
+		t.Errorf("checkpointPath for worker w2 = %q", got)
+	}
+}
+
+func TestChunkHash(t *testing.T) {
+	h := chunkHash("It was a dark and stormy night.")
+	if len(h) != 32 || strings.Trim(h, "0123456789abcdef") != "" {
+		t.Errorf("chunkHash = %q, want 32 hex digits", h)
+	}
+	if h != chunkHash("It was a dark and stormy night.") {
+		t.Error("chunkHash differs for the same chunk")
+	}
+	if h == chunkHash("It was a dark and stormy night!") {
+		t.Error("chunkHash is the same for different chunks")
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "data.jsonl")
+	c, convs, _, err := openCheckpoint(out, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(convs) != 0 {
+		t.Errorf("new checkpoint resumed %d conversations", len(convs))
+	}
+	if err := c.Record("h1", conv("one"), &convMeta{Source: "a", Chunk: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// A chunk that produced nothing is still done.
+	if err := c.Record("h2", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Record("h3", conv("three"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Done("h1") || !c.Done("h2") || c.Done("h4") {
+		t.Error("Done doesn't match the recorded chunks")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, convs, metas, err := openCheckpoint(out, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for _, h := range []string{"h1", "h2", "h3"} {
+		if !c.Done(h) {
+			t.Errorf("chunk %s not done after resuming", h)
+		}
+	}
+	if len(convs) != 2 || convs[0][1].Value != "one" || convs[1][1].Value != "three" {
+		t.Fatalf("resumed conversations %v, want one and three", convs)
+	}
+	if metas[0].Source != "a" || metas[0].Chunk != 1 || metas[1].Source != "" {
+		t.Errorf("resumed provenance %+v", metas)
+	}
+}
+
+func TestCheckpointTornLine(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "data.jsonl")
+	c, _, _, err := openCheckpoint(out, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Record("h1", conv("one"), nil); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	f, err := os.OpenFile(checkpointPath(out, ""), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"chunk":"h2","conversation":[{"from":"gp`)
+	f.Close()
+
+	c, convs, _, err := openCheckpoint(out, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(convs) != 1 || !c.Done("h1") || c.Done("h2") {
+		t.Errorf("resumed %d conversations, h1 done %v, h2 done %v; want the torn chunk redone", len(convs), c.Done("h1"), c.Done("h2"))
+	}
+	// What's recorded after resuming survives the next resume.
+	if err := c.Record("h2", conv("two"), nil); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	c, convs, _, err = openCheckpoint(out, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if len(convs) != 2 || !c.Done("h2") {
+		t.Errorf("resumed %d conversations after redoing the torn chunk, want 2", len(convs))
+	}
+}
+
+func TestCheckpointFresh(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "data.jsonl")
+	c, _, _, err := openCheckpoint(out, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Record("h1", conv("one"), nil); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	c, convs, _, err := openCheckpoint(out, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(convs) != 0 || c.Done("h1") {
+		t.Error("a run without --resume kept the old checkpoint")
+	}
+	if fi, err := os.Stat(c.path); err != nil || fi.Size() != 0 {
+		t.Errorf("old checkpoint not truncated: %v, %v", fi, err)
+	}
+	if err := c.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(c.path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("checkpoint still there after Remove: %v", err)
+	}
+}
+
+func TestCheckpointLocked(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "data.jsonl")
+	c, _, _, err := openCheckpoint(out, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, _, _, err := openCheckpoint(out, "", true); err == nil || !strings.Contains(err.Error(), "--worker") {
+		t.Errorf("second run on a checkpoint in use: err = %v, want a hint to use --worker", err)
+	}
+	other, _, _, err := openCheckpoint(out, "w2", false)
+	if err != nil {
+		t.Fatalf("worker w2's checkpoint: %v", err)
+	}
+	other.Close()
+}
@@ -0,0 +1,207 @@
+package synner
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Datasets whose names end in .gz or .zst are compressed with gzip or
+// zstd; everything that reads or writes dataset files goes through these
+// helpers, so the rest of the code only sees the .json or .jsonl inside.
+
+// compressionExt returns path's compression extension, ".gz" or ".zst",
+// or "" for an uncompressed file.
+func compressionExt(path string) string {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".gz", ".zst":
+		return ext
+	}
+	return ""
+}
+
+// datasetExt returns the extension of a dataset file including any
+// compression, like ".jsonl.zst", so derived file names keep both.
+func datasetExt(path string) string {
+	inner := path[:len(path)-len(compressionExt(path))]
+	return filepath.Ext(inner) + path[len(inner):]
+}
+
+// openDataset opens path for reading, decompressing it if needed.
+func openDataset(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	// An empty file, such as one just created by another run's writer,
+	// holds no stream to decompress.
+	if fi, err := f.Stat(); err == nil && fi.Size() == 0 {
+		return f, nil
+	}
+	var r io.ReadCloser
+	switch compressionExt(path) {
+	case ".gz":
+		r, err = gzip.NewReader(f)
+	case ".zst":
+		var d *zstd.Decoder
+		d, err = zstd.NewReader(f)
+		if err == nil {
+			r = d.IOReadCloser()
+		}
+	default:
+		return f, nil
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return readCloser{r, f}, nil
+}
+
+// readDataset is os.ReadFile for possibly compressed dataset files. A
+// compressed stream cut short, as a crash mid-append leaves it, returns
+// what could be read along with io.ErrUnexpectedEOF.
+func readDataset(path string) ([]byte, error) {
+	r, err := openDataset(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// readCloser closes a decompressor and the file under it.
+type readCloser struct {
+	io.ReadCloser
+	f *os.File
+}
+
+func (r readCloser) Close() error {
+	r.ReadCloser.Close()
+	return r.f.Close()
+}
+
+// compressWriter wraps w with the compression path's extension asks for.
+// Closing it finishes the compressed stream but does not close w.
+func compressWriter(w io.Writer, path string) (io.WriteCloser, error) {
+	switch compressionExt(path) {
+	case ".gz":
+		return gzip.NewWriter(w), nil
+	case ".zst":
+		return zstd.NewWriter(w)
+	}
+	return nopCloser{w}, nil
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// intactLength returns how much of raw, the bytes of the JSONL dataset at
+// path, holds only whole lines: up to the last newline, or for compressed
+// files, the streams before a last one cut off mid-append. Every append
+// writes its line as a stream of its own, so the result is where to
+// truncate a torn file. A damaged stream anywhere but the end is an error,
+// since dropping it would drop the lines after it too.
+func intactLength(path string, raw []byte) (int, error) {
+	var next func(b []byte) (n int, lines []byte, err error)
+	switch compressionExt(path) {
+	case ".gz":
+		next = gzipStream
+	case ".zst":
+		next = zstdStream
+	default:
+		return bytes.LastIndexByte(raw, '\n') + 1, nil
+	}
+	off := 0
+	for off < len(raw) {
+		n, lines, err := next(raw[off:])
+		last := err == nil && off+n == len(raw)
+		switch {
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return off, nil
+		case err != nil:
+			return 0, fmt.Errorf("%s is damaged at byte %d: %w", path, off, err)
+		case last && len(lines) > 0 && lines[len(lines)-1] != '\n':
+			return off, nil
+		}
+		off += n
+	}
+	return off, nil
+}
+
+// gzipStream decompresses the gzip member at the start of b, returning its
+// length and contents. A member cut short fails with io.ErrUnexpectedEOF.
+func gzipStream(b []byte) (int, []byte, error) {
+	// bytes.Reader is an io.ByteReader, so gzip reads no further than the
+	// member and r.Len() tells where it ended.
+	r := bytes.NewReader(b)
+	zr, err := gzip.NewReader(r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	zr.Multistream(false)
+	lines, err := io.ReadAll(zr)
+	if err != nil {
+		return 0, nil, err
+	}
+	return len(b) - r.Len(), lines, nil
+}
+
+// zstdStream decompresses the zstd frame at the start of b, returning its
+// length and contents. A frame cut short fails with io.ErrUnexpectedEOF.
+func zstdStream(b []byte) (int, []byte, error) {
+	var h zstd.Header
+	if err := h.Decode(b); err != nil {
+		return 0, nil, err
+	}
+	n := h.HeaderSize
+	if h.Skippable {
+		n += int(h.SkippableSize)
+		if n > len(b) {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+		return n, nil, nil
+	}
+	// Walk the block headers to the end of the frame.
+	for {
+		if n+3 > len(b) {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+		bh := uint32(b[n]) | uint32(b[n+1])<<8 | uint32(b[n+2])<<16
+		size := int(bh >> 3)
+		if (bh>>1)&3 == 1 { // RLE: one byte, repeated size times
+			size = 1
+		}
+		n += 3 + size
+		if bh&1 != 0 {
+			break
+		}
+	}
+	if h.HasCheckSum {
+		n += 4
+	}
+	if n > len(b) {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	d, err := zstd.NewReader(nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer d.Close()
+	lines, err := d.DecodeAll(b[:n], nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	return n, lines, nil
+}
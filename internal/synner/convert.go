@@ -0,0 +1,211 @@
+package synner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// convertOptions are the convert command's settings.
+type convertOptions struct {
+	To string
+	// Roles maps ShareGPT speakers (human, gpt, system) to the target
+	// format's roles.
+	Roles  map[string]string
+	System string
+}
+
+// convertFormats are the shapes convert can write; each writer returns how
+// many records it wrote. sharegpt keeps the input's shape, one document for
+// .json and a line per conversation for .jsonl.
+var convertFormats = map[string]func(path string, d *ShareGPTData, opts convertOptions) (int, error){
+	"sharegpt": func(path string, d *ShareGPTData, opts convertOptions) (int, error) {
+		return len(d.Conversations), saveDataset(path, d)
+	},
+	"alpaca": writeAlpaca,
+	"openai": writeOpenAI,
+	"chatml": writeChatML,
+}
+
+func newConvertCmd(logger *slog.Logger) *cobra.Command {
+	var opts convertOptions
+	cmd := &cobra.Command{
+		Use:   "convert [in] [out]",
+		Short: "Convert a ShareGPT dataset between .json and .jsonl, or to Alpaca, OpenAI chat or ChatML",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			write, ok := convertFormats[opts.To]
+			if !ok {
+				return fmt.Errorf("unknown --to %q (want %s)", opts.To, strings.Join(convertFormatNames(), ", "))
+			}
+			d, err := loadDataset(args[0])
+			if err != nil {
+				return err
+			}
+			n, err := write(args[1], d, opts)
+			if err != nil {
+				return fmt.Errorf("failed to write %s: %w", args[1], err)
+			}
+			logger.Info("Converted",
+				"in", args[0],
+				"out", args[1],
+				"to", opts.To,
+				"conversations", len(d.Conversations),
+				"written", n)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&opts.To, "to",
+		"sharegpt", "Output format: "+strings.Join(convertFormatNames(), ", "))
+	cmd.Flags().StringToStringVar(&opts.Roles, "roles",
+		nil, "Role for a ShareGPT speaker in openai and chatml output, e.g. gpt=model (defaults: human=user, gpt=assistant, system=system)")
+	cmd.Flags().StringVar(&opts.System, "system",
+		"", "System prompt to add to every converted conversation")
+	_ = cmd.RegisterFlagCompletionFunc("to", cobra.FixedCompletions(convertFormatNames(), cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+func convertFormatNames() []string {
+	var names []string
+	for n := range convertFormats {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var defaultRoles = map[string]string{"human": "user", "gpt": "assistant", "system": "system"}
+
+func (o convertOptions) role(from string) string {
+	if r, ok := o.Roles[from]; ok {
+		return r
+	}
+	if r, ok := defaultRoles[from]; ok {
+		return r
+	}
+	return from
+}
+
+// alpacaRecord is one conversation in Alpaca instruction format: the last
+// exchange is the instruction and output, and earlier ones go in history
+// as [instruction, response] pairs.
+type alpacaRecord struct {
+	Instruction string      `json:"instruction"`
+	Input       string      `json:"input"`
+	Output      string      `json:"output"`
+	System      string      `json:"system,omitempty"`
+	History     [][2]string `json:"history,omitempty"`
+}
+
+// writeAlpaca writes a JSON array, or one record per line for .jsonl.
+// Conversations that don't end in a gpt turn after a human one are skipped.
+func writeAlpaca(path string, d *ShareGPTData, opts convertOptions) (int, error) {
+	var recs []any
+	for _, conv := range d.Conversations {
+		rec := alpacaRecord{System: opts.System}
+		var pairs [][2]string
+		var pending *string
+		for _, t := range conv {
+			switch t.From {
+			case "system":
+				if rec.System == "" {
+					rec.System = t.Value
+				}
+			case "human":
+				v := t.Value
+				pending = &v
+			case "gpt":
+				if pending != nil {
+					pairs = append(pairs, [2]string{*pending, t.Value})
+					pending = nil
+				}
+			}
+		}
+		if len(pairs) == 0 || pending != nil {
+			continue
+		}
+		last := pairs[len(pairs)-1]
+		rec.Instruction, rec.Output = last[0], last[1]
+		rec.History = pairs[:len(pairs)-1]
+		recs = append(recs, rec)
+	}
+	return len(recs), writeRecords(path, recs)
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+func (o convertOptions) messages(conv []ShareGPTTurn) []chatMessage {
+	var msgs []chatMessage
+	if o.System != "" {
+		msgs = append(msgs, chatMessage{Role: o.role("system"), Content: o.System})
+	}
+	for _, t := range conv {
+		msgs = append(msgs, chatMessage{Role: o.role(t.From), Content: t.Value})
+	}
+	return msgs
+}
+
+// writeOpenAI writes OpenAI chat-completions fine-tuning JSONL.
+func writeOpenAI(path string, d *ShareGPTData, opts convertOptions) (int, error) {
+	var recs []any
+	for _, conv := range d.Conversations {
+		recs = append(recs, struct {
+			Messages []chatMessage `json:"messages"`
+		}{opts.messages(conv)})
+	}
+	return len(recs), writeJSONLRecords(path, recs)
+}
+
+// writeChatML writes JSONL with each conversation rendered as ChatML text.
+func writeChatML(path string, d *ShareGPTData, opts convertOptions) (int, error) {
+	var recs []any
+	for _, conv := range d.Conversations {
+		var sb strings.Builder
+		for _, m := range opts.messages(conv) {
+			fmt.Fprintf(&sb, "<|im_start|>%s\n%s<|im_end|>\n", m.Role, m.Content)
+		}
+		recs = append(recs, struct {
+			Text string `json:"text"`
+		}{sb.String()})
+	}
+	return len(recs), writeJSONLRecords(path, recs)
+}
+
+// writeRecords writes recs as a JSON array, or as JSONL for .jsonl paths.
+func writeRecords(path string, recs []any) error {
+	if format, _ := outputFormat(path, ""); format == "jsonl" {
+		return writeJSONLRecords(path, recs)
+	}
+	if recs == nil {
+		recs = []any{}
+	}
+	return writeFileAtomic(path, func(f io.Writer) error {
+		enc := json.NewEncoder(f)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(recs)
+	})
+}
+
+func writeJSONLRecords(path string, recs []any) error {
+	return writeFileAtomic(path, func(f io.Writer) error {
+		w := bufio.NewWriter(f)
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		for _, r := range recs {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	})
+}
@@ -0,0 +1,132 @@
+package synner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/nathanleclaire/gpumon/internal/extract"
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errMalformed marks a response whose conversation couldn't be parsed, as
+// opposed to a failed request; only those are worth a corrective re-prompt.
+var errMalformed = errors.New("malformed response")
+
+// parseOptions control how a response is turned into a conversation.
+type parseOptions struct {
+	// MaxCorrections is how many times a malformed response is sent back
+	// with a description of what was wrong.
+	MaxCorrections int
+	// Repair runs llm.RepairJSON over a <json> block that doesn't parse as is.
+	Repair bool
+}
+
+// genResult is what generateConversation did to get a conversation.
+type genResult struct {
+	Corrections int
+	Repaired    bool
+	// Usage adds up every generation made, corrections included.
+	Usage genUsage
+}
+
+// generateConversation generates and parses a conversation, showing the
+// response as it streams as echo says. When the
+// response is malformed, even after repair, it asks again, up to
+// MaxCorrections times, with the previous answer and what was wrong with it
+// appended to the prompt.
+func generateConversation(ctx context.Context, pool *endpointPool, model, prompt string,
+	options map[string]interface{}, opts parseOptions, echo echoMode, logger *slog.Logger) (conv []ShareGPTTurn, res genResult, err error) {
+	ctx, span := otel.Tracer(ServiceName).Start(ctx, "conversation_generation",
+		trace.WithAttributes(attribute.String("model.name", model)))
+	defer func() {
+		span.SetAttributes(
+			attribute.Int("conversation.corrections", res.Corrections),
+			attribute.Bool("conversation.repaired", res.Repaired),
+			attribute.Int("model.output_tokens", res.Usage.OutputTokens),
+		)
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}()
+	p := prompt
+	for attempt := 0; ; attempt++ {
+		res.Corrections = attempt
+		var body string
+		err := pool.do(ctx, func(b llm.Backend) error {
+			var m llm.Metrics
+			var err error
+			body, m, err = generateChat(ctx, b, model, p, options, echo, logger)
+			res.Usage.add(m)
+			return err
+		})
+		if err != nil {
+			return nil, res, err
+		}
+		conv, repaired, err := parseConversation(body, opts.Repair)
+		res.Repaired = repaired
+		if err == nil || attempt >= opts.MaxCorrections || ctx.Err() != nil {
+			return conv, res, err
+		}
+		logger.Warn("Malformed response, re-prompting with a correction",
+			"correction", attempt+1,
+			"maxCorrections", opts.MaxCorrections,
+			"err", err)
+		p = prompt + correctionPrompt(body, err)
+	}
+}
+
+// parseConversation extracts the first conversation from the <json> block,
+// reporting whether it only parsed after llm.RepairJSON.
+func parseConversation(body string, repair bool) ([]ShareGPTTurn, bool, error) {
+	block, ok := extract.Tag(body, "json")
+	if !ok || block.Body == "" {
+		return nil, false, fmt.Errorf("%w: no <json> block found", errMalformed)
+	}
+	if block.Truncated {
+		return nil, false, fmt.Errorf("%w: <json> block cut off before </json>", errMalformed)
+	}
+	jsonBlock := block.Body
+	var outer struct {
+		Conversations [][]ShareGPTTurn `json:"conversations"`
+	}
+	repaired := false
+	if e := json.Unmarshal([]byte(jsonBlock), &outer); e != nil {
+		if !repair || json.Unmarshal([]byte(llm.RepairJSON(jsonBlock)), &outer) != nil {
+			return nil, false, fmt.Errorf("%w: %w", errMalformed, e)
+		}
+		repaired = true
+	}
+	// The prompt's example puts each exchange in its own array; together
+	// they are one conversation.
+	var conv []ShareGPTTurn
+	for _, exchange := range outer.Conversations {
+		conv = append(conv, exchange...)
+	}
+	if len(conv) == 0 {
+		return nil, repaired, fmt.Errorf("%w: no conversation data found", errMalformed)
+	}
+	return conv, repaired, nil
+}
+
+func correctionPrompt(previous string, err error) string {
+	return fmt.Sprintf(`
+
+Your previous response could not be used:
+
+<previous_response>
+%s
+</previous_response>
+
+The problem: %v.
+
+Respond again with the complete conversation. It MUST be valid JSON with the
+structure shown above, enclosed in <json> and </json> tags, with no markdown
+code fences, comments or trailing commas inside the tags.`, trimTo(previous, 4000), err)
+}
@@ -0,0 +1,390 @@
+package synner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// curateOptions are the curate command's settings.
+type curateOptions struct {
+	Out    string
+	Ledger string
+	Start  int
+	Width  int
+	Color  string
+}
+
+func newCurateCmd(logger *slog.Logger) *cobra.Command {
+	opts := curateOptions{Start: -1}
+	cmd := &cobra.Command{
+		Use:   "curate [in]",
+		Short: "Review conversations one by one to accept, reject or edit them",
+		Long: `Review a dataset's conversations one at a time in the terminal:
+
+  a  accept      r  reject      e  edit in $EDITOR, then accept
+  s  skip        b  back        q  save and quit
+
+Each decision is appended to a review ledger as it is made, so a review can
+be stopped and picked up later; it starts at the first conversation without
+a decision. On quit, and when the last conversation is reviewed, the
+accepted and edited conversations are written to the curated output.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCurate(logger, os.Stdin, os.Stdout, args[0], opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.Out, "out",
+		"", "Where to write the curated dataset (default: <in>.curated.<ext>)")
+	cmd.Flags().StringVar(&opts.Ledger, "ledger",
+		"", "Review ledger of decisions, one JSON line each (default: <in>.review.jsonl)")
+	cmd.Flags().IntVar(&opts.Start, "start",
+		-1, "Zero-based index to start at (default: the first without a decision)")
+	cmd.Flags().IntVar(&opts.Width, "width",
+		0, "Wrap text at this many columns (default: $COLUMNS, or 100)")
+	cmd.Flags().StringVar(&opts.Color, "color",
+		"auto", "Color roles: auto (when writing to a terminal), always or never")
+	_ = cmd.RegisterFlagCompletionFunc("color", cobra.FixedCompletions([]string{"auto", "always", "never"}, cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+// Review decisions.
+const (
+	decisionAccept = "accept"
+	decisionReject = "reject"
+	decisionEdit   = "edit"
+)
+
+// reviewEntry is one line of the review ledger. Conversations are matched
+// to decisions by Hash, so a ledger still applies if the dataset is
+// reordered; Conversations holds the edited text for edit decisions.
+type reviewEntry struct {
+	Index         int            `json:"index"`
+	Hash          string         `json:"hash"`
+	Decision      string         `json:"decision"`
+	Conversations []ShareGPTTurn `json:"conversations,omitempty"`
+	Time          time.Time      `json:"time"`
+}
+
+func runCurate(logger *slog.Logger, in io.Reader, out io.Writer, path string, opts curateOptions) error {
+	color, err := useColor(opts.Color, out)
+	if err != nil {
+		return err
+	}
+	width := terminalWidth(opts.Width)
+	ext := datasetExt(path)
+	base := strings.TrimSuffix(path, ext)
+	if opts.Out == "" {
+		opts.Out = base + ".curated" + ext
+	}
+	if opts.Ledger == "" {
+		opts.Ledger = base + ".review.jsonl"
+	}
+
+	recs, err := loadRecords(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if len(recs) == 0 {
+		return fmt.Errorf("%s has no conversations", path)
+	}
+	hashes := make([]string, len(recs))
+	for i, r := range recs {
+		h := conversationHash(r.conv)
+		hashes[i] = hex.EncodeToString(h[:])
+	}
+	decisions, err := loadLedger(opts.Ledger)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", opts.Ledger, err)
+	}
+	ledger, err := os.OpenFile(opts.Ledger, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer ledger.Close()
+
+	i := opts.Start
+	if i < 0 {
+		i = 0
+		for i < len(recs)-1 && decisions[hashes[i]] != nil {
+			i++
+		}
+	}
+	if i >= len(recs) {
+		return fmt.Errorf("--start %d out of range; %s has %d conversations", i, path, len(recs))
+	}
+
+	keys, err := newKeyReader(in)
+	if err != nil {
+		return err
+	}
+	defer keys.Close()
+
+	var note string
+	for i < len(recs) {
+		rec := recs[i]
+		if color {
+			fmt.Fprint(out, "\x1b[H\x1b[2J")
+		}
+		printConversation(out, rec, i, len(recs), width, color)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, ansiStyle(color, ansiDim, curateStatus(decisions, hashes, i)))
+		if note != "" {
+			fmt.Fprintln(out, note)
+			note = ""
+		}
+		fmt.Fprint(out, "[a]ccept [r]eject [e]dit [s]kip [b]ack [q]uit > ")
+		key, err := keys.Read()
+		fmt.Fprintln(out)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		entry := reviewEntry{Index: i, Hash: hashes[i], Time: time.Now().UTC()}
+		switch key {
+		case 'a':
+			entry.Decision = decisionAccept
+		case 'r':
+			entry.Decision = decisionReject
+		case 'e':
+			start := rec.conv
+			if d := decisions[hashes[i]]; d != nil && d.Decision == decisionEdit {
+				start = d.Conversations
+			}
+			keys.Pause()
+			edited, err := editConversation(start)
+			keys.Resume()
+			if err != nil {
+				note = fmt.Sprintf("Edit discarded: %v", err)
+				continue
+			}
+			entry.Decision = decisionEdit
+			entry.Conversations = edited
+		case 's', 'n', ' ':
+			i++
+			continue
+		case 'b', 'p':
+			i = max(i-1, 0)
+			continue
+		case 'q':
+			i = len(recs)
+			continue
+		default:
+			note = fmt.Sprintf("Unknown key %q", key)
+			continue
+		}
+		if err := appendLedger(ledger, entry); err != nil {
+			return fmt.Errorf("failed to write %s: %w", opts.Ledger, err)
+		}
+		decisions[entry.Hash] = &entry
+		i++
+	}
+
+	var curated []datasetRecord
+	accepted, edited, rejected := 0, 0, 0
+	for i, r := range recs {
+		d := decisions[hashes[i]]
+		switch {
+		case d == nil:
+			continue
+		case d.Decision == decisionAccept:
+			accepted++
+		case d.Decision == decisionEdit:
+			if r, err = r.withConv(d.Conversations); err != nil {
+				return err
+			}
+			edited++
+		default:
+			rejected++
+			continue
+		}
+		curated = append(curated, r)
+	}
+	if err := writeRecordsFile(opts.Out, curated); err != nil {
+		return fmt.Errorf("failed to write %s: %w", opts.Out, err)
+	}
+	logger.Info("Wrote curated dataset",
+		"path", opts.Out,
+		"accepted", accepted,
+		"edited", edited,
+		"rejected", rejected,
+		"undecided", len(recs)-accepted-edited-rejected,
+		"ledger", opts.Ledger)
+	return nil
+}
+
+func curateStatus(decisions map[string]*reviewEntry, hashes []string, i int) string {
+	counts := map[string]int{}
+	for _, h := range hashes {
+		if d := decisions[h]; d != nil {
+			counts[d.Decision]++
+		}
+	}
+	s := fmt.Sprintf("reviewed %d of %d · %d accepted · %d edited · %d rejected",
+		counts[decisionAccept]+counts[decisionEdit]+counts[decisionReject], len(hashes),
+		counts[decisionAccept], counts[decisionEdit], counts[decisionReject])
+	if d := decisions[hashes[i]]; d != nil {
+		s += " · this one: " + d.Decision + "ed"
+	}
+	return s
+}
+
+// loadLedger returns the latest decision for each conversation hash.
+func loadLedger(path string) (map[string]*reviewEntry, error) {
+	decisions := map[string]*reviewEntry{}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return decisions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var e reviewEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		decisions[e.Hash] = &e
+	}
+	return decisions, sc.Err()
+}
+
+func appendLedger(f *os.File, e reviewEntry) error {
+	b, err := marshalRaw(e)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// editConversation opens conv as JSON in $VISUAL or $EDITOR (default vi)
+// and returns the edited turns.
+func editConversation(conv []ShareGPTTurn) ([]ShareGPTTurn, error) {
+	f, err := os.CreateTemp("", "synner-curate-*.json")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(conv); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// The editor may carry arguments, as in EDITOR="code --wait".
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", f.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor failed: %w", err)
+	}
+
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	var edited []ShareGPTTurn
+	if err := json.Unmarshal(b, &edited); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if len(edited) == 0 {
+		return nil, errors.New("no turns left")
+	}
+	return edited, nil
+}
+
+// keyReader reads single keypresses from a terminal, switching it out of
+// line mode with stty, or the first character of each line otherwise.
+type keyReader struct {
+	r     *bufio.Reader
+	saved string
+}
+
+func newKeyReader(in io.Reader) (*keyReader, error) {
+	k := &keyReader{r: bufio.NewReader(in)}
+	if f, ok := in.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			if saved, err := stty("-g"); err == nil {
+				k.saved = strings.TrimSpace(saved)
+				k.Resume()
+			}
+		}
+	}
+	return k, nil
+}
+
+func (k *keyReader) Read() (rune, error) {
+	if k.saved != "" {
+		r, _, err := k.r.ReadRune()
+		return r, err
+	}
+	line, err := k.r.ReadString('\n')
+	if err != nil && line == "" {
+		return 0, err
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return ' ', nil
+	}
+	return []rune(strings.ToLower(line))[0], nil
+}
+
+// Pause puts the terminal back in line mode, for an editor.
+func (k *keyReader) Pause() {
+	if k.saved != "" {
+		stty(k.saved)
+	}
+}
+
+// Resume switches the terminal to unbuffered, unechoed input.
+func (k *keyReader) Resume() {
+	if k.saved != "" {
+		stty("-icanon", "-echo", "min", "1")
+	}
+}
+
+func (k *keyReader) Close() error {
+	k.Pause()
+	return nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
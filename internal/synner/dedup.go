@@ -0,0 +1,257 @@
+package synner
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const (
+	// minhashBands*minhashRows is the signature length. With 32 bands of 4
+	// rows, pairs above a Jaccard similarity of about 0.45 are likely to
+	// share a band and get compared.
+	minhashBands = 32
+	minhashRows  = 4
+	minhashSize  = minhashBands * minhashRows
+	// shingleWords is the number of words per shingle.
+	shingleWords = 3
+)
+
+// minhasher computes MinHash signatures over word shingles. The hash
+// functions are fixed so signatures are comparable across runs.
+type minhasher struct {
+	a, b [minhashSize]uint64
+}
+
+func newMinhasher() *minhasher {
+	m := &minhasher{}
+	rng := rand.New(rand.NewSource(1))
+	for i := range m.a {
+		m.a[i] = rng.Uint64() | 1
+		m.b[i] = rng.Uint64()
+	}
+	return m
+}
+
+type signature [minhashSize]uint64
+
+// Signature returns text's MinHash signature and whether it had any
+// shingles at all.
+func (m *minhasher) Signature(text string) (signature, bool) {
+	var sig signature
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+	})
+	if len(words) == 0 {
+		return sig, false
+	}
+	n := max(len(words)-shingleWords+1, 1)
+	for i := 0; i < n; i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:min(i+shingleWords, len(words))], " ")))
+		x := h.Sum64()
+		for j := range sig {
+			if v := m.a[j]*x + m.b[j]; v < sig[j] {
+				sig[j] = v
+			}
+		}
+	}
+	return sig, true
+}
+
+// similarity estimates the Jaccard similarity of the texts behind two
+// signatures.
+func similarity(a, b *signature) float64 {
+	same := 0
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	return float64(same) / minhashSize
+}
+
+// dedupIndex finds conversations that repeat, or nearly repeat, ones it has
+// already seen. Exact repeats are caught by a hash of the whole
+// conversation; near repeats by the MinHash similarity of the gpt turns,
+// looked up through locality-sensitive hashing on signature bands.
+type dedupIndex struct {
+	threshold float64
+	mh        *minhasher
+	exact     map[[32]byte]int
+	sigs      []signature
+	sigIDs    []int
+	bands     [minhashBands]map[uint64][]int
+	n         int
+}
+
+// dedupMatch is the indexed conversation a lookup matched, numbered in the
+// order it was added.
+type dedupMatch struct {
+	ID         int
+	Similarity float64
+	Exact      bool
+}
+
+func (m dedupMatch) String() string {
+	if m.Exact {
+		return "exact duplicate"
+	}
+	return fmt.Sprintf("near duplicate (similarity %.2f)", m.Similarity)
+}
+
+func newDedupIndex(threshold float64) *dedupIndex {
+	d := &dedupIndex{
+		threshold: threshold,
+		mh:        newMinhasher(),
+		exact:     map[[32]byte]int{},
+	}
+	for i := range d.bands {
+		d.bands[i] = map[uint64][]int{}
+	}
+	return d
+}
+
+// Check reports why conv duplicates an indexed conversation, or "" if it
+// doesn't. It does not add conv to the index.
+func (d *dedupIndex) Check(conv []ShareGPTTurn) string {
+	if m, ok := d.Match(conv); ok {
+		return m.String()
+	}
+	return ""
+}
+
+// Match returns the indexed conversation conv duplicates, preferring an
+// exact repeat over the most similar near repeat.
+func (d *dedupIndex) Match(conv []ShareGPTTurn) (dedupMatch, bool) {
+	if d == nil {
+		return dedupMatch{}, false
+	}
+	if id, ok := d.exact[conversationHash(conv)]; ok {
+		return dedupMatch{ID: id, Similarity: 1, Exact: true}, true
+	}
+	sig, ok := d.mh.Signature(gptText(conv))
+	if !ok {
+		return dedupMatch{}, false
+	}
+	best := dedupMatch{ID: -1}
+	seen := map[int]bool{}
+	for b := range d.bands {
+		for _, i := range d.bands[b][bandKey(&sig, b)] {
+			if seen[i] {
+				continue
+			}
+			seen[i] = true
+			if s := similarity(&sig, &d.sigs[i]); s > best.Similarity {
+				best = dedupMatch{ID: d.sigIDs[i], Similarity: s}
+			}
+		}
+	}
+	if best.ID >= 0 && best.Similarity >= d.threshold {
+		return best, true
+	}
+	return dedupMatch{}, false
+}
+
+// Add indexes conv under the next ID.
+func (d *dedupIndex) Add(conv []ShareGPTTurn) {
+	if d == nil {
+		return
+	}
+	id := d.n
+	d.n++
+	if _, ok := d.exact[conversationHash(conv)]; !ok {
+		d.exact[conversationHash(conv)] = id
+	}
+	sig, ok := d.mh.Signature(gptText(conv))
+	if !ok {
+		return
+	}
+	d.sigs = append(d.sigs, sig)
+	d.sigIDs = append(d.sigIDs, id)
+	for b := range d.bands {
+		k := bandKey(&sig, b)
+		d.bands[b][k] = append(d.bands[b][k], len(d.sigs)-1)
+	}
+}
+
+func bandKey(sig *signature, band int) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, v := range sig[band*minhashRows : (band+1)*minhashRows] {
+		binary.LittleEndian.PutUint64(buf[:], v)
+		h.Write(buf[:])
+	}
+	return h.Sum64()
+}
+
+// conversationHash hashes every turn but system ones, with whitespace and
+// case normalized.
+func conversationHash(conv []ShareGPTTurn) [32]byte {
+	h := sha256.New()
+	for _, t := range conv {
+		if t.From == "system" {
+			// Added by --system-prompt, the same for every conversation.
+			continue
+		}
+		h.Write([]byte(t.From))
+		h.Write([]byte{0})
+		h.Write([]byte(strings.ToLower(strings.Join(strings.Fields(t.Value), " "))))
+		h.Write([]byte{0})
+	}
+	var sum [32]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// gptText joins the model's turns, where near-identical phrasings show up.
+func gptText(conv []ShareGPTTurn) string {
+	var parts []string
+	for _, t := range conv {
+		if t.From == "gpt" {
+			parts = append(parts, t.Value)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// openDedup indexes the conversations already in the output, plus those
+// resumed from a checkpoint that aren't in it yet. It returns nil with
+// deduplication off; a nil index accepts everything.
+func openDedup(opts genOptions, format string, resumed [][]ShareGPTTurn) (*dedupIndex, error) {
+	switch opts.Dedup {
+	case "off":
+		return nil, nil
+	case "drop", "flag":
+	default:
+		return nil, fmt.Errorf("unknown --dedup %q (want drop, flag or off)", opts.Dedup)
+	}
+	if opts.DedupThreshold <= 0 || opts.DedupThreshold > 1 {
+		return nil, fmt.Errorf("--dedup-threshold must be in (0, 1], got %v", opts.DedupThreshold)
+	}
+	d := newDedupIndex(opts.DedupThreshold)
+	existing, err := loadDataset(opts.OutFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", opts.OutFile, err)
+	}
+	if existing != nil {
+		for _, conv := range existing.Conversations {
+			d.Add(conv)
+		}
+	}
+	if format == "json" {
+		for _, conv := range resumed {
+			d.Add(conv)
+		}
+	}
+	return d, nil
+}
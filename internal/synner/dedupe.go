@@ -0,0 +1,154 @@
+package synner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// dedupeOptions are the dedupe command's settings.
+type dedupeOptions struct {
+	Against   []string
+	Threshold float64
+	Out       string
+	Report    string
+}
+
+func newDedupeCmd(logger *slog.Logger) *cobra.Command {
+	var opts dedupeOptions
+	cmd := &cobra.Command{
+		Use:   "dedupe [in]",
+		Short: "Remove exact and near-duplicate conversations from a ShareGPT dataset",
+		Long: `Remove exact and near-duplicate conversations from a ShareGPT dataset.
+
+Conversations are compared the same way generate's --dedup does: a hash of
+every turn for exact repeats and the MinHash similarity of the gpt turns for
+near repeats. The first of a group of duplicates is kept. With --against,
+conversations that repeat one in a reference dataset, such as an earlier
+release or an eval set, are removed too.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDedupe(logger, args[0], opts)
+		},
+	}
+	cmd.Flags().StringSliceVar(&opts.Against, "against",
+		nil, "Reference datasets; conversations duplicating theirs are removed")
+	cmd.Flags().Float64Var(&opts.Threshold, "threshold",
+		0.8, "Estimated gpt-turn similarity, from 0 to 1, at which conversations count as near duplicates")
+	cmd.Flags().StringVar(&opts.Out, "out",
+		"", "Where to write the deduplicated dataset (default: <in>.dedup.<ext>, compressed like the input)")
+	cmd.Flags().StringVar(&opts.Report, "report",
+		"", "Where to write the JSON report of removed conversations (default: <out>.report.json)")
+	return cmd
+}
+
+// dedupeReport lists what dedupe removed and why.
+type dedupeReport struct {
+	Input     string          `json:"input"`
+	Against   []string        `json:"against,omitempty"`
+	Threshold float64         `json:"threshold"`
+	Kept      int             `json:"kept"`
+	Removed   []dedupeRemoval `json:"removed"`
+}
+
+// dedupeRemoval is one removed conversation. Indexes are zero-based
+// positions in their file.
+type dedupeRemoval struct {
+	Index      int     `json:"index"`
+	Source     string  `json:"source,omitempty"`
+	Reason     string  `json:"reason"`
+	Similarity float64 `json:"similarity"`
+	MatchFile  string  `json:"match_file"`
+	MatchIndex int     `json:"match_index"`
+	Preview    string  `json:"preview"`
+}
+
+// recordRef locates an indexed conversation.
+type recordRef struct {
+	file  string
+	index int
+}
+
+func runDedupe(logger *slog.Logger, in string, opts dedupeOptions) error {
+	if opts.Threshold <= 0 || opts.Threshold > 1 {
+		return fmt.Errorf("--threshold must be in (0, 1], got %v", opts.Threshold)
+	}
+	if opts.Out == "" {
+		ext := datasetExt(in)
+		opts.Out = strings.TrimSuffix(in, ext) + ".dedup" + ext
+	}
+	if opts.Report == "" {
+		opts.Report = strings.TrimSuffix(opts.Out, datasetExt(opts.Out)) + ".report.json"
+	}
+
+	idx := newDedupIndex(opts.Threshold)
+	var refs []recordRef
+	for _, path := range opts.Against {
+		recs, err := loadRecords(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		for i, r := range recs {
+			idx.Add(r.conv)
+			refs = append(refs, recordRef{path, i})
+		}
+		logger.Info("Indexed reference dataset", "path", path, "conversations", len(recs))
+	}
+
+	recs, err := loadRecords(in)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", in, err)
+	}
+	report := dedupeReport{Input: in, Against: opts.Against, Threshold: opts.Threshold, Removed: []dedupeRemoval{}}
+	kept := make([]datasetRecord, 0, len(recs))
+	for i, r := range recs {
+		if m, ok := idx.Match(r.conv); ok {
+			report.Removed = append(report.Removed, dedupeRemoval{
+				Index:      i,
+				Source:     r.source,
+				Reason:     m.String(),
+				Similarity: m.Similarity,
+				MatchFile:  refs[m.ID].file,
+				MatchIndex: refs[m.ID].index,
+				Preview:    preview(gptText(r.conv), 120),
+			})
+			continue
+		}
+		idx.Add(r.conv)
+		refs = append(refs, recordRef{in, i})
+		kept = append(kept, r)
+	}
+	report.Kept = len(kept)
+
+	if err := writeRecordsFile(opts.Out, kept); err != nil {
+		return fmt.Errorf("failed to write %s: %w", opts.Out, err)
+	}
+	err = writeFileAtomic(opts.Report, func(f io.Writer) error {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(report)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", opts.Report, err)
+	}
+	logger.Info("Deduplicated dataset",
+		"path", opts.Out,
+		"kept", len(kept),
+		"removed", len(report.Removed),
+		"report", opts.Report)
+	return nil
+}
+
+// preview returns the first n runes of s on one line.
+func preview(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	return s
+}
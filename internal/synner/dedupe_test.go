@@ -0,0 +1,145 @@
+package synner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const (
+	story = `The rain had not stopped for three days when Elena finally opened the letter.
+She read it twice by the window, the candle guttering beside her, and then she folded it
+into the pocket of her coat and walked out into the storm without a word to anyone in the
+house. Down at the harbor the boats knocked against the pier and the lamps swung on their
+chains, and she stood there until the last ferry had gone.`
+	otherStory = `Marcus counted the coins on the tavern table a second time, frowning at the
+candlelight as if it had cheated him. The innkeeper watched from the doorway. Outside a cart
+rattled over the cobbles toward the market, and somewhere above them a child was singing an
+old song about the sea and the ships that never came home.`
+)
+
+func TestDedupIndex(t *testing.T) {
+	idx := newDedupIndex(0.8)
+	idx.Add(conv(story))
+	idx.Add(conv(otherStory))
+
+	tests := []struct {
+		name  string
+		conv  []ShareGPTTurn
+		id    int
+		exact bool
+		match bool
+	}{
+		{"exact", conv(story), 0, true, true},
+		{"case and spacing", conv(strings.ToUpper(strings.Join(strings.Fields(otherStory), "  "))), 1, true, true},
+		{"system turn ignored", append([]ShareGPTTurn{{From: "system", Value: "Be vivid."}}, conv(story)...), 0, true, true},
+		{"one word changed", conv(strings.Replace(story, "last ferry", "final ferry", 1)), 0, false, true},
+		{"unrelated", conv("A completely different scene about a spaceship crew arguing over dinner on a quiet evening."), 0, false, false},
+		{"no words", conv("..."), 0, false, false},
+	}
+	for _, tt := range tests {
+		m, ok := idx.Match(tt.conv)
+		if ok != tt.match {
+			t.Errorf("%s: matched = %v, want %v (%v)", tt.name, ok, tt.match, m)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if m.ID != tt.id || m.Exact != tt.exact {
+			t.Errorf("%s: Match = %+v, want ID %d, exact %v", tt.name, m, tt.id, tt.exact)
+		}
+		if !m.Exact && m.Similarity < 0.8 {
+			t.Errorf("%s: similarity %.2f is below the threshold", tt.name, m.Similarity)
+		}
+	}
+
+	var nilIdx *dedupIndex
+	nilIdx.Add(conv(story))
+	if reason := nilIdx.Check(conv(story)); reason != "" {
+		t.Errorf("nil index Check = %q, want it to accept everything", reason)
+	}
+}
+
+func TestRunDedupe(t *testing.T) {
+	dir := t.TempDir()
+	ref := filepath.Join(dir, "eval.jsonl")
+	writeJSONL(t, ref, []jsonlLine{{Conversations: conv(otherStory)}})
+	in := filepath.Join(dir, "data.jsonl")
+	writeJSONL(t, in, []jsonlLine{
+		{Conversations: conv(story), convMeta: convMeta{Source: "a"}},
+		{Conversations: conv("A short unrelated answer about gardening in early spring.")},
+		{Conversations: conv(strings.Replace(story, "last ferry", "final ferry", 1)), convMeta: convMeta{Source: "b"}},
+		{Conversations: conv(otherStory)},
+		{Conversations: conv(story)},
+	})
+
+	if err := runDedupe(discard, in, dedupeOptions{Against: []string{ref}, Threshold: 0.8}); err != nil {
+		t.Fatal(err)
+	}
+	got := answers(t, filepath.Join(dir, "data.dedup.jsonl"))
+	want := []string{story, "A short unrelated answer about gardening in early spring."}
+	if !slices.Equal(got, want) {
+		t.Errorf("kept %q, want %q", got, want)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "data.dedup.report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report dedupeReport
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Kept != 2 || len(report.Removed) != 3 {
+		t.Fatalf("report kept %d and removed %d, want 2 and 3", report.Kept, len(report.Removed))
+	}
+	wantRemoved := []struct {
+		index      int
+		source     string
+		matchFile  string
+		matchIndex int
+		exact      bool
+	}{
+		{2, "b", in, 0, false},
+		{3, "", ref, 0, true},
+		{4, "", in, 0, true},
+	}
+	for i, w := range wantRemoved {
+		r := report.Removed[i]
+		if r.Index != w.index || r.Source != w.source || r.MatchFile != w.matchFile || r.MatchIndex != w.matchIndex {
+			t.Errorf("removed[%d] = %+v, want index %d from %q matching %s:%d", i, r, w.index, w.source, w.matchFile, w.matchIndex)
+		}
+		if exact := r.Reason == "exact duplicate"; exact != w.exact {
+			t.Errorf("removed[%d] reason = %q, want exact %v", i, r.Reason, w.exact)
+		}
+	}
+}
+
+func TestRunDedupeThreshold(t *testing.T) {
+	for _, th := range []float64{0, -0.5, 1.5} {
+		if err := runDedupe(discard, "unused.jsonl", dedupeOptions{Threshold: th}); err == nil {
+			t.Errorf("runDedupe with threshold %v succeeded", th)
+		}
+	}
+}
+
+func TestPreview(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"line one\n  line two", 20, "line one line two"},
+		{"héllo wörld", 5, "héllo…"},
+	}
+	for _, tt := range tests {
+		if got := preview(tt.s, tt.n); got != tt.want {
+			t.Errorf("preview(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package synner
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// provenancer is implemented by sources that can say where the last row
+// returned by NextRow came from: a description of it, and its 0-based
+// index in the source, or -1 if unknown.
+type provenancer interface {
+	Provenance() string
+	Row() int64
+}
+
+// dirSource reads every .txt, .md and .epub file under a directory as one
+// row, so book dumps such as Project Gutenberg exports can be used as is.
+type dirSource struct {
+	files []string
+	next  int
+	cur   string
+}
+
+var dirSourceExts = map[string]bool{".txt": true, ".md": true, ".epub": true}
+
+func openDirSource(dir string) (*dirSource, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && dirSourceExts[strings.ToLower(filepath.Ext(p))] {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", dir, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .txt, .md or .epub files in %s", dir)
+	}
+	sort.Strings(files)
+	return &dirSource{files: files}, nil
+}
+
+func (d *dirSource) NextRow() (string, error) {
+	if d.next >= len(d.files) {
+		return "", io.EOF
+	}
+	d.cur = d.files[d.next]
+	d.next++
+	var text string
+	var err error
+	if strings.EqualFold(filepath.Ext(d.cur), ".epub") {
+		text, err = epubText(d.cur)
+	} else {
+		var b []byte
+		b, err = os.ReadFile(d.cur)
+		text = string(b)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", d.cur, err)
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", fmt.Errorf("%s: empty file", d.cur)
+	}
+	return text, nil
+}
+
+func (d *dirSource) Provenance() string {
+	return d.cur
+}
+
+// Row is the file's index among the directory's sorted files.
+func (d *dirSource) Row() int64 {
+	return int64(d.next - 1)
+}
+
+func (d *dirSource) NumRows() int64 {
+	return int64(len(d.files))
+}
+
+func (d *dirSource) Close() error {
+	return nil
+}
+
+// epubText returns the text of an EPUB's content documents in reading
+// order, one paragraph per line.
+func epubText(p string) (string, error) {
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	docs, err := epubSpine(&zr.Reader)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, name := range docs {
+		f, err := zr.Open(name)
+		if err != nil {
+			// Spines sometimes list documents the archive lacks.
+			continue
+		}
+		err = htmlText(f, &sb)
+		f.Close()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return sb.String(), nil
+}
+
+// epubSpine lists the archive paths of the content documents, following the
+// package document's spine. Without a usable container.xml it falls back to
+// every (X)HTML file in name order.
+func epubSpine(zr *zip.Reader) ([]string, error) {
+	var container struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := readZipXML(zr, "META-INF/container.xml", &container); err != nil || len(container.Rootfiles) == 0 {
+		return epubHTMLFiles(zr), nil
+	}
+	opfPath := container.Rootfiles[0].FullPath
+	var pkg struct {
+		Items []struct {
+			ID   string `xml:"id,attr"`
+			Href string `xml:"href,attr"`
+		} `xml:"manifest>item"`
+		Spine []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"spine>itemref"`
+	}
+	if err := readZipXML(zr, opfPath, &pkg); err != nil {
+		return nil, fmt.Errorf("package document: %w", err)
+	}
+	hrefs := map[string]string{}
+	for _, it := range pkg.Items {
+		hrefs[it.ID] = it.Href
+	}
+	var docs []string
+	for _, ref := range pkg.Spine {
+		if href, ok := hrefs[ref.IDRef]; ok {
+			docs = append(docs, path.Join(path.Dir(opfPath), href))
+		}
+	}
+	if len(docs) == 0 {
+		return epubHTMLFiles(zr), nil
+	}
+	return docs, nil
+}
+
+func epubHTMLFiles(zr *zip.Reader) []string {
+	var docs []string
+	for _, f := range zr.File {
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".xhtml", ".html", ".htm":
+			docs = append(docs, f.Name)
+		}
+	}
+	sort.Strings(docs)
+	return docs
+}
+
+func readZipXML(zr *zip.Reader, name string, v any) error {
+	f, err := zr.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return xml.NewDecoder(f).Decode(v)
+}
+
+// htmlBlocks are the elements that end a paragraph.
+var htmlBlocks = map[string]bool{
+	"p": true, "div": true, "li": true, "blockquote": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// htmlText writes the text of an (X)HTML document to sb, with a newline at
+// the end of each block element. Script and style contents are dropped.
+func htmlText(r io.Reader, sb *strings.Builder) error {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+	skip := 0
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch strings.ToLower(t.Name.Local) {
+			case "script", "style", "head":
+				skip++
+			case "br":
+				sb.WriteString("\n")
+			}
+		case xml.EndElement:
+			name := strings.ToLower(t.Name.Local)
+			switch {
+			case name == "script" || name == "style" || name == "head":
+				skip--
+			case htmlBlocks[name]:
+				sb.WriteString("\n")
+			}
+		case xml.CharData:
+			if skip == 0 {
+				writeCollapsed(sb, string(t))
+			}
+		}
+	}
+}
+
+// writeCollapsed writes s with every run of whitespace folded into one
+// space, keeping the spaces between inline elements.
+func writeCollapsed(sb *strings.Builder, s string) {
+	text := strings.Join(strings.Fields(s), " ")
+	lead := s != "" && strings.TrimLeft(s, " \t\r\n") != s
+	trail := s != "" && strings.TrimRight(s, " \t\r\n") != s
+	if lead || (text == "" && s != "") {
+		sb.WriteString(" ")
+	}
+	sb.WriteString(text)
+	if trail && text != "" {
+		sb.WriteString(" ")
+	}
+}
@@ -0,0 +1,85 @@
+package synner
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// echoMode is how generate shows a response as it streams in.
+type echoMode int
+
+const (
+	// echoNone prints nothing; each response's progress is logged instead.
+	echoNone echoMode = iota
+	// echoPlain prints the response as it arrives.
+	echoPlain
+	// echoAnimate types the response out a rune at a time, catching up
+	// when the model gets ahead.
+	echoAnimate
+)
+
+// displayEcho picks the echoMode for --quiet and --no-animate. The
+// animation is only for a person watching: piped or under nohup, stdout
+// gets the response as it arrives instead.
+func displayEcho(quiet, noAnimate bool) echoMode {
+	switch {
+	case quiet:
+		return echoNone
+	case noAnimate || !isTerminal(os.Stdout):
+		return echoPlain
+	}
+	return echoAnimate
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// animatedPrinter types out the text sent on it at a speed that keeps up
+// with how fast it comes in. Close it and wait on done before printing
+// anything else.
+type animatedPrinter struct {
+	tokens chan string
+	done   chan struct{}
+}
+
+func newAnimatedPrinter() *animatedPrinter {
+	p := &animatedPrinter{
+		tokens: make(chan string, 32),
+		done:   make(chan struct{}),
+	}
+	const (
+		minDelay = 10 * time.Millisecond
+		maxDelay = 50 * time.Millisecond
+	)
+	go func() {
+		defer close(p.done)
+		for t := range p.tokens {
+			// How much of the channel is filled? 0.0 => empty, 1.0 => full
+			usage := float64(len(p.tokens)) / float64(cap(p.tokens))
+
+			// Scale delay so it's smaller (faster) if usage is high
+			delay := time.Duration(
+				float64(minDelay) +
+					(1.0-usage)*float64(maxDelay-minDelay),
+			)
+			for _, r := range t {
+				fmt.Printf("%c", r)
+				time.Sleep(delay)
+			}
+		}
+	}()
+	return p
+}
+
+func (p *animatedPrinter) Print(s string) {
+	p.tokens <- s
+}
+
+func (p *animatedPrinter) Close() {
+	close(p.tokens)
+	<-p.done
+}
@@ -0,0 +1,217 @@
+package synner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// domain describes a genre or corpus for --domain, so the same pipeline can
+// produce sci-fi, mystery or instructional data instead of romance:
+//
+//	name: scifi
+//	prompt_file: scifi.tmpl   # or prompt: inline; {{.Excerpt}} is the chunk
+//	input:
+//	  text_field: body        # column holding the text
+//	  split: train            # hf:// inputs only
+//	output_dir: datasets/scifi
+//	system_prompt: You are a hard science fiction author.
+//	persona:                  # see personaConfig
+//	  infer: true
+//	turns:
+//	  min: 4
+//	  max: 10
+//	  alternate: true
+//	  min_chars: 20
+//	shape:                    # what the prompt asks for, and enforced
+//	  exchanges: 4-6          # human/gpt exchanges
+//	  gpt_paragraphs: 2-4
+//	  human_sentences: 1-2
+//
+// Flags given on the command line override the pack.
+type domain struct {
+	Name       string `yaml:"name"`
+	Prompt     string `yaml:"prompt"`
+	PromptFile string `yaml:"prompt_file"`
+	Input      struct {
+		TextField string `yaml:"text_field"`
+		Split     string `yaml:"split"`
+		Config    string `yaml:"config"`
+	} `yaml:"input"`
+	OutputDir    string         `yaml:"output_dir"`
+	SystemPrompt string         `yaml:"system_prompt"`
+	Persona      *personaConfig `yaml:"persona"`
+	Turns        struct {
+		Min       int   `yaml:"min"`
+		Max       int   `yaml:"max"`
+		Alternate *bool `yaml:"alternate"`
+		MinChars  int   `yaml:"min_chars"`
+		MaxChars  int   `yaml:"max_chars"`
+	} `yaml:"turns"`
+	Shape struct {
+		Exchanges      intRange `yaml:"exchanges"`
+		GPTParagraphs  intRange `yaml:"gpt_paragraphs"`
+		HumanSentences intRange `yaml:"human_sentences"`
+		Enforce        *bool    `yaml:"enforce"`
+	} `yaml:"shape"`
+}
+
+// promptData is what prompt templates are executed with. The shape fields
+// are in words, such as "five" or "three to five".
+type promptData struct {
+	Excerpt        string
+	Domain         string
+	Exchanges      string
+	GPTParagraphs  string
+	HumanSentences string
+	// Persona is the book's persona as a list of points, or "" for none.
+	Persona string
+}
+
+func loadDomain(path string) (*domain, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var d domain
+	dec := yaml.NewDecoder(strings.NewReader(string(b)))
+	dec.KnownFields(true)
+	if err := dec.Decode(&d); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if d.Name == "" {
+		d.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if d.PromptFile != "" {
+		if d.Prompt != "" {
+			return nil, fmt.Errorf("%s: set prompt or prompt_file, not both", path)
+		}
+		p := d.PromptFile
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(filepath.Dir(path), p)
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		d.Prompt = string(b)
+	}
+	if d.Prompt != "" {
+		if _, err := parsePrompt(d.Prompt); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if d.Persona != nil {
+		if err := d.Persona.validate(); err != nil {
+			return nil, fmt.Errorf("%s: persona: %w", path, err)
+		}
+	}
+	return &d, nil
+}
+
+func parsePrompt(text string) (*template.Template, error) {
+	t, err := template.New("prompt").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template: %w", err)
+	}
+	return t, nil
+}
+
+// promptTemplate parses the prompt, defaulting to the romance one.
+func (o *genOptions) promptTemplate() (*template.Template, error) {
+	if o.Prompt == "" {
+		o.Prompt = romancePrompt
+	}
+	if o.DomainName == "" {
+		o.DomainName = "romance"
+	}
+	if !o.Persona.IsZero() && !strings.Contains(o.Prompt, ".Persona") {
+		return nil, errors.New("a persona is configured but the prompt template has no {{.Persona}} to put it in")
+	}
+	return parsePrompt(o.Prompt)
+}
+
+// renderPrompt fills in the prompt for one chunk of a book with persona p,
+// which may be nil.
+func (o *genOptions) renderPrompt(t *template.Template, chunk string, p *persona) (string, error) {
+	var sb strings.Builder
+	err := t.Execute(&sb, promptData{
+		Excerpt:        chunk,
+		Domain:         o.DomainName,
+		Exchanges:      o.Shape.Exchanges.Prose(),
+		GPTParagraphs:  o.Shape.GPTParagraphs.Prose(),
+		HumanSentences: o.Shape.HumanSentences.Prose(),
+		Persona:        p.Prose(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render prompt: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// apply sets the options the pack covers, except those whose flags were
+// given explicitly.
+func (d *domain) apply(opts *genOptions, flags *pflag.FlagSet) {
+	set := func(name string, f func()) {
+		if !flags.Changed(name) {
+			f()
+		}
+	}
+	opts.DomainName = d.Name
+	if d.Prompt != "" {
+		opts.Prompt = d.Prompt
+	}
+	if d.OutputDir != "" {
+		set("out-file", func() {
+			opts.OutFile = filepath.Join(d.OutputDir, "sharegpt_"+d.Name+".json")
+		})
+	}
+	if d.SystemPrompt != "" {
+		set("system-prompt", func() { opts.SystemPrompt = d.SystemPrompt })
+	}
+	if d.Persona != nil {
+		set("persona", func() { opts.Persona = d.Persona })
+	}
+	if d.Input.TextField != "" {
+		set("column", func() { opts.Source.Column = d.Input.TextField })
+	}
+	if d.Input.Split != "" {
+		set("split", func() { opts.Source.Split = d.Input.Split })
+	}
+	if d.Input.Config != "" {
+		set("hf-config", func() { opts.Source.Config = d.Input.Config })
+	}
+	if d.Turns.Min > 0 {
+		set("min-turns", func() { opts.Filter.MinTurns = d.Turns.Min })
+	}
+	if d.Turns.Max > 0 {
+		set("max-turns", func() { opts.Filter.MaxTurns = d.Turns.Max })
+	}
+	if d.Turns.Alternate != nil {
+		set("require-alternation", func() { opts.Filter.Alternate = *d.Turns.Alternate })
+	}
+	if d.Turns.MinChars > 0 {
+		set("min-turn-chars", func() { opts.Filter.MinTurnChars = d.Turns.MinChars })
+	}
+	if d.Turns.MaxChars > 0 {
+		set("max-turn-chars", func() { opts.Filter.MaxTurnChars = d.Turns.MaxChars })
+	}
+	if d.Shape.Exchanges.IsSet() {
+		set("exchanges", func() { opts.Shape.Exchanges = d.Shape.Exchanges })
+	}
+	if d.Shape.GPTParagraphs.IsSet() {
+		set("gpt-paragraphs", func() { opts.Shape.GPTParagraphs = d.Shape.GPTParagraphs })
+	}
+	if d.Shape.HumanSentences.IsSet() {
+		set("human-sentences", func() { opts.Shape.HumanSentences = d.Shape.HumanSentences })
+	}
+	if d.Shape.Enforce != nil {
+		set("enforce-shape", func() { opts.Shape.Enforce = *d.Shape.Enforce })
+	}
+}
@@ -0,0 +1,165 @@
+package synner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nathanleclaire/gpumon/internal/llm"
+)
+
+// runDryRun scans the whole corpus and reports what a run with opts would
+// cost, without writing anything. With DryRunSample > 0 it also times that
+// many generations on the first chunks, discarding them, to project the
+// wall-clock time and output tokens.
+func runDryRun(logger *slog.Logger, opts genOptions) error {
+	if err := opts.Chunk.validate(); err != nil {
+		return err
+	}
+	ds, err := openSource(opts.InFile, opts.Source)
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+	promptTmpl, err := opts.promptTemplate()
+	if err != nil {
+		return err
+	}
+	// Prompts are estimated with the top-level persona; per-book and
+	// inferred ones would need the model or the books' sources.
+	var dryRunPersona *persona
+	if opts.Persona != nil {
+		dryRunPersona = &opts.Persona.persona
+	}
+
+	ch := newParagraphChunker(opts.Chunk)
+	tok, err := newTokenizer(opts.Tokenizer)
+	if err != nil {
+		return err
+	}
+	books, skipped, chunks, promptTokens := 0, 0, 0, 0
+	var sample []string
+	for {
+		text, err := ds.NextRow()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, errSourceFailed) {
+			return err
+		}
+		if err != nil {
+			skipped++
+			continue
+		}
+		books++
+		// As many chunks as generate takes with --max-chunks-per-book.
+		bookChunks := ch.Split(text)
+		if m := opts.Sample.MaxChunksPerBook; m > 0 && len(bookChunks) > m {
+			bookChunks = bookChunks[:m]
+		}
+		for _, chunk := range bookChunks {
+			if opts.MaxChunkTokens > 0 {
+				chunk = tok.Truncate(chunk, opts.MaxChunkTokens)
+			}
+			prompt, err := opts.renderPrompt(promptTmpl, chunk, dryRunPersona)
+			if err != nil {
+				return err
+			}
+			chunks++
+			promptTokens += tok.Count(prompt)
+			if len(sample) < opts.DryRunSample {
+				sample = append(sample, prompt)
+			}
+		}
+		if books%100 == 0 {
+			logger.Info("Scanning corpus", "books", books, "chunks", chunks)
+		}
+	}
+	if chunks == 0 {
+		return errors.New("no chunks found in the corpus")
+	}
+
+	// Each chunk is one request and, at best, one conversation.
+	requests := min(chunks, opts.MaxExamples)
+	promptTokensPerRequest := float64(promptTokens) / float64(chunks)
+	logger.Info("Corpus scanned",
+		"books", books,
+		"skippedRows", skipped,
+		"chunks", chunks,
+		"estimatedRequests", requests,
+		"estimatedPromptTokens", int(promptTokensPerRequest*float64(requests)))
+	if len(sample) == 0 {
+		logger.Info("Skipping throughput sample; pass --dry-run-sample to project time and output tokens")
+		return nil
+	}
+
+	ctx := context.Background()
+	pool, err := newEndpointPool(ctx, opts.OllamaAddrs, logger)
+	if err != nil {
+		return err
+	}
+	var elapsed time.Duration
+	outTokens, convTokens, parsed := 0, 0, 0
+	for i, prompt := range sample {
+		var r timedGeneration
+		err := pool.do(ctx, func(b llm.Backend) error {
+			var err error
+			r, err = timeGeneration(ctx, b, opts.Model, prompt, opts.Temperature, opts.Seed)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		elapsed += r.elapsed
+		outTokens += r.outputTokens
+		if conv, _, err := parseConversation(r.text, opts.Parse.Repair); err == nil {
+			parsed++
+			convTokens += conversationTokens(tok, conv)
+		}
+		logger.Info("Sample generation",
+			"sample", i+1,
+			"of", len(sample),
+			"elapsed", r.elapsed.Round(time.Millisecond),
+			"outputTokens", r.outputTokens)
+	}
+	perRequest := elapsed / time.Duration(len(sample))
+	if parsed > 0 && opts.MaxOutputTokens > 0 {
+		// The token budget may end the run before the examples run out.
+		perConv := max(convTokens/parsed, 1)
+		requests = min(requests, (opts.MaxOutputTokens+perConv-1)/perConv)
+	}
+	logger.Info("Dry run estimate",
+		"requests", requests,
+		"secondsPerRequest", perRequest.Seconds(),
+		"projectedTime", (perRequest * time.Duration(requests)).Round(time.Second),
+		"estimatedGeneratedTokens", outTokens/len(sample)*requests,
+		"sampleParseRate", float64(parsed)/float64(len(sample)))
+	return nil
+}
+
+type timedGeneration struct {
+	text         string
+	elapsed      time.Duration
+	outputTokens int
+}
+
+// timeGeneration runs one generation without streaming it to the terminal.
+func timeGeneration(ctx context.Context, b llm.Backend, model, prompt string, temperature float64, seed int64) (timedGeneration, error) {
+	var r timedGeneration
+	start := time.Now()
+	text, m, err := llm.Collect(ctx, b, llm.Request{
+		Model:   model,
+		Prompt:  prompt,
+		Options: map[string]interface{}{"temperature": temperature, "seed": seed},
+	})
+	r.elapsed = time.Since(start)
+	r.text = text
+	r.outputTokens = m.EvalCount
+	if r.outputTokens == 0 {
+		r.outputTokens = (utf8.RuneCountInString(r.text) + charsPerToken - 1) / charsPerToken
+	}
+	return r, err
+}
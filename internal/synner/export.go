@@ -0,0 +1,342 @@
+package synner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+)
+
+// exportOptions are the export command's settings.
+type exportOptions struct {
+	Trainer string
+	OutDir  string
+	// Name names the datasets in the trainer's config.
+	Name string
+	// Val is an existing validation split; without it, ValRatio of the
+	// input is held out, shuffled with Seed.
+	Val          string
+	ValRatio     float64
+	Seed         int64
+	BaseModel    string
+	ChatTemplate string
+	SequenceLen  int
+}
+
+// trainerExport is how a trainer wants its data laid out and configured.
+// Every trainer gets the splits as ShareGPT JSONL under data/, and a
+// starter config, written from config, next to it.
+type trainerExport struct {
+	// ConfigFile is the starter config's name in the output directory.
+	ConfigFile string
+	// Template is the chat template used without --chat-template, in the
+	// trainer's own naming.
+	Template string
+	config   *template.Template
+	// extra writes any files the trainer needs besides the splits and
+	// config.
+	extra func(dir string, c exportConfig) error
+}
+
+// exportConfig is what a trainer's config template is filled in with.
+// Paths are relative to the output directory.
+type exportConfig struct {
+	exportOptions
+	Train string
+	// Eval is "" when nothing is held out.
+	Eval string
+}
+
+var exportTrainers = map[string]trainerExport{
+	"axolotl": {
+		ConfigFile: "axolotl.yaml",
+		Template:   "chatml",
+		config:     template.Must(template.New("axolotl").Parse(axolotlConfig)),
+	},
+	"llama-factory": {
+		ConfigFile: "llama_factory.yaml",
+		Template:   "qwen",
+		config:     template.Must(template.New("llama-factory").Parse(llamaFactoryConfig)),
+		extra:      writeLlamaFactoryInfo,
+	},
+}
+
+func newExportCmd(logger *slog.Logger) *cobra.Command {
+	var opts exportOptions
+	cmd := &cobra.Command{
+		Use:   "export [in]",
+		Short: "Lay a dataset out for a fine-tuning framework, with a starter training config",
+		Long: `Write a dataset's train and validation splits in the layout --trainer expects,
+under data/ in --out-dir, along with a starter LoRA training config that points
+at them. Run the trainer from --out-dir, after checking the config's base model,
+chat template and hyperparameters suit the run.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runExport(logger, args[0], opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.Trainer, "trainer",
+		"axolotl", "Fine-tuning framework: "+strings.Join(exportTrainerNames(), ", "))
+	cmd.Flags().StringVar(&opts.OutDir, "out-dir",
+		"", "Where to write the data and config (default: <in>.<trainer> next to the input)")
+	cmd.Flags().StringVar(&opts.Name, "name",
+		"synner", "Name of the dataset in the config")
+	cmd.Flags().StringVar(&opts.Val, "val",
+		"", "Existing validation split to use, such as one written by split, instead of holding out --val-ratio")
+	cmd.Flags().Float64Var(&opts.ValRatio, "val-ratio",
+		0.05, "Share of the input to hold out for validation (0 for none)")
+	cmd.Flags().Int64Var(&opts.Seed, "seed",
+		42, "Shuffle seed for the held-out split")
+	cmd.Flags().StringVar(&opts.BaseModel, "base-model",
+		"Qwen/Qwen2.5-7B-Instruct", "Hugging Face model to fine-tune")
+	cmd.Flags().StringVar(&opts.ChatTemplate, "chat-template",
+		"", "Chat template, in the trainer's naming (default: chatml for axolotl, qwen for llama-factory)")
+	cmd.Flags().IntVar(&opts.SequenceLen, "sequence-len",
+		4096, "Maximum tokens per training example")
+	_ = cmd.RegisterFlagCompletionFunc("trainer", cobra.FixedCompletions(exportTrainerNames(), cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+func exportTrainerNames() []string {
+	var names []string
+	for n := range exportTrainers {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func runExport(logger *slog.Logger, in string, opts exportOptions) error {
+	trainer, ok := exportTrainers[opts.Trainer]
+	if !ok {
+		return fmt.Errorf("unknown --trainer %q (want %s)", opts.Trainer, strings.Join(exportTrainerNames(), ", "))
+	}
+	if opts.ValRatio < 0 || opts.ValRatio >= 1 {
+		return fmt.Errorf("--val-ratio must be at least 0 and below 1, got %v", opts.ValRatio)
+	}
+	if opts.ChatTemplate == "" {
+		opts.ChatTemplate = trainer.Template
+	}
+	if opts.OutDir == "" {
+		opts.OutDir = strings.TrimSuffix(in, datasetExt(in)) + "." + opts.Trainer
+	}
+
+	train, err := loadRecords(in)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", in, err)
+	}
+	var val []datasetRecord
+	if opts.Val != "" {
+		if val, err = loadRecords(opts.Val); err != nil {
+			return fmt.Errorf("failed to read %s: %w", opts.Val, err)
+		}
+	} else if opts.ValRatio > 0 {
+		rng := rand.New(rand.NewSource(opts.Seed))
+		rng.Shuffle(len(train), func(i, j int) { train[i], train[j] = train[j], train[i] })
+		n := allocate(len(train), []float64{opts.ValRatio, 1 - opts.ValRatio})[0]
+		val, train = train[:n], train[n:]
+	}
+	if len(train) == 0 {
+		return fmt.Errorf("%s leaves no conversations to train on", in)
+	}
+
+	c := exportConfig{exportOptions: opts, Train: filepath.Join("data", "train.jsonl")}
+	if err := writeTrainerSplit(filepath.Join(opts.OutDir, c.Train), train); err != nil {
+		return err
+	}
+	if len(val) > 0 {
+		c.Eval = filepath.Join("data", "val.jsonl")
+		if err := writeTrainerSplit(filepath.Join(opts.OutDir, c.Eval), val); err != nil {
+			return err
+		}
+	}
+	if trainer.extra != nil {
+		if err := trainer.extra(opts.OutDir, c); err != nil {
+			return err
+		}
+	}
+	config := filepath.Join(opts.OutDir, trainer.ConfigFile)
+	if err := writeFileAtomic(config, func(w io.Writer) error {
+		return trainer.config.Execute(w, c)
+	}); err != nil {
+		return fmt.Errorf("failed to write %s: %w", config, err)
+	}
+	logger.Info("Exported dataset",
+		"trainer", opts.Trainer,
+		"dir", opts.OutDir,
+		"config", config,
+		"train", len(train),
+		"val", len(val))
+	return nil
+}
+
+// writeTrainerSplit writes recs as bare ShareGPT JSONL, without the
+// provenance fields, which trainers would load as extra columns.
+func writeTrainerSplit(path string, recs []datasetRecord) error {
+	lines := make([]any, len(recs))
+	for i, r := range recs {
+		lines[i] = struct {
+			Conversations []ShareGPTTurn `json:"conversations"`
+		}{r.conv}
+	}
+	if err := writeJSONLRecords(path, lines); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeLlamaFactoryInfo writes the dataset_info.json LLaMA-Factory finds
+// the splits by.
+func writeLlamaFactoryInfo(dir string, c exportConfig) error {
+	entry := func(path string) map[string]any {
+		return map[string]any{
+			// dataset_dir is data/, which file_name is relative to.
+			"file_name":  filepath.Base(path),
+			"formatting": "sharegpt",
+			"columns":    map[string]string{"messages": "conversations"},
+			"tags": map[string]string{
+				"role_tag":      "from",
+				"content_tag":   "value",
+				"user_tag":      "human",
+				"assistant_tag": "gpt",
+				"system_tag":    "system",
+			},
+		}
+	}
+	info := map[string]any{c.Name + "_train": entry(c.Train)}
+	if c.Eval != "" {
+		info[c.Name+"_val"] = entry(c.Eval)
+	}
+	path := filepath.Join(dir, "data", "dataset_info.json")
+	if err := writeFileAtomic(path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// axolotlConfig is a starter LoRA config for `axolotl train axolotl.yaml`,
+// mapping ShareGPT's from/value turns onto the chat template.
+const axolotlConfig = `# Starter LoRA config written by gpumon synth export; run from this directory
+# with: axolotl train axolotl.yaml
+base_model: {{printf "%q" .BaseModel}}
+chat_template: {{printf "%q" .ChatTemplate}}
+
+datasets:
+  - path: {{printf "%q" .Train}}
+    ds_type: json
+    type: chat_template
+    field_messages: conversations
+    message_property_mappings:
+      role: from
+      content: value
+    roles:
+      system: ["system"]
+      user: ["human"]
+      assistant: ["gpt"]
+{{- if .Eval}}
+test_datasets:
+  - path: {{printf "%q" .Eval}}
+    ds_type: json
+    split: train
+    type: chat_template
+    field_messages: conversations
+    message_property_mappings:
+      role: from
+      content: value
+    roles:
+      system: ["system"]
+      user: ["human"]
+      assistant: ["gpt"]
+{{- end}}
+dataset_prepared_path: last_run_prepared
+output_dir: {{printf "%q" (print "./outputs/" .Name)}}
+
+sequence_len: {{.SequenceLen}}
+sample_packing: true
+pad_to_sequence_len: true
+
+adapter: lora
+lora_r: 16
+lora_alpha: 32
+lora_dropout: 0.05
+lora_target_linear: true
+
+micro_batch_size: 2
+gradient_accumulation_steps: 4
+num_epochs: 3
+optimizer: adamw_torch_fused
+lr_scheduler: cosine
+learning_rate: 0.0002
+warmup_ratio: 0.03
+bf16: auto
+gradient_checkpointing: true
+flash_attention: true
+
+logging_steps: 10
+{{- if .Eval}}
+evals_per_epoch: 4
+{{- end}}
+saves_per_epoch: 1
+`
+
+// llamaFactoryConfig is a starter LoRA SFT config for
+// `llamafactory-cli train llama_factory.yaml`; the datasets it names are
+// in data/dataset_info.json.
+const llamaFactoryConfig = `# Starter LoRA SFT config written by gpumon synth export; run from this directory
+# with: llamafactory-cli train llama_factory.yaml
+
+### model
+model_name_or_path: {{printf "%q" .BaseModel}}
+
+### method
+stage: sft
+do_train: true
+finetuning_type: lora
+lora_rank: 16
+lora_target: all
+
+### dataset
+dataset_dir: data
+dataset: {{printf "%q" (print .Name "_train")}}
+{{- if .Eval}}
+eval_dataset: {{printf "%q" (print .Name "_val")}}
+{{- end}}
+template: {{printf "%q" .ChatTemplate}}
+cutoff_len: {{.SequenceLen}}
+overwrite_cache: true
+preprocessing_num_workers: 16
+
+### output
+output_dir: {{printf "%q" (print "saves/" .Name "/lora/sft")}}
+logging_steps: 10
+save_steps: 500
+plot_loss: true
+overwrite_output_dir: true
+
+### train
+per_device_train_batch_size: 2
+gradient_accumulation_steps: 4
+learning_rate: 1.0e-4
+num_train_epochs: 3.0
+lr_scheduler_type: cosine
+warmup_ratio: 0.1
+bf16: true
+{{- if .Eval}}
+
+### eval
+per_device_eval_batch_size: 2
+eval_strategy: steps
+eval_steps: 500
+{{- end}}
+`
@@ -0,0 +1,209 @@
+package synner
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Kinds of failureEntry.
+const (
+	// failRequest is a generation that failed outright, such as a timeout
+	// or an endpoint error.
+	failRequest = "request"
+	// failMalformed is a response still unparseable after corrections.
+	failMalformed = "malformed"
+	// failFilter is a quality filter that errored, such as a judge call.
+	failFilter = "filter"
+	// failResolved marks an earlier failure of the chunk as since
+	// processed.
+	failResolved = "resolved"
+)
+
+// failureEntry is a line of the failure ledger: a chunk whose generation
+// failed, with enough to retry it without the corpus, or a failResolved
+// mark. The last line for a chunk hash wins.
+type failureEntry struct {
+	convMeta
+	Kind        string `json:"kind"`
+	Error       string `json:"error,omitempty"`
+	Corrections int    `json:"corrections,omitempty"`
+	// Text is the chunk's full text, before any --max-chunk-tokens cut.
+	Text     string    `json:"text,omitempty"`
+	FailedAt time.Time `json:"failed_at,omitzero"`
+}
+
+// failuresPath is the failure ledger of outFile, shared by every run
+// writing it.
+func failuresPath(outFile string) string {
+	return outFile + ".failures.jsonl"
+}
+
+// failureLedger appends failed chunks to a JSONL file next to the output,
+// so they can be retried with backfill instead of being lost, and marks
+// them resolved once a later run processes them. Appends are made under
+// lockDataset so concurrent runs can share it.
+type failureLedger struct {
+	path string
+	// pending is every chunk whose last entry is a failure, by hash, and
+	// order their hashes in the order they first failed.
+	pending map[string]failureEntry
+	order   []string
+}
+
+func openFailureLedger(path string) (*failureLedger, error) {
+	l := &failureLedger{path: path, pending: map[string]failureEntry{}}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open failure ledger: %w", err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var e failureEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			// A crash mid-append leaves a torn line, which the next
+			// append starts after; that failure is lost but not the
+			// ones recorded since.
+			continue
+		}
+		if e.Kind == failResolved {
+			delete(l.pending, e.ChunkHash)
+			continue
+		}
+		if _, ok := l.pending[e.ChunkHash]; !ok {
+			l.order = append(l.order, e.ChunkHash)
+		}
+		l.pending[e.ChunkHash] = e
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read failure ledger: %w", err)
+	}
+	return l, nil
+}
+
+// Pending returns the chunks still failed, oldest first.
+func (l *failureLedger) Pending() []failureEntry {
+	var es []failureEntry
+	seen := map[string]bool{}
+	for _, h := range l.order {
+		// A chunk resolved and failed again is in order twice.
+		if e, ok := l.pending[h]; ok && !seen[h] {
+			seen[h] = true
+			es = append(es, e)
+		}
+	}
+	return es
+}
+
+// Record appends a failure.
+func (l *failureLedger) Record(e failureEntry) error {
+	if _, ok := l.pending[e.ChunkHash]; !ok {
+		l.order = append(l.order, e.ChunkHash)
+	}
+	l.pending[e.ChunkHash] = e
+	return l.append(e)
+}
+
+// Resolve marks the chunk with this hash processed, if it had failed.
+func (l *failureLedger) Resolve(hash string) error {
+	if _, ok := l.pending[hash]; !ok {
+		return nil
+	}
+	delete(l.pending, hash)
+	return l.append(failureEntry{
+		convMeta: convMeta{ChunkHash: hash},
+		Kind:     failResolved,
+	})
+}
+
+func (l *failureLedger) append(e failureEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockDataset(l.path)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", l.path, err)
+	}
+	defer unlock()
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open failure ledger: %w", err)
+	}
+	if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, fi.Size()-1); err == nil && last[0] != '\n' {
+			b = append([]byte{'\n'}, b...)
+		}
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write failure ledger: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// failureSource hands out a ledger's pending chunks in place of the
+// corpus, for backfill.
+type failureSource struct {
+	pending []failureEntry
+}
+
+func (s *failureSource) Next() (sampledChunk, error) {
+	if len(s.pending) == 0 {
+		return sampledChunk{}, io.EOF
+	}
+	e := s.pending[0]
+	s.pending = s.pending[1:]
+	row := int64(-1)
+	if e.Row != nil {
+		row = *e.Row
+	}
+	return sampledChunk{
+		Text:     e.Text,
+		Row:      corpusRow{Text: e.Text, Source: e.Source, Row: row},
+		Index:    e.Chunk,
+		Total:    e.Chunks,
+		Persona:  e.Persona,
+		Chunking: e.Chunking,
+	}, nil
+}
+
+// failure is the ledger entry for j failing with err.
+func (j genJobResult) failure(kind string, err error, model, promptHash string) failureEntry {
+	e := failureEntry{
+		convMeta: convMeta{
+			Source:      j.source,
+			Chunk:       j.chunkIndex,
+			Chunks:      j.chunksInBook,
+			ChunkHash:   j.hash,
+			ChunkTokens: j.chunkTokens,
+			Model:       model,
+			PromptHash:  promptHash,
+			Persona:     j.persona,
+			Chunking:    j.chunking,
+		},
+		Kind:        kind,
+		Error:       err.Error(),
+		Corrections: j.res.Corrections,
+		Text:        j.chunk,
+		FailedAt:    time.Now().UTC(),
+	}
+	if j.row >= 0 {
+		e.Row = &j.row
+	}
+	return e
+}
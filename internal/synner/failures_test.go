@@ -0,0 +1,134 @@
+package synner
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pendingHashes lists the chunk hashes a ledger still has failed.
+func pendingHashes(l *failureLedger) string {
+	var hs []string
+	for _, e := range l.Pending() {
+		hs = append(hs, e.ChunkHash)
+	}
+	return strings.Join(hs, " ")
+}
+
+func failed(hash, kind string) failureEntry {
+	return failureEntry{convMeta: convMeta{ChunkHash: hash, Source: "book"}, Kind: kind, Text: "chunk " + hash}
+}
+
+func TestFailureLedger(t *testing.T) {
+	path := failuresPath(filepath.Join(t.TempDir(), "data.jsonl"))
+	l, err := openFailureLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Resolve("h0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("resolving a chunk that never failed wrote the ledger: %v", err)
+	}
+	for _, e := range []failureEntry{failed("h1", failRequest), failed("h2", failMalformed), failed("h3", failFilter)} {
+		if err := l.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Resolve("h2"); err != nil {
+		t.Fatal(err)
+	}
+	// h1 failing again keeps its place, with its latest failure.
+	again := failed("h1", failMalformed)
+	again.Error = "still broken"
+	if err := l.Record(again); err != nil {
+		t.Fatal(err)
+	}
+	if got := pendingHashes(l); got != "h1 h3" {
+		t.Errorf("pending = %s, want h1 h3", got)
+	}
+
+	reopened, err := openFailureLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pendingHashes(reopened); got != "h1 h3" {
+		t.Errorf("pending after reopening = %s, want h1 h3", got)
+	}
+	if e := reopened.Pending()[0]; e.Kind != failMalformed || e.Error != "still broken" || e.Text != "chunk h1" {
+		t.Errorf("h1 after reopening = %+v, want its last failure", e)
+	}
+
+	// A chunk resolved and failed again is pending once, in the order it
+	// first failed.
+	if err := reopened.Resolve("h1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Record(failed("h1", failRequest)); err != nil {
+		t.Fatal(err)
+	}
+	if l, err = openFailureLedger(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := pendingHashes(l); got != "h1 h3" {
+		t.Errorf("pending after h1 failed again = %s, want h1 h3", got)
+	}
+}
+
+func TestFailureLedgerTornLine(t *testing.T) {
+	path := failuresPath(filepath.Join(t.TempDir(), "data.jsonl"))
+	l, err := openFailureLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Record(failed("h1", failRequest)); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"chunk_hash":"h2","kind":"requ`)
+	f.Close()
+
+	if l, err = openFailureLedger(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Record(failed("h3", failRequest)); err != nil {
+		t.Fatal(err)
+	}
+	if l, err = openFailureLedger(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := pendingHashes(l); got != "h1 h3" {
+		t.Errorf("pending = %s, want h1 h3 around the torn line", got)
+	}
+}
+
+func TestFailureSource(t *testing.T) {
+	row := int64(7)
+	src := &failureSource{pending: []failureEntry{
+		{convMeta: convMeta{ChunkHash: "h1", Source: "a", Row: &row, Chunk: 2, Chunks: 5}, Text: "first"},
+		{convMeta: convMeta{ChunkHash: "h2", Source: "b"}, Text: "second"},
+	}}
+	c, err := src.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Text != "first" || c.Row.Source != "a" || c.Row.Row != 7 || c.Index != 2 || c.Total != 5 {
+		t.Errorf("first chunk = %+v", c)
+	}
+	if c, err = src.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Text != "second" || c.Row.Row != -1 {
+		t.Errorf("chunk without a row = %+v, want row -1", c)
+	}
+	if _, err := src.Next(); err != io.EOF {
+		t.Errorf("Next after the last chunk: err = %v, want io.EOF", err)
+	}
+}
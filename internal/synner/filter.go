@@ -0,0 +1,174 @@
+package synner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// filterOptions configure the checks every generated conversation must pass
+// before it is written. Zero bounds are unlimited.
+type filterOptions struct {
+	MinTurns     int
+	MaxTurns     int
+	MinTurnChars int
+	MaxTurnChars int
+	// Alternate requires human and gpt turns to alternate, human first.
+	Alternate bool
+	// Refusals are phrases, matched case-insensitively in gpt turns, that
+	// mark a model refusing or breaking character.
+	Refusals []string
+	// JudgeModel, if set, scores each conversation from 1 to 10; those
+	// below JudgeThreshold are rejected.
+	JudgeModel     string
+	JudgeThreshold float64
+}
+
+var defaultRefusals = []string{
+	"as an ai",
+	"i cannot fulfill",
+	"i can't fulfill",
+	"i cannot assist",
+	"i can't assist",
+	"i'm sorry, but i can",
+	"i am unable to",
+	"language model",
+}
+
+// convFilter is one stage of the quality filter chain. Check returns why
+// conv is rejected, or "" to keep it; an error means the check itself
+// failed and the chunk should be tried again later.
+type convFilter interface {
+	Name() string
+	Check(ctx context.Context, conv []ShareGPTTurn) (string, error)
+}
+
+// filterChain runs its filters in order and stops at the first rejection.
+type filterChain []convFilter
+
+func newFilterChain(opts filterOptions, shape shapeOptions, pool *endpointPool, seed int64) (filterChain, error) {
+	if opts.MaxTurns > 0 && opts.MaxTurns < opts.MinTurns {
+		return nil, fmt.Errorf("--max-turns %d is below --min-turns %d", opts.MaxTurns, opts.MinTurns)
+	}
+	if opts.MaxTurnChars > 0 && opts.MaxTurnChars < opts.MinTurnChars {
+		return nil, fmt.Errorf("--max-turn-chars %d is below --min-turn-chars %d", opts.MaxTurnChars, opts.MinTurnChars)
+	}
+	fc := filterChain{
+		turnCountFilter{opts.MinTurns, opts.MaxTurns},
+		turnLengthFilter{opts.MinTurnChars, opts.MaxTurnChars},
+	}
+	if opts.Alternate {
+		fc = append(fc, alternationFilter{})
+	}
+	if shape.Enforce {
+		fc = append(fc, shapeFilter(shape))
+	}
+	if len(opts.Refusals) > 0 {
+		fc = append(fc, refusalFilter(opts.Refusals))
+	}
+	if opts.JudgeModel != "" {
+		fc = append(fc, &judgeFilter{scorer: newLLMScorer(pool, opts.JudgeModel, nil, seed), threshold: opts.JudgeThreshold})
+	}
+	return fc, nil
+}
+
+// Check returns the name of the first filter that rejects conv and why.
+func (fc filterChain) Check(ctx context.Context, conv []ShareGPTTurn) (string, string, error) {
+	for _, f := range fc {
+		why, err := f.Check(ctx, conv)
+		if err != nil {
+			return f.Name(), "", fmt.Errorf("%s filter: %w", f.Name(), err)
+		}
+		if why != "" {
+			return f.Name(), why, nil
+		}
+	}
+	return "", "", nil
+}
+
+type turnCountFilter struct{ min, max int }
+
+func (turnCountFilter) Name() string { return "turns" }
+
+func (f turnCountFilter) Check(_ context.Context, conv []ShareGPTTurn) (string, error) {
+	switch {
+	case len(conv) < f.min:
+		return fmt.Sprintf("%d turns, want at least %d", len(conv), f.min), nil
+	case f.max > 0 && len(conv) > f.max:
+		return fmt.Sprintf("%d turns, want at most %d", len(conv), f.max), nil
+	}
+	return "", nil
+}
+
+type turnLengthFilter struct{ min, max int }
+
+func (turnLengthFilter) Name() string { return "length" }
+
+func (f turnLengthFilter) Check(_ context.Context, conv []ShareGPTTurn) (string, error) {
+	for i, t := range conv {
+		n := len([]rune(strings.TrimSpace(t.Value)))
+		switch {
+		case n < f.min:
+			return fmt.Sprintf("turn %d has %d chars, want at least %d", i+1, n, f.min), nil
+		case f.max > 0 && n > f.max:
+			return fmt.Sprintf("turn %d has %d chars, want at most %d", i+1, n, f.max), nil
+		}
+	}
+	return "", nil
+}
+
+type alternationFilter struct{}
+
+func (alternationFilter) Name() string { return "alternation" }
+
+func (alternationFilter) Check(_ context.Context, conv []ShareGPTTurn) (string, error) {
+	for i, t := range conv {
+		want := "human"
+		if i%2 == 1 {
+			want = "gpt"
+		}
+		if t.From != want {
+			return fmt.Sprintf("turn %d is from %q, want %q", i+1, t.From, want), nil
+		}
+	}
+	return "", nil
+}
+
+type refusalFilter []string
+
+func (refusalFilter) Name() string { return "refusal" }
+
+func (f refusalFilter) Check(_ context.Context, conv []ShareGPTTurn) (string, error) {
+	for i, t := range conv {
+		if t.From != "gpt" {
+			continue
+		}
+		v := strings.ToLower(t.Value)
+		for _, p := range f {
+			if strings.Contains(v, strings.ToLower(p)) {
+				return fmt.Sprintf("turn %d contains %q", i+1, p), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// judgeFilter asks a model to rate the conversation and rejects it below
+// threshold.
+type judgeFilter struct {
+	scorer    *llmScorer
+	threshold float64
+}
+
+func (*judgeFilter) Name() string { return "judge" }
+
+func (f *judgeFilter) Check(ctx context.Context, conv []ShareGPTTurn) (string, error) {
+	score, err := f.scorer.Score(ctx, conv)
+	if err != nil {
+		return "", err
+	}
+	if score < f.threshold {
+		return fmt.Sprintf("judge scored %g, want at least %g", score, f.threshold), nil
+	}
+	return "", nil
+}
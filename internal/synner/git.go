@@ -0,0 +1,205 @@
+package synner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func newPushCmd(logger *slog.Logger) *cobra.Command {
+	var remote string
+	cmd := &cobra.Command{
+		Use:   "push",
+		Short: "Push the current dataset branch and set its upstream",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runGitCommand(logger, "push", "--set-upstream", remote, "HEAD")
+		},
+	}
+	cmd.Flags().StringVar(&remote, "remote",
+		"origin", "Remote to push to")
+	return cmd
+}
+
+// prOptions are the pr command's settings.
+type prOptions struct {
+	Title  string
+	Body   string
+	Base   string
+	Remote string
+	Draft  bool
+}
+
+func newPRCmd(logger *slog.Logger) *cobra.Command {
+	var opts prOptions
+	cmd := &cobra.Command{
+		Use:   "pr",
+		Short: "Open a GitHub pull request for the current dataset branch",
+		Long: `Open a GitHub pull request for the current dataset branch, which must already
+be pushed (see push). Uses the gh CLI if it is installed, and otherwise the
+GitHub API with GITHUB_TOKEN or GH_TOKEN.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPR(logger, opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.Title, "title",
+		"", "Pull request title (required)")
+	cmd.Flags().StringVar(&opts.Body, "body",
+		"", "Pull request description")
+	cmd.Flags().StringVar(&opts.Base, "base",
+		"", "Branch to merge into (default: the remote's default branch)")
+	cmd.Flags().StringVar(&opts.Remote, "remote",
+		"origin", "Remote the branch was pushed to")
+	cmd.Flags().BoolVar(&opts.Draft, "draft",
+		false, "Open the pull request as a draft")
+	cmd.MarkFlagRequired("title")
+	return cmd
+}
+
+func runPR(logger *slog.Logger, opts prOptions) error {
+	head, err := gitOutput("rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return fmt.Errorf("failed to find the current branch: %w", err)
+	}
+	if head == "HEAD" {
+		return errors.New("not on a branch; create one with gpumon synth branch")
+	}
+	if opts.Base == "" {
+		opts.Base = defaultBranch(opts.Remote)
+	}
+	if opts.Base == head {
+		return fmt.Errorf("on %s, the base branch; create a dataset branch with gpumon synth branch", head)
+	}
+
+	if gh, err := exec.LookPath("gh"); err == nil {
+		args := []string{"pr", "create", "--title", opts.Title, "--body", opts.Body,
+			"--base", opts.Base, "--head", head}
+		if opts.Draft {
+			args = append(args, "--draft")
+		}
+		cmd := exec.Command(gh, args...)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			logger.Error("gh error", "stderr", stderr.String())
+			return err
+		}
+		logger.Info("Opened pull request", "url", strings.TrimSpace(stdout.String()))
+		return nil
+	}
+
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		token = os.Getenv("GH_TOKEN")
+	}
+	if token == "" {
+		return errors.New("gh is not installed and neither GITHUB_TOKEN nor GH_TOKEN is set")
+	}
+	remoteURL, err := gitOutput("remote", "get-url", opts.Remote)
+	if err != nil {
+		return fmt.Errorf("failed to read remote %s: %w", opts.Remote, err)
+	}
+	repo, err := githubRepo(remoteURL)
+	if err != nil {
+		return err
+	}
+	url, err := createPullRequest(token, repo, head, opts)
+	if err != nil {
+		return err
+	}
+	logger.Info("Opened pull request", "url", url)
+	return nil
+}
+
+// githubAPI is the API root, overridable for GitHub Enterprise.
+func githubAPI() string {
+	if u := os.Getenv("GITHUB_API_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return "https://api.github.com"
+}
+
+func createPullRequest(token, repo, head string, opts prOptions) (string, error) {
+	body, err := json.Marshal(map[string]any{
+		"title": opts.Title,
+		"body":  opts.Body,
+		"head":  head,
+		"base":  opts.Base,
+		"draft": opts.Draft,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("POST", githubAPI()+"/repos/"+repo+"/pulls", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to create pull request: %w", err)
+	}
+	defer resp.Body.Close()
+	var out struct {
+		HTMLURL string `json:"html_url"`
+		Message string `json:"message"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	json.NewDecoder(resp.Body).Decode(&out)
+	if resp.StatusCode != http.StatusCreated {
+		msg := out.Message
+		for _, e := range out.Errors {
+			msg += "; " + e.Message
+		}
+		return "", fmt.Errorf("failed to create pull request: %s: %s", resp.Status, msg)
+	}
+	return out.HTMLURL, nil
+}
+
+var githubRemote = regexp.MustCompile(`github\.com[:/]([^/]+/[^/]+?)(?:\.git)?/?$`)
+
+// githubRepo returns "owner/name" from an SSH or HTTPS GitHub remote URL.
+func githubRepo(remoteURL string) (string, error) {
+	m := githubRemote.FindStringSubmatch(remoteURL)
+	if m == nil {
+		return "", fmt.Errorf("%s is not a GitHub remote", remoteURL)
+	}
+	return m[1], nil
+}
+
+// defaultBranch is the branch remote's HEAD points at, or main if unknown.
+func defaultBranch(remote string) string {
+	ref, err := gitOutput("symbolic-ref", "--short", "refs/remotes/"+remote+"/HEAD")
+	if err != nil {
+		return "main"
+	}
+	return strings.TrimPrefix(ref, remote+"/")
+}
+
+// gitOutput runs git and returns its trimmed standard output.
+func gitOutput(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,244 @@
+package synner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	hfScheme         = "hf://"
+	hfDatasetsServer = "https://datasets-server.huggingface.co"
+	// hfPageSize is the most rows the datasets server returns per request.
+	hfPageSize = 100
+)
+
+// sourceOptions select what to read from sources with several splits or
+// columns. Column also applies to Parquet files; the rest only to Hugging
+// Face datasets.
+type sourceOptions struct {
+	Split    string
+	Config   string
+	Column   string
+	CacheDir string
+}
+
+// hfSource streams rows of a Hugging Face dataset from the datasets server
+// a page at a time, caching each page on disk so reruns don't download
+// them again. HF_TOKEN, if set, authenticates for gated datasets, and
+// HF_DATASETS_SERVER replaces the server's address.
+type hfSource struct {
+	dataset string
+	opts    sourceOptions
+	http    *http.Client
+	base    string
+	page    []hfRow
+	offset  int
+	total   int
+	cur     int
+}
+
+type hfRow struct {
+	RowIdx int                        `json:"row_idx"`
+	Row    map[string]json.RawMessage `json:"row"`
+}
+
+type hfRowsPage struct {
+	Rows     []hfRow `json:"rows"`
+	NumTotal int     `json:"num_rows_total"`
+}
+
+func openHFSource(uri string, opts sourceOptions) (*hfSource, error) {
+	dataset := strings.Trim(strings.TrimPrefix(uri, hfScheme), "/")
+	if dataset == "" {
+		return nil, fmt.Errorf("no dataset in %q (want hf://owner/name)", uri)
+	}
+	if opts.Split == "" {
+		opts.Split = "train"
+	}
+	if opts.Column == "" {
+		opts.Column = "text"
+	}
+	if opts.CacheDir == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		opts.CacheDir = filepath.Join(dir, "synner", "hf")
+	}
+	base := hfDatasetsServer
+	if env := os.Getenv("HF_DATASETS_SERVER"); env != "" {
+		// For mirrors.
+		base = strings.TrimSuffix(env, "/")
+	}
+	s := &hfSource{
+		dataset: dataset,
+		opts:    opts,
+		http:    &http.Client{Timeout: time.Minute},
+		base:    base,
+		total:   -1,
+	}
+	if s.opts.Config == "" {
+		cfg, err := s.defaultConfig()
+		if err != nil {
+			return nil, err
+		}
+		s.opts.Config = cfg
+	}
+	return s, nil
+}
+
+// defaultConfig picks the first config that has the requested split.
+func (s *hfSource) defaultConfig() (string, error) {
+	var got struct {
+		Splits []struct {
+			Config string `json:"config"`
+			Split  string `json:"split"`
+		} `json:"splits"`
+	}
+	if err := s.get("/splits?dataset="+url.QueryEscape(s.dataset), &got); err != nil {
+		return "", err
+	}
+	var splits []string
+	for _, sp := range got.Splits {
+		if sp.Split == s.opts.Split {
+			return sp.Config, nil
+		}
+		splits = append(splits, sp.Config+"/"+sp.Split)
+	}
+	return "", fmt.Errorf("dataset %s has no split %q (have %s)", s.dataset, s.opts.Split, strings.Join(splits, ", "))
+}
+
+func (s *hfSource) NextRow() (string, error) {
+	if s.cur >= len(s.page) {
+		if s.total >= 0 && s.offset >= s.total {
+			return "", io.EOF
+		}
+		if err := s.fetch(); err != nil {
+			return "", fmt.Errorf("%w: %w", errSourceFailed, err)
+		}
+		if len(s.page) == 0 {
+			return "", io.EOF
+		}
+	}
+	row := s.page[s.cur]
+	s.cur++
+	raw, ok := row.Row[s.opts.Column]
+	if !ok {
+		return "", fmt.Errorf("row %d has no column %q", row.RowIdx, s.opts.Column)
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return "", fmt.Errorf("row %d column %q is not a string", row.RowIdx, s.opts.Column)
+	}
+	if text == "" {
+		return "", fmt.Errorf("empty text field in row %d", row.RowIdx)
+	}
+	return text, nil
+}
+
+// fetch loads the next page, from the cache when it has it.
+func (s *hfSource) fetch() error {
+	cachePath := filepath.Join(s.opts.CacheDir, filepath.FromSlash(s.dataset), s.opts.Config, s.opts.Split,
+		fmt.Sprintf("%09d.json", s.offset))
+	var page hfRowsPage
+	if b, err := os.ReadFile(cachePath); err == nil && json.Unmarshal(b, &page) == nil {
+		s.setPage(page)
+		return nil
+	}
+	q := url.Values{
+		"dataset": {s.dataset},
+		"config":  {s.opts.Config},
+		"split":   {s.opts.Split},
+		"offset":  {fmt.Sprint(s.offset)},
+		"length":  {fmt.Sprint(hfPageSize)},
+	}
+	if err := s.get("/rows?"+q.Encode(), &page); err != nil {
+		return err
+	}
+	if b, err := json.Marshal(page); err == nil {
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0o755); err == nil {
+			_ = os.WriteFile(cachePath, b, 0o644)
+		}
+	}
+	s.setPage(page)
+	return nil
+}
+
+func (s *hfSource) setPage(page hfRowsPage) {
+	s.page, s.cur = page.Rows, 0
+	s.offset += len(page.Rows)
+	s.total = page.NumTotal
+}
+
+func (s *hfSource) get(path string, v any) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, s.base+path, nil)
+	if err != nil {
+		return err
+	}
+	if token := os.Getenv("HF_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := s.http.Do(req)
+		if err != nil {
+			return fmt.Errorf("datasets server: %w", err)
+		}
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("datasets server: %w", err)
+		}
+		// The server rate-limits and answers 5xx while it converts a dataset.
+		if (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500) && attempt < 3 {
+			time.Sleep(time.Duration(attempt+1) * 2 * time.Second)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			var e struct {
+				Error string `json:"error"`
+			}
+			if json.Unmarshal(b, &e) != nil || e.Error == "" {
+				e.Error = strings.TrimSpace(string(b))
+			}
+			return fmt.Errorf("datasets server: %s: %s", resp.Status, e.Error)
+		}
+		if err := json.Unmarshal(b, v); err != nil {
+			return fmt.Errorf("datasets server: %w", err)
+		}
+		return nil
+	}
+}
+
+func (s *hfSource) Provenance() string {
+	if s.cur == 0 || s.cur > len(s.page) {
+		return ""
+	}
+	return fmt.Sprintf("%s%s/%s/%s#%d", hfScheme, s.dataset, s.opts.Config, s.opts.Split, s.page[s.cur-1].RowIdx)
+}
+
+func (s *hfSource) Row() int64 {
+	if s.cur == 0 || s.cur > len(s.page) {
+		return -1
+	}
+	return int64(s.page[s.cur-1].RowIdx)
+}
+
+// NumRows fetches the first page, if need be, for the dataset's size.
+func (s *hfSource) NumRows() int64 {
+	if s.total < 0 && s.fetch() != nil {
+		return -1
+	}
+	return int64(s.total)
+}
+
+func (s *hfSource) Close() error {
+	return nil
+}
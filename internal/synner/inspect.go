@@ -0,0 +1,195 @@
+package synner
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// inspectOptions are the inspect command's settings.
+type inspectOptions struct {
+	N       int
+	Indexes []int
+	Seed    int64
+	Width   int
+	Color   string
+}
+
+func newInspectCmd(logger *slog.Logger) *cobra.Command {
+	var opts inspectOptions
+	cmd := &cobra.Command{
+		Use:   "inspect [in]",
+		Short: "Pretty-print random or chosen conversations from a dataset for spot checks",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !config.IsSet(cmd.Flags(), "seed") {
+				opts.Seed = time.Now().UnixNano()
+			}
+			return runInspect(os.Stdout, args[0], opts)
+		},
+	}
+	cmd.Flags().IntVar(&opts.N, "n",
+		5, "Number of random conversations to show")
+	cmd.Flags().IntSliceVar(&opts.Indexes, "index",
+		nil, "Zero-based indexes of conversations to show instead of random ones")
+	cmd.Flags().Int64Var(&opts.Seed, "seed",
+		0, "Seed for picking conversations (default: random)")
+	cmd.Flags().IntVar(&opts.Width, "width",
+		0, "Wrap text at this many columns (default: $COLUMNS, or 100)")
+	cmd.Flags().StringVar(&opts.Color, "color",
+		"auto", "Color roles: auto (when writing to a terminal), always or never")
+	_ = cmd.RegisterFlagCompletionFunc("color", cobra.FixedCompletions([]string{"auto", "always", "never"}, cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+// ANSI styles for roles.
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiDim   = "\x1b[2m"
+)
+
+var roleColors = map[string]string{
+	"human":  "\x1b[1;36m",
+	"gpt":    "\x1b[1;35m",
+	"system": "\x1b[1;33m",
+}
+
+func runInspect(out io.Writer, in string, opts inspectOptions) error {
+	color, err := useColor(opts.Color, out)
+	if err != nil {
+		return err
+	}
+	width := terminalWidth(opts.Width)
+
+	recs, err := loadRecords(in)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", in, err)
+	}
+	if len(recs) == 0 {
+		return fmt.Errorf("%s has no conversations", in)
+	}
+	picks := opts.Indexes
+	if len(picks) == 0 {
+		rng := rand.New(rand.NewSource(opts.Seed))
+		picks = rng.Perm(len(recs))[:min(opts.N, len(recs))]
+	}
+	for _, i := range picks {
+		if i < 0 || i >= len(recs) {
+			return fmt.Errorf("index %d out of range; %s has %d conversations", i, in, len(recs))
+		}
+	}
+
+	for n, i := range picks {
+		if n > 0 {
+			fmt.Fprintln(out)
+		}
+		printConversation(out, recs[i], i, len(recs), width, color)
+	}
+	if len(opts.Indexes) == 0 {
+		fmt.Fprintln(out, ansiStyle(color, ansiDim, fmt.Sprintf("\n%d of %d conversations, --seed %d", len(picks), len(recs), opts.Seed)))
+	}
+	return nil
+}
+
+// terminalWidth is width if set, else $COLUMNS, else 100.
+func terminalWidth(width int) int {
+	if width > 0 {
+		return width
+	}
+	if w, _ := strconv.Atoi(os.Getenv("COLUMNS")); w > 0 {
+		return w
+	}
+	return 100
+}
+
+func ansiStyle(color bool, code, s string) string {
+	if !color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// printConversation prints rec, the i'th of total, with a header rule,
+// colored roles and text wrapped to width.
+func printConversation(out io.Writer, rec datasetRecord, i, total, width int, color bool) {
+	header := fmt.Sprintf("── #%d of %d", i, total)
+	if rec.source != "" {
+		header += " · " + rec.source
+	}
+	header += fmt.Sprintf(" · %d turns ", len(rec.conv))
+	if pad := width - len([]rune(header)); pad > 0 {
+		header += strings.Repeat("─", pad)
+	}
+	fmt.Fprintln(out, ansiStyle(color, ansiBold, header))
+	for _, t := range rec.conv {
+		code, ok := roleColors[t.From]
+		if !ok {
+			code = ansiBold
+		}
+		fmt.Fprintln(out, ansiStyle(color, code, t.From+":"))
+		for _, line := range wrap(t.Value, width-2) {
+			if line == "" {
+				fmt.Fprintln(out)
+				continue
+			}
+			fmt.Fprintln(out, "  "+line)
+		}
+	}
+}
+
+// useColor resolves --color for out.
+func useColor(mode string, out io.Writer) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		f, ok := out.(*os.File)
+		if !ok {
+			return false, nil
+		}
+		fi, err := f.Stat()
+		return err == nil && fi.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf("unknown --color %q (want auto, always or never)", mode)
+}
+
+// wrap breaks text into lines of at most width runes at spaces, keeping
+// its own line breaks. Words longer than width get a line to themselves.
+func wrap(text string, width int) []string {
+	width = max(width, 20)
+	var lines []string
+	for _, para := range strings.Split(strings.TrimSpace(text), "\n") {
+		words := strings.Fields(para)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		line, n := words[0], len([]rune(words[0]))
+		for _, w := range words[1:] {
+			wn := len([]rune(w))
+			if n+1+wn > width {
+				lines = append(lines, line)
+				line, n = w, wn
+				continue
+			}
+			line += " " + w
+			n += 1 + wn
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,38 @@
+package synner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// errLocked is returned by lockFile when another process holds the lock
+// and it was asked not to wait.
+var errLocked = errors.New("locked by another process")
+
+// lockPath is the lock file guarding writes to a dataset. Datasets are
+// replaced by rename, so the lock can't live on the dataset itself.
+func lockPath(path string) string {
+	return path + ".lock"
+}
+
+// lockDataset waits for exclusive use of the dataset at path among synner
+// processes, including ones on other machines sharing the filesystem, and
+// returns a func that gives it up.
+func lockDataset(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(lockPath(path), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f, true); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
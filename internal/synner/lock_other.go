@@ -0,0 +1,17 @@
+//go:build !unix && !windows
+
+package synner
+
+import (
+	"errors"
+	"os"
+	"runtime"
+)
+
+// Without file locks concurrent runs would interleave and repair each
+// other's appends, so shared datasets are refused rather than risked.
+var errNoLocking = errors.New("dataset locking is not supported on " + runtime.GOOS)
+
+func lockFile(f *os.File, wait bool) error { return errNoLocking }
+
+func unlockFile(f *os.File) error { return nil }
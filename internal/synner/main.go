@@ -0,0 +1,1289 @@
+package synner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nathanleclaire/gpumon/internal/config"
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"github.com/nathanleclaire/gpumon/internal/plugins"
+	"github.com/nathanleclaire/gpumon/pkg/collector"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type ShareGPTTurn struct {
+	From  string `json:"from"`
+	Value string `json:"value"`
+}
+
+type ShareGPTData struct {
+	Conversations [][]ShareGPTTurn `json:"conversations"`
+}
+
+type DataSource interface {
+	NextRow() (string, error)
+	Close() error
+}
+
+// parquetSource reads one text column of a Parquet file, a batch of rows
+// at a time.
+type parquetSource struct {
+	path   string
+	column string
+	pr     *reader.ParquetReader
+	f      source.ParquetFile
+	batch  []interface{}
+	cur    int64
+	max    int64
+}
+
+// parquetBatch is how many values are read from the column at once.
+const parquetBatch = 64
+
+func (p *parquetSource) NextRow() (string, error) {
+	if p.cur >= p.max {
+		return "", io.EOF
+	}
+	if len(p.batch) == 0 {
+		vals, _, _, err := p.pr.ReadColumnByPath(p.column, parquetBatch)
+		if err != nil {
+			return "", fmt.Errorf("%w: failed to read rows: %w", errSourceFailed, err)
+		}
+		if len(vals) == 0 {
+			return "", io.EOF
+		}
+		p.batch = vals
+	}
+	v := p.batch[0]
+	p.batch = p.batch[1:]
+	p.cur++
+	text, _ := v.(string)
+	if text == "" {
+		return "", fmt.Errorf("empty text field in row %d", p.cur-1)
+	}
+	return text, nil
+}
+
+func (p *parquetSource) Provenance() string {
+	return fmt.Sprintf("%s#%d", p.path, p.cur-1)
+}
+
+func (p *parquetSource) Row() int64 {
+	return p.cur - 1
+}
+
+func (p *parquetSource) NumRows() int64 {
+	return p.max
+}
+
+func (p *parquetSource) Close() error {
+	p.pr.ReadStop()
+	return p.f.Close()
+}
+
+// ServiceName is the default service.name for the synth commands.
+const ServiceName = "synner"
+
+// NewCommand returns the synth command tree, logging to logger. Each
+// response's progress is logged at debug level.
+func NewCommand(logger *slog.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "synth",
+		Short: "Generate, curate and publish synthetic ShareGPT datasets with local models",
+	}
+	cmd.AddCommand(
+		newGenerateCmd(logger),
+		newConvertCmd(logger),
+		newSplitCmd(logger),
+		newDedupeCmd(logger),
+		newInspectCmd(logger),
+		newMergeCmd(logger),
+		newServeCmd(logger),
+		newStatsCmd(logger),
+		newValidateCmd(logger),
+		newCurateCmd(logger),
+		newScoreCmd(logger),
+		newAugmentCmd(logger),
+		newExportCmd(logger),
+		newBackfillCmd(logger),
+		newBranchCmd(logger),
+		newCommitCmd(logger),
+		newPushCmd(logger),
+		newPRCmd(logger),
+	)
+	return cmd
+}
+
+// genOptions are the generate command's settings.
+type genOptions struct {
+	InFile      string
+	OutFile     string
+	OutFormat   string
+	Model       string
+	OllamaAddrs []string
+	// Parallel is how many generations each endpoint runs at once.
+	Parallel    int
+	MaxExamples int
+	// MaxOutputTokens, if positive, stops the run once the conversations
+	// written hold about this many tokens.
+	MaxOutputTokens int
+	Resume          bool
+	Source          sourceOptions
+	// Registry is the --registry URL of the cross-run chunk registry.
+	Registry string
+	// Worker names this run among several writing to OutFile at once, to
+	// give it a checkpoint of its own.
+	Worker string
+	// Report is where to write the end-of-run report as JSON, and Price
+	// what the backend charges, to estimate the run's cost.
+	Report string
+	Price  pricing
+	// GPUInterval, when positive, samples the local GPUs through the run
+	// for the report, with the collector chosen by --collector (nvidia-smi
+	// or a collector plugin).
+	GPUInterval time.Duration
+	// Tokenizer counts tokens for MaxOutputTokens, MaxChunkTokens and the
+	// counts recorded with each conversation; see newTokenizer.
+	Tokenizer      string
+	MaxChunkTokens int
+	// ShuffleBuffer is how many books are held in memory to shuffle the
+	// corpus order.
+	ShuffleBuffer int
+	// Dedup is drop, flag or off; DedupThreshold is the gpt-turn
+	// similarity at which a conversation counts as a near duplicate.
+	Dedup          string
+	DedupThreshold float64
+	Filter         filterOptions
+	Shape          shapeOptions
+	Sample         sampleOptions
+	Parse          parseOptions
+	// Chunk is how books are cut into chunks, recorded with each
+	// conversation.
+	Chunk chunkOptions
+	// Seed drives the corpus shuffle, sampling and the models' sampling.
+	Seed        int64
+	Temperature float64
+	// Quiet and NoAnimate control how responses are shown as they stream
+	// in; see displayEcho.
+	Quiet     bool
+	NoAnimate bool
+	// DryRun scans the corpus and estimates the run instead of generating;
+	// DryRunSample is how many generations it times for the estimate.
+	DryRun       bool
+	DryRunSample int
+	// Domain is the --domain pack; DomainName and Prompt come from it, or
+	// default to romance and romancePrompt.
+	Domain     string
+	DomainName string
+	Prompt     string
+	// SystemPrompt, if set, is added to every conversation written, as a
+	// leading system turn or, with SystemPromptAs "field", a system field.
+	SystemPrompt   string
+	SystemPromptAs string
+	// PersonaFile is the --persona config; Persona is it or the domain
+	// pack's, with PersonaInfer turning on inference.
+	PersonaFile  string
+	PersonaInfer bool
+	Persona      *personaConfig
+	// Backfill, if set, is a failure ledger whose pending chunks are
+	// generated instead of the corpus.
+	Backfill string
+}
+
+func newGenerateCmd(logger *slog.Logger) *cobra.Command {
+	opts := defaultGenOptions()
+	cmd := &cobra.Command{
+		Use:   "generate",
+		Short: "Generate synthetic ShareGPT-format data from a romance corpus",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.prepare(cmd.Flags()); err != nil {
+				return err
+			}
+			if opts.DryRun {
+				return runDryRun(logger, opts)
+			}
+			return runGenerate(cmd.Context(), logger, opts)
+		},
+	}
+	addGenerateFlags(cmd, &opts)
+	return cmd
+}
+
+func defaultGenOptions() genOptions {
+	return genOptions{Shape: shapeOptions{
+		Exchanges:      intRange{5, 5},
+		GPTParagraphs:  intRange{3, 5},
+		HumanSentences: intRange{1, 2},
+	}}
+}
+
+// prepare fills in what the flags leave to be worked out: the seed, and
+// the domain pack and persona config they name.
+func (o *genOptions) prepare(flags *pflag.FlagSet) error {
+	if !config.IsSet(flags, "seed") {
+		o.Seed = time.Now().UnixNano()
+	}
+	if o.Domain != "" {
+		d, err := loadDomain(o.Domain)
+		if err != nil {
+			return fmt.Errorf("failed to load domain: %w", err)
+		}
+		d.apply(o, flags)
+	}
+	if o.PersonaFile != "" {
+		p, err := loadPersonaConfig(o.PersonaFile)
+		if err != nil {
+			return fmt.Errorf("failed to load persona: %w", err)
+		}
+		o.Persona = p
+	}
+	if o.PersonaInfer {
+		if o.Persona == nil {
+			o.Persona = &personaConfig{}
+		}
+		o.Persona.Infer = true
+	}
+	return nil
+}
+
+// addGenerateFlags adds the flags of generate, which backfill shares, to
+// cmd.
+func addGenerateFlags(cmd *cobra.Command, opts *genOptions) {
+	cmd.Flags().StringVar(&opts.InFile, "input-file",
+		"romance.parquet", "Parquet file, a directory of .txt/.md/.epub files (one book per file), or hf://owner/dataset")
+	cmd.Flags().StringVar(&opts.OutFile, "out-file",
+		filepath.Join("datasets", "romance", "sharegpt_romance.json"),
+		"Output file; .jsonl paths get one conversation per line")
+	cmd.Flags().StringVar(&opts.OutFormat, "out-format",
+		"", "json (rewritten at the end of the run) or jsonl (appended as each conversation is generated); default: from --out-file's extension")
+	cmd.Flags().StringVar(&opts.Model, "model",
+		"llama2", "Local model name in Ollama")
+	cmd.Flags().StringSliceVar(&opts.OllamaAddrs, "ollama-addr",
+		[]string{"http://localhost:11434"}, "Ollama server address; repeat or comma-separate to spread generations across several")
+	cmd.Flags().IntVar(&opts.Parallel, "parallel",
+		1, "Generations to run at once on each Ollama endpoint")
+	cmd.Flags().IntVar(&opts.MaxExamples, "max-examples",
+		1000, "Max examples to generate")
+	cmd.Flags().IntVar(&opts.MaxOutputTokens, "max-output-tokens",
+		0, "Stop once the conversations written hold about this many tokens, counted with --tokenizer (0 for no limit)")
+	cmd.Flags().StringVar(&opts.Tokenizer, "tokenizer",
+		"chars", "How to count tokens: chars (estimate at 4 characters per token), a tiktoken encoding such as cl100k_base or o200k_base, or an OpenAI model name such as gpt-4o")
+	cmd.Flags().IntVar(&opts.Chunk.ParagraphsPerChunk, "paragraphs-per-chunk",
+		3, "Paragraphs of a book per chunk; each chunk repeats the last paragraph of the one before")
+	cmd.Flags().IntVar(&opts.Chunk.MinChars, "min-chunk-chars",
+		200, "Drop chunks shorter than this many characters")
+	cmd.Flags().IntVar(&opts.Chunk.MaxChars, "max-chunk-chars",
+		0, "Split chunks longer than this many characters at paragraph, sentence or word boundaries (0 for no limit)")
+	cmd.Flags().IntVar(&opts.MaxChunkTokens, "max-chunk-tokens",
+		0, "Truncate chunks longer than this many tokens before prompting (0 for no limit)")
+	cmd.Flags().StringVar(&opts.Registry, "registry",
+		"", "sqlite://path of a registry of chunks that produced accepted conversations, shared across runs; chunks in it are skipped")
+	cmd.Flags().StringVar(&opts.Worker, "worker",
+		"", "Name of this run among several writing to the same --out-file, e.g. the hostname; each needs its own checkpoint to --resume from")
+	cmd.Flags().StringVar(&opts.Report, "report",
+		"", "Also write the end-of-run cost and throughput report as JSON to this path")
+	cmd.Flags().Float64Var(&opts.Price.In, "price-in",
+		0, "Dollars per million prompt tokens, to estimate the run's cost on a paid backend")
+	cmd.Flags().Float64Var(&opts.Price.Out, "price-out",
+		0, "Dollars per million output tokens, to estimate the run's cost on a paid backend")
+	cmd.Flags().DurationVar(&opts.GPUInterval, "gpu-sample-interval",
+		0, "Sample this machine's GPU utilization, VRAM and power from --collector at this interval, for the run report (0 disables)")
+	cmd.Flags().StringVar(&opts.PersonaFile, "persona",
+		"", "YAML persona config: the main character and their voice, other recurring characters, the narrator's style and POV, per run or per book")
+	cmd.Flags().BoolVar(&opts.PersonaInfer, "persona-infer",
+		false, "Ask the model for each book's persona from its opening, filling in what --persona leaves unset")
+	cmd.Flags().StringVar(&opts.SystemPrompt, "system-prompt",
+		"", "System prompt to add to every conversation written (default: none)")
+	cmd.Flags().StringVar(&opts.SystemPromptAs, "system-prompt-as",
+		"turn", "Where --system-prompt goes: turn (a leading system turn) or field (a system field on each JSONL line)")
+	cmd.Flags().BoolVar(&opts.Resume, "resume",
+		false, "Continue an interrupted run from its checkpoint, skipping chunks already processed")
+	cmd.Flags().StringVar(&opts.Source.Split, "split",
+		"train", "Dataset split to read (hf:// inputs)")
+	cmd.Flags().StringVar(&opts.Source.Config, "hf-config",
+		"", "Dataset config to read (hf:// inputs; default: the first with --split; formerly --config)")
+	cmd.Flags().StringVar(&opts.Source.Column, "column",
+		"text", "Column holding the book text (Parquet and hf:// inputs)")
+	cmd.Flags().StringVar(&opts.Source.CacheDir, "cache-dir",
+		"", "Where downloaded hf:// rows are cached (default: the user cache dir)")
+	cmd.Flags().IntVar(&opts.ShuffleBuffer, "shuffle-buffer",
+		64, "Books held in memory to randomize the corpus order; larger is closer to a full shuffle (1 keeps the source order)")
+	cmd.Flags().StringVar(&opts.Sample.Order, "sample-order",
+		"sequential", "Order of chunks across books: sequential (a book at a time), round-robin (a chunk from each open book in turn) or weighted (a random open book, in proportion to its chunks left)")
+	cmd.Flags().IntVar(&opts.Sample.Window, "sample-window",
+		16, "Books open at once for round-robin and weighted --sample-order")
+	cmd.Flags().IntVar(&opts.Sample.MaxChunksPerBook, "max-chunks-per-book",
+		0, "Take at most this many chunks from a book, picked at random (0 for no limit)")
+	cmd.Flags().StringVar(&opts.Dedup, "dedup",
+		"drop", "What to do with conversations that repeat ones already in the output: drop, flag (log and keep) or off")
+	cmd.Flags().Float64Var(&opts.DedupThreshold, "dedup-threshold",
+		0.8, "Estimated Jaccard similarity of the gpt turns at which a conversation counts as a near duplicate")
+	cmd.Flags().IntVar(&opts.Filter.MinTurns, "min-turns",
+		2, "Reject conversations with fewer turns")
+	cmd.Flags().IntVar(&opts.Filter.MaxTurns, "max-turns",
+		0, "Reject conversations with more turns (0 for no limit)")
+	cmd.Flags().IntVar(&opts.Filter.MinTurnChars, "min-turn-chars",
+		1, "Reject conversations with a shorter turn")
+	cmd.Flags().IntVar(&opts.Filter.MaxTurnChars, "max-turn-chars",
+		0, "Reject conversations with a longer turn (0 for no limit)")
+	cmd.Flags().BoolVar(&opts.Filter.Alternate, "require-alternation",
+		true, "Reject conversations whose turns don't alternate human, gpt, human, ...")
+	cmd.Flags().StringSliceVar(&opts.Filter.Refusals, "refusal-phrases",
+		defaultRefusals, "Reject conversations whose gpt turns contain one of these phrases (case-insensitive)")
+	cmd.Flags().StringVar(&opts.Filter.JudgeModel, "judge-model",
+		"", "Ollama model that scores each conversation from 1 to 10 (default: no judge)")
+	cmd.Flags().Float64Var(&opts.Filter.JudgeThreshold, "judge-threshold",
+		6, "Reject conversations the judge scores below this")
+	cmd.Flags().Var(&opts.Shape.Exchanges, "exchanges",
+		"Human/gpt exchanges to ask for per conversation, as N or MIN-MAX")
+	cmd.Flags().Var(&opts.Shape.GPTParagraphs, "gpt-paragraphs",
+		"Paragraphs to ask for in each gpt turn, as N or MIN-MAX")
+	cmd.Flags().Var(&opts.Shape.HumanSentences, "human-sentences",
+		"Sentences to ask for in each human turn, as N or MIN-MAX")
+	cmd.Flags().BoolVar(&opts.Shape.Enforce, "enforce-shape",
+		true, "Reject conversations outside --exchanges, --gpt-paragraphs and --human-sentences")
+	cmd.Flags().IntVar(&opts.Parse.MaxCorrections, "max-corrections",
+		2, "Times to re-prompt with the error when a response has no valid <json> block (0 to give up at once)")
+	cmd.Flags().BoolVar(&opts.Parse.Repair, "repair",
+		true, "Repair sloppy JSON (code fences, trailing commas, raw newlines in strings) before giving up on a response; --repair=false to disable")
+	cmd.Flags().Int64Var(&opts.Seed, "seed",
+		0, "Seed for the corpus shuffle, sampling and Ollama, to reproduce a build exactly (default: from the clock, and logged)")
+	cmd.Flags().Float64Var(&opts.Temperature, "temperature",
+		0.7, "Sampling temperature for generation")
+	cmd.Flags().BoolVar(&opts.Quiet, "quiet",
+		false, "Don't print the model's responses; follow progress in the log instead")
+	cmd.Flags().BoolVar(&opts.NoAnimate, "no-animate",
+		false, "Print responses as they arrive instead of typing them out (the default when stdout isn't a terminal)")
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run",
+		false, "Scan the corpus and report book, chunk, request and token counts without generating")
+	cmd.Flags().IntVar(&opts.DryRunSample, "dry-run-sample",
+		0, "With --dry-run, time this many generations (discarded) to project wall-clock time and output tokens")
+	cmd.Flags().StringVar(&opts.Domain, "domain",
+		"", "YAML domain pack with the prompt template, text column, output directory and turn rules (default: romance)")
+	_ = cmd.RegisterFlagCompletionFunc("out-format", cobra.FixedCompletions([]string{"json", "jsonl"}, cobra.ShellCompDirectiveNoFileComp))
+	_ = cmd.RegisterFlagCompletionFunc("tokenizer", completeTokenizer)
+	_ = cmd.RegisterFlagCompletionFunc("system-prompt-as", cobra.FixedCompletions([]string{"turn", "field"}, cobra.ShellCompDirectiveNoFileComp))
+	_ = cmd.RegisterFlagCompletionFunc("sample-order", cobra.FixedCompletions([]string{"sequential", "round-robin", "weighted"}, cobra.ShellCompDirectiveNoFileComp))
+	_ = cmd.RegisterFlagCompletionFunc("dedup", cobra.FixedCompletions([]string{"drop", "flag", "off"}, cobra.ShellCompDirectiveNoFileComp))
+	// --input reads better than --input-file for hf:// datasets.
+	cmd.Flags().SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "input" {
+			name = "input-file"
+		}
+		return pflag.NormalizedName(name)
+	})
+}
+
+func newBranchCmd(logger *slog.Logger) *cobra.Command {
+	return &cobra.Command{
+		Use:   "branch [branch-name]",
+		Short: "Create a git branch for dataset changes",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runGitCommand(logger, "checkout", "-b", args[0])
+		},
+	}
+}
+
+func newCommitCmd(logger *slog.Logger) *cobra.Command {
+	return &cobra.Command{
+		Use:   "commit [msg]",
+		Short: "Commit dataset changes",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := runGitCommand(logger, "add", "datasets"); err != nil {
+				return err
+			}
+			return runGitCommand(logger, "commit", "-m", args[0])
+		},
+	}
+}
+
+// runGenerate writes the dataset. Its spans are children of any span in
+// ctx.
+func runGenerate(ctx context.Context, logger *slog.Logger, opts genOptions) error {
+	// Failed chunks go to the output's failure ledger; a backfill reads
+	// its chunks from one, and marks them resolved in it.
+	ledgerPath := failuresPath(opts.OutFile)
+	if opts.Backfill != "" {
+		ledgerPath = opts.Backfill
+	}
+	failures, err := openFailureLedger(ledgerPath)
+	if err != nil {
+		return err
+	}
+	var ds DataSource
+	if opts.Backfill == "" {
+		if ds, err = openSource(opts.InFile, opts.Source); err != nil {
+			return err
+		}
+		defer ds.Close()
+	} else if len(failures.Pending()) == 0 {
+		logger.Info("Nothing to backfill", "ledger", ledgerPath)
+		return nil
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	// Ollama samples with the same seed too, so a build is reproducible
+	// given the same models.
+	modelOptions := map[string]interface{}{"temperature": opts.Temperature, "seed": opts.Seed}
+
+	promptTmpl, err := opts.promptTemplate()
+	if err != nil {
+		return err
+	}
+	tok, err := newTokenizer(opts.Tokenizer)
+	if err != nil {
+		return err
+	}
+	// The template's hash, recorded with each conversation, tells apart
+	// conversations from different prompts.
+	promptHash := chunkHash(opts.Prompt)
+
+	ch := newParagraphChunker(opts.Chunk)
+	format, err := outputFormat(opts.OutFile, opts.OutFormat)
+	if err != nil {
+		return err
+	}
+	if err := opts.Sample.validate(); err != nil {
+		return err
+	}
+	if err := opts.Chunk.validate(); err != nil {
+		return err
+	}
+	switch opts.SystemPromptAs {
+	case "turn":
+	case "field":
+		if format != "jsonl" {
+			return errors.New("--system-prompt-as field needs jsonl output; JSON output has no room for it")
+		}
+	default:
+		return fmt.Errorf("unknown --system-prompt-as %q (want turn or field)", opts.SystemPromptAs)
+	}
+	if strings.ContainsAny(opts.Worker, `/\`) {
+		return fmt.Errorf("--worker %q must not contain a path separator", opts.Worker)
+	}
+	cp, resumed, resumedMeta, err := openCheckpoint(opts.OutFile, opts.Worker, opts.Resume)
+	if err != nil {
+		return err
+	}
+	defer cp.Close()
+	var out convWriter
+	if format == "jsonl" {
+		// Conversations are appended as they are generated, so the resumed
+		// ones are already in the file.
+		out, err = openJSONLWriter(opts.OutFile)
+	} else {
+		out, err = openJSONWriter(opts.OutFile)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.SystemPrompt != "" {
+		out = &systemPromptWriter{convWriter: out, prompt: opts.SystemPrompt, field: opts.SystemPromptAs == "field"}
+	}
+	if format == "json" {
+		for i, conv := range resumed {
+			_ = out.Add(conv, resumedMeta[i])
+		}
+	}
+	if opts.Resume {
+		logger.Info("Resuming from checkpoint",
+			"checkpoint", cp.path,
+			"conversations", len(resumed))
+	}
+	dedup, err := openDedup(opts, format, resumed)
+	if err != nil {
+		return err
+	}
+	reg, err := openRegistry(opts.Registry)
+	if err != nil {
+		return err
+	}
+	defer reg.Close()
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, span := otel.Tracer(ServiceName).Start(ctx, "command_generate", trace.WithAttributes(
+		attribute.String("model.name", opts.Model),
+		attribute.String("output", opts.OutFile),
+	))
+	defer span.End()
+	pool, err := newEndpointPool(ctx, opts.OllamaAddrs, logger)
+	if err != nil {
+		return err
+	}
+	filters, err := newFilterChain(opts.Filter, opts.Shape, pool, opts.Seed)
+	if err != nil {
+		return err
+	}
+	personas := newPersonaResolver(opts.Persona, pool, opts.Model, modelOptions, logger)
+
+	totalBooks := int64(-1)
+	if rc, ok := ds.(rowCounter); ok {
+		totalBooks = rc.NumRows()
+	}
+	workers := pool.Len() * max(opts.Parallel, 1)
+	logger.Info("Starting generation",
+		"totalBooks", totalBooks,
+		"shuffleBuffer", opts.ShuffleBuffer,
+		"workers", workers,
+		"seed", opts.Seed)
+
+	// Workers generate and filter; this goroutine alone dedups, writes and
+	// checkpoints. Responses are only echoed when there is one worker;
+	// otherwise they would interleave.
+	echo := displayEcho(opts.Quiet, opts.NoAnimate)
+	if workers > 1 {
+		echo = echoNone
+	}
+	jobs := make(chan genJob)
+	results := make(chan genJobResult)
+	wctx, cancelWorkers := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancelWorkers()
+		close(jobs)
+		wg.Wait()
+	}()
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				r := genJobResult{genJob: job}
+				r.conv, r.res, r.err = generateConversation(wctx, pool, opts.Model, job.prompt,
+					modelOptions, opts.Parse, echo, logger)
+				if r.err == nil && len(r.conv) > 0 {
+					r.filter, r.rejected, r.filterErr = filters.Check(wctx, r.conv)
+				}
+				select {
+				case results <- r:
+				case <-wctx.Done():
+				}
+			}
+		}()
+	}
+
+	count, chunkSoFar, books, rejected, registered := len(resumed), 0, 0, 0, 0
+	unregistered := resumedMeta
+	totalCorrections, recovered, repaired := 0, 0, 0
+	tokens := 0
+	for _, conv := range resumed {
+		tokens += conversationTokens(tok, conv)
+	}
+	resumedTokens := tokens
+
+	// The report is printed however the run ends, so a failed or
+	// interrupted run can still be budgeted from.
+	report := runReport{
+		Output:  opts.OutFile,
+		Model:   opts.Model,
+		Status:  "failed",
+		Workers: workers,
+		Started: time.Now(),
+		Resumed: len(resumed),
+	}
+	var usage genUsage
+	var gpus *collector.Sampler
+	if opts.GPUInterval > 0 {
+		c, stop, err := plugins.OpenCollector(ctx, logger)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		gpus = collector.StartSampler(ctx, c, opts.GPUInterval)
+	}
+	defer func() {
+		if report.Status == "failed" && ctx.Err() != nil {
+			report.Status = "interrupted"
+		}
+		if gpus != nil {
+			if stats, err := gpus.Stop(); err != nil {
+				logger.Warn("GPU sampling failed", "err", err)
+			} else {
+				report.GPU = newGPUReport(stats)
+			}
+		}
+		report.Accepted = count - len(resumed)
+		report.Rejected = rejected
+		report.SkippedRegistered = registered
+		report.Corrections = totalCorrections
+		report.Failovers = pool.Failovers()
+		report.DatasetTokens = tokens - resumedTokens
+		report.finish(usage, opts.Price)
+		span.SetAttributes(
+			attribute.String("run.status", report.Status),
+			attribute.Int("run.accepted", report.Accepted),
+			attribute.Int("run.failed", report.Failed),
+			attribute.Int("run.output_tokens", report.OutputTokens),
+		)
+		printRunReport(os.Stderr, report)
+		if opts.Report != "" {
+			if err := writeRunReport(opts.Report, report); err != nil {
+				logger.Error("Could not write report", "path", opts.Report, "err", err)
+			}
+		}
+	}()
+	// budgetLeft reports whether neither --max-examples nor
+	// --max-output-tokens has been reached, counting the generations in
+	// flight as if they will all succeed.
+	inflight := 0
+	budgetLeft := func() bool {
+		return count+inflight < opts.MaxExamples && (opts.MaxOutputTokens <= 0 || tokens < opts.MaxOutputTokens)
+	}
+
+	var sampler chunkSource
+	if opts.Backfill != "" {
+		pending := failures.Pending()
+		logger.Info("Backfilling failed chunks",
+			"ledger", ledgerPath,
+			"chunks", len(pending))
+		sampler = &failureSource{pending: pending}
+	} else {
+		rows := newShuffleBuffer(ds, opts.ShuffleBuffer, rng, logger)
+		sampler = newChunkSampler(opts.Sample, rows, ch, rng, func(row corpusRow, chunks int) {
+			books++
+			logger.Info("Processing book",
+				"index", books,
+				"totalBooks", totalBooks,
+				"source", row.Source,
+				"chunks", chunks,
+				"preview", trimTo(row.Text, 80))
+		})
+	}
+
+	// nextJob returns the next chunk not yet processed, reading books as
+	// needed, or ok false once the corpus is exhausted.
+	nextJob := func() (genJob, bool, error) {
+		for {
+			c, err := sampler.Next()
+			if errors.Is(err, io.EOF) {
+				return genJob{}, false, nil
+			}
+			if err != nil {
+				return genJob{}, false, err
+			}
+			chunkSoFar++
+			// The hash is of the whole chunk, so checkpoints and the
+			// registry don't depend on --max-chunk-tokens.
+			hash := chunkHash(c.Text)
+			if cp.Done(hash) {
+				continue
+			}
+			done, err := reg.Done(context.Background(), hash)
+			if err != nil {
+				return genJob{}, false, err
+			}
+			if done {
+				registered++
+				if err := failures.Resolve(hash); err != nil {
+					return genJob{}, false, err
+				}
+				continue
+			}
+			text, n := c.Text, tok.Count(c.Text)
+			if opts.MaxChunkTokens > 0 && n > opts.MaxChunkTokens {
+				text = tok.Truncate(text, opts.MaxChunkTokens)
+				logger.Debug("Truncated chunk",
+					"tokens", n,
+					"maxChunkTokens", opts.MaxChunkTokens)
+				n = tok.Count(text)
+			}
+			logger.Info("Generating chunk",
+				"source", c.Row.Source,
+				"chunkIndex", c.Index,
+				"chunksInBook", c.Total,
+				"chunkTokens", n,
+				"globalChunkIndex", chunkSoFar)
+			p, err := personas.For(ctx, c.Row.Source, c.Row.Text)
+			if err != nil {
+				return genJob{}, false, err
+			}
+			if p == nil {
+				p = c.Persona
+			}
+			chunking := c.Chunking
+			if chunking == nil {
+				chunking = &opts.Chunk
+			}
+			prompt, err := opts.renderPrompt(promptTmpl, text, p)
+			if err != nil {
+				return genJob{}, false, err
+			}
+			return genJob{
+				chunk:        c.Text,
+				chunkTokens:  n,
+				hash:         hash,
+				source:       c.Row.Source,
+				row:          c.Row.Row,
+				chunkIndex:   c.Index,
+				chunksInBook: c.Total,
+				persona:      p,
+				chunking:     chunking,
+				prompt:       prompt,
+			}, true, nil
+		}
+	}
+
+	exhausted := false
+	for {
+		for !exhausted && inflight < workers && budgetLeft() {
+			job, ok, err := nextJob()
+			if err != nil && ctx.Err() != nil {
+				return fmt.Errorf("interrupted; rerun with --resume to continue from %s", cp.path)
+			}
+			if err != nil {
+				return err
+			}
+			if !ok {
+				exhausted = true
+				break
+			}
+			select {
+			case jobs <- job:
+				inflight++
+				report.ChunksAttempted++
+			case <-ctx.Done():
+				return fmt.Errorf("interrupted; rerun with --resume to continue from %s", cp.path)
+			}
+		}
+		if inflight == 0 {
+			break
+		}
+		var r genJobResult
+		select {
+		case r = <-results:
+			inflight--
+		case <-ctx.Done():
+			return fmt.Errorf("interrupted; rerun with --resume to continue from %s", cp.path)
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("interrupted; rerun with --resume to continue from %s", cp.path)
+		}
+		if errors.Is(r.err, errAllEndpointsDown) {
+			return fmt.Errorf("%w; rerun with --resume to continue from %s", r.err, cp.path)
+		}
+
+		resp := r.conv
+		usage.merge(r.res.Usage)
+		totalCorrections += r.res.Corrections
+		if r.err == nil && r.res.Corrections > 0 {
+			recovered++
+		}
+		if r.err == nil && r.res.Repaired {
+			repaired++
+		}
+		if r.err != nil {
+			report.Failed++
+			logger.Error("ollama generate error",
+				"chunk_preview", trimTo(r.chunk, 60),
+				"corrections", r.res.Corrections,
+				"err", r.err)
+			kind := failRequest
+			if errors.Is(r.err, errMalformed) {
+				kind = failMalformed
+			}
+			if err := failures.Record(r.failure(kind, r.err, opts.Model, promptHash)); err != nil {
+				return err
+			}
+			continue
+		}
+		if r.filterErr != nil {
+			report.Failed++
+			logger.Error("quality filter error",
+				"chunk_preview", trimTo(r.chunk, 60),
+				"err", r.filterErr)
+			if err := failures.Record(r.failure(failFilter, r.filterErr, opts.Model, promptHash)); err != nil {
+				return err
+			}
+			continue
+		}
+		if r.rejected != "" {
+			logger.Warn("Rejected conversation",
+				"filter", r.filter,
+				"reason", r.rejected,
+				"chunk_preview", trimTo(r.chunk, 60))
+			resp = nil
+			rejected++
+		}
+		if why := dedup.Check(resp); len(resp) > 0 && why != "" {
+			logger.Warn("Duplicate conversation",
+				"reason", why,
+				"action", opts.Dedup,
+				"chunk_preview", trimTo(r.chunk, 60))
+			if opts.Dedup == "drop" {
+				resp = nil
+				report.Duplicates++
+			}
+		}
+		var meta *convMeta
+		if len(resp) > 0 {
+			if count >= opts.MaxExamples {
+				// More generations were in flight than were needed; leave
+				// the chunk for a later run.
+				continue
+			}
+			dedup.Add(resp)
+			meta = &convMeta{
+				Source:      r.source,
+				Chunk:       r.chunkIndex,
+				Chunks:      r.chunksInBook,
+				ChunkHash:   r.hash,
+				ChunkTokens: r.chunkTokens,
+				Model:       opts.Model,
+				PromptHash:  promptHash,
+				GeneratedAt: time.Now().UTC(),
+				Tokenizer:   opts.Tokenizer,
+				TurnTokens:  turnTokens(tok, resp),
+				Persona:     r.persona,
+				Chunking:    r.chunking,
+			}
+			if r.row >= 0 {
+				meta.Row = &r.row
+			}
+			if err := out.Add(resp, *meta); err != nil {
+				return err
+			}
+			if format == "jsonl" {
+				if err := reg.Accept(ctx, *meta, opts.OutFile); err != nil {
+					return err
+				}
+			} else {
+				// Not in the output until it is written on Close.
+				unregistered = append(unregistered, *meta)
+			}
+			count++
+			n := conversationTokens(tok, resp)
+			tokens += n
+			logger.Info("Conversation added",
+				"count", count,
+				"tokens", n,
+				"totalTokens", tokens,
+				"maxOutputTokens", opts.MaxOutputTokens)
+		}
+		if err := cp.Record(r.hash, resp, meta); err != nil {
+			return err
+		}
+		if err := failures.Resolve(r.hash); err != nil {
+			return err
+		}
+	}
+
+	if opts.Backfill == "" && books == 0 && budgetLeft() {
+		return errors.New("no valid rows found")
+	}
+
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", opts.OutFile, err)
+	}
+	// Conversations resumed from the checkpoint, and those of a JSON
+	// output, are only safely in the output now.
+	for _, m := range unregistered {
+		if err := reg.Accept(context.Background(), m, opts.OutFile); err != nil {
+			return err
+		}
+	}
+	if err := cp.Remove(); err != nil {
+		logger.Warn("Could not remove checkpoint", "path", cp.path, "err", err)
+	}
+	report.Status = "complete"
+	logger.Info("Generation complete",
+		"output", opts.OutFile,
+		"count", count,
+		"outputTokens", tokens,
+		"rejected", rejected,
+		"corrections", totalCorrections,
+		"recoveredByCorrection", recovered,
+		"repaired", repaired,
+		"skippedRegistered", registered,
+		"booksRead", books)
+	return nil
+}
+
+// genJob is one chunk handed to a generation worker. chunkIndex is its
+// 1-based position among the chunksInBook chunks of its book, the row-th
+// row of the source. chunk is the chunk's full text; prompt may hold it
+// cut down to --max-chunk-tokens.
+type genJob struct {
+	chunk        string
+	chunkTokens  int
+	hash         string
+	source       string
+	row          int64
+	chunkIndex   int
+	chunksInBook int
+	persona      *persona
+	chunking     *chunkOptions
+	prompt       string
+}
+
+// genJobResult is a worker's conversation for a job and the filter chain's
+// verdict on it.
+type genJobResult struct {
+	genJob
+	conv      []ShareGPTTurn
+	res       genResult
+	err       error
+	filter    string
+	rejected  string
+	filterErr error
+}
+
+// corpusRow is one row of the corpus and, when the source knows it, where
+// it came from. Row is the row's 0-based index in the source, or -1.
+type corpusRow struct {
+	Text   string
+	Source string
+	Row    int64
+}
+
+// errSourceFailed marks a NextRow error after which the source cannot go
+// on, as opposed to one bad row.
+var errSourceFailed = errors.New("source failed")
+
+// openSource opens a Hugging Face dataset, a directory of text and EPUB
+// files, or else a Parquet file.
+func openSource(path string, opts sourceOptions) (DataSource, error) {
+	if strings.HasPrefix(path, hfScheme) {
+		return openHFSource(path, opts)
+	}
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		return openDirSource(path)
+	}
+	return openParquetSource(path, opts.Column)
+}
+
+func openParquetSource(path, column string) (DataSource, error) {
+	f, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open parquet file: %w", err)
+	}
+	pr, err := reader.NewParquetColumnReader(f, 4)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to create parquet reader: %w", err)
+	}
+	colPath := common.ReformPathStr(pr.SchemaHandler.GetRootExName() + "." + column)
+	if _, ok := pr.SchemaHandler.MapIndex[pr.SchemaHandler.ExPathToInPath[colPath]]; !ok {
+		pr.ReadStop()
+		f.Close()
+		return nil, fmt.Errorf("parquet file has no column %q", column)
+	}
+	max := pr.GetNumRows()
+	if max == 0 {
+		pr.ReadStop()
+		f.Close()
+		return nil, fmt.Errorf("parquet file contains no rows")
+	}
+	return &parquetSource{path: path, column: colPath, pr: pr, f: f, max: max}, nil
+}
+
+// chunkOptions are how books are cut into chunks: ParagraphsPerChunk
+// paragraphs at a time, each chunk overlapping the last by a paragraph,
+// dropping chunks shorter than MinChars characters and splitting ones
+// longer than MaxChars, if set.
+type chunkOptions struct {
+	ParagraphsPerChunk int `json:"paragraphs_per_chunk"`
+	MinChars           int `json:"min_chars"`
+	MaxChars           int `json:"max_chars,omitempty"`
+}
+
+func (o chunkOptions) validate() error {
+	if o.ParagraphsPerChunk < 1 {
+		return fmt.Errorf("--paragraphs-per-chunk must be at least 1, got %d", o.ParagraphsPerChunk)
+	}
+	if o.MinChars < 0 {
+		return fmt.Errorf("--min-chunk-chars must not be negative, got %d", o.MinChars)
+	}
+	if o.MaxChars < 0 {
+		return fmt.Errorf("--max-chunk-chars must not be negative, got %d", o.MaxChars)
+	}
+	if o.MaxChars > 0 && o.MaxChars < o.MinChars {
+		return fmt.Errorf("--max-chunk-chars (%d) is less than --min-chunk-chars (%d), so every chunk would be dropped", o.MaxChars, o.MinChars)
+	}
+	return nil
+}
+
+type paragraphChunker struct {
+	paragraphsPerChunk int
+	minChunkLength     int
+	maxChunkLength     int
+}
+
+func newParagraphChunker(opts chunkOptions) *paragraphChunker {
+	if opts.ParagraphsPerChunk <= 0 {
+		opts.ParagraphsPerChunk = 3
+	}
+	return &paragraphChunker{
+		paragraphsPerChunk: opts.ParagraphsPerChunk,
+		minChunkLength:     opts.MinChars,
+		maxChunkLength:     opts.MaxChars,
+	}
+}
+
+func (p *paragraphChunker) Split(row string) []string {
+	paragraphs := strings.Split(row, "\n")
+	var clean []string
+	for _, pp := range paragraphs {
+		t := strings.TrimSpace(pp)
+		if t != "" {
+			clean = append(clean, t)
+		}
+	}
+	if len(clean) == 0 {
+		return nil
+	}
+	var chunks []string
+	var current []string
+	seen := map[string]bool{}
+	for i, para := range clean {
+		current = append(current, para)
+		if len(current) >= p.paragraphsPerChunk || i == len(clean)-1 {
+			for _, chunk := range p.cut(strings.Join(current, "\n\n")) {
+				// Split chunks can repeat pieces of the paragraph the next
+				// chunk overlaps them by.
+				if seen[chunk] {
+					continue
+				}
+				if utf8.RuneCountInString(chunk) >= p.minChunkLength {
+					chunks = append(chunks, chunk)
+					seen[chunk] = true
+				}
+			}
+			current = nil
+			if i < len(clean)-1 {
+				if len(current) == 0 && i > 0 {
+					current = append(current, clean[i])
+				}
+			}
+		}
+	}
+	return chunks
+}
+
+// cut splits a chunk longer than maxChunkLength characters into pieces
+// that fit, breaking at the last paragraph, sentence or word boundary
+// that allows, and mid-word only if there is none.
+func (p *paragraphChunker) cut(chunk string) []string {
+	if p.maxChunkLength <= 0 {
+		return []string{chunk}
+	}
+	var pieces []string
+	for utf8.RuneCountInString(chunk) > p.maxChunkLength {
+		end, n := len(chunk), 0
+		for i := range chunk {
+			if n == p.maxChunkLength {
+				end = i
+				break
+			}
+			n++
+		}
+		head := chunk[:end]
+		at := strings.LastIndex(head, "\n\n")
+		if at <= 0 {
+			at = lastSentenceEnd(head)
+		}
+		if at <= 0 {
+			at = strings.LastIndexAny(head, " \n")
+		}
+		if at <= 0 {
+			at = end
+		}
+		pieces = append(pieces, strings.TrimSpace(chunk[:at]))
+		chunk = strings.TrimSpace(chunk[at:])
+	}
+	if chunk != "" {
+		pieces = append(pieces, chunk)
+	}
+	return pieces
+}
+
+// lastSentenceEnd returns the index just past the last sentence-ending
+// punctuation in s that is followed by a space, or -1.
+func lastSentenceEnd(s string) int {
+	for i := len(s) - 2; i > 0; i-- {
+		if strings.IndexByte(".!?", s[i]) >= 0 && (s[i+1] == ' ' || s[i+1] == '\n') {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// romancePrompt is the prompt template used without a --domain pack.
+const romancePrompt = `
+You are an expert narrative synthesizer tasked with transforming a romance
+literature excerpt into an immersive and suspenseful experience. Your goal is
+to create a turn-based conversation between a narrator gpt (who will outline the
+scene and perform the dialogue of NPCs) and the human (who will be the human user
+in the final trained chatbot).
+
+Your task is to generate an emotionally authentic narrator/user roleplay based
+on the given literature excerpt:
+
+<literature>
+{{printf "%q" .Excerpt}}
+</literature>
+
+Key Requirements:
+- Emphasize a **romantic narrative**.
+- Attempt to understand the characters' names, relationships, and the context of the story.
+- Maintain consistent character voices and narrative flow throughout the conversation.
+- Include subtle relationship dynamics and tension.
+- Incorporate occasional actions or non-verbal cues in parentheses.
+- Generate {{.Exchanges}} conversation turns, with the gpt response's length ALWAYS being
+  about **{{.GPTParagraphs}} paragraphs** of AT LEAST three sentences each, and the
+  user's input at about {{.HumanSentences}} sentences.
+- Vary the length of responses organically.
+- Human will always go first per-turn, then GPT.
+- Human will always be the main character from the chunk of literature. Make a best
+  guess as you walk through the excerpt who the main character is to insert them
+  as.
+{{- if .Persona}}
+
+Keep to these characters and this style throughout:
+
+{{.Persona}}
+{{- end}}
+
+Output the conversation in the following JSON structure, enclosed in <json> tags.
+**YOUR RESPONSE MUST INCLUDE THESE TAGS**.
+
+<json>
+{
+	"conversations": [
+	[
+		{"from": "human", "value": "dialogue"},
+		{"from": "gpt",   "value": "response"}
+	]
+	]
+}
+</json>
+
+Example:
+
+<literature>
+Elizabeth could not help but observe Mr. Darcy across the crowded ballroom. His
+tall figure cut an imposing silhouette against the candlelit walls, and though
+he maintained his usual stern countenance, she caught his eyes following her
+movements more than once. Their last heated argument about her sister's
+engagement to Mr. Bingley still burned fresh in her mind.
+</literature>
+
+Expected Output:
+
+<json>
+{
+"conversations": [
+[
+{"from": "human", "value": "I want to approach Mr. Darcy, but after our last argument, I'm hesitant. Perhaps I should simply observe him from afar for now."},
+{"from": "gpt", "value": "The grandiose ballroom sparkles with candlelight, casting dramatic shadows across the elaborately decorated walls. Mr. Darcy stands apart from the crowd, his commanding presence drawing attention even in his solitude. Though he maintains his characteristic stoic expression, his dark eyes seem to find you with remarkable frequency among the swirling dancers and chattering guests.\n\nMrs. Bennet's shrill voice carries across the room as she loudly proclaims the virtues of your sister Jane to anyone who will listen. The celebration of her engagement to Mr. Bingley has set all of Meryton abuzz with excitement and speculation.\n\nYou notice Mr. Darcy's jaw tighten almost imperceptibly when your eyes meet briefly across the room. The memory of his harsh words about your family's social standing and his interference in Jane's relationship with Mr. Bingley still stings, though something in his gaze now seems different – perhaps tinged with regret?"}
+],
+[
+{"from": "human", "value": "I shall not let him intimidate me. I straighten my posture and meet his gaze directly."},
+{"from": "gpt", "value": "A subtle spark of approval seems to flicker in Mr. Darcy's eyes at your display of fortitude. He inclines his head ever so slightly in acknowledgment, the gesture barely perceptible to any but the most attentive observer. The string quartet begins a new piece, its gentle melody weaving through the excited murmurs of the assembled company.\n\nMr. Bingley approaches his friend, speaking in animated tones that contrast sharply with Mr. Darcy's reserved demeanor. Though you cannot hear their words, you see Mr. Darcy's attention remain fixed in your direction even as he responds to his companion.\n\n'Oh, Lizzy!' your younger sister Kitty appears at your elbow, practically bouncing with excitement. 'Is it not thrilling? And to think, you might have had your own wealthy suitor if you hadn't been so sharp with Mr. Darcy!' (She giggles, oblivious to the complexity of the situation)"}
+]
+]
+}
+</json>
+`
+
+// generateChat returns the backend's whole response, showing it as it
+// streams in as echo says. Without an echo, the response's speed is logged
+// to logger, if given, once it is done.
+func generateChat(ctx context.Context, b llm.Backend,
+	model, prompt string, options map[string]interface{}, echo echoMode, logger *slog.Logger) (string, llm.Metrics, error) {
+
+	var full strings.Builder
+	var printer *animatedPrinter
+	if echo == echoAnimate {
+		printer = newAnimatedPrinter()
+	}
+	metrics, _, err := b.Complete(ctx, llm.Request{Model: model, Prompt: prompt, Options: options}, func(chunk string) {
+		full.WriteString(chunk)
+		switch echo {
+		case echoPlain:
+			fmt.Print(chunk)
+		case echoAnimate:
+			printer.Print(chunk)
+		}
+	})
+	if printer != nil {
+		printer.Close()
+	}
+	if echo != echoNone {
+		fmt.Print("\n\n")
+	} else if err == nil && logger != nil {
+		logger.Debug("Response received",
+			"model", model,
+			"outputTokens", metrics.EvalCount,
+			"seconds", metrics.TotalDuration.Seconds(),
+			"tokensPerSecond", llm.TokensPerSecond(metrics))
+	}
+	if err != nil {
+		return "", metrics, err
+	}
+	return full.String(), metrics, nil
+}
+
+func loadShareGPT(path string) (*ShareGPTData, error) {
+	b, err := readDataset(path)
+	if err != nil {
+		return &ShareGPTData{}, nil
+	}
+	var d ShareGPTData
+	if e := json.Unmarshal(b, &d); e != nil {
+		return nil, e
+	}
+	return &d, nil
+}
+
+func saveShareGPT(path string, d *ShareGPTData) error {
+	return writeFileAtomic(path, func(f io.Writer) error {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	})
+}
+
+func runGitCommand(logger *slog.Logger, subcmd string, args ...string) error {
+	cmd := exec.Command("git", append([]string{subcmd}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		logger.Error("git error", "stderr", stderr.String())
+		return err
+	}
+	logger.Info("git "+subcmd+" ok", "args", args)
+	return nil
+}
+
+func trimTo(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,119 @@
+package synner
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+)
+
+// mergeOptions are the merge command's settings.
+type mergeOptions struct {
+	Dedup     bool
+	Threshold float64
+}
+
+func newMergeCmd(logger *slog.Logger) *cobra.Command {
+	var opts mergeOptions
+	cmd := &cobra.Command{
+		Use:   "merge [out] [in...]",
+		Short: "Combine ShareGPT datasets into one, dropping duplicates across them",
+		Long: `Combine ShareGPT datasets from different runs, machines or domains into one.
+
+Inputs may mix .json and .jsonl; the output format follows out's extension.
+Conversations repeated within or across inputs are kept once, first input
+first. A .jsonl output keeps every field of the input lines, such as source,
+and records the file each conversation came from as "origin". A .json output
+holds only the conversations.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMerge(logger, args[0], args[1:], opts)
+		},
+	}
+	cmd.Flags().BoolVar(&opts.Dedup, "dedup",
+		true, "Drop exact and near-duplicate conversations")
+	cmd.Flags().Float64Var(&opts.Threshold, "threshold",
+		0.8, "Estimated gpt-turn similarity, from 0 to 1, at which conversations count as near duplicates")
+	return cmd
+}
+
+func runMerge(logger *slog.Logger, out string, ins []string, opts mergeOptions) error {
+	if opts.Threshold <= 0 || opts.Threshold > 1 {
+		return fmt.Errorf("--threshold must be in (0, 1], got %v", opts.Threshold)
+	}
+	format, _ := outputFormat(out, "")
+	var idx *dedupIndex
+	if opts.Dedup {
+		idx = newDedupIndex(opts.Threshold)
+	}
+	var merged []datasetRecord
+	dropped, withMeta := 0, 0
+	for _, in := range ins {
+		recs, err := loadRecords(in)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", in, err)
+		}
+		added := 0
+		for _, r := range recs {
+			if idx.Check(r.conv) != "" {
+				dropped++
+				continue
+			}
+			idx.Add(r.conv)
+			raw, err := mergedRaw(r, in, format)
+			if err != nil {
+				return fmt.Errorf("failed to merge %s: %w", in, err)
+			}
+			if r.source != "" {
+				withMeta++
+			}
+			merged = append(merged, datasetRecord{raw: raw, conv: r.conv, source: r.source})
+			added++
+		}
+		logger.Info("Merged dataset",
+			"path", in,
+			"conversations", len(recs),
+			"added", added)
+	}
+	if format == "json" && withMeta > 0 {
+		logger.Warn("JSON output has no room for provenance; write .jsonl to keep it",
+			"conversationsWithSource", withMeta)
+	}
+	if err := writeRecordsFile(out, merged); err != nil {
+		return fmt.Errorf("failed to write %s: %w", out, err)
+	}
+	logger.Info("Wrote merged dataset",
+		"path", out,
+		"conversations", len(merged),
+		"duplicatesDropped", dropped)
+	return nil
+}
+
+// mergedRaw returns r as it should appear in a merged file of the given
+// format: the bare conversation for JSON, or its JSONL line, with every
+// field kept and origin added unless an earlier merge already set it.
+func mergedRaw(r datasetRecord, in, format string) (json.RawMessage, error) {
+	if format == "json" {
+		return marshalRaw(r.conv)
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(r.raw, &fields); err != nil {
+		// A conversation from a .json file, not a JSONL line.
+		b, err := marshalRaw(jsonlLine{Conversations: r.conv})
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &fields); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := fields["origin"]; !ok {
+		b, err := marshalRaw(in)
+		if err != nil {
+			return nil, err
+		}
+		fields["origin"] = b
+	}
+	return marshalRaw(fields)
+}
@@ -0,0 +1,370 @@
+package synner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// convWriter receives conversations as they are generated.
+type convWriter interface {
+	Add(conv []ShareGPTTurn, meta convMeta) error
+	Close() error
+}
+
+// convMeta is what is known about where a conversation came from, enough
+// to trace it back to its source passage. JSONL output keeps it on each
+// line; JSON output keeps it in a metaPath sidecar.
+type convMeta struct {
+	// Source is the book the conversation was generated from, and Row its
+	// 0-based row in the input, when the input has rows.
+	Source string `json:"source,omitempty"`
+	Row    *int64 `json:"row,omitempty"`
+	// Chunk is the 1-based position of the conversation's chunk among the
+	// Chunks chunks of its book, and ChunkHash the chunk's checkpoint hash.
+	// ChunkTokens is its length as prompted, after any truncation.
+	Chunk       int    `json:"chunk,omitempty"`
+	Chunks      int    `json:"chunks,omitempty"`
+	ChunkHash   string `json:"chunk_hash,omitempty"`
+	ChunkTokens int    `json:"chunk_tokens,omitempty"`
+	Model       string `json:"model,omitempty"`
+	// PromptHash is the hash of the prompt template, before the chunk is
+	// filled in.
+	PromptHash  string    `json:"prompt_hash,omitempty"`
+	GeneratedAt time.Time `json:"generated_at,omitzero"`
+	// TurnTokens counts each turn's tokens with Tokenizer.
+	Tokenizer  string `json:"tokenizer,omitempty"`
+	TurnTokens []int  `json:"turn_tokens,omitempty"`
+	// System is a dataset-level system prompt, for --system-prompt-as
+	// field.
+	System string `json:"system,omitempty"`
+	// Persona is the persona the prompt was given, if any.
+	Persona *persona `json:"persona,omitempty"`
+	// Chunking is how the book was cut into chunks.
+	Chunking *chunkOptions `json:"chunking,omitempty"`
+}
+
+// metaPath is the sidecar holding the provenance of a JSON dataset's
+// conversations, one convMeta line each, in the same order.
+func metaPath(path string) string {
+	return strings.TrimSuffix(path, datasetExt(path)) + ".meta.jsonl"
+}
+
+// outputFormat is "jsonl" for .jsonl paths, compressed or not, and "json"
+// otherwise, unless format names one explicitly.
+func outputFormat(path, format string) (string, error) {
+	switch format {
+	case "json", "jsonl":
+		return format, nil
+	case "":
+		if strings.HasPrefix(strings.ToLower(datasetExt(path)), ".jsonl") {
+			return "jsonl", nil
+		}
+		return "json", nil
+	}
+	return "", fmt.Errorf("unknown output format %q (want json or jsonl)", format)
+}
+
+// systemPromptWriter adds a system prompt to each conversation before
+// passing it on: as a leading system turn, or with field as the line's
+// system field.
+type systemPromptWriter struct {
+	convWriter
+	prompt string
+	field  bool
+}
+
+func (w *systemPromptWriter) Add(conv []ShareGPTTurn, meta convMeta) error {
+	if w.field {
+		meta.System = w.prompt
+	} else {
+		conv = append([]ShareGPTTurn{{From: "system", Value: w.prompt}}, conv...)
+	}
+	return w.convWriter.Add(conv, meta)
+}
+
+// jsonWriter keeps the run's conversations in memory and on Close appends
+// them to the ShareGPT document, along with the metaPath sidecar. The file
+// is read again under lockDataset at that point, so runs writing the same
+// file add to it rather than overwrite each other.
+type jsonWriter struct {
+	path  string
+	convs [][]ShareGPTTurn
+	metas []convMeta
+}
+
+func openJSONWriter(path string) (*jsonWriter, error) {
+	// Fail now rather than after the run if the file can't be added to.
+	if _, err := loadShareGPT(path); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if _, err := loadMeta(metaPath(path)); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", metaPath(path), err)
+	}
+	return &jsonWriter{path: path}, nil
+}
+
+func (w *jsonWriter) Add(conv []ShareGPTTurn, meta convMeta) error {
+	w.convs = append(w.convs, conv)
+	w.metas = append(w.metas, meta)
+	return nil
+}
+
+func (w *jsonWriter) Close() error {
+	unlock, err := lockDataset(w.path)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", w.path, err)
+	}
+	defer unlock()
+	d, err := loadShareGPT(w.path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", w.path, err)
+	}
+	metas, err := loadMeta(metaPath(w.path))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", metaPath(w.path), err)
+	}
+	// Keep the sidecar in step with a file written without one.
+	metas = append(metas, make([]convMeta, max(len(d.Conversations)-len(metas), 0))...)
+	metas = append(metas[:len(d.Conversations)], w.metas...)
+	d.Conversations = append(d.Conversations, w.convs...)
+	if err := saveShareGPT(w.path, d); err != nil {
+		return err
+	}
+	return writeFileAtomic(metaPath(w.path), func(f io.Writer) error {
+		bw := bufio.NewWriter(f)
+		enc := json.NewEncoder(bw)
+		for _, m := range metas {
+			if err := enc.Encode(m); err != nil {
+				return err
+			}
+		}
+		return bw.Flush()
+	})
+}
+
+// loadMeta reads a metaPath sidecar, which may not exist.
+func loadMeta(path string) ([]convMeta, error) {
+	f, err := openDataset(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var metas []convMeta
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		var m convMeta
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		metas = append(metas, m)
+	}
+	return metas, sc.Err()
+}
+
+// jsonlWriter appends each conversation to the file as one
+// {"conversations": [...], "source": "...", "chunk": n, ...} line with its
+// convMeta and syncs it, so nothing generated is lost if the run dies. Each
+// append is made under lockDataset, so several runs, on this machine or
+// others sharing the filesystem, can add to the same file; to that end a
+// compressed file gets a whole gzip member or zstd frame per line.
+type jsonlWriter struct {
+	path string
+	f    *os.File
+}
+
+type jsonlLine struct {
+	Conversations []ShareGPTTurn `json:"conversations"`
+	convMeta
+}
+
+func openJSONLWriter(path string) (*jsonlWriter, error) {
+	unlock, err := lockDataset(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	defer unlock()
+	if err := repairJSONL(path); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonlWriter{path: path, f: f}, nil
+}
+
+func (w *jsonlWriter) Add(conv []ShareGPTTurn, meta convMeta) error {
+	b, err := json.Marshal(jsonlLine{Conversations: conv, convMeta: meta})
+	if err != nil {
+		return err
+	}
+	unlock, err := lockDataset(w.path)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", w.path, err)
+	}
+	defer unlock()
+	cw, err := compressWriter(w.f, w.path)
+	if err != nil {
+		return err
+	}
+	if _, err := cw.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to append conversation: %w", err)
+	}
+	if err := cw.Close(); err != nil {
+		return fmt.Errorf("failed to append conversation: %w", err)
+	}
+	return w.f.Sync()
+}
+
+func (w *jsonlWriter) Close() error {
+	return w.f.Close()
+}
+
+// repairJSONL drops a torn last line, or the unfinished compressed stream,
+// left by a crash mid-append. It truncates the file in place rather than
+// replacing it, so runs that already have it open keep appending to the
+// file everyone reads. Callers hold the dataset lock.
+func repairJSONL(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	raw, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	n, err := intactLength(path, raw)
+	if err != nil {
+		return err
+	}
+	if n == len(raw) {
+		return nil
+	}
+	if err := f.Truncate(int64(n)); err != nil {
+		return fmt.Errorf("failed to repair %s: %w", path, err)
+	}
+	return f.Sync()
+}
+
+// writeFileAtomic writes path through a synced temporary file in the same
+// directory and renames it into place, so readers never see a partial file.
+// What write writes is compressed if path's extension asks for it.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	cw, err := compressWriter(f, path)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := write(cw); err != nil {
+		f.Close()
+		return err
+	}
+	if err := cw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// loadJSONL reads a ShareGPT JSONL file into the single-document form.
+func loadJSONL(path string) (*ShareGPTData, error) {
+	f, err := openDataset(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d := &ShareGPTData{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	// A bad line is only an error if another follows it; a torn last line
+	// or unfinished compressed stream from a crashed run is dropped.
+	var bad error
+	for n := 1; sc.Scan(); n++ {
+		if bad != nil {
+			return nil, bad
+		}
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var l jsonlLine
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			bad = fmt.Errorf("%s:%d: %w", path, n, err)
+			continue
+		}
+		d.Conversations = append(d.Conversations, l.Conversations)
+	}
+	if err := sc.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return d, nil
+}
+
+// loadDataset reads a ShareGPT file in either format.
+func loadDataset(path string) (*ShareGPTData, error) {
+	format, _ := outputFormat(path, "")
+	if format == "jsonl" {
+		return loadJSONL(path)
+	}
+	b, err := readDataset(path)
+	if err != nil {
+		return nil, err
+	}
+	var d ShareGPTData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &d, nil
+}
+
+// saveDataset writes d in the format of path's extension.
+func saveDataset(path string, d *ShareGPTData) error {
+	format, _ := outputFormat(path, "")
+	if format == "json" {
+		return saveShareGPT(path, d)
+	}
+	return writeFileAtomic(path, func(f io.Writer) error {
+		w := bufio.NewWriter(f)
+		enc := json.NewEncoder(w)
+		for _, conv := range d.Conversations {
+			if err := enc.Encode(jsonlLine{Conversations: conv}); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	})
+}
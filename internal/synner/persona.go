@@ -0,0 +1,294 @@
+package synner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nathanleclaire/gpumon/internal/extract"
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"gopkg.in/yaml.v3"
+)
+
+// persona pins down who the human plays and how the narrator writes, so
+// conversations from a corpus with recurring characters stay consistent.
+// It is given to the prompt as {{.Persona}} and recorded with each
+// conversation.
+type persona struct {
+	MainCharacter string `yaml:"main_character" json:"main_character,omitempty"`
+	// Voice is how the main character speaks and acts.
+	Voice    string `yaml:"voice" json:"voice,omitempty"`
+	Narrator string `yaml:"narrator" json:"narrator,omitempty"`
+	// POV is the narrator's point of view: first, second or third.
+	POV        string             `yaml:"pov" json:"pov,omitempty"`
+	Characters []personaCharacter `yaml:"characters" json:"characters,omitempty"`
+	// Inferred marks a persona the model read from the book.
+	Inferred bool `yaml:"-" json:"inferred,omitempty"`
+}
+
+// personaCharacter is another recurring character, voiced by the narrator.
+type personaCharacter struct {
+	Name  string `yaml:"name" json:"name"`
+	Voice string `yaml:"voice" json:"voice,omitempty"`
+}
+
+// personaConfig is a --persona file, or a domain pack's persona section:
+//
+//	main_character: Elizabeth Bennet
+//	voice: quick-witted, teasing, proud of her judgement
+//	narrator: wry Regency omniscient, fond of irony
+//	pov: second
+//	characters:
+//	  - name: Mr. Darcy
+//	    voice: reserved, formal, blunt when pressed
+//	infer: true               # ask the model for each book's persona
+//	books:                    # per-book personas, by source or file name
+//	  emma.txt:
+//	    main_character: Emma Woodhouse
+//
+// A book's entry in books is used as is. Otherwise the top-level persona
+// is used, with an inferred one filling in whatever it leaves empty.
+type personaConfig struct {
+	persona `yaml:",inline"`
+	Infer   bool               `yaml:"infer"`
+	Books   map[string]persona `yaml:"books"`
+}
+
+func loadPersonaConfig(path string) (*personaConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c personaConfig
+	dec := yaml.NewDecoder(strings.NewReader(string(b)))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &c, nil
+}
+
+func (c *personaConfig) validate() error {
+	if err := c.persona.validate(); err != nil {
+		return err
+	}
+	for src, p := range c.Books {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("books: %s: %w", src, err)
+		}
+	}
+	return nil
+}
+
+func (p *persona) validate() error {
+	switch p.POV {
+	case "", "first", "second", "third":
+		return nil
+	}
+	return fmt.Errorf("unknown pov %q (want first, second or third)", p.POV)
+}
+
+// IsZero reports whether the config sets no persona at all.
+func (c *personaConfig) IsZero() bool {
+	return c == nil || (!c.Infer && len(c.Books) == 0 && c.persona.isZero())
+}
+
+func (p *persona) isZero() bool {
+	return p == nil || (p.MainCharacter == "" && p.Voice == "" && p.Narrator == "" && p.POV == "" && len(p.Characters) == 0)
+}
+
+// Prose renders p for the prompt, or "" for no persona.
+func (p *persona) Prose() string {
+	if p.isZero() {
+		return ""
+	}
+	var sb strings.Builder
+	if p.MainCharacter != "" {
+		fmt.Fprintf(&sb, "- The human plays %s", p.MainCharacter)
+		if p.Voice != "" {
+			fmt.Fprintf(&sb, ", who is %s", p.Voice)
+		}
+		sb.WriteString(".\n")
+	} else if p.Voice != "" {
+		fmt.Fprintf(&sb, "- The human's character is %s.\n", p.Voice)
+	}
+	for _, c := range p.Characters {
+		fmt.Fprintf(&sb, "- The narrator voices %s", c.Name)
+		if c.Voice != "" {
+			fmt.Fprintf(&sb, ", who is %s", c.Voice)
+		}
+		sb.WriteString(".\n")
+	}
+	if p.Narrator != "" {
+		fmt.Fprintf(&sb, "- The narrator's style: %s.\n", p.Narrator)
+	}
+	if p.POV != "" {
+		fmt.Fprintf(&sb, "- The narrator writes in the %s person.\n", p.POV)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// personaResolver finds the persona for each book, asking the model once
+// per book when inference is on. A nil personaResolver has no personas.
+// It is only used by generate's dispatching goroutine.
+type personaResolver struct {
+	cfg     personaConfig
+	pool    *endpointPool
+	model   string
+	options map[string]interface{}
+	logger  *slog.Logger
+	// inferred caches each book's inferred persona, nil if inference
+	// failed.
+	inferred map[string]*persona
+}
+
+func newPersonaResolver(cfg *personaConfig, pool *endpointPool, model string, options map[string]interface{}, logger *slog.Logger) *personaResolver {
+	if cfg.IsZero() {
+		return nil
+	}
+	return &personaResolver{
+		cfg:      *cfg,
+		pool:     pool,
+		model:    model,
+		options:  options,
+		logger:   logger,
+		inferred: map[string]*persona{},
+	}
+}
+
+// For returns the persona for the book source, whose text is book, or nil
+// for none.
+func (r *personaResolver) For(ctx context.Context, source, book string) (*persona, error) {
+	if r == nil {
+		return nil, nil
+	}
+	if p, ok := r.cfg.Books[source]; ok {
+		return &p, nil
+	}
+	if p, ok := r.cfg.Books[filepath.Base(source)]; ok {
+		return &p, nil
+	}
+	p := r.cfg.persona
+	if r.cfg.Infer {
+		inferred, ok := r.inferred[source]
+		if !ok {
+			var err error
+			inferred, err = r.infer(ctx, book)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if err != nil {
+				r.logger.Warn("Could not infer persona; using the default",
+					"source", source,
+					"err", err)
+			} else {
+				r.logger.Info("Inferred persona",
+					"source", source,
+					"mainCharacter", inferred.MainCharacter,
+					"pov", inferred.POV)
+			}
+			r.inferred[source] = inferred
+		}
+		if inferred != nil {
+			p.fillFrom(*inferred)
+		}
+	}
+	if p.isZero() {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+// fillFrom sets p's empty fields from o, marking p inferred if o is and
+// any were set.
+func (p *persona) fillFrom(o persona) {
+	filled := false
+	fill := func(dst *string, src string) {
+		if *dst == "" && src != "" {
+			*dst = src
+			filled = true
+		}
+	}
+	fill(&p.MainCharacter, o.MainCharacter)
+	fill(&p.Voice, o.Voice)
+	fill(&p.Narrator, o.Narrator)
+	fill(&p.POV, o.POV)
+	if len(p.Characters) == 0 && len(o.Characters) > 0 {
+		p.Characters = o.Characters
+		filled = true
+	}
+	p.Inferred = filled && o.Inferred
+}
+
+// personaSampleBytes is how much of the start of a book the model reads to
+// infer its persona.
+const personaSampleBytes = 12000
+
+func (r *personaResolver) infer(ctx context.Context, book string) (*persona, error) {
+	if len(book) > personaSampleBytes {
+		book = book[:personaSampleBytes]
+		// The cut may fall inside a character.
+		for !utf8.ValidString(book) {
+			book = book[:len(book)-1]
+		}
+	}
+	var resp string
+	err := r.pool.do(ctx, func(b llm.Backend) error {
+		var err error
+		resp, _, err = generateChat(ctx, b, r.model, personaPrompt(book), r.options, echoNone, r.logger)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	block := extract.TagBody(resp, "persona")
+	if block == "" {
+		return nil, fmt.Errorf("%w: no <persona> block found", errMalformed)
+	}
+	var p persona
+	if err := json.Unmarshal([]byte(block), &p); err != nil {
+		return nil, fmt.Errorf("%w: %w", errMalformed, err)
+	}
+	p.POV = strings.ToLower(strings.TrimSpace(p.POV))
+	if p.validate() != nil {
+		p.POV = ""
+	}
+	if p.isZero() {
+		return nil, fmt.Errorf("%w: empty persona", errMalformed)
+	}
+	p.Inferred = true
+	return &p, nil
+}
+
+func personaPrompt(book string) string {
+	return fmt.Sprintf(`Below is the opening of a book. It will be turned into roleplay conversations
+in which a human plays the book's main character and a narrator tells the story
+and voices everyone else.
+
+<book>
+%s
+</book>
+
+Identify the main character and how they speak and act, up to five other
+recurring characters and how each speaks, the narrator's style, and the point
+of view (first, second or third person) the narrator should write in. Reply
+with only JSON in this structure, inside <persona></persona> tags:
+
+<persona>
+{
+  "main_character": "name",
+  "voice": "how they speak and act",
+  "narrator": "narrative style",
+  "pov": "second",
+  "characters": [{"name": "name", "voice": "how they speak"}]
+}
+</persona>`, book)
+}
@@ -0,0 +1,197 @@
+package synner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/internal/llm"
+)
+
+const (
+	// healthInterval is how often endpoints marked down are probed.
+	healthInterval = 10 * time.Second
+	// allDownWait is how long a request waits for any endpoint to come
+	// back before the run gives up.
+	allDownWait = 2 * time.Minute
+)
+
+// errAllEndpointsDown means no Ollama endpoint answered for allDownWait;
+// the run stops so it can be resumed once they are back.
+var errAllEndpointsDown = errors.New("all Ollama endpoints are down")
+
+// endpointPool spreads requests over one or more Ollama servers, sending
+// each to the healthy endpoint with the fewest requests in flight. An
+// endpoint whose request fails is marked down and the request is retried
+// on another; endpoints marked down are probed in the background and put
+// back once they answer.
+type endpointPool struct {
+	mu     sync.Mutex
+	eps    []*endpoint
+	up     chan struct{}
+	logger *slog.Logger
+	// failovers counts requests retried on another endpoint.
+	failovers int
+}
+
+type endpoint struct {
+	addr     string
+	backend  *llm.Ollama
+	healthy  bool
+	inflight int
+}
+
+// newEndpointPool checks every address and fails if none is reachable.
+func newEndpointPool(ctx context.Context, addrs []string, logger *slog.Logger) (*endpointPool, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no Ollama address given")
+	}
+	p := &endpointPool{up: make(chan struct{}), logger: logger}
+	seen := map[string]bool{}
+	for _, a := range addrs {
+		a = strings.TrimSuffix(strings.TrimSpace(a), "/")
+		if a == "" || seen[a] {
+			continue
+		}
+		seen[a] = true
+		b, err := llm.NewOllama(a)
+		if err != nil {
+			return nil, err
+		}
+		p.eps = append(p.eps, &endpoint{addr: a, backend: b})
+	}
+	healthy := 0
+	for _, ep := range p.eps {
+		if err := ep.backend.Client().Heartbeat(ctx); err != nil {
+			logger.Warn("Ollama endpoint unreachable", "endpoint", ep.addr, "err", err)
+			continue
+		}
+		ep.healthy = true
+		healthy++
+	}
+	if healthy == 0 {
+		return nil, fmt.Errorf("%w: %s", errAllEndpointsDown, strings.Join(addrs, ", "))
+	}
+	if len(p.eps) > 1 {
+		logger.Info("Load balancing across Ollama endpoints",
+			"endpoints", len(p.eps),
+			"healthy", healthy)
+	}
+	go p.probe(ctx)
+	return p, nil
+}
+
+func (p *endpointPool) Len() int {
+	return len(p.eps)
+}
+
+// probe puts endpoints that answer a heartbeat back into rotation.
+func (p *endpointPool) probe(ctx context.Context) {
+	t := time.NewTicker(healthInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		p.mu.Lock()
+		var down []*endpoint
+		for _, ep := range p.eps {
+			if !ep.healthy {
+				down = append(down, ep)
+			}
+		}
+		p.mu.Unlock()
+		for _, ep := range down {
+			hctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			err := ep.backend.Client().Heartbeat(hctx)
+			cancel()
+			if err != nil {
+				continue
+			}
+			p.logger.Info("Ollama endpoint is back", "endpoint", ep.addr)
+			p.mu.Lock()
+			ep.healthy = true
+			close(p.up)
+			p.up = make(chan struct{})
+			p.mu.Unlock()
+		}
+	}
+}
+
+// acquire returns the least busy healthy endpoint, waiting up to
+// allDownWait for one if all are down.
+func (p *endpointPool) acquire(ctx context.Context) (*endpoint, error) {
+	deadline := time.NewTimer(allDownWait)
+	defer deadline.Stop()
+	for {
+		p.mu.Lock()
+		var best *endpoint
+		for _, ep := range p.eps {
+			if ep.healthy && (best == nil || ep.inflight < best.inflight) {
+				best = ep
+			}
+		}
+		if best != nil {
+			best.inflight++
+			p.mu.Unlock()
+			return best, nil
+		}
+		up := p.up
+		p.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline.C:
+			return nil, errAllEndpointsDown
+		case <-up:
+		}
+	}
+}
+
+// release returns ep to the pool, marking it down if its request failed
+// for any reason but cancellation.
+func (p *endpointPool) release(ctx context.Context, ep *endpoint, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ep.inflight--
+	if err != nil && ctx.Err() == nil && ep.healthy {
+		ep.healthy = false
+		p.logger.Warn("Marking Ollama endpoint down", "endpoint", ep.addr, "err", err)
+	}
+}
+
+// do runs fn against an endpoint, failing over to the others in turn.
+func (p *endpointPool) do(ctx context.Context, fn func(b llm.Backend) error) error {
+	var err error
+	for attempt := 0; attempt < len(p.eps); attempt++ {
+		if attempt > 0 {
+			p.mu.Lock()
+			p.failovers++
+			p.mu.Unlock()
+		}
+		ep, aerr := p.acquire(ctx)
+		if aerr != nil {
+			return aerr
+		}
+		err = fn(ep.backend)
+		p.release(ctx, ep, err)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// Failovers returns how many requests have been retried on another
+// endpoint after one failed.
+func (p *endpointPool) Failovers() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.failovers
+}
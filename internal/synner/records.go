@@ -0,0 +1,164 @@
+package synner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// datasetRecord is one conversation as it appears in a dataset file, so
+// commands that rewrite a JSONL file keep every field of its lines.
+type datasetRecord struct {
+	raw    json.RawMessage
+	conv   []ShareGPTTurn
+	source string
+	// chunk and chunks locate the source chunk within its book, when the
+	// line records it.
+	chunk, chunks int
+}
+
+// loadRecords reads every conversation of a ShareGPT .json or .jsonl file.
+func loadRecords(path string) ([]datasetRecord, error) {
+	if format, _ := outputFormat(path, ""); format == "json" {
+		d, err := loadDataset(path)
+		if err != nil {
+			return nil, err
+		}
+		recs := make([]datasetRecord, 0, len(d.Conversations))
+		for _, conv := range d.Conversations {
+			b, err := json.Marshal(conv)
+			if err != nil {
+				return nil, err
+			}
+			recs = append(recs, datasetRecord{raw: b, conv: conv})
+		}
+		return recs, nil
+	}
+	f, err := openDataset(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var recs []datasetRecord
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var l jsonlLine
+		if err := json.Unmarshal(line, &l); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		recs = append(recs, datasetRecord{
+			raw:    bytes.Clone(line),
+			conv:   l.Conversations,
+			source: l.Source,
+			chunk:  l.Chunk,
+			chunks: l.Chunks,
+		})
+	}
+	return recs, sc.Err()
+}
+
+// writeRecordsFile writes recs in the format of path's extension. JSONL
+// lines are written as read; a .json output keeps only the conversations.
+func writeRecordsFile(path string, recs []datasetRecord) error {
+	if format, _ := outputFormat(path, ""); format == "json" {
+		convs := make([][]ShareGPTTurn, len(recs))
+		for i, r := range recs {
+			convs[i] = r.conv
+		}
+		return writeFileAtomic(path, func(f io.Writer) error {
+			enc := json.NewEncoder(f)
+			enc.SetIndent("", "  ")
+			return enc.Encode(ShareGPTData{Conversations: convs})
+		})
+	}
+	return writeFileAtomic(path, func(f io.Writer) error {
+		w := bufio.NewWriter(f)
+		for _, r := range recs {
+			line, err := r.jsonlLine()
+			if err != nil {
+				return err
+			}
+			w.Write(line)
+			w.WriteByte('\n')
+		}
+		return w.Flush()
+	})
+}
+
+// jsonlLine returns r as a JSONL line: as read from a .jsonl file, or
+// wrapped in {"conversations": ...} if it came from a .json one.
+func (r datasetRecord) jsonlLine() (json.RawMessage, error) {
+	if len(r.raw) > 0 && r.raw[0] == '{' {
+		return r.raw, nil
+	}
+	return marshalRaw(jsonlLine{Conversations: r.conv})
+}
+
+// withConv returns r with its conversation replaced, keeping the other
+// fields of a JSONL line.
+func (r datasetRecord) withConv(conv []ShareGPTTurn) (datasetRecord, error) {
+	r, err := r.withField("conversations", conv)
+	if err != nil {
+		return r, err
+	}
+	r.conv = conv
+	return r, nil
+}
+
+// withField returns r with one field of its JSONL line set to v.
+func (r datasetRecord) withField(key string, v any) (datasetRecord, error) {
+	fields, err := r.fields()
+	if err != nil {
+		return r, err
+	}
+	if fields[key], err = marshalRaw(v); err != nil {
+		return r, err
+	}
+	if r.raw, err = marshalRaw(fields); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+func (r datasetRecord) fields() (map[string]json.RawMessage, error) {
+	line, err := r.jsonlLine()
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// scores returns the scores recorded in r's "scores" field by the score
+// command, or nil.
+func (r datasetRecord) scores() (map[string]float64, error) {
+	fields, err := r.fields()
+	if err != nil || fields["scores"] == nil {
+		return nil, err
+	}
+	var scores map[string]float64
+	err = json.Unmarshal(fields["scores"], &scores)
+	return scores, err
+}
+
+// marshalRaw encodes v like json.Marshal but leaves <, > and & alone, since
+// the text is prose, not HTML.
+func marshalRaw(v any) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
@@ -0,0 +1,109 @@
+package synner
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const registrySchema = `
+CREATE TABLE IF NOT EXISTS chunks (
+	hash         TEXT PRIMARY KEY,
+	source       TEXT NOT NULL,
+	model        TEXT NOT NULL,
+	prompt_hash  TEXT NOT NULL,
+	output       TEXT NOT NULL,
+	timestamp    TEXT NOT NULL
+);
+`
+
+// chunkRegistry records, across runs and output files, the hashes of chunks
+// that produced an accepted conversation, so rerunning against the same
+// corpus only processes new chunks and ones that failed or were rejected.
+// A nil *chunkRegistry records nothing and skips nothing.
+type chunkRegistry struct {
+	db *sql.DB
+}
+
+// openRegistry opens the registry named by a --registry URL. Only
+// sqlite:// is supported; an empty spec disables the registry.
+func openRegistry(spec string) (*chunkRegistry, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	path, ok := strings.CutPrefix(spec, "sqlite://")
+	if !ok || path == "" {
+		return nil, fmt.Errorf("unsupported registry %q (want sqlite://path)", spec)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open registry: %w", err)
+	}
+	// SQLite allows a single writer, and generate records from one
+	// goroutine; other runs sharing the file wait for the lock.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`PRAGMA busy_timeout = 10000`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open registry: %w", err)
+	}
+	if _, err := db.Exec(registrySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create registry schema: %w", err)
+	}
+	return &chunkRegistry{db: db}, nil
+}
+
+func (r *chunkRegistry) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.db.Close()
+}
+
+// Done reports whether the chunk with this hash already produced an
+// accepted conversation.
+func (r *chunkRegistry) Done(ctx context.Context, hash string) (bool, error) {
+	if r == nil {
+		return false, nil
+	}
+	var one int
+	err := r.db.QueryRowContext(ctx, `SELECT 1 FROM chunks WHERE hash = ?`, hash).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to query registry: %w", err)
+	}
+	return true, nil
+}
+
+// Accept records that the chunk in meta produced a conversation written to
+// output.
+func (r *chunkRegistry) Accept(ctx context.Context, meta convMeta, output string) error {
+	if r == nil || meta.ChunkHash == "" {
+		return nil
+	}
+	ts := meta.GeneratedAt
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	_, err := r.db.ExecContext(ctx, `
+INSERT OR REPLACE INTO chunks (hash, source, model, prompt_hash, output, timestamp)
+VALUES (?, ?, ?, ?, ?, ?)`,
+		meta.ChunkHash, meta.Source, meta.Model, meta.PromptHash, output,
+		ts.UTC().Format("2006-01-02T15:04:05.000Z"))
+	if err != nil {
+		return fmt.Errorf("failed to record chunk in registry: %w", err)
+	}
+	return nil
+}
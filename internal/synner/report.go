@@ -0,0 +1,189 @@
+package synner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"github.com/nathanleclaire/gpumon/pkg/collector"
+)
+
+// genUsage adds up what the model was asked for and gave back over one or
+// more generations, as Ollama reports it.
+type genUsage struct {
+	Generations  int
+	PromptTokens int
+	OutputTokens int
+	// EvalTime is the time spent producing output tokens, so
+	// OutputTokens/EvalTime is the model's own speed.
+	EvalTime time.Duration
+}
+
+func (u *genUsage) add(m llm.Metrics) {
+	u.Generations++
+	u.PromptTokens += m.PromptEvalCount
+	u.OutputTokens += m.EvalCount
+	u.EvalTime += m.EvalDuration
+}
+
+func (u *genUsage) merge(o genUsage) {
+	u.Generations += o.Generations
+	u.PromptTokens += o.PromptTokens
+	u.OutputTokens += o.OutputTokens
+	u.EvalTime += o.EvalTime
+}
+
+// pricing is what a backend charges, in dollars per million tokens.
+type pricing struct {
+	In  float64
+	Out float64
+}
+
+// runReport is generate's end-of-run summary, for budgeting dataset runs.
+// Chunk counts cover this run only, not conversations resumed from a
+// checkpoint.
+type runReport struct {
+	Output   string    `json:"output"`
+	Model    string    `json:"model"`
+	Status   string    `json:"status"`
+	Workers  int       `json:"workers"`
+	Started  time.Time `json:"started"`
+	WallTime float64   `json:"wall_seconds"`
+
+	// ChunksAttempted counts chunks sent to the model; each ends up
+	// accepted, failed, rejected, dropped as a duplicate or, once
+	// --max-examples is met, unused.
+	ChunksAttempted   int `json:"chunks_attempted"`
+	Accepted          int `json:"accepted"`
+	Failed            int `json:"failed"`
+	Rejected          int `json:"rejected"`
+	Duplicates        int `json:"duplicates_dropped"`
+	Resumed           int `json:"resumed"`
+	SkippedRegistered int `json:"skipped_registered"`
+	// The retries: corrective re-prompts for malformed responses, and
+	// requests failed over to another endpoint.
+	Corrections int `json:"corrections"`
+	Failovers   int `json:"failovers"`
+
+	Generations  int `json:"generations"`
+	PromptTokens int `json:"prompt_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	// DatasetTokens counts the accepted conversations with --tokenizer.
+	DatasetTokens int `json:"dataset_tokens"`
+	// TokensPerSec is output tokens over wall-clock time, all workers
+	// together; EvalTokensPerSec is over the time the model spent
+	// generating them, summed across workers.
+	TokensPerSec     float64 `json:"tokens_per_second"`
+	EvalTokensPerSec float64 `json:"eval_tokens_per_second"`
+	// Cost is only estimated when a price is given.
+	Cost *float64 `json:"estimated_cost_usd,omitempty"`
+	// GPU is only sampled with --gpu-sample-interval.
+	GPU *gpuReport `json:"gpu,omitempty"`
+}
+
+// gpuReport is the load on this machine's GPUs over the run, to tell how
+// near the workers came to saturating them.
+type gpuReport struct {
+	Samples         int     `json:"samples"`
+	UtilAvgPercent  float64 `json:"util_avg_percent"`
+	UtilPeakPercent float64 `json:"util_peak_percent"`
+	MemoryAvgMiB    float64 `json:"memory_avg_mib"`
+	MemoryPeakMiB   float64 `json:"memory_peak_mib"`
+	MemoryTotalMiB  float64 `json:"memory_total_mib,omitempty"`
+	PowerAvgWatts   float64 `json:"power_avg_watts,omitempty"`
+	PowerPeakWatts  float64 `json:"power_peak_watts,omitempty"`
+	// EnergyWh is the average power over the run's wall-clock time.
+	EnergyWh float64 `json:"energy_wh,omitempty"`
+}
+
+func newGPUReport(s collector.Stats) *gpuReport {
+	const mib = 1 << 20
+	return &gpuReport{
+		Samples:         s.Samples,
+		UtilAvgPercent:  s.AvgUtilPercent,
+		UtilPeakPercent: s.PeakUtilPercent,
+		MemoryAvgMiB:    s.AvgMemoryBytes / mib,
+		MemoryPeakMiB:   float64(s.PeakMemoryBytes) / mib,
+		MemoryTotalMiB:  float64(s.MemoryTotalBytes) / mib,
+		PowerAvgWatts:   s.AvgPowerWatts,
+		PowerPeakWatts:  s.PeakPowerWatts,
+	}
+}
+
+// Thresholds at which the report suggests changing --parallel.
+const (
+	gpuMemoryFull = 0.95
+	gpuUnderused  = 70
+)
+
+// finish fills in the figures derived from the counts.
+func (r *runReport) finish(usage genUsage, price pricing) {
+	r.WallTime = time.Since(r.Started).Seconds()
+	r.Generations = usage.Generations
+	r.PromptTokens = usage.PromptTokens
+	r.OutputTokens = usage.OutputTokens
+	if r.WallTime > 0 {
+		r.TokensPerSec = float64(usage.OutputTokens) / r.WallTime
+	}
+	if usage.EvalTime > 0 {
+		r.EvalTokensPerSec = float64(usage.OutputTokens) / usage.EvalTime.Seconds()
+	}
+	if price.In > 0 || price.Out > 0 {
+		cost := (float64(usage.PromptTokens)*price.In + float64(usage.OutputTokens)*price.Out) / 1e6
+		r.Cost = &cost
+	}
+	if r.GPU != nil {
+		r.GPU.EnergyWh = r.GPU.PowerAvgWatts * r.WallTime / 3600
+	}
+}
+
+func printRunReport(out io.Writer, r runReport) {
+	fmt.Fprintf(out, "\nrun %s: %s with %s, %d workers, %s\n", r.Status, r.Output, r.Model, r.Workers,
+		time.Duration(r.WallTime*float64(time.Second)).Round(time.Second))
+	fmt.Fprintf(out, "  chunks: %d attempted, %d accepted, %d failed, %d rejected, %d duplicates dropped\n",
+		r.ChunksAttempted, r.Accepted, r.Failed, r.Rejected, r.Duplicates)
+	if r.Resumed > 0 || r.SkippedRegistered > 0 {
+		fmt.Fprintf(out, "  earlier runs: %d conversations resumed, %d chunks skipped as registered\n",
+			r.Resumed, r.SkippedRegistered)
+	}
+	fmt.Fprintf(out, "  retries: %d corrections, %d failovers\n", r.Corrections, r.Failovers)
+	fmt.Fprintf(out, "  tokens: %d in, %d out over %d generations; %d in the dataset\n",
+		r.PromptTokens, r.OutputTokens, r.Generations, r.DatasetTokens)
+	fmt.Fprintf(out, "  throughput: %.1f tokens/s overall, %.1f tokens/s per generation\n",
+		r.TokensPerSec, r.EvalTokensPerSec)
+	if r.Cost != nil {
+		fmt.Fprintf(out, "  estimated cost: $%.4f", *r.Cost)
+		if r.Accepted > 0 {
+			fmt.Fprintf(out, " ($%.4f per accepted conversation)", *r.Cost/float64(r.Accepted))
+		}
+		fmt.Fprintln(out)
+	}
+	if g := r.GPU; g != nil {
+		fmt.Fprintf(out, "  gpu: %.0f%% average, %.0f%% peak utilization; %.0f MiB peak memory",
+			g.UtilAvgPercent, g.UtilPeakPercent, g.MemoryPeakMiB)
+		if g.MemoryTotalMiB > 0 {
+			fmt.Fprintf(out, " of %.0f", g.MemoryTotalMiB)
+		}
+		if g.PowerAvgWatts > 0 {
+			fmt.Fprintf(out, "; %.0f W average, %.0f W peak, %.1f Wh", g.PowerAvgWatts, g.PowerPeakWatts, g.EnergyWh)
+		}
+		fmt.Fprintln(out)
+		switch {
+		case g.MemoryTotalMiB > 0 && g.MemoryPeakMiB >= gpuMemoryFull*g.MemoryTotalMiB:
+			fmt.Fprintln(out, "  note: GPU memory was nearly full; a higher --parallel risks spilling the model out of VRAM")
+		case g.UtilAvgPercent < gpuUnderused:
+			fmt.Fprintln(out, "  note: the GPUs were often idle; a higher --parallel may raise throughput")
+		}
+	}
+}
+
+// writeRunReport writes r as JSON to path.
+func writeRunReport(path string, r runReport) error {
+	return writeFileAtomic(path, func(f io.Writer) error {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	})
+}
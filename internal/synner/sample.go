@@ -0,0 +1,149 @@
+package synner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"slices"
+)
+
+// sampleOptions control which chunks of each book are generated from and
+// how books are interleaved, so a dataset cut off by --max-examples isn't
+// dominated by whichever long books were shuffled to the front.
+type sampleOptions struct {
+	// Order is sequential (every chunk of a book before the next book),
+	// round-robin (one chunk from each of Window open books in turn) or
+	// weighted (a random open book, in proportion to its chunks left).
+	Order  string
+	Window int
+	// MaxChunksPerBook, if positive, caps the chunks taken from a book,
+	// picked at random.
+	MaxChunksPerBook int
+}
+
+func (o sampleOptions) validate() error {
+	switch o.Order {
+	case "sequential", "round-robin", "weighted":
+	default:
+		return fmt.Errorf("unknown --sample-order %q (want sequential, round-robin or weighted)", o.Order)
+	}
+	if o.Window < 1 {
+		return fmt.Errorf("--sample-window must be at least 1, got %d", o.Window)
+	}
+	if o.MaxChunksPerBook < 0 {
+		return fmt.Errorf("--max-chunks-per-book must not be negative, got %d", o.MaxChunksPerBook)
+	}
+	return nil
+}
+
+// chunkSource is where generate gets its chunks: a chunkSampler over the
+// corpus, or a failureSource for backfill.
+type chunkSource interface {
+	// Next returns the next chunk, or io.EOF once there are no more.
+	Next() (sampledChunk, error)
+}
+
+// sampledChunk is a chunk picked by a chunkSampler. Index is its 1-based
+// position among the Total chunks of its book.
+type sampledChunk struct {
+	Text  string
+	Row   corpusRow
+	Index int
+	Total int
+	// Persona and Chunking are the persona a backfilled chunk was first
+	// prompted with and how it was cut from its book.
+	Persona  *persona
+	Chunking *chunkOptions
+}
+
+// openBook is a book being sampled from; picks are the indexes of its
+// chunks still to be returned, in book order.
+type openBook struct {
+	row    corpusRow
+	chunks []string
+	picks  []int
+}
+
+// chunkSampler reads books from rows, splits them into chunks and returns
+// the chunks in the order sampleOptions asks for, holding at most Window
+// books in memory.
+type chunkSampler struct {
+	opts   sampleOptions
+	rows   *shuffleBuffer
+	ch     *paragraphChunker
+	rng    *rand.Rand
+	open   []*openBook
+	turn   int
+	eof    bool
+	onBook func(row corpusRow, chunks int)
+}
+
+func newChunkSampler(opts sampleOptions, rows *shuffleBuffer, ch *paragraphChunker, rng *rand.Rand, onBook func(corpusRow, int)) *chunkSampler {
+	return &chunkSampler{opts: opts, rows: rows, ch: ch, rng: rng, onBook: onBook}
+}
+
+// Next returns the next chunk, or io.EOF once every book is exhausted.
+func (s *chunkSampler) Next() (sampledChunk, error) {
+	window := s.opts.Window
+	if s.opts.Order == "sequential" {
+		window = 1
+	}
+	for !s.eof && len(s.open) < window {
+		row, err := s.rows.Next()
+		if errors.Is(err, io.EOF) {
+			s.eof = true
+			break
+		}
+		if err != nil {
+			return sampledChunk{}, err
+		}
+		b := s.openBook(row)
+		s.onBook(row, len(b.picks))
+		if len(b.picks) > 0 {
+			s.open = append(s.open, b)
+		}
+	}
+	if len(s.open) == 0 {
+		return sampledChunk{}, io.EOF
+	}
+
+	i := 0
+	switch s.opts.Order {
+	case "round-robin":
+		i = s.turn % len(s.open)
+	case "weighted":
+		left := 0
+		for _, b := range s.open {
+			left += len(b.picks)
+		}
+		n := s.rng.Intn(left)
+		for n >= len(s.open[i].picks) {
+			n -= len(s.open[i].picks)
+			i++
+		}
+	}
+	b := s.open[i]
+	c := b.picks[0]
+	b.picks = b.picks[1:]
+	s.turn = i + 1
+	if len(b.picks) == 0 {
+		// The book after it moves into its place and is next in turn.
+		s.open = slices.Delete(s.open, i, i+1)
+		s.turn = i
+	}
+	return sampledChunk{Text: b.chunks[c], Row: b.row, Index: c + 1, Total: len(b.chunks)}, nil
+}
+
+func (s *chunkSampler) openBook(row corpusRow) *openBook {
+	b := &openBook{row: row, chunks: s.ch.Split(row.Text)}
+	b.picks = make([]int, len(b.chunks))
+	for i := range b.picks {
+		b.picks[i] = i
+	}
+	if m := s.opts.MaxChunksPerBook; m > 0 && len(b.picks) > m {
+		b.picks = s.rng.Perm(len(b.chunks))[:m]
+		slices.Sort(b.picks)
+	}
+	return b
+}
@@ -0,0 +1,404 @@
+package synner
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/internal/config"
+	"github.com/nathanleclaire/gpumon/internal/llm"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// scorer rates a conversation; higher is better.
+type scorer interface {
+	Score(ctx context.Context, conv []ShareGPTTurn) (float64, error)
+}
+
+// defaultRubric is the rubric prompt used by --judge-model and by score
+// without --rubric. Rubrics are templates; {{.Conversation}} is the
+// conversation as "role: text" paragraphs.
+const defaultRubric = `Rate the quality of this roleplay conversation between a user (human)
+and a narrator (gpt) as training data for a chatbot, from 1 (unusable) to 10
+(excellent). Consider coherence, consistent character voices, how well the
+narrator responds to the user, and the quality of the prose.
+
+<conversation>
+{{.Conversation}}</conversation>
+
+Answer with one line of the form "Score: N".`
+
+// llmScorer prompts an Ollama model with a rubric and reads the "Score: N"
+// line of its answer.
+type llmScorer struct {
+	pool   *endpointPool
+	model  string
+	rubric *template.Template
+	seed   int64
+}
+
+// newLLMScorer returns a scorer for model; a nil rubric is defaultRubric.
+func newLLMScorer(pool *endpointPool, model string, rubric *template.Template, seed int64) *llmScorer {
+	if rubric == nil {
+		rubric = template.Must(parseRubric(defaultRubric))
+	}
+	return &llmScorer{pool: pool, model: model, rubric: rubric, seed: seed}
+}
+
+func parseRubric(text string) (*template.Template, error) {
+	t, err := template.New("rubric").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rubric template: %w", err)
+	}
+	return t, nil
+}
+
+var judgeScore = regexp.MustCompile(`(?i)score\s*[:=]?\s*(\d+(?:\.\d+)?)`)
+
+func (s *llmScorer) Score(ctx context.Context, conv []ShareGPTTurn) (float64, error) {
+	var sb strings.Builder
+	for _, t := range conv {
+		fmt.Fprintf(&sb, "%s: %s\n\n", t.From, t.Value)
+	}
+	var prompt strings.Builder
+	if err := s.rubric.Execute(&prompt, struct{ Conversation string }{sb.String()}); err != nil {
+		return 0, fmt.Errorf("failed to render rubric: %w", err)
+	}
+	var resp string
+	err := s.pool.do(ctx, func(b llm.Backend) error {
+		var err error
+		resp, _, err = llm.Collect(ctx, b, llm.Request{
+			Model:   s.model,
+			Prompt:  prompt.String(),
+			Options: map[string]interface{}{"temperature": 0, "seed": s.seed},
+		})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	m := judgeScore.FindStringSubmatch(resp)
+	if m == nil {
+		return 0, errors.New("no score in judge response")
+	}
+	return strconv.ParseFloat(m[1], 64)
+}
+
+// rewardScorer posts {"conversations": [...]} to a reward model server and
+// reads {"score": x} back.
+type rewardScorer struct {
+	url    string
+	client *http.Client
+}
+
+func (s *rewardScorer) Score(ctx context.Context, conv []ShareGPTTurn) (float64, error) {
+	body, err := json.Marshal(jsonlLine{Conversations: conv})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("reward model: %s", resp.Status)
+	}
+	var out struct {
+		Score *float64 `json:"score"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return 0, fmt.Errorf("reward model: %w", err)
+	}
+	if out.Score == nil {
+		return 0, errors.New("reward model: no score in response")
+	}
+	return *out.Score, nil
+}
+
+// scoreOptions are the score command's settings.
+type scoreOptions struct {
+	Scorer      string
+	Rubric      string
+	Name        string
+	OllamaAddrs []string
+	Parallel    int
+	Seed        int64
+	Out         string
+	Rescore     bool
+	// MinScore applies only if HasMinScore; BestOf, if positive, keeps the
+	// top-scoring conversations of each source book.
+	MinScore    float64
+	HasMinScore bool
+	BestOf      int
+}
+
+func newScoreCmd(logger *slog.Logger) *cobra.Command {
+	var opts scoreOptions
+	cmd := &cobra.Command{
+		Use:   "score [in]",
+		Short: "Score conversations with a rubric-prompted model or a reward model",
+		Long: `Score every conversation of a dataset and store the scores under "scores" in
+its JSONL lines, then optionally keep only those above --min-score or the
+--best-of highest-scoring conversations of each source book.
+
+--scorer is an Ollama model, prompted with --rubric, or the http(s) URL of a
+reward model server, which is sent {"conversations": [...]} and answers
+{"score": x}. Conversations that already have a score under --name are not
+scored again unless --rescore is given, so an interrupted run can be picked
+up by scoring its output.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.HasMinScore = config.IsSet(cmd.Flags(), "min-score")
+			return runScore(cmd.Context(), logger, args[0], opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.Scorer, "scorer",
+		"", "Ollama model to prompt with --rubric, or http(s):// URL of a reward model server (required)")
+	cmd.Flags().StringVar(&opts.Rubric, "rubric",
+		"", "Rubric prompt template file; {{.Conversation}} is the conversation, and the answer must hold \"Score: N\" (default: the --judge-model rubric)")
+	cmd.Flags().StringVar(&opts.Name, "name",
+		"", "Key the scores are stored under (default: the model name, or reward for a URL)")
+	cmd.Flags().StringSliceVar(&opts.OllamaAddrs, "ollama-addr",
+		[]string{"http://localhost:11434"}, "Ollama server address; repeat or comma-separate to spread scoring across several")
+	cmd.Flags().IntVar(&opts.Parallel, "parallel",
+		1, "Conversations to score at once on each Ollama server, or against the reward model")
+	cmd.Flags().Int64Var(&opts.Seed, "seed",
+		0, "Seed for the scoring model")
+	cmd.Flags().StringVar(&opts.Out, "out",
+		"", "Where to write the scored dataset (default: <in>.scored.<ext>)")
+	cmd.Flags().BoolVar(&opts.Rescore, "rescore",
+		false, "Score conversations again even if they already have a score under --name")
+	cmd.Flags().Float64Var(&opts.MinScore, "min-score",
+		0, "Keep only conversations scoring at least this")
+	cmd.Flags().IntVar(&opts.BestOf, "best-of",
+		0, "Keep only this many of the highest-scoring conversations from each source book (0 for all)")
+	cmd.MarkFlagRequired("scorer")
+	return cmd
+}
+
+func runScore(ctx context.Context, logger *slog.Logger, in string, opts scoreOptions) error {
+	ext := datasetExt(in)
+	if opts.Out == "" {
+		opts.Out = strings.TrimSuffix(in, ext) + ".scored" + ext
+	}
+	if format, _ := outputFormat(opts.Out, ""); format == "json" {
+		logger.Warn("JSON output keeps only the conversations; use a .jsonl --out to keep the scores", "out", opts.Out)
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, span := otel.Tracer(ServiceName).Start(ctx, "command_score", trace.WithAttributes(
+		attribute.String("scorer", opts.Scorer),
+		attribute.String("input", in),
+	))
+	defer span.End()
+
+	var sc scorer
+	workers := max(opts.Parallel, 1)
+	if strings.HasPrefix(opts.Scorer, "http://") || strings.HasPrefix(opts.Scorer, "https://") {
+		sc = &rewardScorer{url: opts.Scorer, client: &http.Client{Timeout: 5 * time.Minute}}
+		if opts.Name == "" {
+			opts.Name = "reward"
+		}
+	} else {
+		rubric, err := parseRubric(defaultRubric)
+		if opts.Rubric != "" {
+			b, rerr := os.ReadFile(opts.Rubric)
+			if rerr != nil {
+				return rerr
+			}
+			rubric, err = parseRubric(string(b))
+		}
+		if err != nil {
+			return err
+		}
+		pool, err := newEndpointPool(ctx, opts.OllamaAddrs, logger)
+		if err != nil {
+			return err
+		}
+		sc = newLLMScorer(pool, opts.Scorer, rubric, opts.Seed)
+		workers *= pool.Len()
+		if opts.Name == "" {
+			opts.Name = opts.Scorer
+		}
+	}
+
+	recs, err := loadRecords(in)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", in, err)
+	}
+	scores := make([]map[string]float64, len(recs))
+	var todo []int
+	for i, r := range recs {
+		if scores[i], err = r.scores(); err != nil {
+			return fmt.Errorf("failed to read scores of conversation %d: %w", i, err)
+		}
+		if _, ok := scores[i][opts.Name]; opts.Rescore || !ok {
+			todo = append(todo, i)
+		}
+	}
+	logger.Info("Scoring conversations",
+		"scorer", opts.Scorer,
+		"name", opts.Name,
+		"toScore", len(todo),
+		"alreadyScored", len(recs)-len(todo))
+
+	// Workers score; this goroutine alone records the results.
+	type result struct {
+		i     int
+		score float64
+		err   error
+	}
+	jobs := make(chan int)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				score, err := sc.Score(ctx, recs[i].conv)
+				results <- result{i, score, err}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, i := range todo {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	scored, failed := 0, 0
+	for r := range results {
+		if r.err != nil {
+			if ctx.Err() == nil {
+				failed++
+				logger.Error("Scoring failed", "index", r.i, "err", r.err)
+			}
+			continue
+		}
+		if scores[r.i] == nil {
+			scores[r.i] = map[string]float64{}
+		}
+		scores[r.i][opts.Name] = r.score
+		scored++
+		logger.Info("Scored conversation",
+			"index", r.i,
+			"score", r.score,
+			"done", scored+failed,
+			"of", len(todo))
+	}
+	if ctx.Err() != nil {
+		logger.Warn("Interrupted; writing the scores so far. Score the output again to finish", "out", opts.Out)
+	}
+
+	keep := make([]bool, len(recs))
+	for i := range recs {
+		s, ok := scores[i][opts.Name]
+		keep[i] = !opts.HasMinScore || ok && s >= opts.MinScore
+	}
+	if opts.BestOf > 0 {
+		bestOf(recs, scores, opts.Name, opts.BestOf, keep)
+	}
+	var out []datasetRecord
+	for i, r := range recs {
+		if !keep[i] {
+			continue
+		}
+		if scores[i] != nil {
+			if r, err = r.withField("scores", scores[i]); err != nil {
+				return err
+			}
+		}
+		out = append(out, r)
+	}
+	if err := writeRecordsFile(opts.Out, out); err != nil {
+		return fmt.Errorf("failed to write %s: %w", opts.Out, err)
+	}
+	logger.Info("Wrote scored dataset",
+		"path", opts.Out,
+		"scored", scored,
+		"failed", failed,
+		"kept", len(out),
+		"dropped", len(recs)-len(out))
+	return nil
+}
+
+// DatasetScores reads the dataset at path, as written by generate or
+// score, and returns how many conversations it holds and the scores stored
+// with them under each name.
+func DatasetScores(path string) (int, map[string][]float64, error) {
+	recs, err := loadRecords(path)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	byName := map[string][]float64{}
+	for i, r := range recs {
+		scores, err := r.scores()
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to read scores of conversation %d: %w", i, err)
+		}
+		for name, v := range scores {
+			byName[name] = append(byName[name], v)
+		}
+	}
+	return len(recs), byName, nil
+}
+
+// bestOf clears keep for all but the n highest-scoring conversations of
+// each source; unscored conversations rank last.
+func bestOf(recs []datasetRecord, scores []map[string]float64, name string, n int, keep []bool) {
+	bySource := map[string][]int{}
+	for i, r := range recs {
+		if keep[i] {
+			bySource[r.source] = append(bySource[r.source], i)
+		}
+	}
+	for _, idx := range bySource {
+		slices.SortStableFunc(idx, func(a, b int) int {
+			sa, oka := scores[a][name]
+			sb, okb := scores[b][name]
+			if oka != okb {
+				if oka {
+					return -1
+				}
+				return 1
+			}
+			return cmp.Compare(sb, sa)
+		})
+		for _, i := range idx[min(n, len(idx)):] {
+			keep[i] = false
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package synner
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+// serveOptions are the serve command's settings.
+type serveOptions struct {
+	Addr     string
+	PageSize int
+}
+
+func newServeCmd(logger *slog.Logger) *cobra.Command {
+	var opts serveOptions
+	cmd := &cobra.Command{
+		Use:   "serve [in]",
+		Short: "Browse and search a dataset's conversations in a local web UI",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServe(logger, args[0], opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.Addr, "addr",
+		"localhost:8090", "Address to serve the UI on; use :8090 to share it on the network")
+	cmd.Flags().IntVar(&opts.PageSize, "page-size",
+		20, "Conversations per page")
+	return cmd
+}
+
+var serveTemplates = template.Must(template.New("serve").Funcs(template.FuncMap{
+	"add":  func(a, b int) int { return a + b },
+	"snip": func(s string) string { return preview(s, 160) },
+}).Parse(`
+{{define "head"}}<!doctype html>
+<html><head><meta charset="utf-8"><title>synner – {{.}}</title>
+<style>
+body{font-family:system-ui,sans-serif;margin:2em auto;max-width:60em;padding:0 1em;color:#222}
+a{color:#2857a4}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:.3em .6em;text-align:left;vertical-align:top}
+th{background:#f4f4f4}form{margin:1em 0}input[type=search]{width:24em;padding:.3em}
+.list .item{border-bottom:1px solid #eee;padding:.6em 0}.muted{color:#777;font-size:.9em}
+.turn{display:flex;margin:.6em 0}.turn.human{justify-content:flex-end}
+.bubble{max-width:75%;padding:.6em .9em;border-radius:1em;white-space:pre-wrap;line-height:1.4}
+.human .bubble{background:#2857a4;color:#fff;border-bottom-right-radius:.2em}
+.gpt .bubble{background:#f0f0f0;border-bottom-left-radius:.2em}
+.system .bubble{background:#fff7d6;font-style:italic}
+.role{font-size:.75em;color:#777;margin:0 .4em;align-self:flex-end}
+</style></head><body><p><a href="/">{{.}}</a></p>{{end}}
+
+{{define "index"}}{{template "head" .File}}
+<form action="/" method="get"><input type="search" name="q" value="{{.Query}}" placeholder="Search turns and sources">
+<button>Search</button>{{if .Query}} <a href="/">clear</a>{{end}}</form>
+<p class="muted">{{if .Query}}{{.Matches}} of {{end}}{{.Total}} conversations{{if .Pages}} · page {{.Page}} of {{.Pages}}{{end}}</p>
+<div class="list">{{range .Items}}<div class="item"><a href="/conv/{{.Index}}">#{{.Index}}</a>
+<span class="muted">{{.Turns}} turns{{with .Source}} · {{.}}{{end}}</span><br>{{snip .Preview}}</div>
+{{else}}<p>No conversations{{if $.Query}} match “{{$.Query}}”{{end}}.</p>{{end}}</div>
+<p>{{if gt .Page 1}}<a href="{{.PageURL (add .Page -1)}}">← previous</a>{{end}}
+{{if lt .Page .Pages}} <a href="{{.PageURL (add .Page 1)}}">next →</a>{{end}}</p>
+</body></html>{{end}}
+
+{{define "conv"}}{{template "head" .File}}
+<p>{{if gt .Index 0}}<a href="/conv/{{add .Index -1}}">← #{{add .Index -1}}</a>{{end}}
+{{if lt (add .Index 1) .Total}} <a href="/conv/{{add .Index 1}}">#{{add .Index 1}} →</a>{{end}}</p>
+<h1>Conversation #{{.Index}}</h1>
+<table>{{range .Meta}}<tr><th>{{.Key}}</th><td>{{.Value}}</td></tr>{{end}}</table>
+{{range .Turns}}<div class="turn {{.From}}">{{if ne .From "human"}}<span class="role">{{.From}}</span>{{end}}
+<div class="bubble">{{.Value}}</div>{{if eq .From "human"}}<span class="role">{{.From}}</span>{{end}}</div>{{end}}
+</body></html>{{end}}
+`))
+
+type serveServer struct {
+	file     string
+	recs     []datasetRecord
+	pageSize int
+	logger   *slog.Logger
+}
+
+func runServe(logger *slog.Logger, in string, opts serveOptions) error {
+	recs, err := loadRecords(in)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", in, err)
+	}
+	s := &serveServer{file: in, recs: recs, pageSize: max(opts.PageSize, 1), logger: logger}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.index)
+	mux.HandleFunc("GET /conv/{i}", s.conv)
+	logger.Info("Serving dataset UI",
+		"addr", "http://"+opts.Addr,
+		"conversations", len(recs))
+	return http.ListenAndServe(opts.Addr, mux)
+}
+
+func (s *serveServer) render(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := serveTemplates.ExecuteTemplate(w, name, data); err != nil {
+		s.logger.Error("Render failed", "template", name, "err", err)
+	}
+}
+
+type serveItem struct {
+	Index   int
+	Turns   int
+	Source  string
+	Preview string
+}
+
+type serveIndex struct {
+	File    string
+	Query   string
+	Total   int
+	Matches int
+	Page    int
+	Pages   int
+	Items   []serveItem
+}
+
+func (p serveIndex) PageURL(page int) string {
+	v := url.Values{"page": {strconv.Itoa(page)}}
+	if p.Query != "" {
+		v.Set("q", p.Query)
+	}
+	return "/?" + v.Encode()
+}
+
+func (s *serveServer) index(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	var hits []int
+	for i, rec := range s.recs {
+		if q == "" || recordMatches(rec, q) {
+			hits = append(hits, i)
+		}
+	}
+	pages := (len(hits) + s.pageSize - 1) / s.pageSize
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	page = max(min(page, pages), 1)
+	data := serveIndex{File: s.file, Query: q, Total: len(s.recs), Matches: len(hits), Page: page, Pages: pages}
+	for _, i := range hits[min((page-1)*s.pageSize, len(hits)):min(page*s.pageSize, len(hits))] {
+		rec := s.recs[i]
+		data.Items = append(data.Items, serveItem{
+			Index:   i,
+			Turns:   len(rec.conv),
+			Source:  rec.source,
+			Preview: firstTurn(rec.conv, q),
+		})
+	}
+	s.render(w, "index", data)
+}
+
+// recordMatches reports whether q appears, ignoring case, in any turn or
+// the source of rec.
+func recordMatches(rec datasetRecord, q string) bool {
+	q = strings.ToLower(q)
+	if strings.Contains(strings.ToLower(rec.source), q) {
+		return true
+	}
+	for _, t := range rec.conv {
+		if strings.Contains(strings.ToLower(t.Value), q) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstTurn is the text listed for a conversation: the first turn that
+// matches q, from the match on, or the first turn.
+func firstTurn(conv []ShareGPTTurn, q string) string {
+	if q != "" {
+		lq := strings.ToLower(q)
+		for _, t := range conv {
+			// Lowercasing can change byte lengths outside ASCII, so only
+			// cut at the match when the offsets line up.
+			lv := strings.ToLower(t.Value)
+			if i := strings.Index(lv, lq); i >= 0 {
+				if len(lv) == len(t.Value) && i > 40 {
+					j := i - 40
+					for !utf8.RuneStart(t.Value[j]) {
+						j++
+					}
+					return "…" + t.Value[j:]
+				}
+				return t.Value
+			}
+		}
+	}
+	if len(conv) == 0 {
+		return ""
+	}
+	return conv[0].Value
+}
+
+type serveMeta struct {
+	Key, Value string
+}
+
+type serveConv struct {
+	File  string
+	Index int
+	Total int
+	Meta  []serveMeta
+	Turns []ShareGPTTurn
+}
+
+func (s *serveServer) conv(w http.ResponseWriter, r *http.Request) {
+	i, err := strconv.Atoi(r.PathValue("i"))
+	if err != nil || i < 0 || i >= len(s.recs) {
+		http.NotFound(w, r)
+		return
+	}
+	rec := s.recs[i]
+	chars := 0
+	for _, t := range rec.conv {
+		chars += len([]rune(t.Value))
+	}
+	meta := []serveMeta{
+		{"turns", strconv.Itoa(len(rec.conv))},
+		{"characters", strconv.Itoa(chars)},
+		{"estimated tokens", strconv.Itoa(estimateTokens(rec.conv))},
+	}
+	// Everything else a JSONL line carries, such as source and origin.
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(rec.raw, &fields) == nil {
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			if k != "conversations" {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v := string(fields[k])
+			var str string
+			if json.Unmarshal(fields[k], &str) == nil {
+				v = str
+			}
+			meta = append(meta, serveMeta{k, v})
+		}
+	}
+	s.render(w, "conv", serveConv{File: s.file, Index: i, Total: len(s.recs), Meta: meta, Turns: rec.conv})
+}
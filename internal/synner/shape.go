@@ -0,0 +1,141 @@
+package synner
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// shapeOptions describe the conversations the prompt asks for: how many
+// human/gpt exchanges, and how long each side's turns are. With Enforce set,
+// conversations outside the shape are rejected by the filter chain.
+type shapeOptions struct {
+	Exchanges      intRange
+	GPTParagraphs  intRange
+	HumanSentences intRange
+	Enforce        bool
+}
+
+// intRange is an inclusive range of counts, written "3-5", or "5" for
+// exactly five. It is both a flag value and a YAML scalar.
+type intRange struct {
+	Min, Max int
+}
+
+func (r *intRange) Set(s string) error {
+	a, b, found := strings.Cut(strings.TrimSpace(s), "-")
+	lo, err := strconv.Atoi(strings.TrimSpace(a))
+	if err != nil {
+		return fmt.Errorf("invalid range %q: want N or MIN-MAX", s)
+	}
+	hi := lo
+	if found {
+		if hi, err = strconv.Atoi(strings.TrimSpace(b)); err != nil {
+			return fmt.Errorf("invalid range %q: want N or MIN-MAX", s)
+		}
+	}
+	if lo < 1 || hi < lo {
+		return fmt.Errorf("invalid range %q: want 1 <= MIN <= MAX", s)
+	}
+	r.Min, r.Max = lo, hi
+	return nil
+}
+
+func (r *intRange) String() string {
+	if r.Min == r.Max {
+		return strconv.Itoa(r.Min)
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+func (*intRange) Type() string { return "range" }
+
+func (r *intRange) UnmarshalYAML(n *yaml.Node) error {
+	return r.Set(n.Value)
+}
+
+// IsSet reports whether the range was given; the zero range is not valid.
+func (r intRange) IsSet() bool { return r.Max > 0 }
+
+func (r intRange) Contains(n int) bool { return n >= r.Min && n <= r.Max }
+
+var numberWords = []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "ten"}
+
+// Prose renders the range for a prompt: "five", "one or two", "three to
+// five".
+func (r intRange) Prose() string {
+	word := func(n int) string {
+		if n < len(numberWords) {
+			return numberWords[n]
+		}
+		return strconv.Itoa(n)
+	}
+	switch r.Max - r.Min {
+	case 0:
+		return word(r.Min)
+	case 1:
+		return word(r.Min) + " or " + word(r.Max)
+	}
+	return word(r.Min) + " to " + word(r.Max)
+}
+
+// shapeFilter rejects conversations outside the requested shape.
+type shapeFilter shapeOptions
+
+func (shapeFilter) Name() string { return "shape" }
+
+func (f shapeFilter) Check(_ context.Context, conv []ShareGPTTurn) (string, error) {
+	if n := (len(conv) + 1) / 2; !f.Exchanges.Contains(n) {
+		return fmt.Sprintf("%d exchanges, want %s", n, f.Exchanges.String()), nil
+	}
+	for i, t := range conv {
+		switch t.From {
+		case "gpt":
+			if n := countParagraphs(t.Value); !f.GPTParagraphs.Contains(n) {
+				return fmt.Sprintf("turn %d has %d paragraphs, want %s", i+1, n, f.GPTParagraphs.String()), nil
+			}
+		case "human":
+			if n := countSentences(t.Value); !f.HumanSentences.Contains(n) {
+				return fmt.Sprintf("turn %d has %d sentences, want %s", i+1, n, f.HumanSentences.String()), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// countParagraphs counts the non-blank lines of s; models separate
+// paragraphs with one newline as often as with two.
+func countParagraphs(s string) int {
+	n := 0
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) != "" {
+			n++
+		}
+	}
+	return n
+}
+
+var (
+	parenthetical = regexp.MustCompile(`\([^)]*\)`)
+	sentenceEnd   = regexp.MustCompile(`[.!?]+(?:["'”’])?(?:\s|$)`)
+)
+
+// countSentences roughly counts the sentences in s, leaving out actions
+// in parentheses.
+func countSentences(s string) int {
+	s = strings.TrimSpace(parenthetical.ReplaceAllString(s, " "))
+	if s == "" {
+		return 0
+	}
+	ends := sentenceEnd.FindAllStringIndex(s, -1)
+	n := len(ends)
+	if n == 0 || ends[n-1][1] < len(s) {
+		// Trailing text without a full stop.
+		n++
+	}
+	return n
+}
@@ -0,0 +1,140 @@
+package synner
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// splitOptions are the split command's settings.
+type splitOptions struct {
+	Ratios   []float64
+	Names    []string
+	Seed     int64
+	Stratify bool
+	OutDir   string
+}
+
+func newSplitCmd(logger *slog.Logger) *cobra.Command {
+	var opts splitOptions
+	cmd := &cobra.Command{
+		Use:   "split [in]",
+		Short: "Partition a ShareGPT dataset into reproducible train/val/test files",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSplit(logger, args[0], opts)
+		},
+	}
+	cmd.Flags().Float64SliceVar(&opts.Ratios, "ratios",
+		[]float64{0.9, 0.05, 0.05}, "Share of conversations in each split; normalized if they don't sum to 1")
+	cmd.Flags().StringSliceVar(&opts.Names, "names",
+		[]string{"train", "val", "test"}, "Name of each split, used in the output file names")
+	cmd.Flags().Int64Var(&opts.Seed, "seed",
+		42, "Shuffle seed; the same seed and input give the same splits")
+	cmd.Flags().BoolVar(&opts.Stratify, "stratify",
+		false, "Split each source book's conversations in the same ratios (needs a .jsonl input written by generate)")
+	cmd.Flags().StringVar(&opts.OutDir, "out-dir",
+		"", "Where to write the splits (default: next to the input)")
+	return cmd
+}
+
+func runSplit(logger *slog.Logger, in string, opts splitOptions) error {
+	if len(opts.Ratios) != len(opts.Names) {
+		return fmt.Errorf("%d ratios for %d split names", len(opts.Ratios), len(opts.Names))
+	}
+	sum := 0.0
+	for _, r := range opts.Ratios {
+		if r < 0 {
+			return fmt.Errorf("negative ratio %v", r)
+		}
+		sum += r
+	}
+	if sum == 0 {
+		return errors.New("ratios sum to zero")
+	}
+	ratios := make([]float64, len(opts.Ratios))
+	for i, r := range opts.Ratios {
+		ratios[i] = r / sum
+	}
+
+	recs, err := loadRecords(in)
+	if err != nil {
+		return err
+	}
+	groups := map[string][]datasetRecord{}
+	if opts.Stratify {
+		for _, r := range recs {
+			if r.source == "" {
+				return fmt.Errorf("%s has conversations without a source; --stratify needs a .jsonl output from generate", in)
+			}
+			groups[r.source] = append(groups[r.source], r)
+		}
+	} else {
+		groups[""] = recs
+	}
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	splits := make([][]datasetRecord, len(ratios))
+	for _, k := range keys {
+		g := groups[k]
+		rng.Shuffle(len(g), func(i, j int) { g[i], g[j] = g[j], g[i] })
+		start := 0
+		for i, n := range allocate(len(g), ratios) {
+			splits[i] = append(splits[i], g[start:start+n]...)
+			start += n
+		}
+	}
+
+	ext := datasetExt(in)
+	base := strings.TrimSuffix(filepath.Base(in), ext)
+	dir := opts.OutDir
+	if dir == "" {
+		dir = filepath.Dir(in)
+	}
+	for i, name := range opts.Names {
+		out := filepath.Join(dir, base+"."+name+ext)
+		if err := writeRecordsFile(out, splits[i]); err != nil {
+			return fmt.Errorf("failed to write %s: %w", out, err)
+		}
+		logger.Info("Wrote split",
+			"split", name,
+			"path", out,
+			"conversations", len(splits[i]))
+	}
+	return nil
+}
+
+// allocate divides n items by ratios, giving the leftovers from rounding
+// down to the largest remainders so the counts always sum to n.
+func allocate(n int, ratios []float64) []int {
+	counts := make([]int, len(ratios))
+	rem := make([]float64, len(ratios))
+	left := n
+	for i, r := range ratios {
+		exact := float64(n) * r
+		counts[i] = int(math.Floor(exact))
+		rem[i] = exact - float64(counts[i])
+		left -= counts[i]
+	}
+	order := make([]int, len(ratios))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return rem[order[a]] > rem[order[b]] })
+	for i := 0; i < left; i++ {
+		counts[order[i%len(order)]]++
+	}
+	return counts
+}
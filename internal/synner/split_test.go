@@ -0,0 +1,182 @@
+package synner
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// conv is a two-turn conversation whose answer is text.
+func conv(text string) []ShareGPTTurn {
+	return []ShareGPTTurn{{From: "human", Value: "Continue the story."}, {From: "gpt", Value: text}}
+}
+
+// writeJSONL writes lines as a .jsonl dataset.
+func writeJSONL(t *testing.T, path string, lines []jsonlLine) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, l := range lines {
+		if err := enc.Encode(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// answers loads a dataset and returns each conversation's last turn.
+func answers(t *testing.T, path string) []string {
+	t.Helper()
+	recs, err := loadRecords(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]string, len(recs))
+	for i, r := range recs {
+		out[i] = r.conv[len(r.conv)-1].Value
+	}
+	return out
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		n      int
+		ratios []float64
+		want   []int
+	}{
+		{0, []float64{0.9, 0.05, 0.05}, []int{0, 0, 0}},
+		{10, []float64{0.9, 0.05, 0.05}, []int{9, 1, 0}},
+		{100, []float64{0.9, 0.05, 0.05}, []int{90, 5, 5}},
+		{3, []float64{1.0 / 3, 1.0 / 3, 1.0 / 3}, []int{1, 1, 1}},
+		{7, []float64{0.5, 0.5}, []int{4, 3}},
+		{5, []float64{1, 0}, []int{5, 0}},
+		{11, []float64{0.7, 0.2, 0.1}, []int{8, 2, 1}},
+	}
+	for _, tt := range tests {
+		got := allocate(tt.n, tt.ratios)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("allocate(%d, %v) = %v, want %v", tt.n, tt.ratios, got, tt.want)
+		}
+	}
+}
+
+// splitInput writes 30 conversations, 20 from book a and 10 from book b.
+func splitInput(t *testing.T, dir string) (string, []string) {
+	t.Helper()
+	var lines []jsonlLine
+	var all []string
+	for i := range 30 {
+		src := "a"
+		if i%3 == 2 {
+			src = "b"
+		}
+		text := src + "-" + string(rune('A'+i))
+		lines = append(lines, jsonlLine{Conversations: conv(text), convMeta: convMeta{Source: src}})
+		all = append(all, text)
+	}
+	in := filepath.Join(dir, "data.jsonl")
+	writeJSONL(t, in, lines)
+	return in, all
+}
+
+func TestSplit(t *testing.T) {
+	dir := t.TempDir()
+	in, all := splitInput(t, dir)
+	opts := splitOptions{Ratios: []float64{8, 1, 1}, Names: []string{"train", "val", "test"}, Seed: 7}
+
+	read := func(outDir string) [][]string {
+		var splits [][]string
+		for _, name := range opts.Names {
+			splits = append(splits, answers(t, filepath.Join(outDir, "data."+name+".jsonl")))
+		}
+		return splits
+	}
+	split := func(outDir string, opts splitOptions) [][]string {
+		opts.OutDir = outDir
+		if err := os.MkdirAll(outDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := runSplit(discard, in, opts); err != nil {
+			t.Fatal(err)
+		}
+		return read(outDir)
+	}
+
+	first := split(filepath.Join(dir, "1"), opts)
+	if got := []int{len(first[0]), len(first[1]), len(first[2])}; !slices.Equal(got, []int{24, 3, 3}) {
+		t.Errorf("split sizes = %v, want [24 3 3]", got)
+	}
+	union := slices.Concat(first...)
+	slices.Sort(union)
+	want := slices.Clone(all)
+	slices.Sort(want)
+	if !slices.Equal(union, want) {
+		t.Errorf("splits hold %v, want each conversation once: %v", union, want)
+	}
+
+	again := split(filepath.Join(dir, "2"), opts)
+	for i := range first {
+		if !slices.Equal(first[i], again[i]) {
+			t.Errorf("split %s differs between runs with seed %d: %v, then %v", opts.Names[i], opts.Seed, first[i], again[i])
+		}
+	}
+
+	reseeded := opts
+	reseeded.Seed = 8
+	if other := split(filepath.Join(dir, "3"), reseeded); slices.Equal(first[0], other[0]) {
+		t.Errorf("seeds %d and %d gave the same train split", opts.Seed, reseeded.Seed)
+	}
+}
+
+func TestSplitStratify(t *testing.T) {
+	dir := t.TempDir()
+	in, _ := splitInput(t, dir)
+	opts := splitOptions{Ratios: []float64{0.8, 0.1, 0.1}, Names: []string{"train", "val", "test"}, Seed: 1, Stratify: true, OutDir: dir}
+	if err := runSplit(discard, in, opts); err != nil {
+		t.Fatal(err)
+	}
+	// Book a's 20 conversations split 16/2/2 and book b's 10 split 8/1/1.
+	want := []map[byte]int{{'a': 16, 'b': 8}, {'a': 2, 'b': 1}, {'a': 2, 'b': 1}}
+	for i, name := range opts.Names {
+		got := map[byte]int{}
+		for _, a := range answers(t, filepath.Join(dir, "data."+name+".jsonl")) {
+			got[a[0]]++
+		}
+		if got['a'] != want[i]['a'] || got['b'] != want[i]['b'] {
+			t.Errorf("%s split has %v per book, want %v", name, got, want[i])
+		}
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	dir := t.TempDir()
+	in, _ := splitInput(t, dir)
+	noSource := filepath.Join(dir, "nosource.jsonl")
+	writeJSONL(t, noSource, []jsonlLine{{Conversations: conv("x")}})
+
+	tests := []struct {
+		name string
+		in   string
+		opts splitOptions
+	}{
+		{"names and ratios differ", in, splitOptions{Ratios: []float64{0.5, 0.5}, Names: []string{"train"}}},
+		{"negative ratio", in, splitOptions{Ratios: []float64{1, -0.5}, Names: []string{"train", "val"}}},
+		{"zero ratios", in, splitOptions{Ratios: []float64{0, 0}, Names: []string{"train", "val"}}},
+		{"stratify without sources", noSource, splitOptions{Ratios: []float64{1}, Names: []string{"train"}, Stratify: true}},
+	}
+	for _, tt := range tests {
+		tt.opts.OutDir = dir
+		if err := runSplit(discard, tt.in, tt.opts); err == nil {
+			t.Errorf("%s: runSplit succeeded", tt.name)
+		}
+	}
+}
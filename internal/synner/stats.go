@@ -0,0 +1,320 @@
+package synner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// statsOptions are the stats command's settings.
+type statsOptions struct {
+	JSON       string
+	Bins       int
+	Top        int
+	ShortReply int
+	Tokenizer  string
+}
+
+func newStatsCmd(logger *slog.Logger) *cobra.Command {
+	var opts statsOptions
+	cmd := &cobra.Command{
+		Use:   "stats [in]",
+		Short: "Report turn-length, per-book and chunk-position distributions of a dataset",
+		Long: `Report how a dataset is distributed, to catch ones dominated by a few books or
+degenerate short replies: histograms of gpt and human turn lengths, the books
+with the most conversations, and where in their books the source chunks sit.
+Per-book and chunk-position figures need a .jsonl dataset written by
+generate, which records them.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runStats(logger, os.Stdout, args[0], opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.JSON, "json",
+		"", "Also write the report as JSON to this path")
+	cmd.Flags().IntVar(&opts.Bins, "bins",
+		10, "Histogram bins")
+	cmd.Flags().IntVar(&opts.Top, "top",
+		10, "Books to list by conversation count")
+	cmd.Flags().IntVar(&opts.ShortReply, "short-reply",
+		200, "Count gpt turns under this many characters as short replies")
+	cmd.Flags().StringVar(&opts.Tokenizer, "tokenizer",
+		"chars", "How to count tokens: chars (estimate at 4 characters per token), a tiktoken encoding such as cl100k_base, or an OpenAI model name")
+	_ = cmd.RegisterFlagCompletionFunc("tokenizer", completeTokenizer)
+	return cmd
+}
+
+// statsReport is the JSON form of the stats report.
+type statsReport struct {
+	Input          string        `json:"input"`
+	Conversations  int           `json:"conversations"`
+	Turns          int           `json:"turns"`
+	Tokenizer      string        `json:"tokenizer"`
+	Tokens         int           `json:"tokens"`
+	ConvTokens     lengthStats   `json:"conversation_tokens"`
+	GPTTurnChars   lengthStats   `json:"gpt_turn_chars"`
+	HumanTurnChars lengthStats   `json:"human_turn_chars"`
+	ShortReplies   int           `json:"short_gpt_replies"`
+	ShortReplyMax  int           `json:"short_reply_chars"`
+	Sources        sourceStats   `json:"sources"`
+	ChunkPositions positionStats `json:"chunk_positions"`
+}
+
+type lengthStats struct {
+	Count     int            `json:"count"`
+	Min       int            `json:"min"`
+	Max       int            `json:"max"`
+	Mean      float64        `json:"mean"`
+	P10       int            `json:"p10"`
+	P50       int            `json:"p50"`
+	P90       int            `json:"p90"`
+	Histogram []histogramBin `json:"histogram"`
+}
+
+type histogramBin struct {
+	// Lo is inclusive and Hi exclusive, except in the last bin.
+	Lo    float64 `json:"lo"`
+	Hi    float64 `json:"hi"`
+	Count int     `json:"count"`
+}
+
+type sourceStats struct {
+	Books int `json:"books"`
+	// Unknown counts conversations without a recorded source.
+	Unknown int           `json:"unknown"`
+	Top     []sourceCount `json:"top"`
+	// TopShare is the fraction of conversations from the Top books.
+	TopShare float64 `json:"top_share"`
+	// MaxShare is the fraction from the single biggest book.
+	MaxShare float64 `json:"max_share"`
+}
+
+type sourceCount struct {
+	Source        string `json:"source"`
+	Conversations int    `json:"conversations"`
+}
+
+type positionStats struct {
+	Known int `json:"known"`
+	// Histogram is over the relative position in the book, 0 to 1.
+	Histogram []histogramBin `json:"histogram"`
+}
+
+func runStats(logger *slog.Logger, out io.Writer, in string, opts statsOptions) error {
+	if opts.Bins < 1 {
+		return fmt.Errorf("--bins must be at least 1, got %d", opts.Bins)
+	}
+	tok, err := newTokenizer(opts.Tokenizer)
+	if err != nil {
+		return err
+	}
+	recs, err := loadRecords(in)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", in, err)
+	}
+	r := statsReport{Input: in, Conversations: len(recs), Tokenizer: opts.Tokenizer, ShortReplyMax: opts.ShortReply}
+	var gpt, human, positions, convTokens []float64
+	perSource := map[string]int{}
+	for _, rec := range recs {
+		r.Turns += len(rec.conv)
+		n := conversationTokens(tok, rec.conv)
+		r.Tokens += n
+		convTokens = append(convTokens, float64(n))
+		for _, t := range rec.conv {
+			n := len([]rune(t.Value))
+			switch t.From {
+			case "gpt":
+				gpt = append(gpt, float64(n))
+				if n < opts.ShortReply {
+					r.ShortReplies++
+				}
+			case "human":
+				human = append(human, float64(n))
+			}
+		}
+		if rec.source == "" {
+			r.Sources.Unknown++
+		} else {
+			perSource[rec.source]++
+		}
+		if rec.chunk > 0 && rec.chunks > 0 {
+			// The middle of the chunk's slot, so a one-chunk book is 0.5.
+			positions = append(positions, (float64(rec.chunk)-0.5)/float64(rec.chunks))
+		}
+	}
+	r.GPTTurnChars = newLengthStats(gpt, opts.Bins)
+	r.HumanTurnChars = newLengthStats(human, opts.Bins)
+	r.ConvTokens = newLengthStats(convTokens, opts.Bins)
+	r.Sources = newSourceStats(perSource, r.Sources.Unknown, opts.Top)
+	r.ChunkPositions = positionStats{Known: len(positions), Histogram: histogram(positions, 0, 1, opts.Bins)}
+
+	printStats(out, r)
+	if opts.JSON != "" {
+		err := writeFileAtomic(opts.JSON, func(f io.Writer) error {
+			enc := json.NewEncoder(f)
+			enc.SetIndent("", "  ")
+			enc.SetEscapeHTML(false)
+			return enc.Encode(r)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", opts.JSON, err)
+		}
+		logger.Info("Wrote stats report", "path", opts.JSON)
+	}
+	return nil
+}
+
+func newLengthStats(v []float64, bins int) lengthStats {
+	if len(v) == 0 {
+		return lengthStats{Histogram: []histogramBin{}}
+	}
+	sort.Float64s(v)
+	sum := 0.0
+	for _, x := range v {
+		sum += x
+	}
+	pct := func(p float64) int {
+		return int(v[int(math.Round(p*float64(len(v)-1)))])
+	}
+	return lengthStats{
+		Count:     len(v),
+		Min:       int(v[0]),
+		Max:       int(v[len(v)-1]),
+		Mean:      sum / float64(len(v)),
+		P10:       pct(0.1),
+		P50:       pct(0.5),
+		P90:       pct(0.9),
+		Histogram: histogram(v, v[0], v[len(v)-1], bins),
+	}
+}
+
+// histogram counts v in bins equal-width bins from lo to hi.
+func histogram(v []float64, lo, hi float64, bins int) []histogramBin {
+	if len(v) == 0 {
+		return []histogramBin{}
+	}
+	if hi <= lo {
+		return []histogramBin{{Lo: lo, Hi: hi, Count: len(v)}}
+	}
+	width := (hi - lo) / float64(bins)
+	h := make([]histogramBin, bins)
+	for i := range h {
+		h[i].Lo = lo + float64(i)*width
+		h[i].Hi = lo + float64(i+1)*width
+	}
+	for _, x := range v {
+		i := min(int((x-lo)/width), bins-1)
+		h[max(i, 0)].Count++
+	}
+	return h
+}
+
+func newSourceStats(perSource map[string]int, unknown, top int) sourceStats {
+	s := sourceStats{Books: len(perSource), Unknown: unknown, Top: []sourceCount{}}
+	total := 0
+	for src, n := range perSource {
+		s.Top = append(s.Top, sourceCount{src, n})
+		total += n
+	}
+	sort.Slice(s.Top, func(i, j int) bool {
+		if s.Top[i].Conversations != s.Top[j].Conversations {
+			return s.Top[i].Conversations > s.Top[j].Conversations
+		}
+		return s.Top[i].Source < s.Top[j].Source
+	})
+	s.Top = s.Top[:min(top, len(s.Top))]
+	if total > 0 {
+		inTop := 0
+		for _, c := range s.Top {
+			inTop += c.Conversations
+		}
+		s.TopShare = float64(inTop) / float64(total)
+		if len(s.Top) > 0 {
+			s.MaxShare = float64(s.Top[0].Conversations) / float64(total)
+		}
+	}
+	return s
+}
+
+const statsBarWidth = 40
+
+func printStats(out io.Writer, r statsReport) {
+	fmt.Fprintf(out, "%s: %d conversations, %d turns, %d tokens (%s)\n", r.Input, r.Conversations, r.Turns, r.Tokens, r.Tokenizer)
+	printLengths(out, "conversation length (tokens)", "conversations", r.ConvTokens)
+	printLengths(out, "gpt turn length (chars)", "turns", r.GPTTurnChars)
+	if r.GPTTurnChars.Count > 0 {
+		fmt.Fprintf(out, "  short replies (< %d chars): %d (%.1f%%)\n", r.ShortReplyMax, r.ShortReplies,
+			100*float64(r.ShortReplies)/float64(r.GPTTurnChars.Count))
+	}
+	printLengths(out, "human turn length (chars)", "turns", r.HumanTurnChars)
+
+	fmt.Fprintf(out, "\nconversations per book: %d books", r.Sources.Books)
+	if r.Sources.Unknown > 0 {
+		fmt.Fprintf(out, ", %d conversations without a source", r.Sources.Unknown)
+	}
+	fmt.Fprintln(out)
+	if len(r.Sources.Top) > 0 {
+		most := r.Sources.Top[0].Conversations
+		for _, c := range r.Sources.Top {
+			fmt.Fprintf(out, "  %-40s %6d %s\n", trimLeft(c.Source, 40), c.Conversations, bar(c.Conversations, most))
+		}
+		fmt.Fprintf(out, "  top %d books hold %.1f%% of conversations; the biggest %.1f%%\n",
+			len(r.Sources.Top), 100*r.Sources.TopShare, 100*r.Sources.MaxShare)
+	}
+
+	fmt.Fprintf(out, "\nchunk position in book: %d conversations with a known position\n", r.ChunkPositions.Known)
+	printHistogram(out, r.ChunkPositions.Histogram, func(b histogramBin) string {
+		return fmt.Sprintf("%3.0f%%-%3.0f%%", 100*b.Lo, 100*b.Hi)
+	})
+}
+
+func printLengths(out io.Writer, title, noun string, s lengthStats) {
+	fmt.Fprintf(out, "\n%s: %d %s", title, s.Count, noun)
+	if s.Count == 0 {
+		fmt.Fprintln(out)
+		return
+	}
+	fmt.Fprintf(out, ", min %d, p10 %d, median %d, p90 %d, max %d, mean %.0f\n",
+		s.Min, s.P10, s.P50, s.P90, s.Max, s.Mean)
+	printHistogram(out, s.Histogram, func(b histogramBin) string {
+		return fmt.Sprintf("%6.0f-%-6.0f", b.Lo, b.Hi)
+	})
+}
+
+func printHistogram(out io.Writer, h []histogramBin, label func(histogramBin) string) {
+	most := 0
+	for _, b := range h {
+		most = max(most, b.Count)
+	}
+	for _, b := range h {
+		fmt.Fprintf(out, "  %s %6d %s\n", label(b), b.Count, bar(b.Count, most))
+	}
+}
+
+// bar draws n as a share of most, statsBarWidth cells wide at most.
+func bar(n, most int) string {
+	if most == 0 {
+		return ""
+	}
+	w := int(math.Round(float64(n) / float64(most) * statsBarWidth))
+	if w == 0 && n > 0 {
+		return "▏"
+	}
+	return strings.Repeat("█", w)
+}
+
+// trimLeft keeps the last n runes of s, where long paths differ.
+func trimLeft(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return "…" + string(r[len(r)-n+1:])
+}
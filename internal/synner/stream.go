@@ -0,0 +1,66 @@
+package synner
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand"
+)
+
+// rowCounter is implemented by sources that know how many rows they hold.
+type rowCounter interface {
+	NumRows() int64
+}
+
+// shuffleBuffer streams rows from a source in random order while holding at
+// most size rows in memory: each row returned is picked at random from the
+// buffer, which is then refilled from the source. The order is only
+// approximately uniform, but memory stays bounded however large the corpus.
+// A size of 1 or less keeps the source order.
+type shuffleBuffer struct {
+	src    DataSource
+	pv     provenancer
+	buf    []corpusRow
+	size   int
+	rng    *rand.Rand
+	logger *slog.Logger
+	eof    bool
+}
+
+func newShuffleBuffer(src DataSource, size int, rng *rand.Rand, logger *slog.Logger) *shuffleBuffer {
+	pv, _ := src.(provenancer)
+	return &shuffleBuffer{src: src, pv: pv, size: max(size, 1), rng: rng, logger: logger}
+}
+
+// Next returns the next row, or io.EOF once the source and buffer are
+// drained. Unreadable rows are logged and skipped.
+func (s *shuffleBuffer) Next() (corpusRow, error) {
+	for !s.eof && len(s.buf) < s.size {
+		text, err := s.src.NextRow()
+		if errors.Is(err, io.EOF) {
+			s.eof = true
+			break
+		}
+		if errors.Is(err, errSourceFailed) {
+			return corpusRow{}, err
+		}
+		if err != nil {
+			s.logger.Error("Row read error", "err", err)
+			continue
+		}
+		r := corpusRow{Text: text, Row: -1}
+		if s.pv != nil {
+			r.Source, r.Row = s.pv.Provenance(), s.pv.Row()
+		}
+		s.buf = append(s.buf, r)
+	}
+	if len(s.buf) == 0 {
+		return corpusRow{}, io.EOF
+	}
+	i := s.rng.Intn(len(s.buf))
+	last := len(s.buf) - 1
+	s.buf[i], s.buf[last] = s.buf[last], s.buf[i]
+	r := s.buf[last]
+	s.buf = s.buf[:last]
+	return r, nil
+}
@@ -0,0 +1,118 @@
+package synner
+
+import (
+	"fmt"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/spf13/cobra"
+)
+
+// charsPerToken is the rough number of characters per token for English
+// prose with common BPE tokenizers.
+const charsPerToken = 4
+
+// tokenizer counts text in a model's tokens and cuts it down to a budget.
+type tokenizer interface {
+	Count(text string) int
+	// Truncate returns the longest prefix of text within max tokens.
+	Truncate(text string, max int) string
+}
+
+// charTokenizer estimates tokens at charsPerToken characters each, for
+// when no real tokenizer is configured.
+type charTokenizer struct{}
+
+func (charTokenizer) Count(text string) int {
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
+
+func (charTokenizer) Truncate(text string, max int) string {
+	r := []rune(text)
+	if len(r) <= max*charsPerToken {
+		return text
+	}
+	return string(r[:max*charsPerToken])
+}
+
+// tiktokenTokenizer counts with an OpenAI BPE encoding, downloaded on first
+// use and cached in $TIKTOKEN_CACHE_DIR.
+type tiktokenTokenizer struct {
+	enc *tiktoken.Tiktoken
+}
+
+func (t tiktokenTokenizer) Count(text string) int {
+	return len(t.enc.EncodeOrdinary(text))
+}
+
+func (t tiktokenTokenizer) Truncate(text string, max int) string {
+	toks := t.enc.EncodeOrdinary(text)
+	if len(toks) <= max {
+		return text
+	}
+	s := t.enc.Decode(toks[:max])
+	// The cut may fall inside a character split across tokens.
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+var tiktokenEncodings = []string{
+	tiktoken.MODEL_O200K_BASE,
+	tiktoken.MODEL_CL100K_BASE,
+	tiktoken.MODEL_P50K_BASE,
+	tiktoken.MODEL_R50K_BASE,
+	tiktoken.MODEL_P50K_EDIT,
+}
+
+// completeTokenizer completes --tokenizer with chars and the tiktoken
+// encodings; OpenAI model names are accepted too but not offered.
+func completeTokenizer(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return append([]string{"chars"}, tiktokenEncodings...), cobra.ShellCompDirectiveNoFileComp
+}
+
+// newTokenizer returns the --tokenizer named by spec: chars, a tiktoken
+// encoding such as cl100k_base, or an OpenAI model name such as gpt-4o.
+func newTokenizer(spec string) (tokenizer, error) {
+	if spec == "" || spec == "chars" {
+		return charTokenizer{}, nil
+	}
+	var enc *tiktoken.Tiktoken
+	var err error
+	if slices.Contains(tiktokenEncodings, spec) {
+		enc, err = tiktoken.GetEncoding(spec)
+	} else {
+		enc, err = tiktoken.EncodingForModel(spec)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer %q: %w", spec, err)
+	}
+	return tiktokenTokenizer{enc: enc}, nil
+}
+
+// turnTokens counts the tokens of each of conv's turns.
+func turnTokens(tok tokenizer, conv []ShareGPTTurn) []int {
+	n := make([]int, len(conv))
+	for i, t := range conv {
+		n[i] = tok.Count(t.Value)
+	}
+	return n
+}
+
+// conversationTokens counts how many training tokens conv adds to the
+// dataset, counting only the turn texts.
+func conversationTokens(tok tokenizer, conv []ShareGPTTurn) int {
+	total := 0
+	for _, n := range turnTokens(tok, conv) {
+		total += n
+	}
+	return total
+}
+
+// estimateTokens approximates conversationTokens at charsPerToken
+// characters per token.
+func estimateTokens(conv []ShareGPTTurn) int {
+	return conversationTokens(charTokenizer{}, conv)
+}
@@ -0,0 +1,258 @@
+package synner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+// validateOptions are the validate command's settings.
+type validateOptions struct {
+	MinTurns int
+	MaxTurns int
+	Roles    []string
+	// Alternate requires human and gpt turns to alternate, human first,
+	// after an optional leading system turn.
+	Alternate bool
+	Format    string
+}
+
+func newValidateCmd(logger *slog.Logger) *cobra.Command {
+	var opts validateOptions
+	cmd := &cobra.Command{
+		Use:   "validate [file...]",
+		Short: "Check ShareGPT datasets against the structural rules, for CI and pre-commit",
+		Long: `Check every conversation of one or more .json or .jsonl datasets, compressed or
+not, and print a finding for each problem: invalid UTF-8, a line or
+conversation that isn't ShareGPT, an unknown role, an empty value, turns out of
+human/gpt order, or a turn count out of bounds. Findings are printed one per
+line with the conversation's 0-based index and, where there is one, the turn's,
+as text or, with --format json, JSON. The command fails if there are any.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Format != "text" && opts.Format != "json" {
+				return fmt.Errorf("unknown --format %q (want text or json)", opts.Format)
+			}
+			// Findings aren't a usage error.
+			cmd.SilenceUsage = true
+			return runValidate(logger, os.Stdout, args, opts)
+		},
+	}
+	cmd.Flags().IntVar(&opts.MinTurns, "min-turns",
+		2, "Flag conversations with fewer turns")
+	cmd.Flags().IntVar(&opts.MaxTurns, "max-turns",
+		0, "Flag conversations with more turns (0 for no limit)")
+	cmd.Flags().StringSliceVar(&opts.Roles, "roles",
+		[]string{"system", "human", "gpt"}, "Roles a turn may be from")
+	cmd.Flags().BoolVar(&opts.Alternate, "require-alternation",
+		true, "Flag turns out of human, gpt, human, ... order, after an optional leading system turn")
+	cmd.Flags().StringVar(&opts.Format, "format",
+		"text", "How to print findings: text (path: conversation N turn M: rule: message) or json (one object per line)")
+	_ = cmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"text", "json"}, cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+// validationFinding is one problem validate found. Index is the
+// conversation's 0-based position in the file, and Line its line in a
+// .jsonl file; Turn, when set, is the 0-based turn.
+type validationFinding struct {
+	Path    string `json:"path"`
+	Index   int    `json:"index"`
+	Line    int    `json:"line,omitempty"`
+	Turn    *int   `json:"turn,omitempty"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// rawTurn is a turn as written, so missing fields can be told from empty
+// ones.
+type rawTurn struct {
+	From  *string `json:"from"`
+	Value *string `json:"value"`
+}
+
+func runValidate(logger *slog.Logger, out io.Writer, paths []string, opts validateOptions) error {
+	enc := json.NewEncoder(out)
+	report := func(f validationFinding) {
+		if opts.Format == "json" {
+			enc.Encode(f)
+			return
+		}
+		where := fmt.Sprintf("conversation %d", f.Index)
+		if f.Line > 0 {
+			where += fmt.Sprintf(" (line %d)", f.Line)
+		}
+		if f.Turn != nil {
+			where += fmt.Sprintf(" turn %d", *f.Turn)
+		}
+		fmt.Fprintf(out, "%s: %s: %s: %s\n", f.Path, where, f.Rule, f.Message)
+	}
+	total, bad := 0, 0
+	for _, path := range paths {
+		convs, findings, err := validateDataset(path, opts)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		for _, f := range findings {
+			report(f)
+		}
+		total += len(findings)
+		logger.Info("Validated dataset",
+			"path", path,
+			"conversations", convs,
+			"findings", len(findings))
+		if len(findings) > 0 {
+			bad++
+		}
+	}
+	if total > 0 {
+		return fmt.Errorf("%d findings in %d of %d files", total, bad, len(paths))
+	}
+	return nil
+}
+
+// validateDataset checks every conversation of path, returning how many
+// there are and what is wrong with them. The error is for a file that
+// can't be read at all.
+func validateDataset(path string, opts validateOptions) (int, []validationFinding, error) {
+	f, err := openDataset(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+	var findings []validationFinding
+	add := func(index, line int, turn *int, rule, format string, args ...any) {
+		findings = append(findings, validationFinding{
+			Path:    path,
+			Index:   index,
+			Line:    line,
+			Turn:    turn,
+			Rule:    rule,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if format, _ := outputFormat(path, ""); format == "json" {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return 0, nil, err
+		}
+		// Raw conversations keep their bytes, invalid UTF-8 included.
+		var d struct {
+			Conversations []json.RawMessage `json:"conversations"`
+		}
+		if err := json.Unmarshal(b, &d); err != nil {
+			add(0, 0, nil, "parse", "not a ShareGPT document: %v", err)
+			return 0, findings, nil
+		}
+		if d.Conversations == nil {
+			add(0, 0, nil, "parse", "no conversations field")
+		}
+		for i, raw := range d.Conversations {
+			validateRaw(raw, opts, func(turn *int, rule, format string, args ...any) {
+				add(i, 0, turn, rule, format, args...)
+			})
+		}
+		return len(d.Conversations), findings, nil
+	}
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	index := 0
+	for n := 1; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var l struct {
+			Conversations json.RawMessage `json:"conversations"`
+		}
+		if err := json.Unmarshal(line, &l); err != nil {
+			add(index, n, nil, "parse", "not a JSON object: %v", err)
+		} else if l.Conversations == nil {
+			add(index, n, nil, "parse", "no conversations field")
+		} else {
+			// The line's other fields must be valid UTF-8 too.
+			if !utf8.Valid(line) && utf8.Valid(l.Conversations) {
+				add(index, n, nil, "utf8", "invalid UTF-8 outside the conversation")
+			}
+			validateRaw(l.Conversations, opts, func(turn *int, rule, format string, args ...any) {
+				add(index, n, turn, rule, format, args...)
+			})
+		}
+		index++
+	}
+	if err := sc.Err(); err != nil {
+		return index, findings, err
+	}
+	return index, findings, nil
+}
+
+// validateRaw checks one conversation as written, passing each problem to
+// add.
+func validateRaw(raw json.RawMessage, opts validateOptions, add func(turn *int, rule, format string, args ...any)) {
+	var turns []rawTurn
+	if err := json.Unmarshal(raw, &turns); err != nil {
+		add(nil, "parse", "not a list of turns: %v", err)
+		return
+	}
+	switch {
+	case len(turns) < opts.MinTurns:
+		add(nil, "turns", "%d turns, want at least %d", len(turns), opts.MinTurns)
+	case opts.MaxTurns > 0 && len(turns) > opts.MaxTurns:
+		add(nil, "turns", "%d turns, want at most %d", len(turns), opts.MaxTurns)
+	}
+	if !utf8.Valid(raw) {
+		// Say which turns, since decoding has replaced the bad bytes.
+		var values []struct {
+			From  json.RawMessage `json:"from"`
+			Value json.RawMessage `json:"value"`
+		}
+		json.Unmarshal(raw, &values)
+		for i, v := range values {
+			if !utf8.Valid(v.From) || !utf8.Valid(v.Value) {
+				add(&i, "utf8", "invalid UTF-8")
+			}
+		}
+	}
+	// want is the role alternation expects next; a leading system turn is
+	// allowed.
+	want := "human"
+	for i, t := range turns {
+		switch {
+		case t.From == nil:
+			add(&i, "role", "no from field")
+		case !slices.Contains(opts.Roles, *t.From):
+			add(&i, "role", "unknown role %q (want one of %s)", *t.From, strings.Join(opts.Roles, ", "))
+		}
+		switch {
+		case t.Value == nil:
+			add(&i, "empty", "no value field")
+		case strings.TrimSpace(*t.Value) == "":
+			add(&i, "empty", "empty value")
+		}
+		if !opts.Alternate || t.From == nil {
+			continue
+		}
+		if i == 0 && *t.From == "system" {
+			continue
+		}
+		if *t.From != want {
+			add(&i, "alternation", "turn is from %q, want %q", *t.From, want)
+		}
+		if *t.From == "human" {
+			want = "gpt"
+		} else {
+			want = "human"
+		}
+	}
+}
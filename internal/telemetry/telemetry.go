@@ -0,0 +1,250 @@
+// Package telemetry installs the OpenTelemetry trace and meter providers
+// shared by every gpumon command. Both signals go over OTLP/HTTP to the same
+// endpoint, or to Honeycomb when only an API key is set; with neither, or
+// with --otel-disabled, no-op providers are installed and spans and metrics
+// cost nothing. With --otel-local-only no exporter that can reach the
+// network is ever created, whatever else is configured, so air-gapped hosts
+// can rely on telemetry never leaving the machine.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/nathanleclaire/gpumon/internal/version"
+	"github.com/nathanleclaire/gpumon/pkg/export"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Config selects where telemetry goes.
+type Config struct {
+	// Endpoint is an OTLP/HTTP endpoint.
+	Endpoint     string
+	HoneycombKey string
+	// ServiceName is the service.name resource attribute.
+	ServiceName string
+	// TraceExporter is otlp, stdout or none; empty picks otlp when an
+	// endpoint or Honeycomb key is set, otherwise none.
+	TraceExporter string
+	Disabled      bool
+	// LocalOnly forbids network exporters: Endpoint and HoneycombKey are
+	// ignored and only the stdout trace exporter may be used.
+	LocalOnly bool
+}
+
+// renamed maps the telemetry flags' old names to their --otel-* ones.
+var renamed = map[string]string{
+	"otlp-endpoint":  "otel-endpoint",
+	"service-name":   "otel-service-name",
+	"trace-exporter": "otel-trace-exporter",
+}
+
+// NormalizeFlagName accepts the telemetry flags' old names, so command lines
+// and recorded runs using them keep working. Install it on the root command
+// with SetGlobalNormalizationFunc.
+func NormalizeFlagName(_ *pflag.FlagSet, name string) pflag.NormalizedName {
+	if n, ok := renamed[name]; ok {
+		return pflag.NormalizedName(n)
+	}
+	return pflag.NormalizedName(name)
+}
+
+// AddFlags adds the telemetry flags to fs and binds them to viper.
+func AddFlags(fs *pflag.FlagSet) {
+	_ = viper.BindEnv("honeycomb.key", "HONEYCOMB_API_KEY")
+	fs.String("honeycomb-key", "",
+		"Honeycomb API Key (defaults from env HONEYCOMB_API_KEY if set)")
+	_ = viper.BindPFlag("honeycomb.key", fs.Lookup("honeycomb-key"))
+	_ = viper.BindEnv("otel.endpoint", "OTEL_EXPORTER_OTLP_ENDPOINT")
+	fs.String("otel-endpoint", "",
+		"OTLP/HTTP endpoint for traces and metrics, e.g. http://localhost:4318 (defaults from env OTEL_EXPORTER_OTLP_ENDPOINT if set)")
+	_ = viper.BindPFlag("otel.endpoint", fs.Lookup("otel-endpoint"))
+	_ = viper.BindEnv("otel.service.name", "OTEL_SERVICE_NAME")
+	fs.String("otel-service-name", "",
+		"service.name reported with traces and metrics (defaults from env OTEL_SERVICE_NAME if set, else per command tree)")
+	_ = viper.BindPFlag("otel.service.name", fs.Lookup("otel-service-name"))
+	fs.String("otel-trace-exporter", "",
+		"Trace exporter: otlp, stdout or none (default otlp when an endpoint or Honeycomb key is set, otherwise none)")
+	_ = viper.BindPFlag("otel.trace.exporter", fs.Lookup("otel-trace-exporter"))
+	_ = viper.BindEnv("otel.disabled", "OTEL_SDK_DISABLED")
+	fs.Bool("otel-disabled", false,
+		"Turn off traces and metrics even when an endpoint or Honeycomb key is set (defaults from env OTEL_SDK_DISABLED if set)")
+	_ = viper.BindPFlag("otel.disabled", fs.Lookup("otel-disabled"))
+	fs.Bool("otel-local-only", false,
+		"Never send telemetry off the machine: OTLP and Honeycomb export stay off even when configured; --otel-trace-exporter stdout still works")
+	_ = viper.BindPFlag("otel.local.only", fs.Lookup("otel-local-only"))
+}
+
+// ConfigFromViper reads the flags added by AddFlags, falling back to
+// service when --otel-service-name is unset.
+func ConfigFromViper(service string) Config {
+	cfg := Config{
+		Endpoint:      viper.GetString("otel.endpoint"),
+		HoneycombKey:  viper.GetString("honeycomb.key"),
+		ServiceName:   viper.GetString("otel.service.name"),
+		TraceExporter: strings.ToLower(viper.GetString("otel.trace.exporter")),
+		Disabled:      viper.GetBool("otel.disabled"),
+		LocalOnly:     viper.GetBool("otel.local.only"),
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = service
+	}
+	return cfg
+}
+
+// Enabled reports whether cfg sends telemetry anywhere over OTLP.
+func (cfg Config) Enabled() bool {
+	return !cfg.Disabled && !cfg.LocalOnly && (cfg.Endpoint != "" || cfg.HoneycombKey != "")
+}
+
+// RequireExport returns why cfg sends no metrics, or nil if it does. Commands
+// whose only output is metrics call it before starting.
+func (cfg Config) RequireExport() error {
+	switch {
+	case cfg.Enabled():
+		return nil
+	case cfg.Disabled:
+		return errors.New("telemetry is off (--otel-disabled); nowhere to send metrics")
+	case cfg.LocalOnly:
+		return errors.New("telemetry is local-only (--otel-local-only); nowhere to send metrics")
+	default:
+		return errors.New("no metrics destination; set --otel-endpoint or --honeycomb-key")
+	}
+}
+
+// Start installs the global tracer and meter providers for cfg and returns
+// a shutdown function that flushes them.
+func Start(ctx context.Context, logger *slog.Logger, cfg Config) (func(context.Context) error, error) {
+	if cfg.Disabled {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetMeterProvider(metricnoop.NewMeterProvider())
+		logger.Debug("Telemetry disabled by --otel-disabled")
+		return func(context.Context) error { return nil }, nil
+	}
+	if cfg.LocalOnly {
+		if cfg.TraceExporter == "otlp" {
+			return nil, errors.New("--otel-trace-exporter otlp sends spans off the machine; it can't be used with --otel-local-only")
+		}
+		if cfg.Endpoint != "" || cfg.HoneycombKey != "" {
+			logger.Info("Telemetry is local-only; ignoring the configured endpoint and Honeycomb key")
+		}
+		cfg.Endpoint, cfg.HoneycombKey = "", ""
+	}
+
+	res, err := resource.New(ctx, resource.WithAttributes(
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.ServiceVersion(version.Version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build resource: %w", err)
+	}
+
+	traceShutdown, err := startTracing(logger, cfg, res)
+	if err != nil {
+		return nil, err
+	}
+	metricShutdown, err := startMetrics(ctx, logger, cfg, res)
+	if err != nil {
+		_ = traceShutdown(ctx)
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		return errors.Join(traceShutdown(ctx), metricShutdown(ctx))
+	}, nil
+}
+
+func startTracing(logger *slog.Logger, cfg Config, res *resource.Resource) (func(context.Context) error, error) {
+	exporter := cfg.TraceExporter
+	if exporter == "" {
+		exporter = "none"
+		if cfg.Enabled() {
+			exporter = "otlp"
+		}
+	}
+
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "none":
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		logger.Debug("Tracing disabled; set --otel-endpoint or --honeycomb-key to enable")
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		// Spans go to stderr so they never mix with report output on stdout.
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr), stdouttrace.WithPrettyPrint())
+	case "otlp":
+		exp, err = otlptracehttp.New(context.Background(), traceOptions(cfg)...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q (want otlp, stdout or none)", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating %s exporter: %w", exporter, err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	logger.Debug("Tracing enabled", "exporter", exporter, "endpoint", cfg.Endpoint, "service", cfg.ServiceName)
+	return tp.Shutdown, nil
+}
+
+func startMetrics(ctx context.Context, logger *slog.Logger, cfg Config, res *resource.Resource) (func(context.Context) error, error) {
+	if !cfg.Enabled() {
+		otel.SetMeterProvider(metricnoop.NewMeterProvider())
+		logger.Debug("Metrics disabled; set --otel-endpoint or --honeycomb-key to enable")
+		return func(context.Context) error { return nil }, nil
+	}
+	ocfg := export.OTLPConfig{Endpoint: cfg.Endpoint, Resource: res}
+	if cfg.HoneycombKey != "" {
+		if ocfg.Endpoint == "" {
+			ocfg.Endpoint = export.HoneycombEndpoint
+		}
+		ocfg.Headers = honeycombHeaders(cfg.HoneycombKey)
+	}
+	mp, err := export.NewOTLPMeterProvider(ctx, ocfg)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetMeterProvider(mp)
+	logger.Debug("Metrics enabled", "endpoint", ocfg.Endpoint, "interval", export.DefaultInterval)
+	return mp.Shutdown, nil
+}
+
+// traceOptions points the exporter at cfg.Endpoint, or at Honeycomb when
+// only an API key is given. An endpoint with a scheme is used
+// as a full URL; a bare host[:port] is reached over HTTPS. Extra headers can
+// be supplied via OTEL_EXPORTER_OTLP_HEADERS.
+func traceOptions(cfg Config) []otlptracehttp.Option {
+	var opts []otlptracehttp.Option
+	switch {
+	case strings.Contains(cfg.Endpoint, "://"):
+		opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	case cfg.Endpoint != "":
+		opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+	case cfg.HoneycombKey != "":
+		opts = append(opts, otlptracehttp.WithEndpoint(export.HoneycombEndpoint))
+	}
+	if cfg.HoneycombKey != "" {
+		opts = append(opts, otlptracehttp.WithHeaders(honeycombHeaders(cfg.HoneycombKey)))
+	}
+	return opts
+}
+
+func honeycombHeaders(key string) map[string]string {
+	return map[string]string{"x-honeycomb-team": key}
+}
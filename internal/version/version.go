@@ -0,0 +1,81 @@
+// Package version reports what gpumon build is running. Release builds set
+// the variables with -ldflags:
+//
+//	go build -ldflags "\
+//	  -X github.com/nathanleclaire/gpumon/internal/version.Version=v1.2.0 \
+//	  -X github.com/nathanleclaire/gpumon/internal/version.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/nathanleclaire/gpumon/internal/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" \
+//	  -o bin/gpumon ./gpumon
+//
+// Without them, the commit, and its commit time as the date, come from the
+// VCS stamp Go embeds when building inside a git checkout.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	// Version is the release, "dev" for untagged builds.
+	Version = "dev"
+	// Commit is the git SHA the binary was built from.
+	Commit = ""
+	// Date is when the binary was built, in RFC 3339.
+	Date = ""
+)
+
+// Info is the build's identity.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"go_version"`
+	// Modified is set when the build's checkout had uncommitted changes.
+	Modified bool `json:"modified,omitempty"`
+}
+
+// Get returns the build info, filling in what ldflags left unset from the
+// embedded VCS stamp.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, Date: Date, GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = s.Value
+			}
+		case "vcs.time":
+			if info.Date == "" {
+				info.Date = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+// String is the one-line form printed by --version.
+func (i Info) String() string {
+	commit := i.Commit
+	if commit == "" {
+		commit = "unknown"
+	}
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	if i.Modified {
+		commit += "-dirty"
+	}
+	date := i.Date
+	if date == "" {
+		date = "unknown"
+	}
+	return fmt.Sprintf("%s (commit %s, built %s, %s)", i.Version, commit, date, i.GoVersion)
+}
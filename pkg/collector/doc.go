@@ -0,0 +1,26 @@
+// Package collector reads GPU state in-process: utilization, memory and
+// power from nvidia-smi, or DCGM profiling counters from dynolog, either as
+// one-off snapshots or sampled over an interval.
+//
+// Take a snapshot of every visible GPU:
+//
+//	gpus, err := (&collector.NvidiaSMI{}).Collect(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	for _, g := range gpus {
+//		fmt.Printf("%s: %d%% busy, %d MiB used\n", g.Name, g.GPUUtilPercent, g.MemoryUsedBytes>>20)
+//	}
+//
+// Summarise GPU load while a job runs:
+//
+//	s := collector.StartSampler(ctx, &collector.NvidiaSMI{}, 2*time.Second)
+//	runJob(ctx)
+//	stats, err := s.Stop()
+//	if err == nil {
+//		fmt.Printf("avg %.0f%%, peak %.0f W\n", stats.AvgUtilPercent, stats.PeakPowerWatts)
+//	}
+//
+// Any type with a Collect method returning []Data is a Collector, so tests
+// and other sources can stand in for nvidia-smi.
+package collector
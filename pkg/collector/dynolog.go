@@ -0,0 +1,96 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+)
+
+// DynologData is one DCGM sample as dynolog logs it. Numeric fields that
+// dynolog quotes use `,string` so Unmarshal succeeds; unquoted ones don't.
+type DynologData struct {
+	DCGMError           int64   `json:"dcgm_error"`
+	Device              int64   `json:"device"`
+	FP16Active          float64 `json:"fp16_active,string"`
+	FP32Active          float64 `json:"fp32_active,string"`
+	FP64Active          float64 `json:"fp64_active,string"`
+	GPUFreqMHz          float64 `json:"gpu_frequency_mhz"`
+	GPUMemoryUtil       float64 `json:"gpu_memory_utilization"`
+	GPUPowerDraw        float64 `json:"gpu_power_draw,string"`
+	GraphicsActiveRatio float64 `json:"graphics_engine_active_ratio,string"`
+	HbmMemBWUtil        float64 `json:"hbm_mem_bw_util,string"`
+	NvlinkRxBytes       int64   `json:"nvlink_rx_bytes"`
+	NvlinkTxBytes       int64   `json:"nvlink_tx_bytes"`
+	PcieRxBytes         int64   `json:"pcie_rx_bytes"`
+	PcieTxBytes         int64   `json:"pcie_tx_bytes"`
+	SmActiveRatio       float64 `json:"sm_active_ratio,string"`
+	SmOccupancy         float64 `json:"sm_occupancy,string"`
+	TensorcoreActive    float64 `json:"tensorcore_active,string"`
+}
+
+// Regex capturing JSON after `data =`
+var dataRegex = regexp.MustCompile(`data\s*=\s*(\{.*)$`)
+
+// DefaultDCGMLibPath is where Debian and Ubuntu packages install DCGM.
+const DefaultDCGMLibPath = "/lib/x86_64-linux-gnu/libdcgm.so.4"
+
+// DynologCollector runs dynolog with its GPU monitor on and reads the JSON
+// samples it logs to stderr. Call Start once, then Collect for each sample.
+type DynologCollector struct {
+	// DCGMLibPath is passed to dynolog, "" for DefaultDCGMLibPath.
+	DCGMLibPath string
+	// Tee, if set, receives every line dynolog logs.
+	Tee io.Writer
+
+	cmd     *exec.Cmd
+	scanner *bufio.Scanner
+}
+
+// Start launches dynolog, which runs until ctx is done.
+func (c *DynologCollector) Start(ctx context.Context) error {
+	lib := c.DCGMLibPath
+	if lib == "" {
+		lib = DefaultDCGMLibPath
+	}
+	c.cmd = exec.CommandContext(ctx, "dynolog",
+		"--enable_gpu_monitor",
+		"--dcgm_lib_path="+lib,
+		"--use_JSON",
+		"--dcgm_reporting_interval_s",
+		"1",
+	)
+	stderr, err := c.cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := c.cmd.Start(); err != nil {
+		return err
+	}
+	c.scanner = bufio.NewScanner(stderr)
+	return nil
+}
+
+// Collect blocks until dynolog logs its next sample.
+func (c *DynologCollector) Collect(ctx context.Context) (DynologData, error) {
+	for c.scanner.Scan() {
+		line := c.scanner.Text()
+		if c.Tee != nil {
+			fmt.Fprintln(c.Tee, line)
+		}
+		if m := dataRegex.FindStringSubmatch(line); len(m) >= 2 {
+			var raw DynologData
+			if err := json.Unmarshal([]byte(m[1]), &raw); err != nil {
+				return DynologData{}, err
+			}
+			return raw, nil
+		}
+	}
+	if err := c.scanner.Err(); err != nil {
+		return DynologData{}, err
+	}
+	return DynologData{}, fmt.Errorf("no dynolog JSON lines found yet")
+}
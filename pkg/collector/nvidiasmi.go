@@ -0,0 +1,114 @@
+package collector
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Data is one GPU's state at a point in time.
+type Data struct {
+	ID              string
+	Name            string
+	MemoryUsedBytes int64
+	GPUUtilPercent  int64
+	// MemoryTotalBytes and PowerDrawWatts are 0 when nvidia-smi doesn't
+	// report them.
+	MemoryTotalBytes int64
+	PowerDrawWatts   float64
+}
+
+// Collector returns the current state of every visible GPU.
+type Collector interface {
+	Collect(ctx context.Context) ([]Data, error)
+}
+
+// NvidiaSMI shells out to `nvidia-smi -q -x` on each Collect. The zero
+// value runs nvidia-smi from PATH.
+type NvidiaSMI struct {
+	// Path is the nvidia-smi binary, "" for the one on PATH.
+	Path string
+}
+
+func (c *NvidiaSMI) Collect(ctx context.Context) ([]Data, error) {
+	bin := c.Path
+	if bin == "" {
+		bin = "nvidia-smi"
+	}
+	out, err := exec.CommandContext(ctx, bin, "-q", "-x").Output()
+	if err != nil {
+		return nil, fmt.Errorf("exec error: %w", err)
+	}
+	var smiLog struct {
+		GPUs []struct {
+			ID          string `xml:"id,attr"`
+			ProductName string `xml:"product_name"`
+			FBMemory    struct {
+				Total string `xml:"total"`
+				Used  string `xml:"used"`
+			} `xml:"fb_memory_usage"`
+			Utilization struct {
+				GPUUtil string `xml:"gpu_util"`
+			} `xml:"utilization"`
+			// Drivers from 530 on report power under gpu_power_readings.
+			Power struct {
+				Draw string `xml:"power_draw"`
+			} `xml:"power_readings"`
+			GPUPower struct {
+				Draw        string `xml:"power_draw"`
+				InstantDraw string `xml:"instant_power_draw"`
+			} `xml:"gpu_power_readings"`
+		} `xml:"gpu"`
+	}
+	if err := xml.Unmarshal(out, &smiLog); err != nil {
+		return nil, fmt.Errorf("unmarshal error: %w", err)
+	}
+	var results []Data
+	for _, g := range smiLog.GPUs {
+		mem, _ := parseMemory(g.FBMemory.Used)
+		util, _ := parsePercentage(g.Utilization.GPUUtil)
+		total, _ := parseMemory(g.FBMemory.Total)
+		var power float64
+		for _, p := range []string{g.GPUPower.Draw, g.GPUPower.InstantDraw, g.Power.Draw} {
+			if w, err := parseWatts(p); err == nil {
+				power = w
+				break
+			}
+		}
+		results = append(results, Data{
+			ID:               g.ID,
+			Name:             g.ProductName,
+			MemoryUsedBytes:  mem,
+			GPUUtilPercent:   util,
+			MemoryTotalBytes: total,
+			PowerDrawWatts:   power,
+		})
+	}
+	return results, nil
+}
+
+func parsePercentage(val string) (int64, error) {
+	s := strings.ReplaceAll(val, "%", "")
+	s = strings.TrimSpace(s)
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// parseWatts parses a power reading such as "70.50 W"; "N/A" is an error.
+func parseWatts(val string) (float64, error) {
+	s := strings.ReplaceAll(val, "W", "")
+	s = strings.TrimSpace(s)
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseMemory(val string) (int64, error) {
+	s := strings.ReplaceAll(val, "MiB", "")
+	s = strings.TrimSpace(s)
+	num, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return num * 1024 * 1024, nil
+}
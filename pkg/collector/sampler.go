@@ -0,0 +1,101 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Stats summarises the samples taken while a Sampler ran. Utilization is
+// averaged across GPUs, and memory and power summed across them, for each
+// sample before the peak and mean over time are taken.
+type Stats struct {
+	Samples         int
+	AvgUtilPercent  float64
+	PeakUtilPercent float64
+	AvgMemoryBytes  float64
+	PeakMemoryBytes int64
+	// MemoryTotalBytes is the GPUs' combined memory, 0 if unknown.
+	MemoryTotalBytes int64
+	AvgPowerWatts    float64
+	PeakPowerWatts   float64
+}
+
+// Sampler polls a Collector in the background until stopped.
+type Sampler struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.Mutex
+	stats   Stats
+	lastErr error
+}
+
+// StartSampler takes a sample immediately and then one per interval until
+// Stop is called or ctx is done.
+func StartSampler(ctx context.Context, c Collector, interval time.Duration) *Sampler {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Sampler{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			s.sample(ctx, c)
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+	return s
+}
+
+func (s *Sampler) sample(ctx context.Context, c Collector) {
+	data, err := c.Collect(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		if ctx.Err() == nil {
+			s.lastErr = err
+		}
+		return
+	}
+	if len(data) == 0 {
+		return
+	}
+	var util, power float64
+	var mem, total int64
+	for _, d := range data {
+		util += float64(d.GPUUtilPercent)
+		mem += d.MemoryUsedBytes
+		total += d.MemoryTotalBytes
+		power += d.PowerDrawWatts
+	}
+	util /= float64(len(data))
+
+	st := &s.stats
+	n := float64(st.Samples)
+	st.AvgUtilPercent = (st.AvgUtilPercent*n + util) / (n + 1)
+	st.AvgMemoryBytes = (st.AvgMemoryBytes*n + float64(mem)) / (n + 1)
+	st.PeakUtilPercent = max(st.PeakUtilPercent, util)
+	st.PeakMemoryBytes = max(st.PeakMemoryBytes, mem)
+	st.MemoryTotalBytes = total
+	st.AvgPowerWatts = (st.AvgPowerWatts*n + power) / (n + 1)
+	st.PeakPowerWatts = max(st.PeakPowerWatts, power)
+	st.Samples++
+}
+
+// Stop ends sampling and returns the collected stats. The error is the last
+// collection failure, if no sample succeeded.
+func (s *Sampler) Stop() (Stats, error) {
+	s.cancel()
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats.Samples == 0 {
+		return s.stats, s.lastErr
+	}
+	return s.stats, nil
+}
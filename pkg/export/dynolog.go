@@ -0,0 +1,65 @@
+package export
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nathanleclaire/gpumon/pkg/collector"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// RegisterDynologMetrics observes each sample c reads as dcgm.* gauges,
+// one per DynologData field, tagged with gpu_id. Start c first.
+func RegisterDynologMetrics(m metric.Meter, c *collector.DynologCollector) (metric.Registration, error) {
+	dcgmErrGauge, _ := m.Int64ObservableGauge("dcgm.error")
+	nvlinkRxGauge, _ := m.Int64ObservableGauge("dcgm.nvlink_rx_bytes")
+	nvlinkTxGauge, _ := m.Int64ObservableGauge("dcgm.nvlink_tx_bytes")
+	pcieRxGauge, _ := m.Int64ObservableGauge("dcgm.pcie_rx_bytes")
+	pcieTxGauge, _ := m.Int64ObservableGauge("dcgm.pcie_tx_bytes")
+	fp16Gauge, _ := m.Float64ObservableGauge("dcgm.fp16_active_ratio")
+	fp32Gauge, _ := m.Float64ObservableGauge("dcgm.fp32_active_ratio")
+	fp64Gauge, _ := m.Float64ObservableGauge("dcgm.fp64_active_ratio")
+	freqGauge, _ := m.Float64ObservableGauge("dcgm.gpu_frequency_mhz")
+	memUtilGauge, _ := m.Float64ObservableGauge("dcgm.gpu_memory_util")
+	powerGauge, _ := m.Float64ObservableGauge("dcgm.gpu_power_draw_watts")
+	gfxRatioGauge, _ := m.Float64ObservableGauge("dcgm.graphics_engine_active_ratio")
+	hbmGauge, _ := m.Float64ObservableGauge("dcgm.hbm_mem_bw_util")
+	smActiveGauge, _ := m.Float64ObservableGauge("dcgm.sm_active_ratio")
+	smOccGauge, _ := m.Float64ObservableGauge("dcgm.sm_occupancy_ratio")
+	tensorGauge, _ := m.Float64ObservableGauge("dcgm.tensorcore_active_ratio")
+
+	return m.RegisterCallback(
+		func(ctx context.Context, obs metric.Observer) error {
+			data, err := c.Collect(ctx)
+			if err != nil {
+				return err
+			}
+			// Convert device int64 -> string for attribute
+			attrs := []attribute.KeyValue{
+				attribute.String("gpu_id", fmt.Sprintf("%d", data.Device)),
+			}
+			obs.ObserveInt64(dcgmErrGauge, data.DCGMError, metric.WithAttributes(attrs...))
+			obs.ObserveInt64(nvlinkRxGauge, data.NvlinkRxBytes, metric.WithAttributes(attrs...))
+			obs.ObserveInt64(nvlinkTxGauge, data.NvlinkTxBytes, metric.WithAttributes(attrs...))
+			obs.ObserveInt64(pcieRxGauge, data.PcieRxBytes, metric.WithAttributes(attrs...))
+			obs.ObserveInt64(pcieTxGauge, data.PcieTxBytes, metric.WithAttributes(attrs...))
+			obs.ObserveFloat64(fp16Gauge, data.FP16Active, metric.WithAttributes(attrs...))
+			obs.ObserveFloat64(fp32Gauge, data.FP32Active, metric.WithAttributes(attrs...))
+			obs.ObserveFloat64(fp64Gauge, data.FP64Active, metric.WithAttributes(attrs...))
+			obs.ObserveFloat64(freqGauge, data.GPUFreqMHz, metric.WithAttributes(attrs...))
+			obs.ObserveFloat64(memUtilGauge, data.GPUMemoryUtil, metric.WithAttributes(attrs...))
+			obs.ObserveFloat64(powerGauge, data.GPUPowerDraw, metric.WithAttributes(attrs...))
+			obs.ObserveFloat64(gfxRatioGauge, data.GraphicsActiveRatio, metric.WithAttributes(attrs...))
+			obs.ObserveFloat64(hbmGauge, data.HbmMemBWUtil, metric.WithAttributes(attrs...))
+			obs.ObserveFloat64(smActiveGauge, data.SmActiveRatio, metric.WithAttributes(attrs...))
+			obs.ObserveFloat64(smOccGauge, data.SmOccupancy, metric.WithAttributes(attrs...))
+			obs.ObserveFloat64(tensorGauge, data.TensorcoreActive, metric.WithAttributes(attrs...))
+			return nil
+		},
+		dcgmErrGauge, nvlinkRxGauge, nvlinkTxGauge, pcieRxGauge, pcieTxGauge,
+		fp16Gauge, fp32Gauge, fp64Gauge, freqGauge, memUtilGauge,
+		powerGauge, gfxRatioGauge, hbmGauge, smActiveGauge, smOccGauge,
+		tensorGauge,
+	)
+}
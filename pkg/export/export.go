@@ -0,0 +1,142 @@
+// Package export publishes GPU readings from package collector as
+// OpenTelemetry gauges, and sets up a meter provider that ships them over
+// OTLP/HTTP, so a Go service can report its GPUs without running gpumon.
+//
+// Export nvidia-smi readings every 15 seconds to an OTLP collector:
+//
+//	mp, err := export.NewOTLPMeterProvider(ctx, export.OTLPConfig{
+//		Endpoint:    "http://localhost:4318",
+//		ServiceName: "trainer",
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer mp.Shutdown(context.Background())
+//	reg, err := export.RegisterGPUMetrics(mp.Meter("gpu-metrics"), &collector.NvidiaSMI{})
+//	if err != nil {
+//		return err
+//	}
+//	defer reg.Unregister()
+//
+// The gauges only read the GPUs when the provider collects, so registering
+// them costs nothing between exports. Any metric.Meter works, including one
+// from a provider the service already has.
+package export
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/pkg/collector"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+// HoneycombEndpoint is Honeycomb's OTLP/HTTP endpoint; send the API key in
+// the x-honeycomb-team header.
+const HoneycombEndpoint = "api.honeycomb.io"
+
+// DefaultInterval is how often NewOTLPMeterProvider exports by default.
+const DefaultInterval = 15 * time.Second
+
+// OTLPConfig configures NewOTLPMeterProvider.
+type OTLPConfig struct {
+	// Endpoint is a full URL such as http://localhost:4318, or a bare
+	// host[:port] reached over HTTPS. Empty uses the OTEL_EXPORTER_OTLP_*
+	// environment variables, else localhost:4318.
+	Endpoint string
+	// Headers are sent with every export, e.g. API keys.
+	Headers map[string]string
+	// Resource describes the service; nil builds one from ServiceName.
+	Resource    *resource.Resource
+	ServiceName string
+	// Interval between exports, DefaultInterval if 0.
+	Interval time.Duration
+}
+
+// NewOTLPMeterProvider returns a meter provider that exports to cfg's
+// endpoint periodically. Shut it down to flush the last readings.
+func NewOTLPMeterProvider(ctx context.Context, cfg OTLPConfig) (*sdkmetric.MeterProvider, error) {
+	var opts []otlpmetrichttp.Option
+	switch {
+	case strings.Contains(cfg.Endpoint, "://"):
+		opts = append(opts, otlpmetrichttp.WithEndpointURL(cfg.Endpoint))
+	case cfg.Endpoint != "":
+		opts = append(opts, otlpmetrichttp.WithEndpoint(cfg.Endpoint))
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlpmetrichttp.WithHeaders(cfg.Headers))
+	}
+	exp, err := otlpmetrichttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+	}
+	res := cfg.Resource
+	if res == nil {
+		res, err = resource.New(ctx, resource.WithAttributes(semconv.ServiceName(cfg.ServiceName)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to build resource: %w", err)
+		}
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exp, sdkmetric.WithInterval(interval))),
+	), nil
+}
+
+// RegisterGPUMetrics observes every GPU c reports, tagged with gpu_id,
+// gpu_name and extra, on each collection of m's provider:
+//
+//	gpu.memory_used_bytes, gpu.memory_total_bytes
+//	gpu.utilization_percent, gpu.power_draw_watts
+//
+// Memory total and power are left out for GPUs that don't report them.
+func RegisterGPUMetrics(m metric.Meter, c collector.Collector, extra ...attribute.KeyValue) (metric.Registration, error) {
+	memG, err := m.Int64ObservableGauge("gpu.memory_used_bytes")
+	if err != nil {
+		return nil, err
+	}
+	totalG, err := m.Int64ObservableGauge("gpu.memory_total_bytes")
+	if err != nil {
+		return nil, err
+	}
+	utilG, err := m.Int64ObservableGauge("gpu.utilization_percent")
+	if err != nil {
+		return nil, err
+	}
+	powerG, err := m.Float64ObservableGauge("gpu.power_draw_watts")
+	if err != nil {
+		return nil, err
+	}
+	return m.RegisterCallback(func(ctx context.Context, obs metric.Observer) error {
+		data, err := c.Collect(ctx)
+		if err != nil {
+			return err
+		}
+		for _, g := range data {
+			attrs := metric.WithAttributes(append([]attribute.KeyValue{
+				attribute.String("gpu_id", g.ID),
+				attribute.String("gpu_name", g.Name),
+			}, extra...)...)
+			obs.ObserveInt64(memG, g.MemoryUsedBytes, attrs)
+			obs.ObserveInt64(utilG, g.GPUUtilPercent, attrs)
+			if g.MemoryTotalBytes > 0 {
+				obs.ObserveInt64(totalG, g.MemoryTotalBytes, attrs)
+			}
+			if g.PowerDrawWatts > 0 {
+				obs.ObserveFloat64(powerG, g.PowerDrawWatts, attrs)
+			}
+		}
+		return nil
+	}, memG, totalG, utilG, powerG)
+}
@@ -0,0 +1,269 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/pkg/collector"
+)
+
+// HandshakeTimeout bounds how long Start waits for a plugin to answer
+// handshake.
+const HandshakeTimeout = 10 * time.Second
+
+// ErrClosed is returned by calls on a plugin that has exited or been
+// closed.
+var ErrClosed = errors.New("plugin exited")
+
+// Client is a running plugin. It is a collector.Collector, and its
+// Complete method streams completions, as far as the plugin's Info says it
+// supports them. Its methods may be called concurrently.
+type Client struct {
+	info Info
+	cmd  *exec.Cmd
+
+	wmu   sync.Mutex
+	stdin io.WriteCloser
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]*call
+	err     error // why the plugin stopped, once done is closed
+	done    chan struct{}
+}
+
+// call is a request waiting for its response.
+type call struct {
+	resp chan message
+
+	mu      sync.Mutex // held while onChunk runs, so it stops on return
+	onChunk func(string)
+}
+
+// Start runs the plugin at path and handshakes with it, giving up when ctx
+// is done. The plugin runs until Close. Its stderr is copied to stderr, if
+// set.
+func Start(ctx context.Context, path string, stderr io.Writer) (*Client, error) {
+	cmd := exec.Command(path)
+	cmd.Env = append(os.Environ(), CookieKey+"="+CookieValue)
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin: %w", err)
+	}
+	c := &Client{
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: map[int64]*call{},
+		done:    make(chan struct{}),
+	}
+	go c.read(stdout)
+
+	ctx, cancel := context.WithTimeout(ctx, HandshakeTimeout)
+	defer cancel()
+	err = c.call(ctx, MethodHandshake, HandshakeParams{ProtocolVersion: ProtocolVersion}, &c.info, nil)
+	if err == nil && c.info.ProtocolVersion != ProtocolVersion {
+		err = fmt.Errorf("plugin speaks protocol %d, want %d", c.info.ProtocolVersion, ProtocolVersion)
+	}
+	if err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("plugin %s handshake: %w", path, err)
+	}
+	return c, nil
+}
+
+// Info is what the plugin said about itself in the handshake.
+func (c *Client) Info() Info { return c.info }
+
+// Collect asks the plugin for the state of its devices.
+func (c *Client) Collect(ctx context.Context) ([]collector.Data, error) {
+	if !c.info.Collector {
+		return nil, fmt.Errorf("plugin %s is not a collector", c.info.Name)
+	}
+	var res CollectResult
+	if err := c.call(ctx, MethodCollect, nil, &res, nil); err != nil {
+		return nil, err
+	}
+	data := make([]collector.Data, 0, len(res.GPUs))
+	for _, g := range res.GPUs {
+		data = append(data, collector.Data{
+			ID:               g.ID,
+			Name:             g.Name,
+			MemoryUsedBytes:  g.MemoryUsedBytes,
+			GPUUtilPercent:   g.UtilPercent,
+			MemoryTotalBytes: g.MemoryTotalBytes,
+			PowerDrawWatts:   g.PowerDrawWatts,
+		})
+	}
+	return data, nil
+}
+
+// Complete streams one completion from the plugin, calling onChunk with
+// each piece of text as it arrives. onChunk is not called after Complete
+// returns.
+func (c *Client) Complete(ctx context.Context, req CompleteRequest, onChunk func(string)) (CompleteResult, error) {
+	if !c.info.Backend {
+		return CompleteResult{}, fmt.Errorf("plugin %s is not a backend", c.info.Name)
+	}
+	var res CompleteResult
+	err := c.call(ctx, MethodComplete, req, &res, onChunk)
+	return res, err
+}
+
+// Close closes the plugin's stdin, which asks it to exit, and waits for it,
+// killing it if it hasn't exited within a few seconds.
+func (c *Client) Close() error {
+	c.wmu.Lock()
+	_ = c.stdin.Close()
+	c.wmu.Unlock()
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+		_ = c.cmd.Process.Kill()
+		<-c.done
+	}
+	return c.cmd.Wait()
+}
+
+// call sends a request and decodes its result into result, passing any
+// chunks sent for it to onChunk.
+func (c *Client) call(ctx context.Context, method string, params, result interface{}, onChunk func(string)) error {
+	cl := &call{resp: make(chan message, 1), onChunk: onChunk}
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = cl
+	c.mu.Unlock()
+
+	msg := message{JSONRPC: "2.0", ID: &id, Method: method}
+	if params != nil {
+		b, err := json.Marshal(params)
+		if err != nil {
+			c.forget(id)
+			return err
+		}
+		msg.Params = b
+	}
+	if err := c.send(msg); err != nil {
+		c.forget(id)
+		return err
+	}
+
+	select {
+	case resp := <-cl.resp:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil || len(resp.Result) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("bad %s result: %w", method, err)
+		}
+		return nil
+	case <-ctx.Done():
+		c.forget(id)
+		cl.mu.Lock()
+		cl.onChunk = nil
+		cl.mu.Unlock()
+		b, _ := json.Marshal(CancelParams{ID: id})
+		_ = c.send(message{JSONRPC: "2.0", Method: MethodCancel, Params: b})
+		return ctx.Err()
+	case <-c.done:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.err
+	}
+}
+
+func (c *Client) forget(id int64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+func (c *Client) send(msg message) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := c.stdin.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("%w: %v", ErrClosed, err)
+	}
+	return nil
+}
+
+// read dispatches the plugin's messages until its stdout closes, then fails
+// every pending call.
+func (c *Client) read(stdout io.Reader) {
+	sc := bufio.NewScanner(stdout)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	var err error
+	for sc.Scan() {
+		var msg message
+		if err = json.Unmarshal(sc.Bytes(), &msg); err != nil {
+			err = fmt.Errorf("plugin wrote something other than JSON-RPC to stdout: %w", err)
+			break
+		}
+		switch {
+		case msg.Method == MethodChunk:
+			var p ChunkParams
+			if json.Unmarshal(msg.Params, &p) != nil {
+				continue
+			}
+			c.mu.Lock()
+			cl := c.pending[p.ID]
+			c.mu.Unlock()
+			if cl != nil {
+				cl.mu.Lock()
+				if cl.onChunk != nil {
+					cl.onChunk(p.Text)
+				}
+				cl.mu.Unlock()
+			}
+		case msg.Method == "" && msg.ID != nil:
+			c.mu.Lock()
+			cl := c.pending[*msg.ID]
+			delete(c.pending, *msg.ID)
+			c.mu.Unlock()
+			if cl != nil {
+				cl.resp <- msg
+			}
+		}
+	}
+	if err == nil {
+		err = sc.Err()
+	}
+	if err == nil {
+		err = ErrClosed
+	} else {
+		err = fmt.Errorf("%w: %v", ErrClosed, err)
+		_ = c.cmd.Process.Kill()
+	}
+	c.mu.Lock()
+	c.err = err
+	c.pending = map[int64]*call{}
+	c.mu.Unlock()
+	close(c.done)
+}
@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Found is a plugin executable in a plugins directory.
+type Found struct {
+	Name string
+	Path string
+}
+
+// Discover lists the plugins in dir: executables named Prefix+name (with
+// .exe on Windows), sorted by name. A missing dir has none.
+func Discover(dir string) ([]Found, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugins directory: %w", err)
+	}
+	var found []Found
+	for _, e := range entries {
+		name, ok := pluginName(e.Name())
+		if !ok || e.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if fi, err := os.Stat(path); err != nil || !executable(fi) {
+			continue
+		}
+		found = append(found, Found{Name: name, Path: path})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Name < found[j].Name })
+	return found, nil
+}
+
+// Find returns the path of the plugin called name in dir.
+func Find(dir, name string) (string, error) {
+	found, err := Discover(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range found {
+		if f.Name == name {
+			return f.Path, nil
+		}
+	}
+	return "", fmt.Errorf("no plugin %q in %s (want an executable named %s%s there)", name, dir, Prefix, name)
+}
+
+func pluginName(file string) (string, bool) {
+	if runtime.GOOS == "windows" {
+		file = strings.TrimSuffix(file, ".exe")
+	}
+	name, ok := strings.CutPrefix(file, Prefix)
+	return name, ok && name != ""
+}
+
+func executable(fi fs.FileInfo) bool {
+	if fi.IsDir() {
+		return false
+	}
+	return runtime.GOOS == "windows" || fi.Mode().Perm()&0o111 != 0
+}
@@ -0,0 +1,210 @@
+// Package plugin lets GPU collectors and LLM backends live outside gpumon,
+// as separate binaries it runs as subprocesses, the way Terraform runs its
+// providers. A plugin can support accelerators nvidia-smi doesn't know
+// (TPUs, Gaudi, ...) or serve completions from an inference stack gpumon
+// has no client for, without being built into gpumon.
+//
+// A plugin is an executable named gpumon-plugin-<name> in gpumon's plugins
+// directory. gpumon starts it when a command asks for <name> and speaks
+// JSON-RPC 2.0 to it over its stdin and stdout, one JSON object per line.
+// Anything the plugin writes to stderr ends up in gpumon's log. The plugin
+// exits when its stdin is closed.
+//
+// Writing a plugin in Go takes a main function calling Serve:
+//
+//	func main() {
+//		err := plugin.Serve(&plugin.Plugin{
+//			Name:      "tpu",
+//			Version:   "0.1.0",
+//			Collector: tpuCollector{}, // a collector.Collector
+//		})
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//
+// Plugins in other languages implement the protocol below directly.
+//
+// # Protocol
+//
+// The host starts the plugin with GPUMON_PLUGIN_COOKIE set to CookieValue,
+// which plugins check so that running one by hand explains itself instead
+// of waiting on stdin. The host then sends, as JSON-RPC requests:
+//
+//   - handshake, with HandshakeParams. The plugin answers with its Info, or
+//     an error if it doesn't speak the host's ProtocolVersion. Nothing else
+//     is sent before it answers.
+//   - collect, without params, to plugins whose Info has Collector set. The
+//     result is a CollectResult with one GPU per device.
+//   - complete, with a CompleteRequest, to plugins whose Info has Backend
+//     set. While it runs the plugin sends chunk notifications, ChunkParams
+//     carrying the request's id, with the text as it is generated; the
+//     result is a CompleteResult.
+//
+// Requests can overlap, so a plugin must answer each by its id. When the
+// host gives up on a request it sends a $/cancel notification with
+// CancelParams, and stops waiting for the answer.
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ProtocolVersion is the protocol this package speaks. It changes only when
+// a change would break plugins built against an older version.
+const ProtocolVersion = 1
+
+// CookieKey and CookieValue are the environment variable the host sets for
+// its plugins, and its value.
+const (
+	CookieKey   = "GPUMON_PLUGIN_COOKIE"
+	CookieValue = "6c3b0e1d4f2a4d3c9b8e7f60a5d4c3b2"
+)
+
+// Prefix starts the file name of every plugin executable.
+const Prefix = "gpumon-plugin-"
+
+// Method names.
+const (
+	MethodHandshake = "handshake"
+	MethodCollect   = "collect"
+	MethodComplete  = "complete"
+	MethodChunk     = "chunk"
+	MethodCancel    = "$/cancel"
+)
+
+// HandshakeParams are the params of handshake.
+type HandshakeParams struct {
+	ProtocolVersion int `json:"protocol_version"`
+}
+
+// Info describes a plugin, as it answers handshake.
+type Info struct {
+	Name            string `json:"name"`
+	Version         string `json:"version,omitempty"`
+	ProtocolVersion int    `json:"protocol_version"`
+	// Collector and Backend say which of collect and complete the plugin
+	// serves.
+	Collector bool `json:"collector"`
+	Backend   bool `json:"backend"`
+}
+
+// GPU is one device's state, as reported by collect. Accelerators without
+// a utilization or power reading leave it 0.
+type GPU struct {
+	ID               string  `json:"id"`
+	Name             string  `json:"name"`
+	UtilPercent      int64   `json:"util_percent"`
+	MemoryUsedBytes  int64   `json:"memory_used_bytes"`
+	MemoryTotalBytes int64   `json:"memory_total_bytes,omitempty"`
+	PowerDrawWatts   float64 `json:"power_draw_watts,omitempty"`
+}
+
+// CollectResult is the result of collect.
+type CollectResult struct {
+	GPUs []GPU `json:"gpus"`
+}
+
+// Message is one chat turn.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// CompleteRequest is the params of complete. The fields are those of
+// gpumon's own backends; a plugin ignores what it doesn't support, or fails
+// the request if ignoring it would give the wrong answer, e.g. a Grammar
+// it can't enforce.
+type CompleteRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+	System string `json:"system,omitempty"`
+	// Chat asks for System, History and Prompt to be sent as a chat
+	// transcript rather than one prompt.
+	Chat    bool      `json:"chat,omitempty"`
+	History []Message `json:"history,omitempty"`
+	// Context continues an earlier exchange, from CompleteResult.Context.
+	Context []int `json:"context,omitempty"`
+	// Format is "json" or a JSON Schema to constrain the output to.
+	Format json.RawMessage `json:"format,omitempty"`
+	// Grammar is a GBNF grammar to constrain the output to.
+	Grammar string `json:"grammar,omitempty"`
+	// Options are sampling options under Ollama's names, e.g. temperature
+	// and num_predict.
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// Messages assembles the chat transcript: optional system prompt, any prior
+// history, then the prompt as the final user turn.
+func (r CompleteRequest) Messages() []Message {
+	var msgs []Message
+	if r.System != "" {
+		msgs = append(msgs, Message{Role: "system", Content: r.System})
+	}
+	msgs = append(msgs, r.History...)
+	return append(msgs, Message{Role: "user", Content: r.Prompt})
+}
+
+// Metrics are a completion's token counts and timings, in nanoseconds on
+// the wire. Plugins leave out what they don't know.
+type Metrics struct {
+	PromptEvalCount    int           `json:"prompt_eval_count,omitempty"`
+	PromptEvalDuration time.Duration `json:"prompt_eval_duration,omitempty"`
+	EvalCount          int           `json:"eval_count,omitempty"`
+	EvalDuration       time.Duration `json:"eval_duration,omitempty"`
+	LoadDuration       time.Duration `json:"load_duration,omitempty"`
+	TotalDuration      time.Duration `json:"total_duration,omitempty"`
+}
+
+// CompleteResult is the result of complete.
+type CompleteResult struct {
+	Metrics Metrics `json:"metrics"`
+	// Context, if the backend keeps one, continues the exchange in a later
+	// request.
+	Context []int `json:"context,omitempty"`
+}
+
+// ChunkParams are the params of chunk: the next piece of the output of the
+// complete request with id ID.
+type ChunkParams struct {
+	ID   int64  `json:"id"`
+	Text string `json:"text"`
+}
+
+// CancelParams are the params of $/cancel.
+type CancelParams struct {
+	ID int64 `json:"id"`
+}
+
+// Error codes, from JSON-RPC 2.0 and, for failures of the plugin's own
+// work, CodeFailed.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeFailed         = -32000
+)
+
+// Error is a JSON-RPC error, as returned by a plugin.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// message is any JSON-RPC 2.0 message: a request when Method and ID are
+// set, a notification when only Method is, and a response otherwise.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
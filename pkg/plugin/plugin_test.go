@@ -0,0 +1,259 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nathanleclaire/gpumon/pkg/collector"
+)
+
+// helperEnv makes the test binary, started by Start, act as the plugin
+// named by its value instead of running the tests.
+const helperEnv = "GPUMON_PLUGIN_TEST_HELPER"
+
+func TestMain(m *testing.M) {
+	mode := os.Getenv(helperEnv)
+	if mode == "" {
+		os.Exit(m.Run())
+	}
+	if err := runHelper(mode); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func runHelper(mode string) error {
+	switch mode {
+	case "serve":
+		return Serve(&Plugin{Name: "test", Version: "1.0", Collector: testCollector{}, Backend: testBackend{}})
+	case "silent":
+		// Never answers the handshake, and exits when stdin closes.
+		_, err := io.Copy(io.Discard, os.Stdin)
+		return err
+	case "garbage":
+		fmt.Println("starting up...")
+		_, err := io.Copy(io.Discard, os.Stdin)
+		return err
+	case "old":
+		sc := bufio.NewScanner(os.Stdin)
+		for sc.Scan() {
+			fmt.Println(`{"jsonrpc":"2.0","id":1,"result":{"name":"old","protocol_version":0}}`)
+		}
+		return sc.Err()
+	}
+	return fmt.Errorf("unknown helper mode %q", mode)
+}
+
+type testCollector struct{}
+
+func (testCollector) Collect(context.Context) ([]collector.Data, error) {
+	return []collector.Data{{ID: "0", Name: "Test GPU", GPUUtilPercent: 42, MemoryUsedBytes: 1 << 30, PowerDrawWatts: 100}}, nil
+}
+
+// testBackend streams the prompt back a word at a time. The prompt "block"
+// streams one word and then waits to be cancelled, saying so on stderr.
+type testBackend struct{}
+
+func (testBackend) Complete(ctx context.Context, req CompleteRequest, onChunk func(string)) (CompleteResult, error) {
+	if req.Prompt == "block" {
+		onChunk("waiting")
+		<-ctx.Done()
+		fmt.Fprintln(os.Stderr, "cancelled:", ctx.Err())
+		return CompleteResult{}, ctx.Err()
+	}
+	words := strings.Fields(req.Prompt)
+	for _, w := range words {
+		onChunk(w)
+	}
+	return CompleteResult{Metrics: Metrics{EvalCount: len(words)}}, nil
+}
+
+// syncBuffer collects a plugin's stderr.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// start runs the test binary as the plugin for mode.
+func start(t *testing.T, ctx context.Context, mode string) (*Client, *syncBuffer, error) {
+	t.Helper()
+	t.Setenv(helperEnv, mode)
+	stderr := &syncBuffer{}
+	c, err := Start(ctx, os.Args[0], stderr)
+	if err == nil {
+		t.Cleanup(func() { _ = c.Close() })
+	}
+	return c, stderr, err
+}
+
+func TestHandshake(t *testing.T) {
+	c, _, err := start(t, context.Background(), "serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Info{Name: "test", Version: "1.0", ProtocolVersion: ProtocolVersion, Collector: true, Backend: true}
+	if got := c.Info(); got != want {
+		t.Errorf("Info() = %+v, want %+v", got, want)
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, _, err := start(t, ctx, "silent")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Start on a silent plugin: err = %v, want a deadline error", err)
+	}
+}
+
+func TestHandshakeBadFirstLine(t *testing.T) {
+	_, _, err := start(t, context.Background(), "garbage")
+	if !errors.Is(err, ErrClosed) || !strings.Contains(err.Error(), "other than JSON-RPC") {
+		t.Errorf("Start on a plugin printing text: err = %v, want a JSON-RPC error", err)
+	}
+}
+
+func TestHandshakeProtocolVersion(t *testing.T) {
+	_, _, err := start(t, context.Background(), "old")
+	if err == nil || !strings.Contains(err.Error(), "speaks protocol 0") {
+		t.Errorf("Start on an old plugin: err = %v, want a protocol error", err)
+	}
+}
+
+func TestServeNeedsCookie(t *testing.T) {
+	t.Setenv(CookieKey, "")
+	if err := Serve(&Plugin{Collector: testCollector{}}); !errors.Is(err, ErrNotPlugin) {
+		t.Errorf("Serve without the cookie: err = %v, want ErrNotPlugin", err)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	c, _, err := start(t, context.Background(), "serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := testCollector{}.Collect(context.Background())
+	if len(data) != 1 || data[0] != want[0] {
+		t.Errorf("Collect() = %+v, want %+v", data, want)
+	}
+}
+
+func TestCompleteChunks(t *testing.T) {
+	c, _, err := start(t, context.Background(), "serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chunks []string
+	res, err := c.Complete(context.Background(), CompleteRequest{Prompt: "one two three"}, func(s string) {
+		chunks = append(chunks, s)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(chunks, " "); got != "one two three" {
+		t.Errorf("chunks = %q, want one two three", got)
+	}
+	if res.Metrics.EvalCount != 3 {
+		t.Errorf("EvalCount = %d, want 3", res.Metrics.EvalCount)
+	}
+}
+
+func TestCompleteCancel(t *testing.T) {
+	c, stderr, err := start(t, context.Background(), "serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	var chunks []string
+	_, err = c.Complete(ctx, CompleteRequest{Prompt: "block"}, func(s string) {
+		mu.Lock()
+		chunks = append(chunks, s)
+		mu.Unlock()
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Complete: err = %v, want context.Canceled", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); !strings.Contains(stderr.String(), "cancelled"); {
+		if time.Now().After(deadline) {
+			t.Fatalf("plugin never saw $/cancel; stderr: %q", stderr.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(chunks) != 1 {
+		t.Errorf("chunks = %q, want only the one before cancelling", chunks)
+	}
+
+	// The plugin still answers after a cancelled request.
+	if _, err := c.Collect(context.Background()); err != nil {
+		t.Errorf("Collect after cancel: %v", err)
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	in := strings.Join([]string{
+		`not json`,
+		`{"jsonrpc":"2.0","id":1,"method":"nope"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"complete","params":{"prompt":"x"}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"handshake","params":{"protocol_version":99}}`,
+	}, "\n")
+	var out bytes.Buffer
+	p := &Plugin{Name: "test", Collector: testCollector{}}
+	if err := serve(context.Background(), p, strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+	codes := map[int64]int{}
+	sc := bufio.NewScanner(&out)
+	for sc.Scan() {
+		var msg message
+		if err := json.Unmarshal(sc.Bytes(), &msg); err != nil {
+			t.Fatalf("serve wrote %q: %v", sc.Text(), err)
+		}
+		if msg.Error == nil {
+			t.Errorf("serve answered %s without an error", sc.Text())
+			continue
+		}
+		var id int64
+		if msg.ID != nil {
+			id = *msg.ID
+		}
+		codes[id] = msg.Error.Code
+	}
+	want := map[int64]int{0: CodeParseError, 1: CodeMethodNotFound, 2: CodeMethodNotFound, 3: CodeFailed}
+	for id, code := range want {
+		if codes[id] != code {
+			t.Errorf("error code for request %d = %d, want %d", id, codes[id], code)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/nathanleclaire/gpumon/pkg/collector"
+)
+
+// Backend streams completions for a plugin, calling onChunk with each piece
+// of text as it is generated.
+type Backend interface {
+	Complete(ctx context.Context, req CompleteRequest, onChunk func(string)) (CompleteResult, error)
+}
+
+// Plugin is what a plugin serves: a collector, a backend, or both.
+type Plugin struct {
+	// Name is how the plugin identifies itself; gpumon knows it by its
+	// file name, which should match.
+	Name    string
+	Version string
+
+	Collector collector.Collector
+	Backend   Backend
+}
+
+// ErrNotPlugin is returned by Serve when the binary was run by hand
+// instead of by gpumon.
+var ErrNotPlugin = errors.New("this is a gpumon plugin: put it in gpumon's plugins directory instead of running it directly")
+
+// Serve speaks the plugin protocol on stdin and stdout until gpumon closes
+// stdin. Once it is called, nothing else may write to stdout; logs belong on
+// stderr, which gpumon logs.
+func Serve(p *Plugin) error {
+	if os.Getenv(CookieKey) != CookieValue {
+		return ErrNotPlugin
+	}
+	if p.Collector == nil && p.Backend == nil {
+		return errors.New("plugin serves neither a collector nor a backend")
+	}
+	return serve(context.Background(), p, os.Stdin, os.Stdout)
+}
+
+// server answers requests, each in its own goroutine.
+type server struct {
+	p *Plugin
+
+	wmu sync.Mutex
+	w   io.Writer
+
+	mu      sync.Mutex
+	cancels map[int64]context.CancelFunc
+}
+
+func serve(ctx context.Context, p *Plugin, r io.Reader, w io.Writer) error {
+	s := &server{p: p, w: w, cancels: map[int64]context.CancelFunc{}}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		var msg message
+		if err := json.Unmarshal(sc.Bytes(), &msg); err != nil {
+			s.reply(message{JSONRPC: "2.0", Error: &Error{Code: CodeParseError, Message: err.Error()}})
+			continue
+		}
+		if msg.ID == nil {
+			if msg.Method == MethodCancel {
+				var p CancelParams
+				if json.Unmarshal(msg.Params, &p) == nil {
+					s.cancel(p.ID)
+				}
+			}
+			continue
+		}
+		id := *msg.ID
+		callCtx, callCancel := context.WithCancel(ctx)
+		s.mu.Lock()
+		s.cancels[id] = callCancel
+		s.mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer s.cancel(id)
+			result, err := s.handle(callCtx, id, msg)
+			resp := message{JSONRPC: "2.0", ID: &id}
+			if err != nil {
+				var rerr *Error
+				if !errors.As(err, &rerr) {
+					rerr = &Error{Code: CodeFailed, Message: err.Error()}
+				}
+				resp.Error = rerr
+			} else if resp.Result, err = json.Marshal(result); err != nil {
+				resp.Result, resp.Error = nil, &Error{Code: CodeFailed, Message: err.Error()}
+			}
+			s.reply(resp)
+		}()
+	}
+	return sc.Err()
+}
+
+func (s *server) cancel(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel, ok := s.cancels[id]; ok {
+		cancel()
+		delete(s.cancels, id)
+	}
+}
+
+func (s *server) handle(ctx context.Context, id int64, msg message) (interface{}, error) {
+	switch msg.Method {
+	case MethodHandshake:
+		var p HandshakeParams
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		if p.ProtocolVersion != ProtocolVersion {
+			return nil, fmt.Errorf("gpumon speaks protocol %d, this plugin %d", p.ProtocolVersion, ProtocolVersion)
+		}
+		return Info{
+			Name:            s.p.Name,
+			Version:         s.p.Version,
+			ProtocolVersion: ProtocolVersion,
+			Collector:       s.p.Collector != nil,
+			Backend:         s.p.Backend != nil,
+		}, nil
+
+	case MethodCollect:
+		if s.p.Collector == nil {
+			break
+		}
+		data, err := s.p.Collector.Collect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		res := CollectResult{GPUs: make([]GPU, 0, len(data))}
+		for _, d := range data {
+			res.GPUs = append(res.GPUs, GPU{
+				ID:               d.ID,
+				Name:             d.Name,
+				UtilPercent:      d.GPUUtilPercent,
+				MemoryUsedBytes:  d.MemoryUsedBytes,
+				MemoryTotalBytes: d.MemoryTotalBytes,
+				PowerDrawWatts:   d.PowerDrawWatts,
+			})
+		}
+		return res, nil
+
+	case MethodComplete:
+		if s.p.Backend == nil {
+			break
+		}
+		var req CompleteRequest
+		if err := json.Unmarshal(msg.Params, &req); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		return s.p.Backend.Complete(ctx, req, func(text string) {
+			b, _ := json.Marshal(ChunkParams{ID: id, Text: text})
+			s.reply(message{JSONRPC: "2.0", Method: MethodChunk, Params: b})
+		})
+	}
+	return nil, &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method %q not found", msg.Method)}
+}
+
+// reply writes msg as one line.
+func (s *server) reply(msg message) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	_, _ = s.w.Write(append(b, '\n'))
+}